@@ -2,6 +2,7 @@ package config
 
 import (
 	"bytes"
+	"fmt"
 	"path/filepath"
 	"strings"
 
@@ -176,6 +177,9 @@ func Load(ctx *cli.Context, loadNetworkConfig bool) (*Config, error) {
 	if err != nil {
 		return nil, err
 	}
+	if err := cfg.MTClient.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid MTClient config: %w", err)
+	}
 
 	if loadNetworkConfig {
 		// Load genesis parameters
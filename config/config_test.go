@@ -13,6 +13,7 @@ import (
 	"github.com/0xPolygonHermez/zkevm-node/config"
 	"github.com/0xPolygonHermez/zkevm-node/config/types"
 	"github.com/0xPolygonHermez/zkevm-node/log"
+	"github.com/0xPolygonHermez/zkevm-node/merkletree"
 	"github.com/ethereum/go-ethereum/common"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -233,6 +234,10 @@ func Test_Defaults(t *testing.T) {
 			path:          "MTClient.URI",
 			expectedValue: "zkevm-prover:50061",
 		},
+		{
+			path:          "MTClient.Arity",
+			expectedValue: uint8(2),
+		},
 		{
 			path:          "State.DB.User",
 			expectedValue: "state_user",
@@ -601,3 +606,16 @@ func TestEnvVarArrayDecoding(t *testing.T) {
 	assert.Equal(t, "b", cfg.Log.Outputs[1])
 	assert.Equal(t, "c", cfg.Log.Outputs[2])
 }
+
+func TestLoadInvalidMTClientArity(t *testing.T) {
+	flagSet := flag.NewFlagSet("", flag.PanicOnError)
+	ctx := cli.NewContext(cli.NewApp(), flagSet, nil)
+
+	os.Setenv("ZKEVM_NODE_MTCLIENT_ARITY", "4")
+	defer func() {
+		os.Unsetenv("ZKEVM_NODE_MTCLIENT_ARITY")
+	}()
+
+	_, err := config.Load(ctx, false)
+	assert.ErrorIs(t, err, merkletree.ErrUnsupportedArity)
+}
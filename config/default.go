@@ -187,6 +187,7 @@ CleanHistoryTimeRetention = "5m"
 
 [MTClient]
 URI = "zkevm-prover:50061"
+Arity = 2
 
 [Executor]
 URI = "zkevm-prover:50071"
@@ -0,0 +1,9 @@
+-- +migrate Up
+CREATE TABLE state.merkletree_node
+(
+    hash BYTEA PRIMARY KEY,
+    data BYTEA NOT NULL
+);
+
+-- +migrate Down
+DROP TABLE state.merkletree_node;
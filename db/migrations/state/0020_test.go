@@ -0,0 +1,43 @@
+package migrations_test
+
+import (
+	"database/sql"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type migrationTest0020 struct {
+	migrationBase
+}
+
+func (m migrationTest0020) InsertData(db *sql.DB) error {
+	return nil
+}
+
+func (m migrationTest0020) RunAssertsAfterMigrationUp(t *testing.T, db *sql.DB) {
+	m.AssertNewAndRemovedItemsAfterMigrationUp(t, db)
+
+	const insertNode = `INSERT INTO state.merkletree_node (hash, data) VALUES (E'\\x01', E'\\x1234');`
+	_, err := db.Exec(insertNode)
+	assert.NoError(t, err)
+
+	// the nodes are indexed by their hash
+	_, err = db.Exec(insertNode)
+	assert.Error(t, err)
+}
+
+func (m migrationTest0020) RunAssertsAfterMigrationDown(t *testing.T, db *sql.DB) {
+	m.AssertNewAndRemovedItemsAfterMigrationDown(t, db)
+}
+
+func TestMigration0020(t *testing.T) {
+	m := migrationTest0020{
+		migrationBase: migrationBase{
+			newTables: []tableMetadata{
+				{"state", "merkletree_node"},
+			},
+		},
+	}
+	runMigrationTest(t, 20, m)
+}
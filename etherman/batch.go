@@ -0,0 +1,281 @@
+package etherman
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+
+	"github.com/0xPolygonHermez/zkevm-node/log"
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core"
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+// DefaultLogsChunkSize is the max interval of L1 blocks of each query of the
+// logs of GetSequencedBatches when Config.LogsChunkSize is not set.
+const DefaultLogsChunkSize = 10000
+
+// logsRangeErrors are the errors returned by the L1 providers when the range
+// of an eth_getLogs query is too large or it matches too many logs. They are
+// specific enough to not match the rate limiting errors, e.g. "429 too many
+// requests", which must not make the query split.
+var logsRangeErrors = []string{
+	"query returned more than",
+	"block range",
+	"range is too large",
+	"range too large",
+	"response size exceeded",
+	"too many results",
+	"too many logs",
+	"too many blocks",
+}
+
+// L1Batch is a batch as sequenced in L1
+type L1Batch struct {
+	BatchNumber uint64
+	// Transactions are the encoded txs of the batch
+	Transactions []byte
+	// GlobalExitRoot is the forced global exit root of a forced batch, or the
+	// L1 info root of the sequence otherwise
+	GlobalExitRoot common.Hash
+	// Timestamp is the forced timestamp of a forced batch, the max timestamp
+	// of the sequence when it's set, or the time of the L1 block otherwise
+	Timestamp     uint64
+	SequencerAddr common.Address
+	L1BlockNumber uint64
+	TxHash        common.Hash
+}
+
+// GetBatchByNumber finds the tx that sequenced the batch in L1 and decodes the
+// batch from its calldata. The L1 block of the sequence is found with a binary
+// search on the last batch sequenced by the rollup at each block, see
+// sequencingBlock, so only the logs of that block are queried. Reading the
+// rollup data at past blocks needs an L1 node keeping their state, e.g. an
+// archive node for the batches sequenced long ago. ErrBatchNotFound is
+// returned when the batch has not been sequenced yet.
+func (etherMan *Client) GetBatchByNumber(ctx context.Context, batchNum uint64) (*L1Batch, error) {
+	header, err := etherMan.EthClient.HeaderByNumber(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	blockNum, found, err := etherMan.sequencingBlock(ctx, batchNum, header.Number.Uint64())
+	if err != nil {
+		return nil, err
+	}
+	if !found {
+		return nil, ErrBatchNotFound
+	}
+
+	var batch *L1Batch
+	// each event has the last batch of the sequence, so the batch is in the
+	// first sequence of the block whose last batch is not lower
+	err = etherMan.forEachSequenceBatchesLog(ctx, blockNum, blockNum, func(vLog types.Log) (bool, error) {
+		sb, err := etherMan.EtrogZkEVM.ParseSequenceBatches(vLog)
+		if err != nil {
+			return false, err
+		}
+		if sb.NumBatch < batchNum {
+			return true, nil
+		}
+		batch, err = etherMan.decodeL1Batch(ctx, vLog, batchNum, sb.NumBatch, sb.L1InfoRoot)
+		return false, err
+	})
+	if err != nil {
+		return nil, err
+	}
+	if batch == nil {
+		return nil, ErrBatchNotFound
+	}
+	return batch, nil
+}
+
+// sequencingBlock returns the L1 block, up to latestBlock, that sequenced the
+// batch: the first one at the end of which the last batch sequenced by the
+// rollup is not lower than batchNum. false is returned when the batch is not
+// sequenced at latestBlock.
+func (etherMan *Client) sequencingBlock(ctx context.Context, batchNum, latestBlock uint64) (uint64, bool, error) {
+	lastBatchAt := func(block uint64) (uint64, error) {
+		opts := &bind.CallOpts{Context: ctx, BlockNumber: new(big.Int).SetUint64(block)}
+		rollupData, err := etherMan.EtrogRollupManager.RollupIDToRollupData(opts, etherMan.RollupID)
+		if errors.Is(err, bind.ErrNoCode) {
+			// the rollup manager was not deployed yet
+			return 0, nil
+		} else if err != nil {
+			return 0, fmt.Errorf("failed to get the last batch sequenced at block %d: %w", block, err)
+		}
+		return rollupData.LastBatchSequenced, nil
+	}
+
+	lastBatch, err := lastBatchAt(latestBlock)
+	if err != nil {
+		return 0, false, err
+	}
+	if lastBatch < batchNum {
+		return 0, false, nil
+	}
+	low, high := uint64(0), latestBlock
+	for low < high {
+		middle := low + (high-low)/2 //nolint:gomnd
+		lastBatch, err := lastBatchAt(middle)
+		if err != nil {
+			return 0, false, err
+		}
+		if lastBatch >= batchNum {
+			high = middle
+		} else {
+			low = middle + 1
+		}
+	}
+	return high, true, nil
+}
+
+func (etherMan *Client) decodeL1Batch(ctx context.Context, vLog types.Log, batchNum, lastBatchNum uint64, l1InfoRoot common.Hash) (*L1Batch, error) {
+	tx, err := etherMan.EthClient.TransactionInBlock(ctx, vLog.BlockHash, vLog.TxIndex)
+	if err != nil {
+		return nil, err
+	}
+	if tx.Hash() != vLog.TxHash {
+		return nil, fmt.Errorf("error: tx hash mismatch. want: %s have: %s", vLog.TxHash, tx.Hash().String())
+	}
+	msg, err := core.TransactionToMessage(tx, types.NewLondonSigner(tx.ChainId()), big.NewInt(0))
+	if err != nil {
+		return nil, err
+	}
+	block, err := etherMan.EthClient.HeaderByHash(ctx, vLog.BlockHash)
+	if err != nil {
+		return nil, err
+	}
+
+	batch := &L1Batch{
+		BatchNumber:    batchNum,
+		GlobalExitRoot: l1InfoRoot,
+		Timestamp:      block.Time,
+		SequencerAddr:  msg.From,
+		L1BlockNumber:  vLog.BlockNumber,
+		TxHash:         vLog.TxHash,
+	}
+	if lastBatchNum == 1 {
+		// the initial sequence is not sent with a sequenceBatches tx
+		return batch, nil
+	}
+
+	sequences, err := decodeSequences(tx.Data(), lastBatchNum, msg.From, vLog.TxHash, msg.Nonce, l1InfoRoot)
+	if err != nil {
+		return nil, err
+	}
+	for _, seq := range sequences {
+		if seq.BatchNumber != batchNum {
+			continue
+		}
+		if data := seq.PolygonRollupBaseEtrogBatchData; data != nil {
+			batch.Transactions = data.Transactions
+			if data.ForcedTimestamp > 0 {
+				batch.GlobalExitRoot = data.ForcedGlobalExitRoot
+				batch.Timestamp = data.ForcedTimestamp
+				return batch, nil
+			}
+		}
+		if seq.SequencedBatchElderberryData != nil {
+			batch.Timestamp = seq.SequencedBatchElderberryData.MaxSequenceTimestamp
+		}
+		return batch, nil
+	}
+	return nil, ErrBatchNotFound
+}
+
+// GetSequencedBatches returns the batches sequenced in the L1 blocks from
+// fromBlock to toBlock, both included, in the order they were sequenced. The
+// logs are queried in chunks of Config.LogsChunkSize blocks, and a chunk
+// rejected by the L1 provider because of its size is split in halves.
+func (etherMan *Client) GetSequencedBatches(ctx context.Context, fromBlock, toBlock uint64) ([]SequencedBatch, error) {
+	var batches []SequencedBatch
+	err := etherMan.forEachSequenceBatchesLog(ctx, fromBlock, toBlock, func(vLog types.Log) (bool, error) {
+		sequences, err := etherMan.sequencedBatchesOfEvent(ctx, vLog)
+		if err != nil {
+			return false, err
+		}
+		batches = append(batches, sequences...)
+		return true, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return batches, nil
+}
+
+// forEachSequenceBatchesLog calls fn with the SequenceBatches logs emitted in
+// the L1 blocks from fromBlock to toBlock, both included, in order, until fn
+// returns false. The logs are queried in chunks of Config.LogsChunkSize
+// blocks, so the chunks after the one fn stopped in are not queried.
+func (etherMan *Client) forEachSequenceBatchesLog(ctx context.Context, fromBlock, toBlock uint64, fn func(vLog types.Log) (bool, error)) error {
+	chunkSize := etherMan.cfg.LogsChunkSize
+	if chunkSize == 0 {
+		chunkSize = DefaultLogsChunkSize
+	}
+
+	for from := fromBlock; from <= toBlock; from += chunkSize {
+		to := from + chunkSize - 1
+		if to > toBlock || to < from {
+			to = toBlock
+		}
+		logs, err := etherMan.filterLogsInRange(ctx, etherMan.SCAddresses[:1], sequenceBatchesSignatureHash, from, to)
+		if err != nil {
+			return err
+		}
+		for _, vLog := range logs {
+			next, err := fn(vLog)
+			if err != nil || !next {
+				return err
+			}
+		}
+		if to == toBlock {
+			break
+		}
+	}
+	return nil
+}
+
+// filterLogsInRange returns the logs with the given topic emitted by the given
+// addresses in the L1 blocks from fromBlock to toBlock, both included. When
+// the L1 provider rejects the range the query is split in halves until it
+// covers a single block.
+func (etherMan *Client) filterLogsInRange(ctx context.Context, addresses []common.Address, topic common.Hash, fromBlock, toBlock uint64) ([]types.Log, error) {
+	query := ethereum.FilterQuery{
+		FromBlock: new(big.Int).SetUint64(fromBlock),
+		ToBlock:   new(big.Int).SetUint64(toBlock),
+		Addresses: addresses,
+		Topics:    [][]common.Hash{{topic}},
+	}
+	logs, err := etherMan.EthClient.FilterLogs(ctx, query)
+	if err == nil || fromBlock == toBlock || !isLogsRangeError(err) {
+		return logs, err
+	}
+
+	middle := fromBlock + (toBlock-fromBlock)/2 //nolint:gomnd
+	log.Debugf("splitting the logs query of blocks %d-%d: %v", fromBlock, toBlock, err)
+	logs, err = etherMan.filterLogsInRange(ctx, addresses, topic, fromBlock, middle)
+	if err != nil {
+		return nil, err
+	}
+	more, err := etherMan.filterLogsInRange(ctx, addresses, topic, middle+1, toBlock)
+	if err != nil {
+		return nil, err
+	}
+	return append(logs, more...), nil
+}
+
+// isLogsRangeError returns whether the error was returned by the L1 provider
+// because the range of the logs query is too large.
+func isLogsRangeError(err error) bool {
+	msg := strings.ToLower(err.Error())
+	for _, rangeErr := range logsRangeErrors {
+		if strings.Contains(msg, rangeErr) {
+			return true
+		}
+	}
+	return false
+}
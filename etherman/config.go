@@ -6,12 +6,29 @@ import "github.com/0xPolygonHermez/zkevm-node/etherman/etherscan"
 type Config struct {
 	// URL is the URL of the Ethereum node for L1
 	URL string `mapstructure:"URL"`
+	// URLs are the URLs of several Ethereum nodes for L1, when set they are
+	// used instead of URL. The requests are sent to the first healthy one,
+	// failing over to the next ones. Only http and https URLs are supported.
+	URLs []string `mapstructure:"URLs"`
 
 	// ForkIDChunkSize is the max interval for each call to L1 provider to get the forkIDs
 	ForkIDChunkSize uint64 `mapstructure:"ForkIDChunkSize"`
+	// LogsChunkSize is the max interval of L1 blocks of each call to L1
+	// provider to get the sequenced batches, DefaultLogsChunkSize is used when
+	// it's zero
+	LogsChunkSize uint64 `mapstructure:"LogsChunkSize"`
 
 	// allow that L1 gas price calculation use multiples sources
 	MultiGasProvider bool `mapstructure:"MultiGasProvider"`
+	// UseDynamicFees makes the txs sent to L1 EIP-1559 txs, otherwise they are
+	// legacy txs
+	UseDynamicFees bool `mapstructure:"UseDynamicFees"`
+	// MaxFeePerGas is the maximum fee per gas in wei of the EIP-1559 txs, there's
+	// no maximum when it's zero
+	MaxFeePerGas uint64 `mapstructure:"MaxFeePerGas"`
+	// MaxPriorityFeePerGas is the tip per gas in wei of the EIP-1559 txs, the
+	// suggested one is used when it's zero
+	MaxPriorityFeePerGas uint64 `mapstructure:"MaxPriorityFeePerGas"`
 	// Configuration for use Etherscan as used as gas provider, basically it needs the API-KEY
 	Etherscan etherscan.Config
 }
@@ -1,8 +1,15 @@
 package etherman
 
 import (
+	"bytes"
 	"errors"
+	"fmt"
 	"strings"
+
+	"github.com/0xPolygonHermez/zkevm-node/etherman/smartcontracts/etrogpolygonzkevm"
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/rpc"
 )
 
 var (
@@ -22,6 +29,8 @@ var (
 	ErrNoSigner = errors.New("no signer to authorize the transaction with")
 	// ErrMissingTrieNode means that a node is missing on the trie
 	ErrMissingTrieNode = errors.New("missing trie node")
+	// ErrExecutionReverted the call to the smc reverted
+	ErrExecutionReverted = errors.New("execution reverted")
 
 	errorsCache = map[string]error{
 		ErrGasRequiredExceedsAllowance.Error():             ErrGasRequiredExceedsAllowance,
@@ -46,3 +55,35 @@ func tryParseError(err error) (error, bool) {
 	}
 	return parsedError, exists
 }
+
+// decodeRevertError decodes the revert reason carried by the error of a call to
+// the rollup smc, both for the require messages and for the custom errors of
+// the smc. The error is returned unchanged when it doesn't carry revert data.
+func decodeRevertError(err error) error {
+	var dataErr rpc.DataError
+	if !errors.As(err, &dataErr) {
+		return err
+	}
+	data, ok := dataErr.ErrorData().(string)
+	if !ok {
+		return err
+	}
+	revertData, decodeErr := hexutil.Decode(data)
+	if decodeErr != nil || len(revertData) < 4 { //nolint:gomnd
+		return err
+	}
+
+	if reason, unpackErr := abi.UnpackRevert(revertData); unpackErr == nil {
+		return fmt.Errorf("%w: %s", ErrExecutionReverted, reason)
+	}
+	a, abiErr := etrogpolygonzkevm.EtrogpolygonzkevmMetaData.GetAbi()
+	if abiErr != nil {
+		return err
+	}
+	for name, customErr := range a.Errors {
+		if bytes.Equal(customErr.ID[:4], revertData[:4]) {
+			return fmt.Errorf("%w: %s", ErrExecutionReverted, name)
+		}
+	}
+	return err
+}
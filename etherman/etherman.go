@@ -36,7 +36,6 @@ import (
 	"github.com/ethereum/go-ethereum/core"
 	"github.com/ethereum/go-ethereum/core/types"
 	"github.com/ethereum/go-ethereum/crypto"
-	"github.com/ethereum/go-ethereum/ethclient"
 	"github.com/ethereum/go-ethereum/rpc"
 	"golang.org/x/crypto/sha3"
 )
@@ -113,6 +112,8 @@ var (
 
 	// ErrNotFound is used when the object is not found
 	ErrNotFound = errors.New("not found")
+	// ErrBatchNotFound is used when the batch has not been sequenced yet
+	ErrBatchNotFound = errors.New("batch not found")
 	// ErrIsReadOnlyMode is used when the EtherMan client is in read-only mode.
 	ErrIsReadOnlyMode = errors.New("etherman client in read-only mode: no account configured to send transactions to L1. " +
 		"please check the [Etherman] PrivateKeyPath and PrivateKeyPassword configuration")
@@ -158,6 +159,7 @@ type ethereumClient interface {
 	ethereum.ContractCaller
 	ethereum.GasEstimator
 	ethereum.GasPricer
+	ethereum.GasPricer1559
 	ethereum.LogFilterer
 	ethereum.TransactionReader
 	ethereum.TransactionSender
@@ -201,15 +203,16 @@ type Client struct {
 
 	GasProviders externalGasProviders
 
-	l1Cfg L1Config
-	cfg   Config
-	auth  map[common.Address]bind.TransactOpts // empty in case of read-only client
+	l1Cfg  L1Config
+	cfg    Config
+	auth   map[common.Address]bind.TransactOpts // empty in case of read-only client
+	nonces nonceTracker
 }
 
 // NewClient creates a new etherman.
 func NewClient(cfg Config, l1Config L1Config) (*Client, error) {
 	// Connect to ethereum node
-	ethClient, err := ethclient.Dial(cfg.URL)
+	ethClient, err := dialL1(cfg)
 	if err != nil {
 		log.Errorf("error connecting to %s: %+v", cfg.URL, err)
 		return nil, err
@@ -1156,6 +1159,14 @@ func (etherMan *Client) GetSendSequenceFee(numBatches uint64) (*big.Int, error)
 	return fee, nil
 }
 
+// GetSequencerCollateral gets the Pol the trusted sequencer must approve to
+// the zkEVM smc for each batch it sequences. There's no deposit in the
+// contracts: the rollup manager charges this batch fee on every sequenced
+// batch, so it's the amount that must be covered by the Pol allowance.
+func (etherMan *Client) GetSequencerCollateral(ctx context.Context) (*big.Int, error) {
+	return etherMan.EtrogRollupManager.GetBatchFee(&bind.CallOpts{Pending: false, Context: ctx})
+}
+
 // TrustedSequencer gets trusted sequencer address
 func (etherMan *Client) TrustedSequencer() (common.Address, error) {
 	return etherMan.EtrogZkEVM.TrustedSequencer(&bind.CallOpts{Pending: false})
@@ -1238,51 +1249,11 @@ func (etherMan *Client) forcedBatchEvent(ctx context.Context, vLog types.Log, bl
 func (etherMan *Client) sequencedBatchesEvent(ctx context.Context, vLog types.Log, blocks *[]Block, blocksOrder *map[common.Hash][]Order) error {
 	log.Debugf("SequenceBatches event detected: txHash: %s", common.Bytes2Hex(vLog.TxHash[:]))
 
-	sb, err := etherMan.EtrogZkEVM.ParseSequenceBatches(vLog)
-	if err != nil {
-		return err
-	}
-
-	// Read the tx for this event.
-	tx, err := etherMan.EthClient.TransactionInBlock(ctx, vLog.BlockHash, vLog.TxIndex)
-	if err != nil {
-		return err
-	}
-	if tx.Hash() != vLog.TxHash {
-		return fmt.Errorf("error: tx hash mismatch. want: %s have: %s", vLog.TxHash, tx.Hash().String())
-	}
-	msg, err := core.TransactionToMessage(tx, types.NewLondonSigner(tx.ChainId()), big.NewInt(0))
+	sequences, err := etherMan.sequencedBatchesOfEvent(ctx, vLog)
 	if err != nil {
 		return err
 	}
 
-	var sequences []SequencedBatch
-	if sb.NumBatch != 1 {
-		methodId := tx.Data()[:4]
-		log.Debugf("MethodId: %s", common.Bytes2Hex(methodId))
-		if bytes.Equal(methodId, methodIDSequenceBatchesEtrog) {
-			sequences, err = decodeSequencesEtrog(tx.Data(), sb.NumBatch, msg.From, vLog.TxHash, msg.Nonce, sb.L1InfoRoot)
-			if err != nil {
-				return fmt.Errorf("error decoding the sequences (etrog): %v", err)
-			}
-		} else if bytes.Equal(methodId, methodIDSequenceBatchesElderberry) {
-			sequences, err = decodeSequencesElderberry(tx.Data(), sb.NumBatch, msg.From, vLog.TxHash, msg.Nonce, sb.L1InfoRoot)
-			if err != nil {
-				return fmt.Errorf("error decoding the sequences (elderberry): %v", err)
-			}
-		} else {
-			return fmt.Errorf("error decoding the sequences: methodId %s unknown", common.Bytes2Hex(methodId))
-		}
-	} else {
-		log.Info("initial transaction sequence...")
-		sequences = append(sequences, SequencedBatch{
-			BatchNumber:   1,
-			SequencerAddr: msg.From,
-			TxHash:        vLog.TxHash,
-			Nonce:         msg.Nonce,
-		})
-	}
-
 	if len(*blocks) == 0 || ((*blocks)[len(*blocks)-1].BlockHash != vLog.BlockHash || (*blocks)[len(*blocks)-1].BlockNumber != vLog.BlockNumber) {
 		fullBlock, err := etherMan.EthClient.BlockByHash(ctx, vLog.BlockHash)
 		if err != nil {
@@ -1305,6 +1276,39 @@ func (etherMan *Client) sequencedBatchesEvent(ctx context.Context, vLog types.Lo
 	return nil
 }
 
+// sequencedBatchesOfEvent decodes the batches sequenced by the tx of the
+// SequenceBatches event.
+func (etherMan *Client) sequencedBatchesOfEvent(ctx context.Context, vLog types.Log) ([]SequencedBatch, error) {
+	sb, err := etherMan.EtrogZkEVM.ParseSequenceBatches(vLog)
+	if err != nil {
+		return nil, err
+	}
+
+	// Read the tx for this event.
+	tx, err := etherMan.EthClient.TransactionInBlock(ctx, vLog.BlockHash, vLog.TxIndex)
+	if err != nil {
+		return nil, err
+	}
+	if tx.Hash() != vLog.TxHash {
+		return nil, fmt.Errorf("error: tx hash mismatch. want: %s have: %s", vLog.TxHash, tx.Hash().String())
+	}
+	msg, err := core.TransactionToMessage(tx, types.NewLondonSigner(tx.ChainId()), big.NewInt(0))
+	if err != nil {
+		return nil, err
+	}
+
+	if sb.NumBatch == 1 {
+		log.Info("initial transaction sequence...")
+		return []SequencedBatch{{
+			BatchNumber:   1,
+			SequencerAddr: msg.From,
+			TxHash:        vLog.TxHash,
+			Nonce:         msg.Nonce,
+		}}, nil
+	}
+	return decodeSequences(tx.Data(), sb.NumBatch, msg.From, vLog.TxHash, msg.Nonce, sb.L1InfoRoot)
+}
+
 func (etherMan *Client) sequencedBatchesPreEtrogEvent(ctx context.Context, vLog types.Log, blocks *[]Block, blocksOrder *map[common.Hash][]Order) error {
 	log.Debug("Pre etrog SequenceBatches event detected")
 	sb, err := etherMan.PreEtrogZkEVM.ParseSequenceBatches(vLog)
@@ -1352,6 +1356,27 @@ func (etherMan *Client) sequencedBatchesPreEtrogEvent(ctx context.Context, vLog
 	return nil
 }
 
+// decodeSequences decodes the batches of a sequenceBatches tx of any of the
+// supported forks.
+func decodeSequences(txData []byte, lastBatchNumber uint64, sequencer common.Address, txHash common.Hash, nonce uint64, l1InfoRoot common.Hash) ([]SequencedBatch, error) {
+	methodId := txData[:4]
+	log.Debugf("MethodId: %s", common.Bytes2Hex(methodId))
+	if bytes.Equal(methodId, methodIDSequenceBatchesEtrog) {
+		sequences, err := decodeSequencesEtrog(txData, lastBatchNumber, sequencer, txHash, nonce, l1InfoRoot)
+		if err != nil {
+			return nil, fmt.Errorf("error decoding the sequences (etrog): %v", err)
+		}
+		return sequences, nil
+	} else if bytes.Equal(methodId, methodIDSequenceBatchesElderberry) {
+		sequences, err := decodeSequencesElderberry(txData, lastBatchNumber, sequencer, txHash, nonce, l1InfoRoot)
+		if err != nil {
+			return nil, fmt.Errorf("error decoding the sequences (elderberry): %v", err)
+		}
+		return sequences, nil
+	}
+	return nil, fmt.Errorf("error decoding the sequences: methodId %s unknown", common.Bytes2Hex(methodId))
+}
+
 func decodeSequencesElderberry(txData []byte, lastBatchNumber uint64, sequencer common.Address, txHash common.Hash, nonce uint64, l1InfoRoot common.Hash) ([]SequencedBatch, error) {
 	// Extract coded txs.
 	// Load contract ABI
@@ -1764,10 +1789,12 @@ func (etherMan *Client) ApprovePol(ctx context.Context, account common.Address,
 	if err == ErrNotFound {
 		return nil, errors.New("can't find account private key to sign tx")
 	}
-	if etherMan.GasProviders.MultiGasProvider {
-		opts.GasPrice = etherMan.GetL1GasPrice(ctx)
+	if err := etherMan.setGasPricing(ctx, &opts); err != nil {
+		return nil, err
 	}
-	tx, err := etherMan.Pol.Approve(&opts, etherMan.l1Cfg.ZkEVMAddr, polAmount)
+	tx, err := etherMan.sendWithNonce(ctx, &opts, func(opts *bind.TransactOpts) (*types.Transaction, error) {
+		return etherMan.Pol.Approve(opts, etherMan.l1Cfg.ZkEVMAddr, polAmount)
+	})
 	if err != nil {
 		if parsedErr, ok := tryParseError(err); ok {
 			err = parsedErr
@@ -1778,6 +1805,74 @@ func (etherMan *Client) ApprovePol(ctx context.Context, account common.Address,
 	return tx, nil
 }
 
+// RegisterSequencer sets the url of the trusted sequencer in the rollup smc, the
+// account must be the admin of the rollup. When dryRun is set the call is only
+// validated with eth_call and no tx is sent, so the returned tx is nil.
+func (etherMan *Client) RegisterSequencer(ctx context.Context, account common.Address, l2NetworkURL string, dryRun bool) (*types.Transaction, error) {
+	if dryRun {
+		input, err := etherMan.registerSequencerInput(l2NetworkURL)
+		if err != nil {
+			return nil, err
+		}
+		_, err = etherMan.EthClient.CallContract(ctx, ethereum.CallMsg{
+			From: account,
+			To:   &etherMan.SCAddresses[0],
+			Data: input,
+		}, nil)
+		if err != nil {
+			return nil, fmt.Errorf("error validating the trusted sequencer url registration. Error: %w", decodeRevertError(err))
+		}
+		return nil, nil
+	}
+
+	opts, err := etherMan.getAuthByAddress(account)
+	if err == ErrNotFound {
+		return nil, errors.New("can't find account private key to sign tx")
+	}
+	opts.Context = ctx
+	if err := etherMan.setGasPricing(ctx, &opts); err != nil {
+		return nil, err
+	}
+	tx, err := etherMan.sendWithNonce(ctx, &opts, func(opts *bind.TransactOpts) (*types.Transaction, error) {
+		return etherMan.EtrogZkEVM.SetTrustedSequencerURL(opts, l2NetworkURL)
+	})
+	if err != nil {
+		if parsedErr, ok := tryParseError(err); ok {
+			err = parsedErr
+		}
+		return nil, fmt.Errorf("error registering the trusted sequencer url. Error: %w", err)
+	}
+
+	return tx, nil
+}
+
+// EstimateRegisterSequencer estimates the gas needed to set the url of the
+// trusted sequencer in the rollup smc. When the call reverts the returned
+// error contains the revert reason of the smc.
+func (etherMan *Client) EstimateRegisterSequencer(ctx context.Context, account common.Address, l2NetworkURL string) (uint64, error) {
+	input, err := etherMan.registerSequencerInput(l2NetworkURL)
+	if err != nil {
+		return 0, err
+	}
+	gas, err := etherMan.EthClient.EstimateGas(ctx, ethereum.CallMsg{
+		From: account,
+		To:   &etherMan.SCAddresses[0],
+		Data: input,
+	})
+	if err != nil {
+		return 0, fmt.Errorf("error estimating the trusted sequencer url registration. Error: %w", decodeRevertError(err))
+	}
+	return gas, nil
+}
+
+func (etherMan *Client) registerSequencerInput(l2NetworkURL string) ([]byte, error) {
+	a, err := etrogpolygonzkevm.EtrogpolygonzkevmMetaData.GetAbi()
+	if err != nil {
+		return nil, err
+	}
+	return a.Pack("setTrustedSequencerURL", l2NetworkURL)
+}
+
 // GetTrustedSequencerURL Gets the trusted sequencer url from rollup smc
 func (etherMan *Client) GetTrustedSequencerURL() (string, error) {
 	return etherMan.EtrogZkEVM.TrustedSequencerURL(&bind.CallOpts{Pending: false})
@@ -1818,6 +1913,51 @@ func (etherMan *Client) GetL1GasPrice(ctx context.Context) *big.Int {
 	return gasPrice
 }
 
+// setGasPricing sets the pricing of the tx sent with the opts. When dynamic
+// fees are enabled the tx is an EIP-1559 one, with the fee cap twice the base
+// fee of the latest block plus the tip. Otherwise it's a legacy one with the
+// gas price of the providers.
+func (etherMan *Client) setGasPricing(ctx context.Context, opts *bind.TransactOpts) error {
+	if !etherMan.cfg.UseDynamicFees {
+		gasPrice := etherMan.GetL1GasPrice(ctx)
+		if gasPrice.Sign() == 0 {
+			var err error
+			gasPrice, err = etherMan.EthClient.SuggestGasPrice(ctx)
+			if err != nil {
+				return err
+			}
+		}
+		opts.GasPrice = gasPrice
+		return nil
+	}
+
+	header, err := etherMan.EthClient.HeaderByNumber(ctx, nil)
+	if err != nil {
+		return err
+	}
+	if header.BaseFee == nil {
+		return errors.New("dynamic fees are enabled but the L1 network doesn't support EIP-1559")
+	}
+	tip := new(big.Int).SetUint64(etherMan.cfg.MaxPriorityFeePerGas)
+	if tip.Sign() == 0 {
+		tip, err = etherMan.EthClient.SuggestGasTipCap(ctx)
+		if err != nil {
+			return err
+		}
+	}
+	feeCap := new(big.Int).Add(new(big.Int).Mul(header.BaseFee, big.NewInt(2)), tip) //nolint:gomnd
+	if maxFee := new(big.Int).SetUint64(etherMan.cfg.MaxFeePerGas); maxFee.Sign() > 0 && feeCap.Cmp(maxFee) > 0 {
+		feeCap = maxFee
+		if tip.Cmp(feeCap) > 0 {
+			tip = feeCap
+		}
+	}
+	opts.GasPrice = nil
+	opts.GasFeeCap = feeCap
+	opts.GasTipCap = tip
+	return nil
+}
+
 // SendTx sends a tx to L1
 func (etherMan *Client) SendTx(ctx context.Context, tx *types.Transaction) error {
 	return etherMan.EthClient.SendTransaction(ctx, tx)
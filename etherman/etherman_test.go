@@ -3,6 +3,7 @@ package etherman
 import (
 	"context"
 	"encoding/hex"
+	"errors"
 	"fmt"
 	"math"
 	"math/big"
@@ -432,3 +433,327 @@ func TestProof(t *testing.T) {
 	}
 	t.Log("Proof: ", p)
 }
+
+func TestRegisterSequencer(t *testing.T) {
+	// Set up testing environment
+	etherman, ethBackend, auth, _, _ := newTestingEnv()
+	ctx := context.Background()
+	const url = "http://sequencer:8123"
+
+	gas, err := etherman.EstimateRegisterSequencer(ctx, auth.From, url)
+	require.NoError(t, err)
+	assert.Greater(t, gas, uint64(21000))
+	assert.Less(t, gas, uint64(1000000))
+
+	// The dry run doesn't change the state
+	blockNumber, err := etherman.GetLatestBlockNumber(ctx)
+	require.NoError(t, err)
+	tx, err := etherman.RegisterSequencer(ctx, auth.From, url, true)
+	require.NoError(t, err)
+	assert.Nil(t, tx)
+	ethBackend.Commit()
+	newBlockNumber, err := etherman.GetLatestBlockNumber(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, blockNumber+1, newBlockNumber)
+	nonce, err := etherman.CurrentNonce(ctx, auth.From)
+	require.NoError(t, err)
+	pendingNonce, err := etherman.PendingNonce(ctx, auth.From)
+	require.NoError(t, err)
+	assert.Equal(t, nonce, pendingNonce)
+	sequencerURL, err := etherman.GetTrustedSequencerURL()
+	require.NoError(t, err)
+	assert.Equal(t, "http://localhost", sequencerURL)
+
+	tx, err = etherman.RegisterSequencer(ctx, auth.From, url, false)
+	require.NoError(t, err)
+	require.NotNil(t, tx)
+	ethBackend.Commit()
+	sequencerURL, err = etherman.GetTrustedSequencerURL()
+	require.NoError(t, err)
+	assert.Equal(t, url, sequencerURL)
+}
+
+func TestEstimateRegisterSequencerRevert(t *testing.T) {
+	// Set up testing environment
+	etherman, _, _, _, _ := newTestingEnv()
+
+	// Only the admin of the rollup can set the url
+	_, err := etherman.EstimateRegisterSequencer(context.Background(), common.HexToAddress("0x1234"), "http://sequencer:8123")
+	assert.ErrorIs(t, err, ErrExecutionReverted)
+	assert.ErrorContains(t, err, "OnlyAdmin")
+}
+
+func TestSubscribeNewBatches(t *testing.T) {
+	// Set up testing environment
+	etherman, ethBackend, auth, _, _ := newTestingEnv()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	events, sub, err := etherman.SubscribeNewBatches(ctx)
+	require.NoError(t, err)
+	defer sub.Unsubscribe()
+
+	rawTxs := "f84901843b9aca00827b0c945fbdb2315678afecb367f032d93f642f64180aa380a46057361d00000000000000000000000000000000000000000000000000000000000000048203e9808073efe1fa2d3e27f26f32208550ea9b0274d49050b816cadab05a771f4275d0242fd5d92b3fb89575c070e6c930587c520ee65a3aa8cfe382fcad20421bf51d621c"
+	tx := etrogpolygonzkevm.PolygonRollupBaseEtrogBatchData{
+		Transactions: common.Hex2Bytes(rawTxs),
+	}
+	_, err = etherman.EtrogZkEVM.SequenceBatches(auth, []etrogpolygonzkevm.PolygonRollupBaseEtrogBatchData{tx}, uint64(time.Now().Unix()), uint64(1), auth.From)
+	require.NoError(t, err)
+	ethBackend.Commit()
+
+	_, err = etherman.EtrogRollupManager.VerifyBatchesTrustedAggregator(auth, 1, uint64(0), uint64(0), uint64(1), [32]byte{}, [32]byte{}, auth.From, [24][32]byte{})
+	require.NoError(t, err)
+	ethBackend.Commit()
+
+	receive := func() BatchEvent {
+		select {
+		case e := <-events:
+			return e
+		case err := <-sub.Err():
+			require.NoError(t, err)
+		case <-time.After(5 * time.Second):
+			require.FailNow(t, "timeout waiting for a batch event")
+		}
+		return BatchEvent{}
+	}
+
+	sequenced := receive()
+	assert.Equal(t, SequencedBatchEvent, sequenced.Type)
+	// the first batch is sequenced by the rollup creation
+	assert.Equal(t, uint64(2), sequenced.BatchNumber)
+	assert.Equal(t, auth.From, sequenced.Sender)
+	assert.NotEqual(t, common.Hash{}, sequenced.TxHash)
+
+	verified := receive()
+	assert.Equal(t, VerifiedBatchEvent, verified.Type)
+	assert.Equal(t, uint64(1), verified.BatchNumber)
+	assert.Equal(t, auth.From, verified.Sender)
+	assert.Equal(t, sequenced.L1BlockNumber+1, verified.L1BlockNumber)
+}
+
+func TestDynamicFees(t *testing.T) {
+	// Set up testing environment
+	etherman, ethBackend, auth, _, _ := newTestingEnv()
+	ctx := context.Background()
+
+	tx, err := etherman.RegisterSequencer(ctx, auth.From, "http://sequencer:8123", false)
+	require.NoError(t, err)
+	assert.Equal(t, uint8(types.LegacyTxType), tx.Type())
+	ethBackend.Commit()
+
+	etherman.cfg.UseDynamicFees = true
+	etherman.cfg.MaxPriorityFeePerGas = 2
+	tx, err = etherman.RegisterSequencer(ctx, auth.From, "http://sequencer:8124", false)
+	require.NoError(t, err)
+	assert.Equal(t, uint8(types.DynamicFeeTxType), tx.Type())
+	assert.Equal(t, big.NewInt(2), tx.GasTipCap())
+	header, err := etherman.EthClient.HeaderByNumber(ctx, nil)
+	require.NoError(t, err)
+	expectedFeeCap := new(big.Int).Add(new(big.Int).Mul(header.BaseFee, big.NewInt(2)), big.NewInt(2))
+	assert.Equal(t, expectedFeeCap, tx.GasFeeCap())
+	ethBackend.Commit()
+
+	// The fee cap is limited by the maximum fee
+	etherman.cfg.MaxFeePerGas = 1
+	opts := *auth
+	require.NoError(t, etherman.setGasPricing(ctx, &opts))
+	assert.Nil(t, opts.GasPrice)
+	assert.Equal(t, big.NewInt(1), opts.GasFeeCap)
+	assert.Equal(t, big.NewInt(1), opts.GasTipCap)
+}
+
+func TestStaleNonce(t *testing.T) {
+	// Set up testing environment
+	etherman, ethBackend, auth, _, _ := newTestingEnv()
+	ctx := context.Background()
+
+	tx, err := etherman.RegisterSequencer(ctx, auth.From, "http://sequencer:8123", false)
+	require.NoError(t, err)
+	nonce := tx.Nonce()
+	// The cached nonce is used by the next tx before the previous one is mined
+	tx, err = etherman.RegisterSequencer(ctx, auth.From, "http://sequencer:8124", false)
+	require.NoError(t, err)
+	assert.Equal(t, nonce+1, tx.Nonce())
+	ethBackend.Commit()
+
+	// A tx sent without etherman makes the cached nonce stale
+	_, err = etherman.EtrogZkEVM.SetTrustedSequencerURL(auth, "http://sequencer:8125")
+	require.NoError(t, err)
+	ethBackend.Commit()
+
+	tx, err = etherman.RegisterSequencer(ctx, auth.From, "http://sequencer:8126", false)
+	require.NoError(t, err)
+	assert.Equal(t, nonce+3, tx.Nonce())
+	ethBackend.Commit()
+	sequencerURL, err := etherman.GetTrustedSequencerURL()
+	require.NoError(t, err)
+	assert.Equal(t, "http://sequencer:8126", sequencerURL)
+
+	// After resetting, the nonce is read from the network
+	_, err = etherman.EtrogZkEVM.SetTrustedSequencerURL(auth, "http://sequencer:8127")
+	require.NoError(t, err)
+	ethBackend.Commit()
+	etherman.ResetNonce()
+	tx, err = etherman.RegisterSequencer(ctx, auth.From, "http://sequencer:8128", false)
+	require.NoError(t, err)
+	assert.Equal(t, nonce+5, tx.Nonce())
+}
+
+func TestGetBatchByNumber(t *testing.T) {
+	// Set up testing environment
+	etherman, ethBackend, auth, _, _ := newTestingEnv()
+	ctx := context.Background()
+
+	rawTxs := "f84901843b9aca00827b0c945fbdb2315678afecb367f032d93f642f64180aa380a46057361d00000000000000000000000000000000000000000000000000000000000000048203e9808073efe1fa2d3e27f26f32208550ea9b0274d49050b816cadab05a771f4275d0242fd5d92b3fb89575c070e6c930587c520ee65a3aa8cfe382fcad20421bf51d621c"
+	sequences := []etrogpolygonzkevm.PolygonRollupBaseEtrogBatchData{{
+		Transactions: []byte{},
+	}, {
+		Transactions: common.Hex2Bytes(rawTxs),
+	}}
+	maxSequenceTimestamp := uint64(time.Now().Unix())
+	tx, err := etherman.EtrogZkEVM.SequenceBatches(auth, sequences, maxSequenceTimestamp, uint64(1), auth.From)
+	require.NoError(t, err)
+	ethBackend.Commit()
+
+	lastBatchNumber, err := etherman.GetLatestBatchNumber()
+	require.NoError(t, err)
+	batch, err := etherman.GetBatchByNumber(ctx, lastBatchNumber)
+	require.NoError(t, err)
+	assert.Equal(t, lastBatchNumber, batch.BatchNumber)
+	assert.Equal(t, common.Hex2Bytes(rawTxs), batch.Transactions)
+	assert.Equal(t, maxSequenceTimestamp, batch.Timestamp)
+	assert.Equal(t, auth.From, batch.SequencerAddr)
+	assert.Equal(t, tx.Hash(), batch.TxHash)
+
+	batch, err = etherman.GetBatchByNumber(ctx, lastBatchNumber-1)
+	require.NoError(t, err)
+	assert.Equal(t, lastBatchNumber-1, batch.BatchNumber)
+	assert.Empty(t, batch.Transactions)
+	assert.Equal(t, tx.Hash(), batch.TxHash)
+
+	_, err = etherman.GetBatchByNumber(ctx, lastBatchNumber+1)
+	assert.ErrorIs(t, err, ErrBatchNotFound)
+
+	// the block of the sequence is searched, so only its logs are queried
+	// even when the later blocks sequence more batches
+	for i := 0; i < 3; i++ {
+		ethBackend.Commit()
+	}
+	_, err = etherman.EtrogZkEVM.SequenceBatches(auth, sequences, uint64(time.Now().Unix()), lastBatchNumber, auth.From)
+	require.NoError(t, err)
+	ethBackend.Commit()
+	client := &rangeLimitedClient{ethereumClient: etherman.EthClient, maxRange: 1}
+	etherman.EthClient = client
+	searched, err := etherman.GetBatchByNumber(ctx, lastBatchNumber-1)
+	require.NoError(t, err)
+	assert.Equal(t, batch, searched)
+	assert.Equal(t, 1, client.queries)
+}
+
+func TestIsLogsRangeError(t *testing.T) {
+	for msg, expected := range map[string]bool{
+		"query returned more than 10000 results":         true,
+		"exceed maximum block range: 5000":               true,
+		"Log response size exceeded":                     true,
+		"429 Too Many Requests":                          false,
+		"too many requests, please retry later":          false,
+		"execution reverted":                             false,
+		"eth_getLogs is limited to a 10,000 block range": true,
+	} {
+		assert.Equal(t, expected, isLogsRangeError(errors.New(msg)), msg)
+	}
+}
+
+// rangeLimitedClient is an L1 client rejecting the logs queries of more than
+// maxRange blocks, like many providers do.
+type rangeLimitedClient struct {
+	ethereumClient
+	maxRange uint64
+	queries  int
+}
+
+func (c *rangeLimitedClient) FilterLogs(ctx context.Context, query ethereum.FilterQuery) ([]types.Log, error) {
+	c.queries++
+	if query.ToBlock.Uint64()-query.FromBlock.Uint64()+1 > c.maxRange {
+		return nil, fmt.Errorf("query returned more than 10000 results")
+	}
+	return c.ethereumClient.FilterLogs(ctx, query)
+}
+
+func TestGetSequencedBatches(t *testing.T) {
+	// Set up testing environment
+	etherman, ethBackend, auth, _, _ := newTestingEnv()
+	ctx := context.Background()
+
+	initBlock, err := etherman.EthClient.BlockByNumber(ctx, nil)
+	require.NoError(t, err)
+	rawTxs := "f84901843b9aca00827b0c945fbdb2315678afecb367f032d93f642f64180aa380a46057361d00000000000000000000000000000000000000000000000000000000000000048203e9808073efe1fa2d3e27f26f32208550ea9b0274d49050b816cadab05a771f4275d0242fd5d92b3fb89575c070e6c930587c520ee65a3aa8cfe382fcad20421bf51d621c"
+	// three sequences of two batches, each one in its own block
+	var txHashes []common.Hash
+	for i := 0; i < 3; i++ {
+		lastBatchNumber, err := etherman.GetLatestBatchNumber()
+		require.NoError(t, err)
+		sequences := []etrogpolygonzkevm.PolygonRollupBaseEtrogBatchData{{
+			Transactions: common.Hex2Bytes(rawTxs),
+		}, {
+			Transactions: common.Hex2Bytes(rawTxs),
+		}}
+		tx, err := etherman.EtrogZkEVM.SequenceBatches(auth, sequences, uint64(time.Now().Unix()), lastBatchNumber, auth.From)
+		require.NoError(t, err)
+		ethBackend.Commit()
+		txHashes = append(txHashes, tx.Hash())
+	}
+	finalBlock, err := etherman.EthClient.BlockByNumber(ctx, nil)
+	require.NoError(t, err)
+
+	batches, err := etherman.GetSequencedBatches(ctx, initBlock.NumberU64(), finalBlock.NumberU64())
+	require.NoError(t, err)
+	require.Len(t, batches, 6)
+	for i, batch := range batches {
+		assert.Equal(t, batches[0].BatchNumber+uint64(i), batch.BatchNumber)
+		assert.Equal(t, auth.From, batch.SequencerAddr)
+		assert.Equal(t, txHashes[i/2], batch.TxHash)
+	}
+
+	// the range is queried in chunks
+	etherman.cfg.LogsChunkSize = 1
+	chunked, err := etherman.GetSequencedBatches(ctx, initBlock.NumberU64(), finalBlock.NumberU64())
+	require.NoError(t, err)
+	assert.Equal(t, batches, chunked)
+
+	// the chunks rejected by the provider are split
+	etherman.cfg.LogsChunkSize = 0
+	client := &rangeLimitedClient{ethereumClient: etherman.EthClient, maxRange: 1}
+	etherman.EthClient = client
+	split, err := etherman.GetSequencedBatches(ctx, initBlock.NumberU64(), finalBlock.NumberU64())
+	require.NoError(t, err)
+	assert.Equal(t, batches, split)
+	assert.Greater(t, client.queries, 1)
+
+	// only the last sequence
+	batches, err = etherman.GetSequencedBatches(ctx, finalBlock.NumberU64(), finalBlock.NumberU64())
+	require.NoError(t, err)
+	require.Len(t, batches, 2)
+	assert.Equal(t, txHashes[2], batches[0].TxHash)
+}
+
+func TestGetSequencerCollateral(t *testing.T) {
+	// Set up testing environment
+	etherman, ethBackend, auth, _, _ := newTestingEnv()
+	ctx := context.Background()
+
+	collateral, err := etherman.GetSequencerCollateral(ctx)
+	require.NoError(t, err)
+	batchFee, err := etherman.EtrogRollupManager.GetBatchFee(&bind.CallOpts{Pending: false})
+	require.NoError(t, err)
+	assert.Equal(t, batchFee, collateral)
+	assert.Positive(t, collateral.Sign())
+
+	// Approving the collateral covers the fee of one batch
+	_, err = etherman.ApprovePol(ctx, auth.From, collateral, etherman.l1Cfg.ZkEVMAddr)
+	require.NoError(t, err)
+	ethBackend.Commit()
+	allowance, err := etherman.Pol.Allowance(&bind.CallOpts{Pending: false}, auth.From, etherman.l1Cfg.ZkEVMAddr)
+	require.NoError(t, err)
+	assert.Equal(t, collateral, allowance)
+}
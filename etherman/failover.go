@@ -0,0 +1,143 @@
+package etherman
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/0xPolygonHermez/zkevm-node/log"
+	"github.com/ethereum/go-ethereum/ethclient"
+	"github.com/ethereum/go-ethereum/rpc"
+)
+
+const (
+	// failoverResponseTimeout is the time to wait for the response of an
+	// endpoint before trying the next one
+	failoverResponseTimeout = 30 * time.Second
+)
+
+// failoverCooldown is the time an endpoint that failed is not used while there
+// are other healthy endpoints
+var failoverCooldown = 30 * time.Second
+
+// dialL1 connects to the L1 node. When several URLs are configured the
+// requests are sent to the first healthy one, failing over to the next ones on
+// connection errors, timeouts or server errors.
+func dialL1(cfg Config) (*ethclient.Client, error) {
+	urls := cfg.URLs
+	if len(urls) == 0 {
+		urls = []string{cfg.URL}
+	}
+	if len(urls) == 1 {
+		return ethclient.Dial(urls[0])
+	}
+
+	base := http.DefaultTransport.(*http.Transport).Clone()
+	base.ResponseHeaderTimeout = failoverResponseTimeout
+	transport, err := newFailoverTransport(urls, base)
+	if err != nil {
+		return nil, err
+	}
+	rpcClient, err := rpc.DialOptions(context.Background(), urls[0], rpc.WithHTTPClient(&http.Client{Transport: transport}))
+	if err != nil {
+		return nil, err
+	}
+	return ethclient.NewClient(rpcClient), nil
+}
+
+type failoverEndpoint struct {
+	url            *url.URL
+	unhealthyUntil time.Time
+}
+
+// failoverTransport is an http.RoundTripper that sends each request to the
+// first healthy endpoint, in the order they are configured. An endpoint that
+// fails is not used again until its cooldown expires, so a recovered endpoint
+// is reused afterwards.
+type failoverTransport struct {
+	base http.RoundTripper
+
+	mu        sync.Mutex
+	endpoints []*failoverEndpoint
+}
+
+func newFailoverTransport(urls []string, base http.RoundTripper) (*failoverTransport, error) {
+	t := &failoverTransport{base: base}
+	for _, rawURL := range urls {
+		u, err := url.Parse(rawURL)
+		if err != nil {
+			return nil, fmt.Errorf("invalid L1 URL %s: %w", rawURL, err)
+		}
+		if u.Scheme != "http" && u.Scheme != "https" {
+			return nil, fmt.Errorf("L1 URL %s not supported, only http and https URLs can be used when several URLs are configured", rawURL)
+		}
+		t.endpoints = append(t.endpoints, &failoverEndpoint{url: u})
+	}
+	return t, nil
+}
+
+// candidates returns the healthy endpoints followed by the unhealthy ones, so
+// they are still tried when all the endpoints failed.
+func (t *failoverTransport) candidates() []*failoverEndpoint {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	now := time.Now()
+	healthy := make([]*failoverEndpoint, 0, len(t.endpoints))
+	var unhealthy []*failoverEndpoint
+	for _, e := range t.endpoints {
+		if now.Before(e.unhealthyUntil) {
+			unhealthy = append(unhealthy, e)
+		} else {
+			healthy = append(healthy, e)
+		}
+	}
+	return append(healthy, unhealthy...)
+}
+
+func (t *failoverTransport) setHealthy(e *failoverEndpoint, healthy bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if healthy {
+		e.unhealthyUntil = time.Time{}
+	} else {
+		e.unhealthyUntil = time.Now().Add(failoverCooldown)
+	}
+}
+
+// RoundTrip implements http.RoundTripper.
+func (t *failoverTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	var lastErr error
+	for _, e := range t.candidates() {
+		r := req.Clone(req.Context())
+		if req.GetBody != nil {
+			body, err := req.GetBody()
+			if err != nil {
+				return nil, err
+			}
+			r.Body = body
+		}
+		u := *e.url
+		r.URL = &u
+		r.Host = u.Host
+
+		resp, err := t.base.RoundTrip(r)
+		if err == nil && resp.StatusCode < http.StatusInternalServerError {
+			t.setHealthy(e, true)
+			return resp, nil
+		}
+		if err == nil {
+			err = fmt.Errorf("received status code %d", resp.StatusCode)
+			_ = resp.Body.Close()
+		}
+		lastErr = err
+		if req.Context().Err() != nil {
+			return nil, lastErr
+		}
+		log.Warnf("L1 endpoint %s failed, trying the next one. Error: %v", e.url.Redacted(), err)
+		t.setHealthy(e, false)
+	}
+	return nil, fmt.Errorf("all the L1 endpoints failed. Last error: %w", lastErr)
+}
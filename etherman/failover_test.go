@@ -0,0 +1,91 @@
+package etherman
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newChainIDServer creates a fake L1 node that responds to eth_chainId, or
+// fails with a server error while failing is set.
+func newChainIDServer(failing *atomic.Bool, calls *atomic.Int32) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		if failing.Load() {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"jsonrpc":"2.0","id":1,"result":"0x539"}`))
+	}))
+}
+
+func TestDialL1Failover(t *testing.T) {
+	defer func(cooldown time.Duration) { failoverCooldown = cooldown }(failoverCooldown)
+	failoverCooldown = 100 * time.Millisecond
+
+	var firstFailing, secondFailing atomic.Bool
+	var firstCalls, secondCalls atomic.Int32
+	first := newChainIDServer(&firstFailing, &firstCalls)
+	defer first.Close()
+	second := newChainIDServer(&secondFailing, &secondCalls)
+	defer second.Close()
+
+	firstFailing.Store(true)
+	client, err := dialL1(Config{URLs: []string{first.URL, second.URL}})
+	require.NoError(t, err)
+	ctx := context.Background()
+
+	chainID, err := client.ChainID(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, uint64(1337), chainID.Uint64())
+	assert.Equal(t, int32(1), firstCalls.Load())
+	assert.Equal(t, int32(1), secondCalls.Load())
+
+	// the failing endpoint is skipped during the cooldown
+	_, err = client.ChainID(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, int32(1), firstCalls.Load())
+	assert.Equal(t, int32(2), secondCalls.Load())
+
+	// and it's used again once it recovers
+	firstFailing.Store(false)
+	time.Sleep(failoverCooldown)
+	_, err = client.ChainID(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, int32(2), firstCalls.Load())
+	assert.Equal(t, int32(2), secondCalls.Load())
+
+	// the request fails when all the endpoints fail
+	firstFailing.Store(true)
+	secondFailing.Store(true)
+	_, err = client.ChainID(ctx)
+	assert.Error(t, err)
+}
+
+func TestDialL1FailoverUnreachable(t *testing.T) {
+	var failing atomic.Bool
+	var calls atomic.Int32
+	srv := newChainIDServer(&failing, &calls)
+	defer srv.Close()
+
+	unreachable := httptest.NewServer(http.NotFoundHandler())
+	unreachable.Close()
+
+	client, err := dialL1(Config{URLs: []string{unreachable.URL, srv.URL}})
+	require.NoError(t, err)
+	chainID, err := client.ChainID(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, uint64(1337), chainID.Uint64())
+}
+
+func TestDialL1FailoverInvalidURL(t *testing.T) {
+	_, err := dialL1(Config{URLs: []string{"ws://localhost:8546", "http://localhost:8545"}})
+	assert.Error(t, err)
+}
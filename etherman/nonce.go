@@ -0,0 +1,99 @@
+package etherman
+
+import (
+	"context"
+	"math/big"
+	"strings"
+	"sync"
+
+	"github.com/0xPolygonHermez/zkevm-node/log"
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+// staleNonceErrors are the errors returned by the L1 node when the nonce of a
+// tx was already used
+var staleNonceErrors = []string{
+	"nonce too low",
+	"replacement transaction underpriced",
+}
+
+// nonceTracker caches the next nonce of each account, so several txs can be
+// sent in quick succession without waiting for the previous ones to be seen
+// by the L1 node.
+type nonceTracker struct {
+	mu     sync.Mutex
+	nonces map[common.Address]uint64
+}
+
+// ResetNonce discards the cached nonces, so they are read again from the L1
+// network.
+func (etherMan *Client) ResetNonce() {
+	etherMan.nonces.mu.Lock()
+	defer etherMan.nonces.mu.Unlock()
+	etherMan.nonces.nonces = nil
+}
+
+// reserveNonce returns the next nonce of the account, it's read from the L1
+// network when it's not cached.
+func (etherMan *Client) reserveNonce(ctx context.Context, account common.Address) (uint64, error) {
+	etherMan.nonces.mu.Lock()
+	defer etherMan.nonces.mu.Unlock()
+	nonce, found := etherMan.nonces.nonces[account]
+	if !found {
+		var err error
+		nonce, err = etherMan.EthClient.PendingNonceAt(ctx, account)
+		if err != nil {
+			return 0, err
+		}
+	}
+	if etherMan.nonces.nonces == nil {
+		etherMan.nonces.nonces = map[common.Address]uint64{}
+	}
+	etherMan.nonces.nonces[account] = nonce + 1
+	return nonce, nil
+}
+
+func (etherMan *Client) resetNonce(account common.Address) {
+	etherMan.nonces.mu.Lock()
+	defer etherMan.nonces.mu.Unlock()
+	delete(etherMan.nonces.nonces, account)
+}
+
+// sendWithNonce sends a tx with the next nonce of the account of the opts.
+// When the nonce is stale it's read again from the L1 network and the tx is
+// sent once more.
+func (etherMan *Client) sendWithNonce(ctx context.Context, opts *bind.TransactOpts, send func(opts *bind.TransactOpts) (*types.Transaction, error)) (*types.Transaction, error) {
+	nonce, err := etherMan.reserveNonce(ctx, opts.From)
+	if err != nil {
+		return nil, err
+	}
+	opts.Nonce = new(big.Int).SetUint64(nonce)
+	tx, err := send(opts)
+	if err != nil && isStaleNonceError(err) {
+		log.Warnf("nonce %d of %s is stale, retrying with the nonce of the L1 network. Error: %v", nonce, opts.From, err)
+		etherMan.resetNonce(opts.From)
+		nonce, err = etherMan.reserveNonce(ctx, opts.From)
+		if err != nil {
+			return nil, err
+		}
+		opts.Nonce = new(big.Int).SetUint64(nonce)
+		tx, err = send(opts)
+	}
+	if err != nil {
+		// the nonce was not used, so it's read again for the next tx
+		etherMan.resetNonce(opts.From)
+		return nil, err
+	}
+	return tx, nil
+}
+
+func isStaleNonceError(err error) bool {
+	for _, msg := range staleNonceErrors {
+		if strings.Contains(err.Error(), msg) {
+			return true
+		}
+	}
+	return false
+}
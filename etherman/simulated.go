@@ -197,8 +197,14 @@ func NewSimulatedEtherman(cfg Config, auth *bind.TransactOpts) (*Client, *simula
 		EtrogGlobalExitRootManager: globalExitRoot,
 		RollupID:                   rollupID,
 		SCAddresses:                []common.Address{zkevmAddr, mockRollupManagerAddr, exitManagerAddr},
-		auth:                       map[common.Address]bind.TransactOpts{},
-		cfg:                        cfg,
+		l1Cfg: L1Config{
+			ZkEVMAddr:                 zkevmAddr,
+			RollupManagerAddr:         mockRollupManagerAddr,
+			PolAddr:                   polAddr,
+			GlobalExitRootManagerAddr: exitManagerAddr,
+		},
+		auth: map[common.Address]bind.TransactOpts{},
+		cfg:  cfg,
 	}
 	err = c.AddOrReplaceAuth(*auth)
 	if err != nil {
@@ -0,0 +1,191 @@
+package etherman
+
+import (
+	"context"
+	"fmt"
+	"math/big"
+	"time"
+
+	"github.com/0xPolygonHermez/zkevm-node/log"
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/event"
+)
+
+const (
+	// maxResubscribeAttempts is the number of consecutive failed attempts to
+	// subscribe to the batch events before giving up
+	maxResubscribeAttempts = 5
+)
+
+// resubscribeBackoff is the wait before the first attempt to resubscribe to the
+// batch events, it's doubled after each failed attempt
+var resubscribeBackoff = time.Second
+
+// BatchEventType is the type of a BatchEvent
+type BatchEventType string
+
+const (
+	// SequencedBatchEvent is sent when batches are sequenced
+	SequencedBatchEvent BatchEventType = "sequenced"
+	// VerifiedBatchEvent is sent when batches are verified
+	VerifiedBatchEvent BatchEventType = "verified"
+)
+
+// BatchEvent is a sequenced or verified batches event of the rollup
+type BatchEvent struct {
+	Type BatchEventType
+	// BatchNumber is the last batch sequenced or verified
+	BatchNumber uint64
+	// Sender is the sequencer of the sequenced batches or the aggregator of
+	// the verified batches
+	Sender        common.Address
+	L1BlockNumber uint64
+	L1BlockHash   common.Hash
+	TxHash        common.Hash
+}
+
+// SubscribeNewBatches subscribes to the sequenced batches events of the rollup
+// smc and to the verified batches events of the rollup in the rollup manager
+// smc. The subscription is renewed when it fails, the error is delivered
+// through Err() when it can't be renewed or an event can't be decoded. The
+// channel is not closed, Err() is closed when the context is done or the
+// subscription is unsubscribed.
+func (etherMan *Client) SubscribeNewBatches(ctx context.Context) (<-chan BatchEvent, ethereum.Subscription, error) {
+	query := ethereum.FilterQuery{
+		Addresses: etherMan.SCAddresses[:2],
+		Topics: [][]common.Hash{{
+			sequenceBatchesSignatureHash,
+			verifyBatchesTrustedAggregatorSignatureHash,
+			rollupManagerVerifyBatchesSignatureHash,
+		}},
+	}
+	logs := make(chan types.Log)
+	logSub, err := etherMan.EthClient.SubscribeFilterLogs(ctx, query, logs)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	events := make(chan BatchEvent)
+	sub := event.NewSubscription(func(quit <-chan struct{}) error {
+		defer func() {
+			if logSub != nil {
+				logSub.Unsubscribe()
+			}
+		}()
+		for {
+			select {
+			case vLog := <-logs:
+				if vLog.Removed {
+					continue
+				}
+				batchEvent, ok, err := etherMan.decodeBatchEvent(ctx, vLog)
+				if err != nil {
+					return err
+				}
+				if !ok {
+					continue
+				}
+				select {
+				case events <- batchEvent:
+				case <-quit:
+					return nil
+				case <-ctx.Done():
+					return nil
+				}
+			case err := <-logSub.Err():
+				log.Warnf("batch events subscription failed, resubscribing. Error: %v", err)
+				logSub, err = etherMan.resubscribe(ctx, quit, query, logs)
+				if err != nil {
+					return err
+				}
+				if logSub == nil {
+					return nil
+				}
+			case <-quit:
+				return nil
+			case <-ctx.Done():
+				return nil
+			}
+		}
+	})
+	return events, sub, nil
+}
+
+// resubscribe subscribes again to the logs with backoff, it returns a nil
+// subscription when it's stopped before succeeding.
+func (etherMan *Client) resubscribe(ctx context.Context, quit <-chan struct{}, query ethereum.FilterQuery, logs chan<- types.Log) (ethereum.Subscription, error) {
+	backoff := resubscribeBackoff
+	var err error
+	for attempt := 0; attempt < maxResubscribeAttempts; attempt++ {
+		select {
+		case <-time.After(backoff):
+		case <-quit:
+			return nil, nil
+		case <-ctx.Done():
+			return nil, nil
+		}
+		var sub ethereum.Subscription
+		sub, err = etherMan.EthClient.SubscribeFilterLogs(ctx, query, logs)
+		if err == nil {
+			return sub, nil
+		}
+		backoff *= 2
+	}
+	return nil, fmt.Errorf("error resubscribing to the batch events after %d attempts. Error: %w", maxResubscribeAttempts, err)
+}
+
+// decodeBatchEvent decodes the log, it returns false when the log is not a
+// batch event of the rollup.
+func (etherMan *Client) decodeBatchEvent(ctx context.Context, vLog types.Log) (BatchEvent, bool, error) {
+	batchEvent := BatchEvent{
+		L1BlockNumber: vLog.BlockNumber,
+		L1BlockHash:   vLog.BlockHash,
+		TxHash:        vLog.TxHash,
+	}
+	switch vLog.Topics[0] {
+	case sequenceBatchesSignatureHash:
+		sb, err := etherMan.EtrogZkEVM.ParseSequenceBatches(vLog)
+		if err != nil {
+			return BatchEvent{}, false, err
+		}
+		tx, err := etherMan.EthClient.TransactionInBlock(ctx, vLog.BlockHash, vLog.TxIndex)
+		if err != nil {
+			return BatchEvent{}, false, err
+		}
+		msg, err := core.TransactionToMessage(tx, types.NewLondonSigner(tx.ChainId()), big.NewInt(0))
+		if err != nil {
+			return BatchEvent{}, false, err
+		}
+		batchEvent.Type = SequencedBatchEvent
+		batchEvent.BatchNumber = sb.NumBatch
+		batchEvent.Sender = msg.From
+	case verifyBatchesTrustedAggregatorSignatureHash:
+		vb, err := etherMan.EtrogRollupManager.ParseVerifyBatchesTrustedAggregator(vLog)
+		if err != nil {
+			return BatchEvent{}, false, err
+		}
+		if vb.RollupID != etherMan.RollupID {
+			return BatchEvent{}, false, nil
+		}
+		batchEvent.Type = VerifiedBatchEvent
+		batchEvent.BatchNumber = vb.NumBatch
+		batchEvent.Sender = vb.Aggregator
+	case rollupManagerVerifyBatchesSignatureHash:
+		vb, err := etherMan.EtrogRollupManager.ParseVerifyBatches(vLog)
+		if err != nil {
+			return BatchEvent{}, false, err
+		}
+		if vb.RollupID != etherMan.RollupID {
+			return BatchEvent{}, false, nil
+		}
+		batchEvent.Type = VerifiedBatchEvent
+		batchEvent.BatchNumber = vb.NumBatch
+		batchEvent.Sender = vb.Aggregator
+	default:
+		return BatchEvent{}, false, nil
+	}
+	return batchEvent, true, nil
+}
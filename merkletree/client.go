@@ -11,7 +11,8 @@ import (
 	"google.golang.org/grpc/credentials/insecure"
 )
 
-// NewMTDBServiceClient creates a new MTDB client.
+// NewMTDBServiceClient creates a new MTDB client. The config is expected to be
+// valid, see Config.Validate.
 func NewMTDBServiceClient(ctx context.Context, c Config) (hashdb.HashDBServiceClient, *grpc.ClientConn, context.CancelFunc) {
 	opts := []grpc.DialOption{
 		grpc.WithTransportCredentials(insecure.NewCredentials()),
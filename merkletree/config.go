@@ -4,4 +4,15 @@ package merkletree
 type Config struct {
 	// URI is the server URI.
 	URI string `mapstructure:"URI"`
+	// Arity is the number of children of each intermediate node of the tree.
+	// Only 2 is supported, 0 means DefaultArity.
+	Arity uint8 `mapstructure:"Arity"`
+}
+
+// Validate checks that the configuration is supported by the tree.
+func (c Config) Validate() error {
+	if c.Arity == 0 {
+		return nil
+	}
+	return ValidateArity(c.Arity)
 }
@@ -0,0 +1,10 @@
+package merkletree
+
+import (
+	poseidon "github.com/iden3/go-iden3-crypto/goldenposeidon"
+)
+
+// HashFunc is the signature of the hash function used to derive leaf keys
+// and tree nodes. It matches poseidon.Hash: 8 input elements and 4 capacity
+// elements in, 4 elements out.
+type HashFunc func(inp [poseidon.NROUNDSF]uint64, capacity [poseidon.CAPLEN]uint64) ([poseidon.CAPLEN]uint64, error)
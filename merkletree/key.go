@@ -1,24 +1,111 @@
 package merkletree
 
 import (
+	"encoding/json"
+	"errors"
+	"fmt"
 	"math"
 	"math/big"
+	"strings"
 
+	"github.com/0xPolygonHermez/zkevm-node/hex"
 	"github.com/ethereum/go-ethereum/common"
 	poseidon "github.com/iden3/go-iden3-crypto/goldenposeidon"
+	"github.com/iden3/go-iden3-crypto/keccak256"
 )
 
 // Key stores key of the leaf
 type Key [32]byte
 
+// HexToKey parses a hex string, with or without the 0x prefix, into a Key.
+func HexToKey(s string) (Key, error) {
+	var k Key
+	s = strings.TrimPrefix(s, "0x")
+	if len(s) != 2*len(k) { //nolint:gomnd
+		return Key{}, fmt.Errorf("invalid key length %d, expected %d hex characters", len(s), 2*len(k)) //nolint:gomnd
+	}
+	b, err := hex.DecodeString(s)
+	if err != nil {
+		return Key{}, err
+	}
+	copy(k[:], b)
+	return k, nil
+}
+
+// Hex returns the 0x prefixed lowercase hex representation of the key.
+func (k Key) Hex() string {
+	return hex.EncodeToHex(k[:])
+}
+
+// String implements fmt.Stringer, it's an alias of Hex.
+func (k Key) String() string {
+	return k.Hex()
+}
+
+// IsZero returns true if all the bytes of the key are zero.
+func (k Key) IsZero() bool {
+	return k == Key{}
+}
+
+// MarshalJSON implements json.Marshaler, the key is encoded as a 0x prefixed
+// hex string.
+func (k Key) MarshalJSON() ([]byte, error) {
+	return json.Marshal(k.Hex())
+}
+
+// UnmarshalJSON implements json.Unmarshaler. It accepts a hex string and,
+// for backwards compatibility, the legacy array of 32 numbers.
+func (k *Key) UnmarshalJSON(data []byte) error {
+	if len(data) > 0 && data[0] == '"' {
+		var s string
+		if err := json.Unmarshal(data, &s); err != nil {
+			return err
+		}
+		key, err := HexToKey(s)
+		if err != nil {
+			return err
+		}
+		*k = key
+		return nil
+	}
+
+	var legacy []uint16
+	if err := json.Unmarshal(data, &legacy); err != nil {
+		return err
+	}
+	if len(legacy) != len(k) {
+		return fmt.Errorf("invalid key length %d, expected %d bytes", len(legacy), len(k))
+	}
+	var key Key
+	for i, b := range legacy {
+		if b > math.MaxUint8 {
+			return fmt.Errorf("invalid key byte %d at position %d", b, i)
+		}
+		key[i] = byte(b)
+	}
+	*k = key
+	return nil
+}
+
 const (
 	// HashPoseidonAllZeroes represents the poseidon hash for an input with all
 	// bits set to zero.
 	HashPoseidonAllZeroes = "0xc71603f33a1144ca7953db0ab48808f4c4055e3364a246c33c18a9786cb0b359"
+
+	// SystemContractAddress is the address of the L2 system contract that
+	// stores the block related information.
+	SystemContractAddress = "0x000000000000000000000000000000005ca1ab1e"
+	// GlobalExitRootManagerL2Address is the address of the L2 global exit root
+	// manager contract.
+	GlobalExitRootManagerL2Address = "0xa40D5f56745a118D0906a34E69aEC8C0Db1cB8fA"
+
+	// globalExitRootStoragePos is the storage position of the globalExitRootMap
+	// mapping in the L2 global exit root manager contract.
+	globalExitRootStoragePos = 0
 )
 
 // keyEthAddr is the common code for all the keys related to ethereum addresses.
-func keyEthAddr(ethAddr common.Address, leafType leafType, key1Capacity [4]uint64) ([]byte, error) {
+func keyEthAddr(ethAddr common.Address, leafType LeafType, key1Capacity [4]uint64, hashFn HashFunc) ([]byte, error) {
 	ethAddrBI := new(big.Int).SetBytes(ethAddr.Bytes())
 	ethAddrArr := scalar2fea(ethAddrBI)
 
@@ -33,7 +120,7 @@ func keyEthAddr(ethAddr common.Address, leafType leafType, key1Capacity [4]uint6
 		0,
 	}
 
-	result, err := poseidon.Hash(key1, key1Capacity)
+	result, err := hashFn(key1, key1Capacity)
 	if err != nil {
 		return nil, err
 	}
@@ -50,6 +137,11 @@ func defaultCapIn() ([4]uint64, error) {
 	return [4]uint64{capIn[0], capIn[1], capIn[2], capIn[3]}, nil
 }
 
+// capInWithHash computes hk0 with the given hash function.
+func capInWithHash(hashFn HashFunc) ([4]uint64, error) {
+	return hashFn([8]uint64{}, [4]uint64{})
+}
+
 // KeyEthAddrBalance returns the key of balance leaf:
 // hk0: H([0, 0, 0, 0, 0, 0, 0, 0], [0, 0, 0, 0])
 // key: H([ethAddr[0:4], ethAddr[4:8], ethAddr[8:12], ethAddr[12:16], ethAddr[16:20], 0, 0, 0], [hk0[0], hk0[1], hk0[2], hk0[3]])
@@ -59,7 +151,18 @@ func KeyEthAddrBalance(ethAddr common.Address) ([]byte, error) {
 		return nil, err
 	}
 
-	return keyEthAddr(ethAddr, LeafTypeBalance, capIn)
+	return keyEthAddr(ethAddr, LeafTypeBalance, capIn, poseidon.Hash)
+}
+
+// KeyEthAddrBalanceWithHash is the same as KeyEthAddrBalance but uses the given hash function
+// instead of poseidon.
+func KeyEthAddrBalanceWithHash(ethAddr common.Address, hashFn HashFunc) ([]byte, error) {
+	capIn, err := capInWithHash(hashFn)
+	if err != nil {
+		return nil, err
+	}
+
+	return keyEthAddr(ethAddr, LeafTypeBalance, capIn, hashFn)
 }
 
 // KeyEthAddrNonce returns the key of nonce leaf:
@@ -71,7 +174,18 @@ func KeyEthAddrNonce(ethAddr common.Address) ([]byte, error) {
 		return nil, err
 	}
 
-	return keyEthAddr(ethAddr, LeafTypeNonce, capIn)
+	return keyEthAddr(ethAddr, LeafTypeNonce, capIn, poseidon.Hash)
+}
+
+// KeyEthAddrNonceWithHash is the same as KeyEthAddrNonce but uses the given hash function
+// instead of poseidon.
+func KeyEthAddrNonceWithHash(ethAddr common.Address, hashFn HashFunc) ([]byte, error) {
+	capIn, err := capInWithHash(hashFn)
+	if err != nil {
+		return nil, err
+	}
+
+	return keyEthAddr(ethAddr, LeafTypeNonce, capIn, hashFn)
 }
 
 // KeyContractCode returns the key of contract code leaf:
@@ -83,18 +197,40 @@ func KeyContractCode(ethAddr common.Address) ([]byte, error) {
 		return nil, err
 	}
 
-	return keyEthAddr(ethAddr, LeafTypeCode, capIn)
+	return keyEthAddr(ethAddr, LeafTypeCode, capIn, poseidon.Hash)
+}
+
+// KeyContractCodeWithHash is the same as KeyContractCode but uses the given hash function
+// instead of poseidon.
+func KeyContractCodeWithHash(ethAddr common.Address, hashFn HashFunc) ([]byte, error) {
+	capIn, err := capInWithHash(hashFn)
+	if err != nil {
+		return nil, err
+	}
+
+	return keyEthAddr(ethAddr, LeafTypeCode, capIn, hashFn)
 }
 
 // KeyContractStorage returns the key of contract storage position leaf:
 // hk0: H([stoPos[0:4], stoPos[4:8], stoPos[8:12], stoPos[12:16], stoPos[16:20], stoPos[20:24], stoPos[24:28], stoPos[28:32], [0, 0, 0, 0])
 // key: H([ethAddr[0:4], ethAddr[4:8], ethAddr[8:12], ethAddr[12:16], ethAddr[16:20], 0, 3, 0], [hk0[0], hk0[1], hk0[2], hk0[3])
 func KeyContractStorage(ethAddr common.Address, storagePos []byte) ([]byte, error) {
+	return KeyContractStorageWithHash(ethAddr, storagePos, poseidon.Hash)
+}
+
+// KeyContractStorageWithHash is the same as KeyContractStorage but uses the
+// given hash function instead of poseidon.
+func KeyContractStorageWithHash(ethAddr common.Address, storagePos []byte, hashFn HashFunc) ([]byte, error) {
+	return keyStorage(ethAddr, storagePos, LeafTypeStorage, hashFn)
+}
+
+// keyStorage is the common code for all the keys related to storage positions.
+func keyStorage(ethAddr common.Address, storagePos []byte, leafType LeafType, hashFn HashFunc) ([]byte, error) {
 	storageBI := new(big.Int).SetBytes(storagePos)
 
 	storageArr := scalar2fea(storageBI)
 
-	hk0, err := poseidon.Hash([8]uint64{
+	hk0, err := hashFn([8]uint64{
 		storageArr[0],
 		storageArr[1],
 		storageArr[2],
@@ -108,7 +244,100 @@ func KeyContractStorage(ethAddr common.Address, storagePos []byte) ([]byte, erro
 		return nil, err
 	}
 
-	return keyEthAddr(ethAddr, LeafTypeStorage, hk0)
+	return keyEthAddr(ethAddr, leafType, hk0, hashFn)
+}
+
+// ErrKeySchemeMismatch is returned by ValidateKeyScheme when a computed key
+// differs from the expected one.
+var ErrKeySchemeMismatch = errors.New("key scheme mismatch")
+
+// keySchemeVectors are storage keys computed by the prover, taken from
+// test/vectors/src/merkle-tree/smt-key-contract-storage.json. They cover the
+// slot 0, a full 32 bytes slot and a slot only filling the lowest limb, which
+// catches a reversed limb order.
+var keySchemeVectors = []struct {
+	ethAddr     string
+	storagePos  string
+	expectedKey string
+}{
+	{
+		ethAddr:     "0x0000000000000000000000000000000000000000",
+		storagePos:  "0x0",
+		expectedKey: "0x1bb61d3f0fa6c77b1ae5de7d05de6c0044a4bdc767729629a8f674ff2e5311ff",
+	},
+	{
+		ethAddr:     "0xFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFF",
+		storagePos:  "0xffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffff",
+		expectedKey: "0x494304e5417629155546805e24d58cf730741efd84c755deaaee0f5305823915",
+	},
+	{
+		ethAddr:     "0xEEF9f339514298C6A857EfCfC1A762aF84438dEE",
+		storagePos:  "0x1c60",
+		expectedKey: "0xb9652ee798f9ca9ea0b636d83ae872dda14a6e7f205695a26071b86c14ba72f7",
+	},
+}
+
+// ValidateKeyScheme checks that KeyContractStorage computes the keys expected
+// by the prover for a set of reference addresses and slots. A mismatch means
+// the layout of the Poseidon inputs changed, e.g. the order of the limbs of
+// the slot, and the state roots would diverge from the prover ones. The
+// returned error wraps ErrKeySchemeMismatch and lists every mismatch.
+func ValidateKeyScheme() error {
+	return validateKeyScheme(KeyContractStorage)
+}
+
+// validateKeyScheme checks the keys computed by keyFn against the vectors.
+func validateKeyScheme(keyFn func(ethAddr common.Address, storagePos []byte) ([]byte, error)) error {
+	var mismatches []string
+	for _, v := range keySchemeVectors {
+		storagePos, err := hex.DecodeHex(v.storagePos)
+		if err != nil {
+			return err
+		}
+		key, err := keyFn(common.HexToAddress(v.ethAddr), storagePos)
+		if err != nil {
+			return err
+		}
+		if actual := hex.EncodeToHex(key); actual != v.expectedKey {
+			mismatches = append(mismatches, fmt.Sprintf("address %s slot %s: got %s, expected %s", v.ethAddr, v.storagePos, actual, v.expectedKey))
+		}
+	}
+	if len(mismatches) > 0 {
+		return fmt.Errorf("%w: %s", ErrKeySchemeMismatch, strings.Join(mismatches, "; "))
+	}
+	return nil
+}
+
+// KeyBySystemSlot returns the key of a storage slot of the system contract.
+// The prover addresses those slots as regular storage leaves, so the key is
+// derived like KeyContractStorage with LeafTypeStorage:
+// hk0: H([slot[0:4], slot[4:8], slot[8:12], slot[12:16], slot[16:20], slot[20:24], slot[24:28], slot[28:32], [0, 0, 0, 0])
+// key: H([sysAddr[0:4], sysAddr[4:8], sysAddr[8:12], sysAddr[12:16], sysAddr[16:20], 0, 3, 0], [hk0[0], hk0[1], hk0[2], hk0[3])
+func KeyBySystemSlot(slot *big.Int) ([]byte, error) {
+	if slot == nil || slot.Sign() < 0 || slot.BitLen() > maxBigIntLen*8 { //nolint:gomnd
+		return nil, fmt.Errorf("invalid system slot %v", slot)
+	}
+
+	return keyStorage(common.HexToAddress(SystemContractAddress), slot.Bytes(), LeafTypeStorage, poseidon.Hash)
+}
+
+// KeyGlobalExitRoot returns the key of the leaf storing the entry rootIndex
+// of the globalExitRootMap mapping of the L2 global exit root manager, a
+// regular storage leaf like the ones of KeyBySystemSlot:
+// pos: keccak256([rootIndex[0:32], globalExitRootStoragePos[0:32]])
+// hk0: H([pos[0:4], pos[4:8], pos[8:12], pos[12:16], pos[16:20], pos[20:24], pos[24:28], pos[28:32], [0, 0, 0, 0])
+// key: H([gerAddr[0:4], gerAddr[4:8], gerAddr[8:12], gerAddr[12:16], gerAddr[16:20], 0, 3, 0], [hk0[0], hk0[1], hk0[2], hk0[3])
+func KeyGlobalExitRoot(rootIndex *big.Int) ([]byte, error) {
+	if rootIndex == nil || rootIndex.Sign() < 0 || rootIndex.BitLen() > maxBigIntLen*8 { //nolint:gomnd
+		return nil, fmt.Errorf("invalid global exit root index %v", rootIndex)
+	}
+
+	pos := keccak256.Hash(
+		ScalarToFilledByteSlice(rootIndex),
+		ScalarToFilledByteSlice(big.NewInt(globalExitRootStoragePos)),
+	)
+
+	return keyStorage(common.HexToAddress(GlobalExitRootManagerL2Address), pos, LeafTypeStorage, poseidon.Hash)
 }
 
 // HashContractBytecode computes the bytecode hash in order to add it to the
@@ -197,5 +426,41 @@ func KeyCodeLength(ethAddr common.Address) ([]byte, error) {
 		return nil, err
 	}
 
-	return keyEthAddr(ethAddr, LeafTypeSCLength, capIn)
+	return keyEthAddr(ethAddr, LeafTypeSCLength, capIn, poseidon.Hash)
+}
+
+// KeyCodeLengthWithHash is the same as KeyCodeLength but uses the given hash function
+// instead of poseidon.
+func KeyCodeLengthWithHash(ethAddr common.Address, hashFn HashFunc) ([]byte, error) {
+	capIn, err := capInWithHash(hashFn)
+	if err != nil {
+		return nil, err
+	}
+
+	return keyEthAddr(ethAddr, LeafTypeSCLength, capIn, hashFn)
+}
+
+// KeyFromBytes returns the key of the leaf of the given type of the address
+// read as raw bytes, e.g. from a database column. The address must be exactly
+// 20 bytes long, unlike common.BytesToAddress it doesn't pad or truncate it.
+// Storage leaves also depend on the storage position, so LeafTypeStorage is
+// rejected, see KeyContractStorage.
+func KeyFromBytes(addr []byte, leafType LeafType) ([]byte, error) {
+	if len(addr) != common.AddressLength {
+		return nil, fmt.Errorf("invalid address length %d, expected %d bytes", len(addr), common.AddressLength)
+	}
+	switch leafType {
+	case LeafTypeBalance, LeafTypeNonce, LeafTypeCode, LeafTypeSCLength:
+	case LeafTypeStorage:
+		return nil, errors.New("the key of a storage leaf needs the storage position, use KeyContractStorage")
+	default:
+		return nil, fmt.Errorf("unknown leaf type %d", leafType)
+	}
+
+	capIn, err := defaultCapIn()
+	if err != nil {
+		return nil, err
+	}
+
+	return keyEthAddr(common.BytesToAddress(addr), leafType, capIn, poseidon.Hash)
 }
@@ -3,14 +3,17 @@ package merkletree
 import (
 	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"math/big"
 	"os"
 	"path"
 	"runtime"
+	"strings"
 	"testing"
 
 	"github.com/ethereum/go-ethereum/common"
+	poseidon "github.com/iden3/go-iden3-crypto/goldenposeidon"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
@@ -109,6 +112,29 @@ func Test_KeyContractStorage(t *testing.T) {
 	}
 }
 
+func Test_ValidateKeyScheme(t *testing.T) {
+	require.NoError(t, ValidateKeyScheme())
+
+	// the limbs of the slot in reverse order
+	reversed := func(ethAddr common.Address, storagePos []byte) ([]byte, error) {
+		storageArr := scalar2fea(new(big.Int).SetBytes(storagePos))
+		var inp [8]uint64
+		for i := range inp {
+			inp[i] = storageArr[len(inp)-1-i]
+		}
+		hk0, err := poseidon.Hash(inp, [4]uint64{})
+		if err != nil {
+			return nil, err
+		}
+		return keyEthAddr(ethAddr, LeafTypeStorage, hk0, poseidon.Hash)
+	}
+	err := validateKeyScheme(reversed)
+	assert.ErrorIs(t, err, ErrKeySchemeMismatch)
+	// the slots 0 and 2^256-1 have the same limbs in both orders
+	assert.ErrorContains(t, err, "slot 0x1c60")
+	assert.NotContains(t, err.Error(), "slot 0x0:")
+}
+
 func Test_byteCodeHash(t *testing.T) {
 	data, err := os.ReadFile("test/vectors/src/merkle-tree/smt-hash-bytecode.json")
 	require.NoError(t, err)
@@ -125,3 +151,208 @@ func Test_byteCodeHash(t *testing.T) {
 		})
 	}
 }
+
+func Test_KeysWithHash(t *testing.T) {
+	addr := common.HexToAddress("0x617b3a3528F9cDd6630fd3301B9c8911F7Bf063D")
+	storagePos := big.NewInt(1).Bytes()
+
+	tcs := []struct {
+		description string
+		keyFunc     func() ([]byte, error)
+		withHash    func(HashFunc) ([]byte, error)
+	}{
+		{
+			description: "keyEthAddressBalance",
+			keyFunc:     func() ([]byte, error) { return KeyEthAddrBalance(addr) },
+			withHash:    func(h HashFunc) ([]byte, error) { return KeyEthAddrBalanceWithHash(addr, h) },
+		},
+		{
+			description: "keyEthAddressNonce",
+			keyFunc:     func() ([]byte, error) { return KeyEthAddrNonce(addr) },
+			withHash:    func(h HashFunc) ([]byte, error) { return KeyEthAddrNonceWithHash(addr, h) },
+		},
+		{
+			description: "keyContractCode",
+			keyFunc:     func() ([]byte, error) { return KeyContractCode(addr) },
+			withHash:    func(h HashFunc) ([]byte, error) { return KeyContractCodeWithHash(addr, h) },
+		},
+		{
+			description: "keyCodeLength",
+			keyFunc:     func() ([]byte, error) { return KeyCodeLength(addr) },
+			withHash:    func(h HashFunc) ([]byte, error) { return KeyCodeLengthWithHash(addr, h) },
+		},
+		{
+			description: "keyContractStorage",
+			keyFunc:     func() ([]byte, error) { return KeyContractStorage(addr, storagePos) },
+			withHash:    func(h HashFunc) ([]byte, error) { return KeyContractStorageWithHash(addr, storagePos, h) },
+		},
+	}
+	for _, tc := range tcs {
+		tc := tc
+		t.Run(tc.description, func(t *testing.T) {
+			expected, err := tc.keyFunc()
+			require.NoError(t, err)
+
+			key, err := tc.withHash(poseidon.Hash)
+			require.NoError(t, err)
+			assert.Equal(t, expected, key)
+
+			calls := 0
+			mockHash := func(inp [8]uint64, capacity [4]uint64) ([4]uint64, error) {
+				calls++
+				return [4]uint64{inp[0], inp[1], inp[2], inp[3]}, nil
+			}
+			key, err = tc.withHash(mockHash)
+			require.NoError(t, err)
+			require.Equal(t, maxBigIntLen, len(key))
+			assert.Equal(t, 2, calls)
+			assert.NotEqual(t, expected, key)
+
+			hashErr := errors.New("hash error")
+			_, err = tc.withHash(func([8]uint64, [4]uint64) ([4]uint64, error) {
+				return [4]uint64{}, hashErr
+			})
+			assert.ErrorIs(t, err, hashErr)
+		})
+	}
+}
+
+func noopHash([8]uint64, [4]uint64) ([4]uint64, error) {
+	return [4]uint64{}, nil
+}
+
+func BenchmarkKeyEthAddrBalance(b *testing.B) {
+	addr := common.HexToAddress("0x617b3a3528F9cDd6630fd3301B9c8911F7Bf063D")
+
+	b.Run("poseidon", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			_, _ = KeyEthAddrBalanceWithHash(addr, poseidon.Hash)
+		}
+	})
+	b.Run("noop", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			_, _ = KeyEthAddrBalanceWithHash(addr, noopHash)
+		}
+	})
+}
+
+func Test_KeySystemStorage(t *testing.T) {
+	// the system leaves are storage leaves of the system contracts, the
+	// expected keys follow the derivation of smt-key-contract-storage.json
+	for slot, expected := range map[int64]string{
+		0: "387cec268ce3c921f8308615ee783219fff7ea1740f685f02390e4b93bfb7317",
+		1: "749c64b39cc6f371f99ef31f63983e76f540543d0414d2fdd5725146b614fc16",
+		3: "62dc6ae3ffcc2dbcd16fececc9dbf194d774a656f0cccc1081d8e5fafb6d43ca",
+	} {
+		key, err := KeyBySystemSlot(big.NewInt(slot))
+		require.NoError(t, err)
+		assert.Equal(t, expected, hex.EncodeToString(key), "slot %d", slot)
+	}
+
+	ger := common.HexToHash("0xad3228b676f7d3cd4284a5443f17f1962b36e491b30a40b2405849e597ba5fb5")
+	key, err := KeyGlobalExitRoot(ger.Big())
+	require.NoError(t, err)
+	assert.Equal(t, "ab4752c8071e8f988fd0e87e8aba97db6a370fcb44bde4e8a9f1b0f9837a3856", hex.EncodeToString(key))
+
+	_, err = KeyBySystemSlot(big.NewInt(-1))
+	assert.Error(t, err)
+	_, err = KeyGlobalExitRoot(new(big.Int).Lsh(big.NewInt(1), 256))
+	assert.Error(t, err)
+	_, err = KeyBySystemSlot(nil)
+	assert.Error(t, err)
+	_, err = KeyGlobalExitRoot(nil)
+	assert.Error(t, err)
+}
+
+func Test_KeyHex(t *testing.T) {
+	const keyHex = "0x0102030405060708090a0b0c0d0e0f101112131415161718191a1b1c1d1e1f20"
+
+	k, err := HexToKey(keyHex)
+	require.NoError(t, err)
+	assert.Equal(t, byte(0x01), k[0])
+	assert.Equal(t, byte(0x20), k[31])
+	assert.Equal(t, keyHex, k.Hex())
+	assert.Equal(t, keyHex, k.String())
+	assert.Equal(t, keyHex, fmt.Sprintf("%v", k))
+	assert.False(t, k.IsZero())
+
+	withoutPrefix, err := HexToKey(keyHex[2:])
+	require.NoError(t, err)
+	assert.Equal(t, k, withoutPrefix)
+
+	upper, err := HexToKey("0x0102030405060708090A0B0C0D0E0F101112131415161718191A1B1C1D1E1F20")
+	require.NoError(t, err)
+	assert.Equal(t, k, upper)
+
+	assert.True(t, Key{}.IsZero())
+	assert.Equal(t, "0x0000000000000000000000000000000000000000000000000000000000000000", Key{}.Hex())
+
+	for _, invalid := range []string{"", "0x", "0x01", keyHex + "21", keyHex[:65], "0x" + strings.Repeat("zz", 32)} {
+		_, err := HexToKey(invalid)
+		assert.Error(t, err, invalid)
+	}
+}
+
+func Test_KeyJSON(t *testing.T) {
+	k, err := HexToKey("0x0102030405060708090a0b0c0d0e0f101112131415161718191a1b1c1d1e1f20")
+	require.NoError(t, err)
+
+	for _, key := range []Key{k, {}} {
+		data, err := json.Marshal(key)
+		require.NoError(t, err)
+		assert.Equal(t, `"`+key.Hex()+`"`, string(data))
+
+		var decoded Key
+		require.NoError(t, json.Unmarshal(data, &decoded))
+		assert.Equal(t, key, decoded)
+	}
+
+	// keys embedded in other types are encoded as strings too
+	data, err := json.Marshal(struct{ Key Key }{Key: k})
+	require.NoError(t, err)
+	assert.Equal(t, `{"Key":"`+k.Hex()+`"}`, string(data))
+
+	// legacy array form
+	legacy, err := json.Marshal([32]byte(k))
+	require.NoError(t, err)
+	var decoded Key
+	require.NoError(t, json.Unmarshal(legacy, &decoded))
+	assert.Equal(t, k, decoded)
+
+	for _, invalid := range []string{`"0x01"`, `[1, 2, 3]`, `[` + strings.Repeat("256, ", 31) + `256]`, `{}`, `"zz"`} {
+		assert.Error(t, json.Unmarshal([]byte(invalid), &decoded), invalid)
+	}
+}
+
+func Test_KeyFromBytes(t *testing.T) {
+	addr := common.HexToAddress("0x617b3a3528F9cDd6630fd3301B9c8911F7Bf063D")
+	tcs := []struct {
+		leafType LeafType
+		keyFunc  func(common.Address) ([]byte, error)
+	}{
+		{LeafTypeBalance, KeyEthAddrBalance},
+		{LeafTypeNonce, KeyEthAddrNonce},
+		{LeafTypeCode, KeyContractCode},
+		{LeafTypeSCLength, KeyCodeLength},
+	}
+	for _, tc := range tcs {
+		expected, err := tc.keyFunc(addr)
+		require.NoError(t, err)
+		key, err := KeyFromBytes(addr.Bytes(), tc.leafType)
+		require.NoError(t, err)
+		assert.Equal(t, expected, key, tc.leafType)
+	}
+
+	// common.BytesToAddress would keep the last 20 bytes
+	_, err := KeyFromBytes(append([]byte{0x01}, addr.Bytes()...), LeafTypeBalance)
+	assert.ErrorContains(t, err, "invalid address length 21")
+	_, err = KeyFromBytes(addr.Bytes()[1:], LeafTypeBalance)
+	assert.ErrorContains(t, err, "invalid address length 19")
+	_, err = KeyFromBytes(nil, LeafTypeBalance)
+	assert.Error(t, err)
+
+	_, err = KeyFromBytes(addr.Bytes(), LeafTypeStorage)
+	assert.ErrorContains(t, err, "storage position")
+	_, err = KeyFromBytes(addr.Bytes(), LeafType(10))
+	assert.ErrorContains(t, err, "unknown leaf type 10")
+}
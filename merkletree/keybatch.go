@@ -0,0 +1,77 @@
+package merkletree
+
+import (
+	"context"
+	"runtime"
+
+	"github.com/ethereum/go-ethereum/common"
+	"golang.org/x/sync/errgroup"
+)
+
+// KeyEthAddrBalanceBatch returns the keys of the balance leaves of the given
+// addresses, in the same order.
+func KeyEthAddrBalanceBatch(ctx context.Context, addrs []common.Address) ([][]byte, error) {
+	return keyEthAddrBatch(ctx, addrs, KeyEthAddrBalance)
+}
+
+// KeyEthAddrNonceBatch returns the keys of the nonce leaves of the given
+// addresses, in the same order.
+func KeyEthAddrNonceBatch(ctx context.Context, addrs []common.Address) ([][]byte, error) {
+	return keyEthAddrBatch(ctx, addrs, KeyEthAddrNonce)
+}
+
+// KeyContractCodeBatch returns the keys of the contract code leaves of the
+// given addresses, in the same order.
+func KeyContractCodeBatch(ctx context.Context, addrs []common.Address) ([][]byte, error) {
+	return keyEthAddrBatch(ctx, addrs, KeyContractCode)
+}
+
+// keyEthAddrBatch derives the keys of the given addresses using a pool of one
+// worker per CPU. The first error or the cancellation of the context stops the
+// remaining work.
+func keyEthAddrBatch(ctx context.Context, addrs []common.Address, keyFunc func(common.Address) ([]byte, error)) ([][]byte, error) {
+	keys := make([][]byte, len(addrs))
+	if len(addrs) == 0 {
+		return keys, nil
+	}
+
+	g, ctx := errgroup.WithContext(ctx)
+	indexes := make(chan int)
+
+	g.Go(func() error {
+		defer close(indexes)
+		for i := range addrs {
+			select {
+			case indexes <- i:
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		}
+		return nil
+	})
+
+	workers := runtime.NumCPU()
+	if workers > len(addrs) {
+		workers = len(addrs)
+	}
+	for w := 0; w < workers; w++ {
+		g.Go(func() error {
+			for i := range indexes {
+				if ctx.Err() != nil {
+					return ctx.Err()
+				}
+				key, err := keyFunc(addrs[i])
+				if err != nil {
+					return err
+				}
+				keys[i] = key
+			}
+			return nil
+		})
+	}
+
+	if err := g.Wait(); err != nil {
+		return nil, err
+	}
+	return keys, nil
+}
@@ -0,0 +1,92 @@
+package merkletree
+
+import (
+	"context"
+	"errors"
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func testAddresses(n int) []common.Address {
+	addrs := make([]common.Address, n)
+	for i := range addrs {
+		addrs[i] = common.BigToAddress(big.NewInt(int64(i + 1)))
+	}
+	return addrs
+}
+
+func TestKeyEthAddrBatch(t *testing.T) {
+	addrs := testAddresses(100)
+
+	tcs := []struct {
+		description string
+		batchFunc   func(context.Context, []common.Address) ([][]byte, error)
+		keyFunc     func(common.Address) ([]byte, error)
+	}{
+		{"balance", KeyEthAddrBalanceBatch, KeyEthAddrBalance},
+		{"nonce", KeyEthAddrNonceBatch, KeyEthAddrNonce},
+		{"code", KeyContractCodeBatch, KeyContractCode},
+	}
+	for _, tc := range tcs {
+		tc := tc
+		t.Run(tc.description, func(t *testing.T) {
+			keys, err := tc.batchFunc(context.Background(), addrs)
+			require.NoError(t, err)
+			require.Len(t, keys, len(addrs))
+			for i, addr := range addrs {
+				expected, err := tc.keyFunc(addr)
+				require.NoError(t, err)
+				assert.Equal(t, expected, keys[i])
+			}
+		})
+	}
+
+	keys, err := KeyEthAddrBalanceBatch(context.Background(), nil)
+	require.NoError(t, err)
+	assert.Empty(t, keys)
+}
+
+func TestKeyEthAddrBatchError(t *testing.T) {
+	addrs := testAddresses(1000)
+	failingAddr := addrs[10]
+	errKey := errors.New("key error")
+
+	keys, err := keyEthAddrBatch(context.Background(), addrs, func(addr common.Address) ([]byte, error) {
+		if addr == failingAddr {
+			return nil, errKey
+		}
+		return KeyEthAddrBalance(addr)
+	})
+	assert.ErrorIs(t, err, errKey)
+	assert.Nil(t, keys)
+}
+
+func TestKeyEthAddrBatchCanceled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	keys, err := KeyEthAddrBalanceBatch(ctx, testAddresses(100_000))
+	assert.ErrorIs(t, err, context.Canceled)
+	assert.Nil(t, keys)
+}
+
+func BenchmarkKeyEthAddrBalanceBatch(b *testing.B) {
+	addrs := testAddresses(100_000)
+
+	b.Run("serial", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			for _, addr := range addrs {
+				_, _ = KeyEthAddrBalance(addr)
+			}
+		}
+	})
+	b.Run("batch", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			_, _ = KeyEthAddrBalanceBatch(context.Background(), addrs)
+		}
+	})
+}
@@ -0,0 +1,150 @@
+package merkletree
+
+import (
+	"container/list"
+	"sync"
+	"sync/atomic"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// keyCacheKey identifies a derived key in the KeyCache.
+type keyCacheKey struct {
+	ethAddr    common.Address
+	leafType   LeafType
+	storagePos common.Hash
+}
+
+type keyCacheEntry struct {
+	id  keyCacheKey
+	key []byte
+}
+
+// KeyCache is a LRU cache in front of the leaf key derivation functions, so
+// the poseidon hashes of the most used addresses are computed only once. It's
+// safe for concurrent use.
+type KeyCache struct {
+	size  int
+	mu    sync.Mutex
+	items map[keyCacheKey]*list.Element
+	lru   *list.List
+
+	hits   atomic.Uint64
+	misses atomic.Uint64
+}
+
+// NewKeyCache creates a KeyCache that holds up to size keys. A size lower than
+// one disables the cache.
+func NewKeyCache(size int) *KeyCache {
+	return &KeyCache{
+		size:  size,
+		items: make(map[keyCacheKey]*list.Element),
+		lru:   list.New(),
+	}
+}
+
+// KeyEthAddrBalance returns the key of balance leaf, see KeyEthAddrBalance.
+func (c *KeyCache) KeyEthAddrBalance(ethAddr common.Address) ([]byte, error) {
+	return c.getOrCompute(keyCacheKey{ethAddr: ethAddr, leafType: LeafTypeBalance}, func() ([]byte, error) {
+		return KeyEthAddrBalance(ethAddr)
+	})
+}
+
+// KeyEthAddrNonce returns the key of nonce leaf, see KeyEthAddrNonce.
+func (c *KeyCache) KeyEthAddrNonce(ethAddr common.Address) ([]byte, error) {
+	return c.getOrCompute(keyCacheKey{ethAddr: ethAddr, leafType: LeafTypeNonce}, func() ([]byte, error) {
+		return KeyEthAddrNonce(ethAddr)
+	})
+}
+
+// KeyContractCode returns the key of contract code leaf, see KeyContractCode.
+func (c *KeyCache) KeyContractCode(ethAddr common.Address) ([]byte, error) {
+	return c.getOrCompute(keyCacheKey{ethAddr: ethAddr, leafType: LeafTypeCode}, func() ([]byte, error) {
+		return KeyContractCode(ethAddr)
+	})
+}
+
+// KeyCodeLength returns the key of code length leaf, see KeyCodeLength.
+func (c *KeyCache) KeyCodeLength(ethAddr common.Address) ([]byte, error) {
+	return c.getOrCompute(keyCacheKey{ethAddr: ethAddr, leafType: LeafTypeSCLength}, func() ([]byte, error) {
+		return KeyCodeLength(ethAddr)
+	})
+}
+
+// KeyContractStorage returns the key of contract storage position leaf, see
+// KeyContractStorage.
+func (c *KeyCache) KeyContractStorage(ethAddr common.Address, storagePos []byte) ([]byte, error) {
+	id := keyCacheKey{ethAddr: ethAddr, leafType: LeafTypeStorage, storagePos: common.BytesToHash(storagePos)}
+	return c.getOrCompute(id, func() ([]byte, error) {
+		return KeyContractStorage(ethAddr, storagePos)
+	})
+}
+
+// Hits returns the number of keys served from the cache.
+func (c *KeyCache) Hits() uint64 {
+	return c.hits.Load()
+}
+
+// Misses returns the number of keys that had to be computed.
+func (c *KeyCache) Misses() uint64 {
+	return c.misses.Load()
+}
+
+// Len returns the number of keys in the cache.
+func (c *KeyCache) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.lru.Len()
+}
+
+func (c *KeyCache) getOrCompute(id keyCacheKey, compute func() ([]byte, error)) ([]byte, error) {
+	if key, ok := c.get(id); ok {
+		c.hits.Add(1)
+		return key, nil
+	}
+	c.misses.Add(1)
+
+	key, err := compute()
+	if err != nil {
+		return nil, err
+	}
+	c.add(id, key)
+	return key, nil
+}
+
+func (c *KeyCache) get(id keyCacheKey) ([]byte, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	elem, ok := c.items[id]
+	if !ok {
+		return nil, false
+	}
+	c.lru.MoveToFront(elem)
+	return copyBytes(elem.Value.(*keyCacheEntry).key), true
+}
+
+func (c *KeyCache) add(id keyCacheKey, key []byte) {
+	if c.size < 1 {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if elem, ok := c.items[id]; ok {
+		c.lru.MoveToFront(elem)
+		return
+	}
+	c.items[id] = c.lru.PushFront(&keyCacheEntry{id: id, key: copyBytes(key)})
+
+	if c.lru.Len() > c.size {
+		oldest := c.lru.Back()
+		c.lru.Remove(oldest)
+		delete(c.items, oldest.Value.(*keyCacheEntry).id)
+	}
+}
+
+func copyBytes(b []byte) []byte {
+	return append([]byte(nil), b...)
+}
@@ -0,0 +1,134 @@
+package merkletree
+
+import (
+	"math/big"
+	"sync"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestKeyCache(t *testing.T) {
+	addr1 := common.HexToAddress("0x1")
+	addr2 := common.HexToAddress("0x2")
+	addr3 := common.HexToAddress("0x3")
+	c := NewKeyCache(2)
+
+	expected, err := KeyEthAddrBalance(addr1)
+	require.NoError(t, err)
+
+	key, err := c.KeyEthAddrBalance(addr1)
+	require.NoError(t, err)
+	assert.Equal(t, expected, key)
+	assert.Equal(t, uint64(0), c.Hits())
+	assert.Equal(t, uint64(1), c.Misses())
+
+	key, err = c.KeyEthAddrBalance(addr1)
+	require.NoError(t, err)
+	assert.Equal(t, expected, key)
+	assert.Equal(t, uint64(1), c.Hits())
+	assert.Equal(t, uint64(1), c.Misses())
+
+	// same address, different leaf type
+	expected, err = KeyEthAddrNonce(addr1)
+	require.NoError(t, err)
+	key, err = c.KeyEthAddrNonce(addr1)
+	require.NoError(t, err)
+	assert.Equal(t, expected, key)
+	assert.Equal(t, uint64(2), c.Misses())
+	assert.Equal(t, 2, c.Len())
+
+	// addr1 balance is the least recently used and gets evicted
+	_, err = c.KeyEthAddrBalance(addr2)
+	require.NoError(t, err)
+	assert.Equal(t, 2, c.Len())
+	_, err = c.KeyEthAddrNonce(addr1)
+	require.NoError(t, err)
+	assert.Equal(t, uint64(2), c.Hits())
+	_, err = c.KeyEthAddrBalance(addr1)
+	require.NoError(t, err)
+	assert.Equal(t, uint64(4), c.Misses())
+
+	// storage keys include the position
+	pos1, pos2 := big.NewInt(1).Bytes(), big.NewInt(2).Bytes()
+	expected, err = KeyContractStorage(addr3, pos2)
+	require.NoError(t, err)
+	_, err = c.KeyContractStorage(addr3, pos1)
+	require.NoError(t, err)
+	key, err = c.KeyContractStorage(addr3, pos2)
+	require.NoError(t, err)
+	assert.Equal(t, expected, key)
+	assert.Equal(t, uint64(6), c.Misses())
+}
+
+func TestKeyCacheDisabled(t *testing.T) {
+	c := NewKeyCache(0)
+	addr := common.HexToAddress("0x1")
+
+	for i := 0; i < 2; i++ {
+		_, err := c.KeyEthAddrBalance(addr)
+		require.NoError(t, err)
+	}
+	assert.Equal(t, uint64(0), c.Hits())
+	assert.Equal(t, uint64(2), c.Misses())
+	assert.Equal(t, 0, c.Len())
+}
+
+func TestKeyCacheConcurrency(t *testing.T) {
+	c := NewKeyCache(4)
+	addrs := []common.Address{
+		common.HexToAddress("0x1"),
+		common.HexToAddress("0x2"),
+		common.HexToAddress("0x3"),
+		common.HexToAddress("0x4"),
+		common.HexToAddress("0x5"),
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 50; j++ {
+				addr := addrs[(i+j)%len(addrs)]
+				expected, err := KeyEthAddrBalance(addr)
+				require.NoError(t, err)
+				key, err := c.KeyEthAddrBalance(addr)
+				require.NoError(t, err)
+				assert.Equal(t, expected, key)
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	assert.Equal(t, uint64(500), c.Hits()+c.Misses())
+	assert.LessOrEqual(t, c.Len(), 4)
+}
+
+func BenchmarkKeyCache(b *testing.B) {
+	// 90% of the requests go to a small set of hot addresses
+	hot := make([]common.Address, 10)
+	for i := range hot {
+		hot[i] = common.BigToAddress(big.NewInt(int64(i + 1)))
+	}
+	addrAt := func(i int) common.Address {
+		if i%10 == 0 {
+			return common.BigToAddress(big.NewInt(int64(i + 1000)))
+		}
+		return hot[i%len(hot)]
+	}
+
+	b.Run("without cache", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			_, _ = KeyEthAddrBalance(addrAt(i))
+		}
+	})
+	b.Run("with cache", func(b *testing.B) {
+		c := NewKeyCache(100)
+		for i := 0; i < b.N; i++ {
+			_, _ = c.KeyEthAddrBalance(addrAt(i))
+		}
+	})
+}
@@ -1,17 +1,38 @@
 package merkletree
 
-// leafType specifies type of the leaf
-type leafType uint8
+import "fmt"
+
+// LeafType specifies type of the leaf
+type LeafType uint8
 
 const (
 	// LeafTypeBalance specifies that leaf stores Balance
-	LeafTypeBalance leafType = 0
+	LeafTypeBalance LeafType = 0
 	// LeafTypeNonce specifies that leaf stores Nonce
-	LeafTypeNonce leafType = 1
+	LeafTypeNonce LeafType = 1
 	// LeafTypeCode specifies that leaf stores Code
-	LeafTypeCode leafType = 2
+	LeafTypeCode LeafType = 2
 	// LeafTypeStorage specifies that leaf stores Storage Value
-	LeafTypeStorage leafType = 3
+	LeafTypeStorage LeafType = 3
 	// LeafTypeSCLength specifies that leaf stores Storage Value
-	LeafTypeSCLength leafType = 4
+	LeafTypeSCLength LeafType = 4
 )
+
+// String implements fmt.Stringer. Unknown values are formatted like
+// "LeafType(7)".
+func (t LeafType) String() string {
+	switch t {
+	case LeafTypeBalance:
+		return "balance"
+	case LeafTypeNonce:
+		return "nonce"
+	case LeafTypeCode:
+		return "code"
+	case LeafTypeStorage:
+		return "storage"
+	case LeafTypeSCLength:
+		return "sc_length"
+	default:
+		return fmt.Sprintf("LeafType(%d)", uint8(t))
+	}
+}
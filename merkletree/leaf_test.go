@@ -0,0 +1,26 @@
+package merkletree
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLeafTypeString(t *testing.T) {
+	tcs := []struct {
+		leafType LeafType
+		expected string
+	}{
+		{LeafTypeBalance, "balance"},
+		{LeafTypeNonce, "nonce"},
+		{LeafTypeCode, "code"},
+		{LeafTypeStorage, "storage"},
+		{LeafTypeSCLength, "sc_length"},
+		{LeafType(7), "LeafType(7)"},
+	}
+	for _, tc := range tcs {
+		assert.Equal(t, tc.expected, tc.leafType.String())
+	}
+	assert.Equal(t, "nonce", fmt.Sprint(LeafTypeNonce))
+}
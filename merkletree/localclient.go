@@ -0,0 +1,375 @@
+package merkletree
+
+import (
+	"context"
+	"fmt"
+	"math/big"
+	"sort"
+	"sync"
+
+	"github.com/0xPolygonHermez/zkevm-node/hex"
+	"github.com/0xPolygonHermez/zkevm-node/merkletree/hashdb"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/emptypb"
+)
+
+// LocalHashDBClient implements hashdb.HashDBServiceClient on top of a Store,
+// so a StateTree can be used without a hashdb server. Every write is applied
+// to the Store straight away, so batches, blocks and flushes are no-ops.
+type LocalHashDBClient struct {
+	smt *smt
+
+	mu         sync.RWMutex
+	programs   map[string][]byte
+	preimages  map[string]KeyPreimage
+	latestRoot []uint64
+}
+
+// NewLocalHashDBClient creates a LocalHashDBClient that stores the tree nodes
+// in the given Store.
+func NewLocalHashDBClient(store Store) *LocalHashDBClient {
+	return &LocalHashDBClient{
+		smt:        newSMT(store, nil),
+		programs:   make(map[string][]byte),
+		preimages:  make(map[string]KeyPreimage),
+		latestRoot: make([]uint64, hashLen),
+	}
+}
+
+// GetLatestStateRoot returns the root of the last Set operation.
+func (c *LocalHashDBClient) GetLatestStateRoot(ctx context.Context, in *emptypb.Empty, opts ...grpc.CallOption) (*hashdb.GetLatestStateRootResponse, error) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	return &hashdb.GetLatestStateRootResponse{
+		LatestRoot: h4ToFea(c.latestRoot),
+		Result:     resultSuccess(),
+	}, nil
+}
+
+// Set sets the value of a key.
+func (c *LocalHashDBClient) Set(ctx context.Context, in *hashdb.SetRequest, opts ...grpc.CallOption) (*hashdb.SetResponse, error) {
+	value := big.NewInt(0)
+	if in.Value != "" {
+		var ok bool
+		value, ok = new(big.Int).SetString(in.Value, hex.Base)
+		if !ok {
+			return nil, status.Errorf(codes.InvalidArgument, "invalid value %q", in.Value)
+		}
+	}
+
+	oldRoot, key := feaToH4(in.OldRoot), feaToH4(in.Key)
+	res, err := c.smt.set(ctx, oldRoot, key, value)
+	if err != nil {
+		return nil, err
+	}
+
+	c.mu.Lock()
+	c.latestRoot = res.newRoot
+	c.mu.Unlock()
+
+	resp := &hashdb.SetResponse{
+		OldRoot:  in.OldRoot,
+		NewRoot:  h4ToFea(res.newRoot),
+		Key:      in.Key,
+		IsOld0:   res.isOld0,
+		OldValue: res.oldValue.Text(hex.Base),
+		NewValue: value.Text(hex.Base),
+		Mode:     res.mode,
+		Result:   resultSuccess(),
+	}
+	if res.insKey != nil {
+		resp.InsKey = h4ToFea(res.insKey)
+		resp.InsValue = res.insValue.Text(hex.Base)
+	}
+	return resp, nil
+}
+
+// Get returns the value of a key along with the siblings of its path.
+func (c *LocalHashDBClient) Get(ctx context.Context, in *hashdb.GetRequest, opts ...grpc.CallOption) (*hashdb.GetResponse, error) {
+	res, err := c.smt.get(ctx, feaToH4(in.Root), feaToH4(in.Key))
+	if err != nil {
+		return nil, err
+	}
+	return getResponse(in.Root, in.Key, res), nil
+}
+
+// GetProofs returns the values of the keys in the tree with the given root
+// along with the siblings of their paths, in the same order. The nodes of the
+// paths of all the keys are fetched together level by level, so their common
+// ancestors are read once, see smt.getMany.
+func (c *LocalHashDBClient) GetProofs(ctx context.Context, root []uint64, keys [][]uint64) ([]*hashdb.GetResponse, error) {
+	res, err := c.smt.getMany(ctx, root, keys)
+	if err != nil {
+		return nil, err
+	}
+	resps := make([]*hashdb.GetResponse, len(res))
+	for i, r := range res {
+		resps[i] = getResponse(h4ToFea(root), h4ToFea(keys[i]), r)
+	}
+	return resps, nil
+}
+
+// getResponse builds the response of a get of the key in the tree with the
+// given root.
+func getResponse(root, key *hashdb.Fea, res *smtGetResult) *hashdb.GetResponse {
+	resp := &hashdb.GetResponse{
+		Root:     root,
+		Key:      key,
+		Siblings: make(map[uint64]*hashdb.SiblingList, len(res.siblings)),
+		IsOld0:   res.isOld0,
+		Value:    res.value.Text(hex.Base),
+		Result:   resultSuccess(),
+	}
+	for level, sibling := range res.siblings {
+		resp.Siblings[uint64(level)] = &hashdb.SiblingList{Sibling: sibling}
+	}
+	if res.insKey != nil {
+		resp.InsKey = h4ToFea(res.insKey)
+		resp.InsValue = res.insValue.Text(hex.Base)
+	}
+	return resp
+}
+
+// GetMany returns the values of the keys in the tree with the given root, in
+// the same order. The nodes of the paths of all the keys are fetched together
+// level by level, see smt.getMany.
+func (c *LocalHashDBClient) GetMany(ctx context.Context, root []uint64, keys [][]uint64) ([]*big.Int, error) {
+	res, err := c.smt.getMany(ctx, root, keys)
+	if err != nil {
+		return nil, err
+	}
+	values := make([]*big.Int, len(res))
+	for i, r := range res {
+		values[i] = r.value
+	}
+	return values, nil
+}
+
+// SetMany sets the values of the keys in the tree with the given root and
+// returns the new root, see smt.setMany.
+func (c *LocalHashDBClient) SetMany(ctx context.Context, root []uint64, keys [][]uint64, values []*big.Int) ([]uint64, error) {
+	newRoot, err := c.smt.setMany(ctx, root, keys, values)
+	if err != nil {
+		return nil, err
+	}
+
+	c.mu.Lock()
+	c.latestRoot = newRoot
+	c.mu.Unlock()
+	return newRoot, nil
+}
+
+// SetProgram stores a program indexed by its hash.
+func (c *LocalHashDBClient) SetProgram(ctx context.Context, in *hashdb.SetProgramRequest, opts ...grpc.CallOption) (*hashdb.SetProgramResponse, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.programs[H4ToString(feaToH4(in.Key))] = append([]byte{}, in.Data...)
+	return &hashdb.SetProgramResponse{Result: resultSuccess()}, nil
+}
+
+// GetProgram returns the program with the given hash.
+func (c *LocalHashDBClient) GetProgram(ctx context.Context, in *hashdb.GetProgramRequest, opts ...grpc.CallOption) (*hashdb.GetProgramResponse, error) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	data, ok := c.programs[H4ToString(feaToH4(in.Key))]
+	if !ok {
+		return &hashdb.GetProgramResponse{Result: &hashdb.ResultCode{Code: hashdb.ResultCode_CODE_DB_KEY_NOT_FOUND}}, nil
+	}
+	return &hashdb.GetProgramResponse{Data: append([]byte{}, data...), Result: resultSuccess()}, nil
+}
+
+// LoadDB stores the given nodes.
+func (c *LocalHashDBClient) LoadDB(ctx context.Context, in *hashdb.LoadDBRequest, opts ...grpc.CallOption) (*emptypb.Empty, error) {
+	for hash, node := range in.InputDb {
+		h, err := StringToh4(hash)
+		if err != nil {
+			return nil, status.Errorf(codes.InvalidArgument, "invalid node hash %q: %v", hash, err)
+		}
+		if err := c.smt.store.Set(ctx, h, node.Fe); err != nil {
+			return nil, err
+		}
+	}
+	return &emptypb.Empty{}, nil
+}
+
+// LoadProgramDB stores the given programs.
+func (c *LocalHashDBClient) LoadProgramDB(ctx context.Context, in *hashdb.LoadProgramDBRequest, opts ...grpc.CallOption) (*emptypb.Empty, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for hash, data := range in.InputProgramDb {
+		h, err := StringToh4(hash)
+		if err != nil {
+			return nil, status.Errorf(codes.InvalidArgument, "invalid program hash %q: %v", hash, err)
+		}
+		c.programs[H4ToString(h)] = append([]byte{}, data...)
+	}
+	return &emptypb.Empty{}, nil
+}
+
+// FinishTx is a no-op.
+func (c *LocalHashDBClient) FinishTx(ctx context.Context, in *hashdb.FinishTxRequest, opts ...grpc.CallOption) (*emptypb.Empty, error) {
+	return &emptypb.Empty{}, nil
+}
+
+// StartBlock is a no-op.
+func (c *LocalHashDBClient) StartBlock(ctx context.Context, in *hashdb.StartBlockRequest, opts ...grpc.CallOption) (*emptypb.Empty, error) {
+	return &emptypb.Empty{}, nil
+}
+
+// FinishBlock is a no-op.
+func (c *LocalHashDBClient) FinishBlock(ctx context.Context, in *hashdb.FinishBlockRequest, opts ...grpc.CallOption) (*emptypb.Empty, error) {
+	return &emptypb.Empty{}, nil
+}
+
+// Flush is a no-op.
+func (c *LocalHashDBClient) Flush(ctx context.Context, in *hashdb.FlushRequest, opts ...grpc.CallOption) (*hashdb.FlushResponse, error) {
+	return &hashdb.FlushResponse{Result: resultSuccess()}, nil
+}
+
+// GetFlushStatus always reports that there is nothing pending to flush.
+func (c *LocalHashDBClient) GetFlushStatus(ctx context.Context, in *emptypb.Empty, opts ...grpc.CallOption) (*hashdb.GetFlushStatusResponse, error) {
+	return &hashdb.GetFlushStatusResponse{}, nil
+}
+
+// GetFlushData is not supported.
+func (c *LocalHashDBClient) GetFlushData(ctx context.Context, in *hashdb.GetFlushDataRequest, opts ...grpc.CallOption) (*hashdb.GetFlushDataResponse, error) {
+	return nil, unimplemented("GetFlushData")
+}
+
+// ConsolidateState is not supported.
+func (c *LocalHashDBClient) ConsolidateState(ctx context.Context, in *hashdb.ConsolidateStateRequest, opts ...grpc.CallOption) (*hashdb.ConsolidateStateResponse, error) {
+	return nil, unimplemented("ConsolidateState")
+}
+
+// Purge is not supported.
+func (c *LocalHashDBClient) Purge(ctx context.Context, in *hashdb.PurgeRequest, opts ...grpc.CallOption) (*hashdb.PurgeResponse, error) {
+	return nil, unimplemented("Purge")
+}
+
+// ReadTree is not supported.
+func (c *LocalHashDBClient) ReadTree(ctx context.Context, in *hashdb.ReadTreeRequest, opts ...grpc.CallOption) (*hashdb.ReadTreeResponse, error) {
+	return nil, unimplemented("ReadTree")
+}
+
+// CancelBatch is not supported, writes are applied straight away.
+func (c *LocalHashDBClient) CancelBatch(ctx context.Context, in *hashdb.CancelBatchRequest, opts ...grpc.CallOption) (*hashdb.CancelBatchResponse, error) {
+	return nil, unimplemented("CancelBatch")
+}
+
+// ResetDB is not supported.
+func (c *LocalHashDBClient) ResetDB(ctx context.Context, in *emptypb.Empty, opts ...grpc.CallOption) (*hashdb.ResetDBResponse, error) {
+	return nil, unimplemented("ResetDB")
+}
+
+// ForEachLeaf calls fn with the key and the value of every leaf of the tree
+// with the given root.
+func (c *LocalHashDBClient) ForEachLeaf(ctx context.Context, root []uint64, fn func(key []uint64, value *big.Int) error) error {
+	return c.smt.walkLeaves(ctx, root, fn)
+}
+
+// ScanPrefix calls fn with the key and the value of every leaf of the tree
+// with the given root whose path starts with the prefix bits.
+func (c *LocalHashDBClient) ScanPrefix(ctx context.Context, root []uint64, prefixBits []bool, fn func(key []uint64, value *big.Int) error) error {
+	prefix := make([]uint64, len(prefixBits))
+	for i, bit := range prefixBits {
+		if bit {
+			prefix[i] = 1
+		}
+	}
+	return c.smt.walkPrefix(ctx, root, prefix, fn)
+}
+
+// DiffLeaves calls fn with the key and both values of every leaf that differs
+// between the trees with the given roots.
+func (c *LocalHashDBClient) DiffLeaves(ctx context.Context, rootA, rootB []uint64, fn func(key []uint64, valueA, valueB *big.Int) error) error {
+	return c.smt.diffLeaves(ctx, rootA, rootB, fn)
+}
+
+// Stats returns the number of nodes and leaves and the depth of the tree with
+// the given root.
+func (c *LocalHashDBClient) Stats(ctx context.Context, root []uint64) (TreeStats, error) {
+	return c.smt.stats(ctx, root)
+}
+
+// Verify checks the hashes of the nodes of the tree with the given root.
+func (c *LocalHashDBClient) Verify(ctx context.Context, root []uint64) (*VerifyReport, error) {
+	return c.smt.verify(ctx, root)
+}
+
+// GC deletes the nodes that are not reachable from any of the given roots, the
+// programs are kept.
+func (c *LocalHashDBClient) GC(ctx context.Context, roots [][]uint64) (int, error) {
+	return c.smt.gc(ctx, roots)
+}
+
+// ForEachProgram calls fn with the hash and the data of every stored program,
+// sorted by hash.
+func (c *LocalHashDBClient) ForEachProgram(ctx context.Context, fn func(hash []uint64, data []byte) error) error {
+	c.mu.RLock()
+	hashes := make([]string, 0, len(c.programs))
+	for hash := range c.programs {
+		hashes = append(hashes, hash)
+	}
+	c.mu.RUnlock()
+	sort.Strings(hashes)
+
+	for _, hash := range hashes {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		c.mu.RLock()
+		data := append([]byte{}, c.programs[hash]...)
+		c.mu.RUnlock()
+		h, err := StringToh4(hash)
+		if err != nil {
+			return err
+		}
+		if err := fn(h, data); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// RecordKeyPreimage records the address, the leaf type and the position the
+// key is derived from. The preimages are kept in memory, only the keys set
+// since the client was created can be decoded.
+func (c *LocalHashDBClient) RecordKeyPreimage(key []uint64, preimage KeyPreimage) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.preimages[H4ToString(key)] = preimage
+}
+
+// KeyPreimage returns the recorded preimage of the key, false when there's
+// none.
+func (c *LocalHashDBClient) KeyPreimage(key []uint64) (KeyPreimage, bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	preimage, found := c.preimages[H4ToString(key)]
+	return preimage, found
+}
+
+func unimplemented(method string) error {
+	return status.Error(codes.Unimplemented, fmt.Sprintf("%s is not supported by the local hashdb client", method))
+}
+
+func resultSuccess() *hashdb.ResultCode {
+	return &hashdb.ResultCode{Code: hashdb.ResultCode_CODE_SUCCESS}
+}
+
+func feaToH4(fea *hashdb.Fea) []uint64 {
+	if fea == nil {
+		return make([]uint64, hashLen)
+	}
+	return []uint64{fea.Fe0, fea.Fe1, fea.Fe2, fea.Fe3}
+}
+
+func h4ToFea(h4 []uint64) *hashdb.Fea {
+	return &hashdb.Fea{Fe0: h4[0], Fe1: h4[1], Fe2: h4[2], Fe3: h4[3]}
+}
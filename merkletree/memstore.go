@@ -0,0 +1,109 @@
+package merkletree
+
+import (
+	"context"
+	"sync"
+)
+
+// MemStore is an in-memory Store, suitable for unit tests and ephemeral
+// tooling. It's safe for concurrent use.
+type MemStore struct {
+	mu    sync.RWMutex
+	nodes map[string][]uint64
+}
+
+// MemStoreSnapshot is a copy of the content of a MemStore.
+type MemStoreSnapshot struct {
+	nodes map[string][]uint64
+}
+
+// NewMemStore creates an empty MemStore.
+func NewMemStore() *MemStore {
+	return &MemStore{
+		nodes: make(map[string][]uint64),
+	}
+}
+
+// Get returns the node with the given hash or ErrNodeNotFound.
+func (s *MemStore) Get(ctx context.Context, hash []uint64) ([]uint64, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	node, ok := s.nodes[H4ToString(hash)]
+	if !ok {
+		return nil, ErrNodeNotFound
+	}
+	return append([]uint64{}, node...), nil
+}
+
+// GetNodes returns the nodes with the given hashes. Missing nodes are not
+// included.
+func (s *MemStore) GetNodes(ctx context.Context, hashes [][]uint64) (map[string][]uint64, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	nodes := make(map[string][]uint64, len(hashes))
+	for _, hash := range hashes {
+		h := H4ToString(hash)
+		if node, ok := s.nodes[h]; ok {
+			nodes[h] = append([]uint64{}, node...)
+		}
+	}
+	return nodes, nil
+}
+
+// Set stores the node with the given hash.
+func (s *MemStore) Set(ctx context.Context, hash []uint64, node []uint64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.nodes[H4ToString(hash)] = append([]uint64{}, node...)
+	return nil
+}
+
+// DeleteExcept deletes every node whose hash is not in keep and returns the
+// number of deleted nodes.
+func (s *MemStore) DeleteExcept(ctx context.Context, keep map[string]struct{}) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	deleted := 0
+	for h := range s.nodes {
+		if _, found := keep[h]; !found {
+			delete(s.nodes, h)
+			deleted++
+		}
+	}
+	return deleted, nil
+}
+
+// Len returns the number of nodes in the store.
+func (s *MemStore) Len() int {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return len(s.nodes)
+}
+
+// Snapshot returns a copy of the current content of the store.
+func (s *MemStore) Snapshot() *MemStoreSnapshot {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return &MemStoreSnapshot{nodes: copyNodes(s.nodes)}
+}
+
+// Restore replaces the content of the store with the given snapshot.
+func (s *MemStore) Restore(snapshot *MemStoreSnapshot) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.nodes = copyNodes(snapshot.nodes)
+}
+
+func copyNodes(nodes map[string][]uint64) map[string][]uint64 {
+	res := make(map[string][]uint64, len(nodes))
+	for k, v := range nodes {
+		res[k] = v
+	}
+	return res
+}
@@ -0,0 +1,57 @@
+package merkletree
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMemStore(t *testing.T) {
+	ctx := context.Background()
+	s := NewMemStore()
+
+	hash := []uint64{1, 2, 3, 4}
+	node := []uint64{1, 2, 3, 4, 5, 6, 7, 8, 0, 0, 0, 0}
+
+	_, err := s.Get(ctx, hash)
+	assert.ErrorIs(t, err, ErrNodeNotFound)
+
+	require.NoError(t, s.Set(ctx, hash, node))
+	stored, err := s.Get(ctx, hash)
+	require.NoError(t, err)
+	assert.Equal(t, node, stored)
+	assert.Equal(t, 1, s.Len())
+
+	// the store keeps its own copy of the nodes
+	node[0] = 100
+	stored[1] = 100
+	stored, err = s.Get(ctx, hash)
+	require.NoError(t, err)
+	assert.Equal(t, []uint64{1, 2, 3, 4, 5, 6, 7, 8, 0, 0, 0, 0}, stored)
+
+	snapshot := s.Snapshot()
+	require.NoError(t, s.Set(ctx, []uint64{5, 6, 7, 8}, node))
+	assert.Equal(t, 2, s.Len())
+
+	s.Restore(snapshot)
+	assert.Equal(t, 1, s.Len())
+	_, err = s.Get(ctx, []uint64{5, 6, 7, 8})
+	assert.ErrorIs(t, err, ErrNodeNotFound)
+	_, err = s.Get(ctx, hash)
+	require.NoError(t, err)
+}
+
+func TestMemStoreGetNodes(t *testing.T) {
+	ctx := context.Background()
+	s := NewMemStore()
+
+	hash := []uint64{1, 2, 3, 4}
+	node := []uint64{1, 2, 3, 4, 5, 6, 7, 8, 0, 0, 0, 0}
+	require.NoError(t, s.Set(ctx, hash, node))
+
+	nodes, err := s.GetNodes(ctx, [][]uint64{hash, {5, 6, 7, 8}})
+	require.NoError(t, err)
+	assert.Equal(t, map[string][]uint64{H4ToString(hash): node}, nodes)
+}
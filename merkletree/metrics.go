@@ -0,0 +1,135 @@
+package merkletree
+
+import (
+	"sync"
+	"time"
+
+	poseidon "github.com/iden3/go-iden3-crypto/goldenposeidon"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const (
+	// metricsPrefix is the prefix of the metrics of the merkletree package.
+	metricsPrefix = "merkletree_"
+	// OperationsName is the name of the metric that counts the tree operations.
+	OperationsName = metricsPrefix + "operations_total"
+	// OperationDurationName is the name of the metric that shows the latency of
+	// the tree operations.
+	OperationDurationName = metricsPrefix + "operation_duration_seconds"
+	// KeyCacheLookupsName is the name of the metric that counts the lookups of
+	// the key caches.
+	KeyCacheLookupsName = metricsPrefix + "key_cache_lookups_total"
+	// OperationLabelName is the name of the label for the operation.
+	OperationLabelName = "operation"
+
+	// OperationHash is used for the calls to the hash function
+	OperationHash = "hash"
+	// OperationNodeGet is used for the reads of the tree
+	OperationNodeGet = "node_get"
+	// OperationNodeSet is used for the writes of the tree
+	OperationNodeSet = "node_set"
+	// OperationGetProof is used for the reads that return a proof
+	OperationGetProof = "get_proof"
+	// OperationGetMany is used for the reads of several leaves together
+	OperationGetMany = "get_many"
+	// OperationCacheHit is used for the key cache lookups that found the key
+	OperationCacheHit = "cache_hit"
+	// OperationCacheMiss is used for the key cache lookups that had to compute the key
+	OperationCacheMiss = "cache_miss"
+)
+
+// Collector gathers the metrics of a StateTree. It implements
+// prometheus.Collector, so it can be registered with any prometheus.Registry.
+// All its methods are safe to call on a nil Collector, which doesn't record
+// anything.
+type Collector struct {
+	operations *prometheus.CounterVec
+	durations  *prometheus.HistogramVec
+	cacheDesc  *prometheus.Desc
+
+	mu     sync.Mutex
+	caches []*KeyCache
+}
+
+// NewCollector creates a Collector.
+func NewCollector() *Collector {
+	return &Collector{
+		operations: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: OperationsName,
+			Help: "[MERKLETREE] number of operations",
+		}, []string{OperationLabelName}),
+		durations: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name: OperationDurationName,
+			Help: "[MERKLETREE] latency of the operations",
+		}, []string{OperationLabelName}),
+		cacheDesc: prometheus.NewDesc(
+			KeyCacheLookupsName,
+			"[MERKLETREE] number of key cache lookups",
+			[]string{OperationLabelName}, nil,
+		),
+	}
+}
+
+// Describe implements prometheus.Collector.
+func (c *Collector) Describe(ch chan<- *prometheus.Desc) {
+	c.operations.Describe(ch)
+	c.durations.Describe(ch)
+	ch <- c.cacheDesc
+}
+
+// Collect implements prometheus.Collector.
+func (c *Collector) Collect(ch chan<- prometheus.Metric) {
+	c.operations.Collect(ch)
+	c.durations.Collect(ch)
+
+	c.mu.Lock()
+	var hits, misses uint64
+	for _, cache := range c.caches {
+		hits += cache.Hits()
+		misses += cache.Misses()
+	}
+	c.mu.Unlock()
+
+	ch <- prometheus.MustNewConstMetric(c.cacheDesc, prometheus.CounterValue, float64(hits), OperationCacheHit)
+	ch <- prometheus.MustNewConstMetric(c.cacheDesc, prometheus.CounterValue, float64(misses), OperationCacheMiss)
+}
+
+// WatchKeyCache adds the hits and misses of the given cache to the key cache
+// lookups metric.
+func (c *Collector) WatchKeyCache(cache *KeyCache) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.caches = append(c.caches, cache)
+}
+
+// WrapHashFunc returns a HashFunc that counts the calls to hashFn.
+func (c *Collector) WrapHashFunc(hashFn HashFunc) HashFunc {
+	if c == nil {
+		return hashFn
+	}
+	counter := c.operations.WithLabelValues(OperationHash)
+	return func(inp [poseidon.NROUNDSF]uint64, capacity [poseidon.CAPLEN]uint64) ([poseidon.CAPLEN]uint64, error) {
+		counter.Inc()
+		return hashFn(inp, capacity)
+	}
+}
+
+// inc increments the counter of the given operation.
+func (c *Collector) inc(operation string) {
+	if c == nil {
+		return
+	}
+	c.operations.WithLabelValues(operation).Inc()
+}
+
+// observeDuration observes the time elapsed since start for the given
+// operation.
+func (c *Collector) observeDuration(operation string, start time.Time) {
+	if c == nil {
+		return
+	}
+	c.durations.WithLabelValues(operation).Observe(time.Since(start).Seconds())
+}
@@ -0,0 +1,74 @@
+package merkletree
+
+import (
+	"context"
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/google/uuid"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMetrics(t *testing.T) {
+	ctx := context.Background()
+	sTree := NewStateTree(NewLocalHashDBClient(NewMemStore()), WithMetrics())
+	collector := sTree.Collector()
+	require.NotNil(t, collector)
+
+	cache := NewKeyCache(10)
+	collector.WatchKeyCache(cache)
+
+	registry := prometheus.NewRegistry()
+	require.NoError(t, registry.Register(collector))
+
+	addr := common.HexToAddress("0x1")
+	root, _, err := sTree.SetBalance(ctx, addr, big.NewInt(1), nil, uuid.NewString())
+	require.NoError(t, err)
+	_, err = sTree.GetBalance(ctx, addr, root)
+	require.NoError(t, err)
+	key, err := KeyEthAddrBalance(addr)
+	require.NoError(t, err)
+	_, err = sTree.GetMany(ctx, root, [][]byte{key})
+	require.NoError(t, err)
+
+	_, err = cache.KeyEthAddrBalance(addr)
+	require.NoError(t, err)
+	_, err = cache.KeyEthAddrBalance(addr)
+	require.NoError(t, err)
+
+	assert.Equal(t, float64(1), testutil.ToFloat64(collector.operations.WithLabelValues(OperationNodeSet)))
+	assert.Equal(t, float64(2), testutil.ToFloat64(collector.operations.WithLabelValues(OperationNodeGet)))
+	// every key derivation hashes the capacity and the key
+	assert.Equal(t, float64(4), testutil.ToFloat64(collector.operations.WithLabelValues(OperationHash)))
+
+	families, err := registry.Gather()
+	require.NoError(t, err)
+	values := make(map[string]float64)
+	for _, family := range families {
+		for _, m := range family.GetMetric() {
+			label := m.GetLabel()[0].GetValue()
+			switch family.GetName() {
+			case KeyCacheLookupsName:
+				values[label] = m.GetCounter().GetValue()
+			case OperationDurationName:
+				values[family.GetName()+label] = float64(m.GetHistogram().GetSampleCount())
+			}
+		}
+	}
+	assert.Equal(t, float64(1), values[OperationCacheHit])
+	assert.Equal(t, float64(1), values[OperationCacheMiss])
+	assert.Equal(t, float64(1), values[OperationDurationName+OperationGetProof])
+	assert.Equal(t, float64(1), values[OperationDurationName+OperationGetMany])
+}
+
+func TestMetricsDisabled(t *testing.T) {
+	sTree := NewStateTree(NewLocalHashDBClient(NewMemStore()))
+	assert.Nil(t, sTree.Collector())
+
+	_, _, err := sTree.SetBalance(context.Background(), common.HexToAddress("0x1"), big.NewInt(1), nil, uuid.NewString())
+	require.NoError(t, err)
+}
@@ -0,0 +1,103 @@
+package pgtreestorage
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+
+	"github.com/0xPolygonHermez/zkevm-node/merkletree"
+	"github.com/jackc/pgx/v4"
+	"github.com/jackc/pgx/v4/pgxpool"
+)
+
+// PostgresStore implements the merkletree.BatchStore interface on top of the
+// state.merkletree_node table, to back the trees of a
+// merkletree.LocalHashDBClient.
+type PostgresStore struct {
+	*pgxpool.Pool
+}
+
+// NewPostgresStore creates a new PostgresStore
+func NewPostgresStore(db *pgxpool.Pool) *PostgresStore {
+	return &PostgresStore{db}
+}
+
+// Get returns the node with the given hash or merkletree.ErrNodeNotFound.
+func (p *PostgresStore) Get(ctx context.Context, hash []uint64) ([]uint64, error) {
+	const getNodeSQL = "SELECT data FROM state.merkletree_node WHERE hash = $1"
+
+	var data []byte
+	err := p.QueryRow(ctx, getNodeSQL, encode(hash)).Scan(&data)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, merkletree.ErrNodeNotFound
+	} else if err != nil {
+		return nil, err
+	}
+	return decode(data)
+}
+
+// GetNodes returns the nodes with the given hashes indexed by the string
+// representation of their hash, see merkletree.H4ToString, reading them with a
+// single query. Missing nodes are not included.
+func (p *PostgresStore) GetNodes(ctx context.Context, hashes [][]uint64) (map[string][]uint64, error) {
+	const getNodesSQL = "SELECT hash, data FROM state.merkletree_node WHERE hash = ANY($1)"
+
+	keys := make([][]byte, len(hashes))
+	for i, hash := range hashes {
+		keys[i] = encode(hash)
+	}
+	rows, err := p.Query(ctx, getNodesSQL, keys)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	nodes := make(map[string][]uint64, len(hashes))
+	for rows.Next() {
+		var key, data []byte
+		if err := rows.Scan(&key, &data); err != nil {
+			return nil, err
+		}
+		hash, err := decode(key)
+		if err != nil {
+			return nil, err
+		}
+		node, err := decode(data)
+		if err != nil {
+			return nil, err
+		}
+		nodes[merkletree.H4ToString(hash)] = node
+	}
+	return nodes, rows.Err()
+}
+
+// Set stores the node with the given hash, replacing the stored one.
+func (p *PostgresStore) Set(ctx context.Context, hash []uint64, node []uint64) error {
+	const setNodeSQL = `INSERT INTO state.merkletree_node (hash, data) VALUES ($1, $2)
+		ON CONFLICT (hash) DO UPDATE SET data = EXCLUDED.data`
+
+	_, err := p.Exec(ctx, setNodeSQL, encode(hash), encode(node))
+	return err
+}
+
+// encode returns the field elements as 8 bytes big endian each.
+func encode(elements []uint64) []byte {
+	b := make([]byte, 0, 8*len(elements))
+	for _, e := range elements {
+		b = binary.BigEndian.AppendUint64(b, e)
+	}
+	return b
+}
+
+// decode returns the field elements encoded by encode.
+func decode(b []byte) ([]uint64, error) {
+	if len(b)%8 != 0 {
+		return nil, fmt.Errorf("invalid encoded length %d", len(b))
+	}
+	elements := make([]uint64, len(b)/8)
+	for i := range elements {
+		elements[i] = binary.BigEndian.Uint64(b[8*i:])
+	}
+	return elements, nil
+}
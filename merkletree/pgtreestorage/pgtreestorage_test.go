@@ -0,0 +1,106 @@
+package pgtreestorage_test
+
+import (
+	"context"
+	"math/big"
+	"os"
+	"testing"
+
+	"github.com/0xPolygonHermez/zkevm-node/db"
+	"github.com/0xPolygonHermez/zkevm-node/merkletree"
+	"github.com/0xPolygonHermez/zkevm-node/merkletree/pgtreestorage"
+	"github.com/0xPolygonHermez/zkevm-node/test/dbutils"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v4/pgxpool"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var (
+	stateDb    *pgxpool.Pool
+	stateDBCfg = dbutils.NewStateConfigFromEnv()
+)
+
+func TestMain(m *testing.M) {
+	if err := dbutils.InitOrResetState(stateDBCfg); err != nil {
+		panic(err)
+	}
+
+	var err error
+	stateDb, err = db.NewSQLDB(stateDBCfg)
+	if err != nil {
+		panic(err)
+	}
+	defer stateDb.Close()
+
+	result := m.Run()
+
+	os.Exit(result)
+}
+
+func TestPostgresStore(t *testing.T) {
+	ctx := context.Background()
+	store := pgtreestorage.NewPostgresStore(stateDb)
+
+	nodeA := []uint64{1, 2, 3, 4, 5, 6, 7, 8, 0, 0, 0, 0}
+	nodeB := []uint64{9, 10, 11, 12, 13, 14, 15, 16, 1, 0, 0, 0}
+	hashA := []uint64{1, 1, 1, 1}
+	hashB := []uint64{2, 2, 2, 2}
+	require.NoError(t, store.Set(ctx, hashA, nodeA))
+	require.NoError(t, store.Set(ctx, hashB, nodeB))
+
+	node, err := store.Get(ctx, hashA)
+	require.NoError(t, err)
+	assert.Equal(t, nodeA, node)
+	_, err = store.Get(ctx, []uint64{3, 3, 3, 3})
+	assert.ErrorIs(t, err, merkletree.ErrNodeNotFound)
+
+	// the missing nodes are not included
+	nodes, err := store.GetNodes(ctx, [][]uint64{hashA, hashB, {3, 3, 3, 3}, hashA})
+	require.NoError(t, err)
+	assert.Equal(t, map[string][]uint64{
+		merkletree.H4ToString(hashA): nodeA,
+		merkletree.H4ToString(hashB): nodeB,
+	}, nodes)
+
+	// the stored node is replaced
+	require.NoError(t, store.Set(ctx, hashA, nodeB))
+	node, err = store.Get(ctx, hashA)
+	require.NoError(t, err)
+	assert.Equal(t, nodeB, node)
+}
+
+func TestPostgresStoreTree(t *testing.T) {
+	ctx := context.Background()
+	tree := merkletree.NewStateTree(merkletree.NewLocalHashDBClient(pgtreestorage.NewPostgresStore(stateDb)))
+	memTree := merkletree.NewStateTree(merkletree.NewLocalHashDBClient(merkletree.NewMemStore()))
+	txID := uuid.NewString()
+
+	root, memRoot := common.Hash{}.Bytes(), common.Hash{}.Bytes()
+	keys := make([][]byte, 0, 20)
+	for i := int64(1); i <= 20; i++ {
+		addr := common.BigToAddress(big.NewInt(i))
+		var err error
+		root, _, err = tree.SetBalance(ctx, addr, big.NewInt(i), root, txID)
+		require.NoError(t, err)
+		memRoot, _, err = memTree.SetBalance(ctx, addr, big.NewInt(i), memRoot, txID)
+		require.NoError(t, err)
+		key, err := merkletree.KeyEthAddrBalance(addr)
+		require.NoError(t, err)
+		keys = append(keys, key)
+	}
+	assert.Equal(t, memRoot, root)
+
+	// the paths of the keys are read level by level with GetNodes
+	values, err := tree.GetMany(ctx, root, keys)
+	require.NoError(t, err)
+	proofs, err := tree.GetProofs(ctx, root, keys)
+	require.NoError(t, err)
+	for i, value := range values {
+		assert.Equal(t, big.NewInt(int64(i+1)), value)
+		ok, err := merkletree.VerifyProof(root, keys[i], value.Bytes(), proofs[i], merkletree.DefaultArity, nil)
+		require.NoError(t, err)
+		assert.True(t, ok)
+	}
+}
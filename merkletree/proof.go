@@ -0,0 +1,234 @@
+package merkletree
+
+import (
+	"errors"
+	"fmt"
+	"math/big"
+
+	"github.com/0xPolygonHermez/zkevm-node/merkletree/hashdb"
+	"github.com/ethereum/go-ethereum/common"
+	poseidon "github.com/iden3/go-iden3-crypto/goldenposeidon"
+)
+
+const (
+	// DefaultArity is the number of children of each intermediate node of the
+	// state tree. It is the only arity supported, see ValidateArity.
+	DefaultArity uint8 = 2
+
+	// hashLen is the number of field elements of a node hash.
+	hashLen = poseidon.CAPLEN
+
+	// maxLevels is the maximum depth of a binary tree with 256 bits keys.
+	maxLevels = 256
+)
+
+var (
+	// ErrInvalidProof is returned when the proof is malformed.
+	ErrInvalidProof = errors.New("invalid proof")
+	// ErrUnsupportedArity is returned when the tree arity is not supported.
+	ErrUnsupportedArity = errors.New("unsupported tree arity")
+)
+
+// DefaultEmptyRoot is the root of an empty state tree with the default arity,
+// i.e. the root of a freshly initialized state, see EmptyRoot.
+var DefaultEmptyRoot = common.Hash{}
+
+// EmptyRoot returns the root of an empty sparse merkle tree with the given
+// arity.
+//
+// The empty subtrees are not hashed but represented by the zero hash, so the
+// empty root is the zero hash whatever the hash function is. hashFn is only
+// taken for consistency with VerifyProof.
+func EmptyRoot(arity uint8, hashFn HashFunc) ([]byte, error) {
+	if err := ValidateArity(arity); err != nil {
+		return nil, err
+	}
+	return h4ToFilledByteSlice(make([]uint64, hashLen)), nil
+}
+
+// ValidateArity checks that the arity can be used with the state tree.
+//
+// Only binary trees are supported: the keys are consumed one bit per level
+// and every node is hashed as H([left[0:4], right[0:4]], capacity), which
+// fills the 8 field elements input of the Poseidon permutation used by the
+// prover. Any other arity would produce roots the prover can't reproduce.
+func ValidateArity(arity uint8) error {
+	if arity != DefaultArity {
+		return fmt.Errorf("%w: %d, only %d is supported", ErrUnsupportedArity, arity, DefaultArity)
+	}
+	return nil
+}
+
+// VerifyProof recomputes the root of the tree from the siblings contained in
+// the proof and checks it against the expected root. It doesn't access any
+// storage, so it can be used by off-chain verifiers.
+//
+// A zero value means that the proof is a proof of absence: the path of the key
+// must end either in an empty node (proof.IsOld0) or in a leaf holding a
+// different key (proof.InsKey, proof.InsValue).
+//
+// Leaves and nodes are hashed as follows:
+// valueHash: H([value[0], ..., value[7]], [0, 0, 0, 0])
+// leaf: H([remainingKey[0:4], valueHash[0:4]], [1, 0, 0, 0])
+// node: H([left[0:4], right[0:4]], [0, 0, 0, 0])
+func VerifyProof(root []byte, key []byte, value []byte, proof *Proof, arity uint8, hashFn HashFunc) (bool, error) {
+	if proof == nil {
+		return false, fmt.Errorf("%w: nil proof", ErrInvalidProof)
+	}
+	if hashFn == nil {
+		hashFn = poseidon.Hash
+	}
+	if err := ValidateArity(arity); err != nil {
+		return false, err
+	}
+
+	nLevels := len(proof.Siblings)
+	if nLevels > maxLevels {
+		return false, fmt.Errorf("%w: %d levels exceeds the maximum of %d for arity %d", ErrInvalidProof, nLevels, maxLevels, arity)
+	}
+	siblingLen := int(arity-1) * hashLen
+	for level, sibling := range proof.Siblings {
+		if len(sibling) != siblingLen {
+			return false, fmt.Errorf("%w: sibling at level %d has %d elements, expected %d for arity %d", ErrInvalidProof, level, len(sibling), siblingLen, arity)
+		}
+	}
+
+	k := scalarToh4(new(big.Int).SetBytes(key))
+	v := new(big.Int).SetBytes(value)
+
+	var (
+		node [hashLen]uint64
+		err  error
+	)
+	switch {
+	case v.Sign() != 0:
+		node, err = hashLeaf(k, scalar2fea(v), nLevels, hashFn)
+		if err != nil {
+			return false, err
+		}
+	case proof.IsOld0:
+		// the path ends in an empty node, whose hash is zero
+	case len(proof.InsKey) != 0:
+		if len(proof.InsKey) != hashLen {
+			return false, fmt.Errorf("%w: InsKey has %d elements, expected %d", ErrInvalidProof, len(proof.InsKey), hashLen)
+		}
+		if len(proof.InsValue) != poseidon.NROUNDSF {
+			return false, fmt.Errorf("%w: InsValue has %d elements, expected %d", ErrInvalidProof, len(proof.InsValue), poseidon.NROUNDSF)
+		}
+		if h4Equal(proof.InsKey, k) {
+			// the key is in the tree, so this can't be a proof of absence
+			return false, nil
+		}
+		for level := 0; level < nLevels; level++ {
+			if keyBit(proof.InsKey, level) != keyBit(k, level) {
+				return false, nil
+			}
+		}
+		node, err = hashLeaf(proof.InsKey, proof.InsValue, nLevels, hashFn)
+		if err != nil {
+			return false, err
+		}
+	default:
+		return false, fmt.Errorf("%w: a proof of absence needs either IsOld0 or InsKey", ErrInvalidProof)
+	}
+
+	for level := nLevels - 1; level >= 0; level-- {
+		var inp [poseidon.NROUNDSF]uint64
+		sibling := proof.Siblings[level]
+		if keyBit(k, level) == 0 {
+			copy(inp[:hashLen], node[:])
+			copy(inp[hashLen:], sibling)
+		} else {
+			copy(inp[:hashLen], sibling)
+			copy(inp[hashLen:], node[:])
+		}
+		node, err = hashFn(inp, [poseidon.CAPLEN]uint64{})
+		if err != nil {
+			return false, err
+		}
+	}
+
+	return h4ToScalar(node[:]).Cmp(new(big.Int).SetBytes(root)) == 0, nil
+}
+
+// hashLeaf computes the hash of a leaf placed at the given level.
+func hashLeaf(key []uint64, value []uint64, level int, hashFn HashFunc) ([hashLen]uint64, error) {
+	var valueInp [poseidon.NROUNDSF]uint64
+	copy(valueInp[:], value)
+	valueHash, err := hashFn(valueInp, [poseidon.CAPLEN]uint64{})
+	if err != nil {
+		return [hashLen]uint64{}, err
+	}
+
+	remainingKey := removeKeyBits(key, level)
+	var inp [poseidon.NROUNDSF]uint64
+	copy(inp[:hashLen], remainingKey)
+	copy(inp[hashLen:], valueHash[:])
+
+	return hashFn(inp, [poseidon.CAPLEN]uint64{1})
+}
+
+// keyBit returns the bit of the key that selects the child at the given level.
+// Bits are taken alternately from each of the key elements.
+func keyBit(key []uint64, level int) uint64 {
+	return (key[level%hashLen] >> uint(level/hashLen)) & 1
+}
+
+// removeKeyBits returns the key without the bits already consumed by the
+// path down to the given level.
+func removeKeyBits(key []uint64, level int) []uint64 {
+	fullLevels := level / hashLen
+	r := make([]uint64, hashLen)
+	for i := 0; i < hashLen; i++ {
+		n := fullLevels
+		if fullLevels*hashLen+i < level {
+			n++
+		}
+		r[i] = key[i] >> uint(n)
+	}
+	return r
+}
+
+func h4Equal(a, b []uint64) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// siblingsFromResponse extracts the sibling of each level of the path of the
+// key from the nodes returned by the hashdb.
+func siblingsFromResponse(key []uint64, siblings map[uint64]*hashdb.SiblingList) [][]uint64 {
+	nodes := make([][]uint64, 0, len(siblings))
+	for level := 0; level < len(siblings); level++ {
+		s, ok := siblings[uint64(level)]
+		if !ok {
+			break
+		}
+		nodes = append(nodes, s.Sibling)
+	}
+	return siblingsFromNodes(key, nodes)
+}
+
+// siblingsFromNodes extracts the sibling of each level of the path of the key
+// from the intermediate nodes of the path. Each node contains the hashes of
+// both children, so the one that isn't in the path is taken.
+func siblingsFromNodes(key []uint64, nodes [][]uint64) [][]uint64 {
+	res := make([][]uint64, 0, len(nodes))
+	for level, node := range nodes {
+		if len(node) < 2*hashLen {
+			return res
+		}
+		if keyBit(key, level) == 0 {
+			res = append(res, node[hashLen:2*hashLen])
+		} else {
+			res = append(res, node[:hashLen])
+		}
+	}
+	return res
+}
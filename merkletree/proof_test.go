@@ -0,0 +1,241 @@
+package merkletree
+
+import (
+	"math/big"
+	"math/rand"
+	"testing"
+
+	poseidon "github.com/iden3/go-iden3-crypto/goldenposeidon"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// testTree is a two levels tree:
+//
+//	     root
+//	    /    \
+//	leafA    node
+//	        /    \
+//	    leafB    leafC
+type testTree struct {
+	root                   []byte
+	keyA, keyB, keyC       []uint64
+	valueA, valueB, valueC *big.Int
+	hashA, hashB, hashC    [hashLen]uint64
+	node                   [hashLen]uint64
+}
+
+func hashNode(t *testing.T, left, right [hashLen]uint64) [hashLen]uint64 {
+	var inp [poseidon.NROUNDSF]uint64
+	copy(inp[:hashLen], left[:])
+	copy(inp[hashLen:], right[:])
+	h, err := poseidon.Hash(inp, [poseidon.CAPLEN]uint64{})
+	require.NoError(t, err)
+	return h
+}
+
+func newTestTree(t *testing.T) *testTree {
+	tt := &testTree{
+		// bit 0 of the path is taken from the lsb of the first element and
+		// bit 1 from the lsb of the second element
+		keyA:   []uint64{0x10, 0x20, 0x30, 0x40},
+		keyB:   []uint64{0x11, 0x20, 0x31, 0x41},
+		keyC:   []uint64{0x11, 0x21, 0x32, 0x42},
+		valueA: big.NewInt(1000),
+		valueB: big.NewInt(2000),
+		valueC: big.NewInt(3000),
+	}
+	var err error
+	tt.hashA, err = hashLeaf(tt.keyA, scalar2fea(tt.valueA), 1, poseidon.Hash)
+	require.NoError(t, err)
+	tt.hashB, err = hashLeaf(tt.keyB, scalar2fea(tt.valueB), 2, poseidon.Hash)
+	require.NoError(t, err)
+	tt.hashC, err = hashLeaf(tt.keyC, scalar2fea(tt.valueC), 2, poseidon.Hash)
+	require.NoError(t, err)
+	tt.node = hashNode(t, tt.hashB, tt.hashC)
+	root := hashNode(t, tt.hashA, tt.node)
+	tt.root = h4ToFilledByteSlice(root[:])
+	return tt
+}
+
+func TestVerifyProofInclusion(t *testing.T) {
+	tt := newTestTree(t)
+
+	tcs := []struct {
+		description string
+		key         []uint64
+		value       *big.Int
+		siblings    [][]uint64
+	}{
+		{
+			description: "leaf in the first level",
+			key:         tt.keyA,
+			value:       tt.valueA,
+			siblings:    [][]uint64{tt.node[:]},
+		},
+		{
+			description: "left leaf in the second level",
+			key:         tt.keyB,
+			value:       tt.valueB,
+			siblings:    [][]uint64{tt.hashA[:], tt.hashC[:]},
+		},
+		{
+			description: "right leaf in the second level",
+			key:         tt.keyC,
+			value:       tt.valueC,
+			siblings:    [][]uint64{tt.hashA[:], tt.hashB[:]},
+		},
+	}
+	for _, tc := range tcs {
+		tc := tc
+		t.Run(tc.description, func(t *testing.T) {
+			proof := &Proof{Siblings: tc.siblings}
+			ok, err := VerifyProof(tt.root, h4ToFilledByteSlice(tc.key), tc.value.Bytes(), proof, DefaultArity, poseidon.Hash)
+			require.NoError(t, err)
+			assert.True(t, ok)
+
+			ok, err = VerifyProof(tt.root, h4ToFilledByteSlice(tc.key), big.NewInt(1).Bytes(), proof, DefaultArity, poseidon.Hash)
+			require.NoError(t, err)
+			assert.False(t, ok)
+		})
+	}
+}
+
+func TestVerifyProofAbsence(t *testing.T) {
+	tt := newTestTree(t)
+
+	t.Run("path ends in a different leaf", func(t *testing.T) {
+		key := []uint64{0x12, 0x22, 0x33, 0x43}
+		proof := &Proof{
+			Siblings: [][]uint64{tt.node[:]},
+			InsKey:   tt.keyA,
+			InsValue: scalar2fea(tt.valueA),
+		}
+		ok, err := VerifyProof(tt.root, h4ToFilledByteSlice(key), nil, proof, DefaultArity, poseidon.Hash)
+		require.NoError(t, err)
+		assert.True(t, ok)
+
+		// the leaf found is the key itself, so it's not absent
+		ok, err = VerifyProof(tt.root, h4ToFilledByteSlice(tt.keyA), nil, proof, DefaultArity, poseidon.Hash)
+		require.NoError(t, err)
+		assert.False(t, ok)
+
+		// the leaf found is not in the path of the key
+		key = []uint64{0x13, 0x22, 0x33, 0x43}
+		ok, err = VerifyProof(tt.root, h4ToFilledByteSlice(key), nil, proof, DefaultArity, poseidon.Hash)
+		require.NoError(t, err)
+		assert.False(t, ok)
+	})
+
+	t.Run("path ends in an empty node", func(t *testing.T) {
+		keyA := []uint64{0x10, 0x20, 0x30, 0x40}
+		leaf, err := hashLeaf(keyA, scalar2fea(big.NewInt(1)), 1, poseidon.Hash)
+		require.NoError(t, err)
+		root := hashNode(t, leaf, [hashLen]uint64{})
+
+		key := []uint64{0x11, 0x20, 0x30, 0x40}
+		proof := &Proof{
+			Siblings: [][]uint64{leaf[:]},
+			IsOld0:   true,
+		}
+		ok, err := VerifyProof(h4ToFilledByteSlice(root[:]), h4ToFilledByteSlice(key), nil, proof, DefaultArity, poseidon.Hash)
+		require.NoError(t, err)
+		assert.True(t, ok)
+
+		ok, err = VerifyProof(h4ToFilledByteSlice(root[:]), h4ToFilledByteSlice(keyA), nil, proof, DefaultArity, poseidon.Hash)
+		require.NoError(t, err)
+		assert.False(t, ok)
+	})
+
+	t.Run("empty tree", func(t *testing.T) {
+		ok, err := VerifyProof(nil, h4ToFilledByteSlice(tt.keyA), nil, &Proof{IsOld0: true}, DefaultArity, poseidon.Hash)
+		require.NoError(t, err)
+		assert.True(t, ok)
+	})
+}
+
+func TestVerifyProofErrors(t *testing.T) {
+	tt := newTestTree(t)
+
+	_, err := VerifyProof(tt.root, h4ToFilledByteSlice(tt.keyA), tt.valueA.Bytes(), nil, DefaultArity, poseidon.Hash)
+	assert.ErrorIs(t, err, ErrInvalidProof)
+
+	proof := &Proof{Siblings: [][]uint64{tt.node[:3]}}
+	_, err = VerifyProof(tt.root, h4ToFilledByteSlice(tt.keyA), tt.valueA.Bytes(), proof, DefaultArity, poseidon.Hash)
+	assert.ErrorIs(t, err, ErrInvalidProof)
+
+	proof = &Proof{Siblings: make([][]uint64, maxLevels+1)}
+	_, err = VerifyProof(tt.root, h4ToFilledByteSlice(tt.keyA), tt.valueA.Bytes(), proof, DefaultArity, poseidon.Hash)
+	assert.ErrorIs(t, err, ErrInvalidProof)
+
+	proof = &Proof{Siblings: [][]uint64{tt.node[:]}}
+	_, err = VerifyProof(tt.root, h4ToFilledByteSlice(tt.keyA), nil, proof, DefaultArity, poseidon.Hash)
+	assert.ErrorIs(t, err, ErrInvalidProof)
+}
+
+func TestVerifyProofTamperedSibling(t *testing.T) {
+	tt := newTestTree(t)
+	siblings := [][]uint64{tt.hashA[:], tt.hashC[:]}
+
+	r := rand.New(rand.NewSource(0)) //nolint:gosec
+	for i := 0; i < 100; i++ {
+		level := r.Intn(len(siblings))
+		element := r.Intn(hashLen)
+		bit := uint(r.Intn(64))
+
+		tampered := make([][]uint64, len(siblings))
+		for l := range siblings {
+			tampered[l] = append([]uint64{}, siblings[l]...)
+		}
+		tampered[level][element] ^= 1 << bit
+
+		ok, err := VerifyProof(tt.root, h4ToFilledByteSlice(tt.keyB), tt.valueB.Bytes(), &Proof{Siblings: tampered}, DefaultArity, poseidon.Hash)
+		require.NoError(t, err)
+		assert.False(t, ok, "level %d, element %d, bit %d", level, element, bit)
+	}
+}
+
+func FuzzVerifyProofTamperedSibling(f *testing.F) {
+	f.Add(uint8(0), uint8(0), uint8(0), uint8(1))
+	f.Add(uint8(1), uint8(3), uint8(7), uint8(0xff))
+	f.Fuzz(func(t *testing.T, level, element, byteIndex, mask uint8) {
+		if mask == 0 {
+			t.Skip()
+		}
+		tt := newTestTree(t)
+		siblings := [][]uint64{append([]uint64{}, tt.hashA[:]...), append([]uint64{}, tt.hashC[:]...)}
+		l := int(level) % len(siblings)
+		e := int(element) % hashLen
+		siblings[l][e] ^= uint64(mask) << (8 * uint(byteIndex%8))
+
+		ok, err := VerifyProof(tt.root, h4ToFilledByteSlice(tt.keyB), tt.valueB.Bytes(), &Proof{Siblings: siblings}, DefaultArity, poseidon.Hash)
+		require.NoError(t, err)
+		assert.False(t, ok)
+	})
+}
+
+func TestValidateArity(t *testing.T) {
+	require.NoError(t, ValidateArity(DefaultArity))
+	for _, arity := range []uint8{0, 1, 3, 4, 16} {
+		assert.ErrorIs(t, ValidateArity(arity), ErrUnsupportedArity, "arity %d", arity)
+	}
+
+	tt := newTestTree(t)
+	_, err := VerifyProof(tt.root, h4ToFilledByteSlice(tt.keyA), tt.valueA.Bytes(), &Proof{}, 4, poseidon.Hash)
+	assert.ErrorIs(t, err, ErrUnsupportedArity)
+}
+
+func TestEmptyRoot(t *testing.T) {
+	root, err := EmptyRoot(DefaultArity, poseidon.Hash)
+	require.NoError(t, err)
+	assert.Equal(t, DefaultEmptyRoot.Bytes(), root)
+
+	_, err = EmptyRoot(4, poseidon.Hash)
+	assert.ErrorIs(t, err, ErrUnsupportedArity)
+}
+
+func TestConfigValidate(t *testing.T) {
+	assert.NoError(t, Config{}.Validate())
+	assert.NoError(t, Config{Arity: DefaultArity}.Validate())
+	assert.ErrorIs(t, Config{Arity: 4}.Validate(), ErrUnsupportedArity)
+}
@@ -0,0 +1,335 @@
+package merkletree
+
+import (
+	"context"
+	"errors"
+	"math/big"
+
+	"github.com/0xPolygonHermez/zkevm-node/merkletree/hashdb"
+	poseidon "github.com/iden3/go-iden3-crypto/goldenposeidon"
+)
+
+// The hashdb service doesn't expose the nodes of the tree, only the proofs of
+// its keys, so the walks below rebuild the subtrees from proofs. The path of
+// the leftmost key of a subtree goes down the left children, so its proof ends
+// in the leftmost leaf of the subtree and holds the hashes of the right
+// children met on the way, which are the subtrees left to walk. A subtree
+// costs a Get per leaf.
+
+// subtreeKey returns the leftmost key of the subtree at the path of the prefix
+// bits.
+func subtreeKey(prefix []uint64) []uint64 {
+	key := make([]uint64, hashLen)
+	for level, bit := range prefix {
+		key[level%hashLen] |= bit << uint(level/hashLen)
+	}
+	return key
+}
+
+// rightPrefix returns the path of the right child of the node at the given
+// level of the path of the leftmost key of the subtree at the prefix.
+func rightPrefix(prefix []uint64, level int) []uint64 {
+	p := make([]uint64, level+1)
+	copy(p, prefix)
+	p[level] = 1
+	return p
+}
+
+// hasPrefix tells whether the path of the key starts with the prefix bits.
+func hasPrefix(key []uint64, prefix []uint64) bool {
+	for level, bit := range prefix {
+		if keyBit(key, level) != bit {
+			return false
+		}
+	}
+	return true
+}
+
+// pathLess tells whether the path of the key a comes before the one of b.
+func pathLess(a, b []uint64) bool {
+	for level := 0; level < maxLevels; level++ {
+		if bitA, bitB := keyBit(a, level), keyBit(b, level); bitA != bitB {
+			return bitA < bitB
+		}
+	}
+	return false
+}
+
+// proofLeaf returns the key and the value of the leaf the path of the proof
+// ends in, a nil key when it ends in an empty node.
+func proofLeaf(proof *Proof) ([]uint64, *big.Int) {
+	if value := fea2scalar(proof.Value); value.Sign() != 0 {
+		return proof.Key, value
+	}
+	if !proof.IsOld0 && len(proof.InsKey) == hashLen {
+		return proof.InsKey, fea2scalar(proof.InsValue)
+	}
+	return nil, nil
+}
+
+// proofWalkLeaves calls fn with the key and the value of every leaf of the
+// subtree at the path of the prefix bits in the tree with the given root, in
+// key path order.
+func (tree *StateTree) proofWalkLeaves(ctx context.Context, root, prefix []uint64, fn func(key []uint64, value *big.Int) error) error {
+	proof, err := tree.get(ctx, root, subtreeKey(prefix))
+	if err != nil {
+		return err
+	}
+	return tree.proofLeaves(ctx, root, prefix, proof, fn)
+}
+
+// proofLeaves is like proofWalkLeaves with the proof of the leftmost key of
+// the subtree already read.
+func (tree *StateTree) proofLeaves(ctx context.Context, root, prefix []uint64, proof *Proof, fn func(key []uint64, value *big.Int) error) error {
+	if key, value := proofLeaf(proof); key != nil && hasPrefix(key, prefix) {
+		if err := fn(key, value); err != nil {
+			return err
+		}
+	}
+	for level := len(proof.Siblings) - 1; level >= len(prefix); level-- {
+		if isZeroH4(proof.Siblings[level]) {
+			continue
+		}
+		if err := tree.proofWalkLeaves(ctx, root, rightPrefix(prefix, level), fn); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// proofDiffLeaves calls fn with the key and both values of every leaf that
+// differs between the subtrees at the path of the prefix bits of the trees
+// with the given roots, whose hashes are hashA and hashB, in key path order.
+// Both paths of the leftmost key go down the left children until one of them
+// ends, the right children met on the way are compared by hash and only the
+// ones that differ are walked.
+func (tree *StateTree) proofDiffLeaves(ctx context.Context, rootA, rootB, prefix, hashA, hashB []uint64, fn func(key []uint64, valueA, valueB *big.Int) error) error {
+	if h4Equal(hashA, hashB) {
+		return nil
+	}
+	zero := big.NewInt(0)
+	if isZeroH4(hashA) {
+		return tree.proofWalkLeaves(ctx, rootB, prefix, func(key []uint64, value *big.Int) error {
+			return fn(key, zero, value)
+		})
+	}
+	if isZeroH4(hashB) {
+		return tree.proofWalkLeaves(ctx, rootA, prefix, func(key []uint64, value *big.Int) error {
+			return fn(key, value, zero)
+		})
+	}
+
+	key := subtreeKey(prefix)
+	proofA, err := tree.get(ctx, rootA, key)
+	if err != nil {
+		return err
+	}
+	proofB, err := tree.get(ctx, rootB, key)
+	if err != nil {
+		return err
+	}
+
+	// below the level where the first path ends, that tree has at most one
+	// leaf, which is compared against the leaves of the other one
+	depth := len(proofA.Siblings)
+	if len(proofB.Siblings) < depth {
+		depth = len(proofB.Siblings)
+	}
+	if depth < len(prefix) {
+		depth = len(prefix)
+	}
+	sub := make([]uint64, depth)
+	copy(sub, prefix)
+	if len(proofA.Siblings) == depth {
+		err = tree.proofDiffLeaf(ctx, rootB, sub, proofA, proofB, func(key []uint64, leafValue, value *big.Int) error {
+			return fn(key, leafValue, value)
+		})
+	} else {
+		err = tree.proofDiffLeaf(ctx, rootA, sub, proofB, proofA, func(key []uint64, leafValue, value *big.Int) error {
+			return fn(key, value, leafValue)
+		})
+	}
+	if err != nil {
+		return err
+	}
+
+	for level := depth - 1; level >= len(prefix); level-- {
+		if err := tree.proofDiffLeaves(ctx, rootA, rootB, rightPrefix(prefix, level), proofA.Siblings[level], proofB.Siblings[level], fn); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// proofDiffLeaf compares the leaf the path of leafProof ends in, if it's
+// under the prefix, against the leaves of the subtree at the prefix of the
+// tree with the given root, whose leftmost key has the given proof. It calls fn
+// with the value of the leaf and the value in the subtree of every key that
+// differs, in key path order.
+func (tree *StateTree) proofDiffLeaf(ctx context.Context, root, prefix []uint64, leafProof, proof *Proof, fn func(key []uint64, leafValue, value *big.Int) error) error {
+	leafKey, leafValue := proofLeaf(leafProof)
+	if leafKey != nil && !hasPrefix(leafKey, prefix) {
+		leafKey = nil
+	}
+
+	zero := big.NewInt(0)
+	err := tree.proofLeaves(ctx, root, prefix, proof, func(key []uint64, value *big.Int) error {
+		if leafKey != nil && pathLess(leafKey, key) {
+			// the leaf isn't in the subtree
+			if err := fn(leafKey, leafValue, zero); err != nil {
+				return err
+			}
+			leafKey = nil
+		}
+		if leafKey == nil || !h4Equal(key, leafKey) {
+			return fn(key, zero, value)
+		}
+		same := value.Cmp(leafValue) == 0
+		leafKey = nil
+		if same {
+			return nil
+		}
+		return fn(key, leafValue, value)
+	})
+	if err != nil {
+		return err
+	}
+	if leafKey != nil {
+		return fn(leafKey, leafValue, zero)
+	}
+	return nil
+}
+
+// proofStats counts the nodes and the leaves of the tree with the given root
+// from the proofs of the leftmost keys of its subtrees. The intermediate nodes
+// of the path of a proof below the prefix of its subtree haven't been met by
+// the proofs of the enclosing subtrees, which only hold their hashes as
+// siblings, so each node is counted once.
+func (tree *StateTree) proofStats(ctx context.Context, root []uint64) (TreeStats, error) {
+	var (
+		stats     TreeStats
+		depthsSum uint64
+	)
+	var walk func(prefix []uint64) error
+	walk = func(prefix []uint64) error {
+		proof, err := tree.get(ctx, root, subtreeKey(prefix))
+		if err != nil {
+			return err
+		}
+		depth := len(proof.Siblings)
+		if depth > len(prefix) {
+			stats.NodeCount += uint64(depth - len(prefix))
+		}
+		if key, _ := proofLeaf(proof); key != nil && hasPrefix(key, prefix) {
+			stats.NodeCount++
+			stats.LeafCount++
+			depthsSum += uint64(depth)
+			if uint64(depth) > stats.MaxDepth {
+				stats.MaxDepth = uint64(depth)
+			}
+		}
+		for level := depth - 1; level >= len(prefix); level-- {
+			if isZeroH4(proof.Siblings[level]) {
+				continue
+			}
+			if err := walk(rightPrefix(prefix, level)); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	if isZeroH4(root) {
+		return stats, nil
+	}
+	if err := walk(nil); err != nil {
+		return TreeStats{}, err
+	}
+	if stats.LeafCount > 0 {
+		stats.AvgPathLength = float64(depthsSum) / float64(stats.LeafCount)
+	}
+	return stats, nil
+}
+
+// proofVerify recomputes the hashes of the nodes of the tree with the given
+// root from the proofs of the leftmost keys of its subtrees. The path of a
+// proof is hashed from its leaf up to the root of its subtree, which must match
+// the hash its parent holds: then the hashes of the nodes of the path are
+// right and are the parents of the siblings, the subtrees left to check.
+// Otherwise the subtree is reported as corrupted and isn't walked further, the
+// subtrees whose proof can't be read are reported as missing.
+func (tree *StateTree) proofVerify(ctx context.Context, root []uint64) (*VerifyReport, error) {
+	report := &VerifyReport{}
+	var check func(prefix, hash, parent []uint64) error
+	check = func(prefix, hash, parent []uint64) error {
+		ref := NodeRef{Hash: hash, Parent: parent}
+		key := subtreeKey(prefix)
+		resp, err := tree.getResponse(ctx, root, key)
+		if errors.Is(err, ErrNodeNotFound) || (err == nil && resp.Result.GetCode() == hashdb.ResultCode_CODE_DB_KEY_NOT_FOUND) {
+			report.Missing = append(report.Missing, ref)
+			return nil
+		} else if err != nil {
+			return err
+		}
+		proof, err := proofFromResponse(root, key, resp)
+		if err != nil {
+			return err
+		}
+		depth := len(proof.Siblings)
+		if depth < len(prefix) {
+			report.Corrupted = append(report.Corrupted, ref)
+			return nil
+		}
+
+		// path holds the hashes of the nodes of the path by level
+		path := make([][]uint64, depth+1)
+		var node [hashLen]uint64
+		leafKey, _ := proofLeaf(proof)
+		if leafKey != nil {
+			value := proof.Value
+			if !h4Equal(leafKey, proof.Key) {
+				value = proof.InsValue
+			}
+			node, err = hashLeaf(leafKey, value, depth, tree.hashFn)
+			if err != nil {
+				return err
+			}
+		}
+		path[depth] = append([]uint64{}, node[:]...)
+		for level := depth - 1; level >= len(prefix); level-- {
+			var inp [poseidon.NROUNDSF]uint64
+			copy(inp[:hashLen], node[:])
+			copy(inp[hashLen:], proof.Siblings[level])
+			node, err = tree.hashFn(inp, [poseidon.CAPLEN]uint64{})
+			if err != nil {
+				return err
+			}
+			path[level] = append([]uint64{}, node[:]...)
+		}
+		if !h4Equal(path[len(prefix)], hash) {
+			report.Corrupted = append(report.Corrupted, ref)
+			return nil
+		}
+
+		// the intermediate nodes of the path, the leaf and its value
+		report.NodeCount += uint64(depth - len(prefix))
+		if leafKey != nil {
+			report.NodeCount += 2
+		}
+		for level := depth - 1; level >= len(prefix); level-- {
+			if isZeroH4(proof.Siblings[level]) {
+				continue
+			}
+			if err := check(rightPrefix(prefix, level), proof.Siblings[level], path[level]); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	if isZeroH4(root) {
+		return report, nil
+	}
+	if err := check(nil, root, nil); err != nil {
+		return nil, err
+	}
+	return report, nil
+}
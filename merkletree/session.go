@@ -0,0 +1,217 @@
+package merkletree
+
+import (
+	"context"
+	"fmt"
+	"math/big"
+	"sync"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// Session is a handle on a StateTree with its own working root and its own
+// stack of snapshots, e.g. for the execution of a batch. The writes done
+// through a session only move its working root, so the snapshots and the
+// rollbacks of a session don't affect the other sessions, the units of work
+// of WithTx nor the bare writes to the tree. The writes of a session are
+// serialized, each writer should open its own.
+//
+// A snapshot only records the working root, so taking one and rolling back to
+// it are cheap. The nodes written after a snapshot that is rolled back are
+// left unreferenced by the session: with LocalHashDBClient they are deleted
+// by the next GC, which only keeps the roots it's given and the ones of the
+// open sessions; the hashdb service keeps them in the batch of the uuid of the
+// session, along with its other writes, and manages its own storage.
+type Session struct {
+	tree *StateTree
+	uuid string
+
+	mu             sync.Mutex
+	root           []uint64
+	snapshots      []sessionSnapshot
+	nextSnapshotID int64
+}
+
+// sessionSnapshot is the working root of a session at the moment the snapshot
+// was taken.
+type sessionSnapshot struct {
+	id   int64
+	root []uint64
+}
+
+// NewSession opens a session whose working root starts at root and whose
+// writes use the given uuid. The session must be closed once it's no longer
+// used, so GC stops keeping its roots.
+func (tree *StateTree) NewSession(root []byte, uuid string) *Session {
+	s := &Session{
+		tree: tree,
+		uuid: uuid,
+		root: scalarToh4(new(big.Int).SetBytes(root)),
+	}
+
+	tree.mu.Lock()
+	defer tree.mu.Unlock()
+	if tree.sessions == nil {
+		tree.sessions = make(map[*Session]struct{})
+	}
+	tree.sessions[s] = struct{}{}
+
+	return s
+}
+
+// Close closes the session, its working root and its snapshots are no longer
+// kept by GC.
+func (s *Session) Close() {
+	s.tree.mu.Lock()
+	defer s.tree.mu.Unlock()
+
+	delete(s.tree.sessions, s)
+}
+
+// UUID returns the uuid used by the writes of the session.
+func (s *Session) UUID() string {
+	return s.uuid
+}
+
+// Root returns the working root of the session, the root resulting from its
+// last write or the one restored by its last rollback.
+func (s *Session) Root() []byte {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return h4ToFilledByteSlice(s.root)
+}
+
+// Set sets the value of the leaf with the given key, which is already hashed,
+// on top of the working root of the session, see StateTree.Set.
+func (s *Session) Set(ctx context.Context, key []byte, value *big.Int) error {
+	return s.update(func(root []byte) ([]byte, error) {
+		return s.tree.Set(ctx, root, key, value, s.uuid)
+	})
+}
+
+// SetBalance sets the balance of the address on top of the working root of
+// the session.
+func (s *Session) SetBalance(ctx context.Context, address common.Address, balance *big.Int) error {
+	return s.update(func(root []byte) ([]byte, error) {
+		newRoot, _, err := s.tree.SetBalance(ctx, address, balance, root, s.uuid)
+		return newRoot, err
+	})
+}
+
+// SetNonce sets the nonce of the address on top of the working root of the
+// session.
+func (s *Session) SetNonce(ctx context.Context, address common.Address, nonce *big.Int) error {
+	return s.update(func(root []byte) ([]byte, error) {
+		newRoot, _, err := s.tree.SetNonce(ctx, address, nonce, root, s.uuid)
+		return newRoot, err
+	})
+}
+
+// SetCode sets the code of the address on top of the working root of the
+// session.
+func (s *Session) SetCode(ctx context.Context, address common.Address, code []byte) error {
+	return s.update(func(root []byte) ([]byte, error) {
+		newRoot, _, err := s.tree.SetCode(ctx, address, code, root, s.uuid)
+		return newRoot, err
+	})
+}
+
+// SetStorageAt sets the value of the storage slot of the address at the given
+// position on top of the working root of the session.
+func (s *Session) SetStorageAt(ctx context.Context, address common.Address, position *big.Int, value *big.Int) error {
+	return s.update(func(root []byte) ([]byte, error) {
+		newRoot, _, err := s.tree.SetStorageAt(ctx, address, position, value, root, s.uuid)
+		return newRoot, err
+	})
+}
+
+// Flush flushes the writes of the session up to its working root.
+func (s *Session) Flush(ctx context.Context) error {
+	return s.tree.Flush(ctx, common.BytesToHash(s.Root()), s.uuid)
+}
+
+// update applies the write on top of the working root of the session and
+// moves the working root to the resulting root. The session is locked during
+// the write, so GC doesn't run until the working root holds its nodes.
+func (s *Session) update(write func(root []byte) ([]byte, error)) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	newRoot, err := write(h4ToFilledByteSlice(s.root))
+	if err != nil {
+		return err
+	}
+	s.root = scalarToh4(new(big.Int).SetBytes(newRoot))
+
+	return nil
+}
+
+// Snapshot records the working root of the session and returns an id that can
+// be used to roll back to it. Snapshots can be nested.
+func (s *Session) Snapshot() (id int64, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.nextSnapshotID++
+	s.snapshots = append(s.snapshots, sessionSnapshot{
+		id:   s.nextSnapshotID,
+		root: s.root,
+	})
+
+	return s.nextSnapshotID, nil
+}
+
+// RollbackToSnapshot restores the working root recorded by the given snapshot
+// of the session. The snapshot is kept, so it can be rolled back to again,
+// but the snapshots of the session nested in it, i.e. taken after it, are
+// discarded. ErrSnapshotNotFound is returned for an unknown, released or
+// discarded snapshot.
+func (s *Session) RollbackToSnapshot(id int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	i, err := s.findSnapshot(id)
+	if err != nil {
+		return err
+	}
+	s.root = s.snapshots[i].root
+	s.snapshots = s.snapshots[:i+1]
+
+	return nil
+}
+
+// ReleaseSnapshot discards the given snapshot of the session, keeping the
+// working root and the other snapshots.
+func (s *Session) ReleaseSnapshot(id int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	i, err := s.findSnapshot(id)
+	if err != nil {
+		return err
+	}
+	s.snapshots = append(s.snapshots[:i], s.snapshots[i+1:]...)
+
+	return nil
+}
+
+// roots returns the working root of the session and the roots of its
+// snapshots. The session must be locked.
+func (s *Session) roots() [][]uint64 {
+	roots := make([][]uint64, 0, len(s.snapshots)+1)
+	roots = append(roots, s.root)
+	for _, snapshot := range s.snapshots {
+		roots = append(roots, snapshot.root)
+	}
+	return roots
+}
+
+func (s *Session) findSnapshot(id int64) (int, error) {
+	for i := len(s.snapshots) - 1; i >= 0; i-- {
+		if s.snapshots[i].id == id {
+			return i, nil
+		}
+	}
+	return 0, fmt.Errorf("%w: %d", ErrSnapshotNotFound, id)
+}
@@ -0,0 +1,902 @@
+package merkletree
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/big"
+
+	poseidon "github.com/iden3/go-iden3-crypto/goldenposeidon"
+)
+
+// nodeLen is the number of field elements of a stored node: the 8 hashed
+// elements followed by the 4 capacity elements.
+const nodeLen = poseidon.NROUNDSF + poseidon.CAPLEN
+
+var (
+	// ErrNodeNotFound is returned by a Store when the requested node doesn't
+	// exist.
+	ErrNodeNotFound = errors.New("node not found")
+)
+
+// Store is the storage of the nodes of the sparse merkle tree. Nodes are
+// indexed by their hash and are made of nodeLen field elements.
+type Store interface {
+	// Get returns the node with the given hash or ErrNodeNotFound.
+	Get(ctx context.Context, hash []uint64) ([]uint64, error)
+	// Set stores the node with the given hash.
+	Set(ctx context.Context, hash []uint64, node []uint64) error
+}
+
+// BatchStore is a Store able to fetch many nodes in a single round-trip, e.g.
+// pgtreestorage.PostgresStore. The stores only back the trees of a
+// LocalHashDBClient, which fetches the nodes of each level together when
+// reading many keys, see smt.getMany. The trees of the node are kept by the
+// hashdb service, which reads its own nodes.
+type BatchStore interface {
+	Store
+	// GetNodes returns the nodes with the given hashes indexed by the string
+	// representation of their hash. Missing nodes are not included.
+	GetNodes(ctx context.Context, hashes [][]uint64) (map[string][]uint64, error)
+}
+
+// SweepStore is a Store able to delete nodes, which is needed to collect the
+// nodes no longer referenced, see StateTree.GC.
+type SweepStore interface {
+	Store
+	// DeleteExcept deletes every node whose hash is not in keep, indexed by
+	// the string representation of the hash, and returns the number of
+	// deleted nodes.
+	DeleteExcept(ctx context.Context, keep map[string]struct{}) (int, error)
+}
+
+// smt implements the sparse merkle tree used by the prover on top of a Store,
+// following the same node layout:
+// value: [value[0], ..., value[7]], [0, 0, 0, 0]
+// leaf: [remainingKey[0:4], valueHash[0:4]], [1, 0, 0, 0]
+// intermediate: [left[0:4], right[0:4]], [0, 0, 0, 0]
+type smt struct {
+	store  Store
+	hashFn HashFunc
+}
+
+// smtGetResult is the result of a get operation.
+type smtGetResult struct {
+	value    *big.Int
+	siblings [][]uint64
+	insKey   []uint64
+	insValue *big.Int
+	isOld0   bool
+}
+
+// smtSetResult is the result of a set operation.
+type smtSetResult struct {
+	newRoot  []uint64
+	oldValue *big.Int
+	insKey   []uint64
+	insValue *big.Int
+	isOld0   bool
+	mode     string
+}
+
+func newSMT(store Store, hashFn HashFunc) *smt {
+	if hashFn == nil {
+		hashFn = poseidon.Hash
+	}
+	return &smt{store: store, hashFn: hashFn}
+}
+
+// get returns the value of the key in the tree with the given root along with
+// the siblings of the path.
+func (t *smt) get(ctx context.Context, root, key []uint64) (*smtGetResult, error) {
+	res, err := t.getMany(ctx, root, [][]uint64{key})
+	if err != nil {
+		return nil, err
+	}
+	return res[0], nil
+}
+
+// pathWalk is the state of the walk down the path of a key in getMany.
+type pathWalk struct {
+	key      []uint64
+	r        []uint64
+	level    int
+	accKey   []uint64
+	siblings [][]uint64
+	// leaf is set once the walk reaches a leaf, r is then the hash of its
+	// value node
+	leaf []uint64
+	res  *smtGetResult
+}
+
+// getMany returns the values of the keys in the tree with the given root along
+// with the siblings of their paths, in the same order. The paths are walked
+// level by level and the nodes of each level are fetched together, so with a
+// BatchStore the number of round-trips depends on the depth of the tree and
+// not on the number of keys. The nodes of a single path depend on each other,
+// so they can't be fetched at once.
+func (t *smt) getMany(ctx context.Context, root []uint64, keys [][]uint64) ([]*smtGetResult, error) {
+	walks := make([]*pathWalk, len(keys))
+	for i, key := range keys {
+		walks[i] = &pathWalk{key: key, r: root}
+	}
+
+	for {
+		var (
+			pending []*pathWalk
+			hashes  [][]uint64
+			seen    = make(map[string]bool)
+		)
+		for _, w := range walks {
+			if w.res != nil {
+				continue
+			}
+			if isZeroH4(w.r) {
+				w.res = &smtGetResult{value: big.NewInt(0), siblings: w.siblings, isOld0: true}
+				continue
+			}
+			pending = append(pending, w)
+			if h := H4ToString(w.r); !seen[h] {
+				seen[h] = true
+				hashes = append(hashes, w.r)
+			}
+		}
+		if len(pending) == 0 {
+			break
+		}
+
+		nodes, err := t.getNodes(ctx, hashes)
+		if err != nil {
+			return nil, err
+		}
+		for _, w := range pending {
+			node := nodes[H4ToString(w.r)]
+			if w.leaf != nil {
+				w.res = pathResult(w, fea2scalar(node[:poseidon.NROUNDSF]))
+				continue
+			}
+			if isLeafNode(node) {
+				w.leaf = node
+				w.r = node[hashLen : 2*hashLen]
+				continue
+			}
+			w.siblings = append(w.siblings, node)
+			bit := keyBit(w.key, w.level)
+			w.r = node[bit*hashLen : (bit+1)*hashLen]
+			w.accKey = append(w.accKey, bit)
+			w.level++
+		}
+	}
+
+	res := make([]*smtGetResult, len(walks))
+	for i, w := range walks {
+		res[i] = w.res
+	}
+	return res, nil
+}
+
+// pathResult builds the result of a walk that ended in a leaf with the given
+// value.
+func pathResult(w *pathWalk, value *big.Int) *smtGetResult {
+	res := &smtGetResult{value: big.NewInt(0), siblings: w.siblings, isOld0: true}
+	foundKey := joinKey(w.accKey, w.leaf[:hashLen])
+	if h4Equal(w.key, foundKey) {
+		res.value = value
+	} else {
+		res.insKey = foundKey
+		res.insValue = value
+		res.isOld0 = false
+	}
+	return res
+}
+
+// set sets the value of the key in the tree with the given root and returns
+// the new root. A zero value removes the leaf.
+func (t *smt) set(ctx context.Context, oldRoot, key []uint64, value *big.Int) (*smtSetResult, error) {
+	var (
+		r              = oldRoot
+		level          = 0
+		accKey         []uint64
+		foundKey       []uint64
+		foundRKey      []uint64
+		foundValueHash []uint64
+		foundVal       *big.Int
+		siblings       [][]uint64
+	)
+	res := &smtSetResult{
+		newRoot:  oldRoot,
+		oldValue: big.NewInt(0),
+		isOld0:   true,
+	}
+
+	for !isZeroH4(r) && foundKey == nil {
+		node, err := t.getNode(ctx, r)
+		if err != nil {
+			return nil, err
+		}
+		siblings = append(siblings, node)
+		if isLeafNode(node) {
+			foundRKey = node[:hashLen]
+			foundKey = joinKey(accKey, foundRKey)
+			foundValueHash = node[hashLen : 2*hashLen]
+			foundVal, err = t.getValue(ctx, foundValueHash)
+			if err != nil {
+				return nil, err
+			}
+		} else {
+			bit := keyBit(key, level)
+			r = node[bit*hashLen : (bit+1)*hashLen]
+			accKey = append(accKey, bit)
+			level++
+		}
+	}
+	level--
+	if len(accKey) > 0 {
+		accKey = accKey[:len(accKey)-1]
+	}
+
+	if value.Sign() != 0 {
+		switch {
+		case foundKey != nil && h4Equal(key, foundKey):
+			res.mode = "update"
+			res.oldValue = foundVal
+			newLeaf, err := t.saveLeaf(ctx, foundRKey, value)
+			if err != nil {
+				return nil, err
+			}
+			if level >= 0 {
+				setChild(siblings[level], keyBit(key, level), newLeaf[:])
+			} else {
+				res.newRoot = newLeaf[:]
+			}
+		case foundKey != nil:
+			res.mode = "insertFound"
+			res.insKey = foundKey
+			res.insValue = foundVal
+			res.isOld0 = false
+
+			level2 := level + 1
+			for keyBit(key, level2) == keyBit(foundKey, level2) {
+				level2++
+			}
+
+			oldKey := removeKeyBits(foundKey, level2+1)
+			oldLeaf, err := t.hashSave(ctx, concatH4(oldKey, foundValueHash), [poseidon.CAPLEN]uint64{1})
+			if err != nil {
+				return nil, err
+			}
+			newLeaf, err := t.saveLeaf(ctx, removeKeyBits(key, level2+1), value)
+			if err != nil {
+				return nil, err
+			}
+
+			node := make([]uint64, nodeLen)
+			setChild(node, keyBit(key, level2), newLeaf[:])
+			setChild(node, keyBit(foundKey, level2), oldLeaf[:])
+			r2, err := t.hashSave(ctx, toHashInput(node), [poseidon.CAPLEN]uint64{})
+			if err != nil {
+				return nil, err
+			}
+			level2--
+
+			for level2 != level {
+				node = make([]uint64, nodeLen)
+				setChild(node, keyBit(key, level2), r2[:])
+				r2, err = t.hashSave(ctx, toHashInput(node), [poseidon.CAPLEN]uint64{})
+				if err != nil {
+					return nil, err
+				}
+				level2--
+			}
+
+			if level >= 0 {
+				setChild(siblings[level], keyBit(key, level), r2[:])
+			} else {
+				res.newRoot = r2[:]
+			}
+		default:
+			res.mode = "insertNotFound"
+			newLeaf, err := t.saveLeaf(ctx, removeKeyBits(key, level+1), value)
+			if err != nil {
+				return nil, err
+			}
+			if level >= 0 {
+				setChild(siblings[level], keyBit(key, level), newLeaf[:])
+			} else {
+				res.newRoot = newLeaf[:]
+			}
+		}
+	} else if foundKey != nil && h4Equal(key, foundKey) {
+		res.oldValue = foundVal
+		if level >= 0 {
+			setChild(siblings[level], keyBit(key, level), make([]uint64, hashLen))
+
+			uKey := uniqueSibling(siblings[level])
+			res.mode = "deleteNotFound"
+			if uKey >= 0 {
+				sibling, err := t.getNode(ctx, siblings[level][uKey*hashLen:(uKey+1)*hashLen])
+				if err != nil {
+					return nil, err
+				}
+				if isLeafNode(sibling) {
+					// the remaining leaf goes up until it finds a node with
+					// another child
+					res.mode = "deleteFound"
+					valueHash := sibling[hashLen : 2*hashLen]
+					res.insKey = joinKey(append(accKey, uint64(uKey)), sibling[:hashLen])
+					res.insValue, err = t.getValue(ctx, valueHash)
+					if err != nil {
+						return nil, err
+					}
+					res.isOld0 = false
+
+					for uKey >= 0 && level >= 0 {
+						level--
+						if level >= 0 {
+							uKey = uniqueSibling(siblings[level])
+						}
+					}
+
+					oldKey := removeKeyBits(res.insKey, level+1)
+					oldLeaf, err := t.hashSave(ctx, concatH4(oldKey, valueHash), [poseidon.CAPLEN]uint64{1})
+					if err != nil {
+						return nil, err
+					}
+					if level >= 0 {
+						setChild(siblings[level], keyBit(key, level), oldLeaf[:])
+					} else {
+						res.newRoot = oldLeaf[:]
+					}
+				}
+			}
+		} else {
+			res.mode = "deleteLast"
+			res.newRoot = make([]uint64, hashLen)
+		}
+	} else {
+		res.mode = "zeroToZero"
+		if foundKey != nil {
+			res.insKey = foundKey
+			res.insValue = foundVal
+			res.isOld0 = false
+		}
+	}
+
+	siblings = siblings[:level+1]
+	for level >= 0 {
+		newRoot, err := t.hashSave(ctx, toHashInput(siblings[level]), toCapacity(siblings[level]))
+		if err != nil {
+			return nil, err
+		}
+		res.newRoot = newRoot[:]
+		level--
+		if level >= 0 {
+			setChild(siblings[level], keyBit(key, level), newRoot[:])
+		}
+	}
+
+	return res, nil
+}
+
+// setMany sets the values of the keys in the tree with the given root and
+// returns the new root, like calling set for each key in order. When the root
+// is empty the tree is built bottom up, so every node is hashed and stored
+// once instead of once per key inserted below it.
+func (t *smt) setMany(ctx context.Context, root []uint64, keys [][]uint64, values []*big.Int) ([]uint64, error) {
+	if !isZeroH4(root) {
+		for i, key := range keys {
+			res, err := t.set(ctx, root, key, values[i])
+			if err != nil {
+				return nil, err
+			}
+			root = res.newRoot
+		}
+		return root, nil
+	}
+
+	// like set, the last value of a key wins and a zero value removes it
+	last := make(map[[hashLen]uint64]int, len(keys))
+	for i, key := range keys {
+		last[[hashLen]uint64(key)] = i
+	}
+	leaves := make([]smtLeaf, 0, len(last))
+	for _, i := range last {
+		if values[i].Sign() != 0 {
+			leaves = append(leaves, smtLeaf{key: keys[i], value: values[i]})
+		}
+	}
+	newRoot, err := t.build(ctx, leaves, 0)
+	if err != nil {
+		return nil, err
+	}
+	return newRoot[:], nil
+}
+
+// smtLeaf is a leaf of the tree built by smt.build.
+type smtLeaf struct {
+	key   []uint64
+	value *big.Int
+}
+
+// build stores the subtree holding the given leaves, whose keys share the
+// bits of the path down to the given level, and returns its hash. The leaves
+// are reordered.
+func (t *smt) build(ctx context.Context, leaves []smtLeaf, level int) ([hashLen]uint64, error) {
+	switch len(leaves) {
+	case 0:
+		return [hashLen]uint64{}, nil
+	case 1:
+		return t.saveLeaf(ctx, removeKeyBits(leaves[0].key, level), leaves[0].value)
+	}
+
+	left := 0
+	for i := range leaves {
+		if keyBit(leaves[i].key, level) == 0 {
+			leaves[left], leaves[i] = leaves[i], leaves[left]
+			left++
+		}
+	}
+	node := make([]uint64, nodeLen)
+	for bit, children := range [][]smtLeaf{leaves[:left], leaves[left:]} {
+		child, err := t.build(ctx, children, level+1)
+		if err != nil {
+			return [hashLen]uint64{}, err
+		}
+		setChild(node, uint64(bit), child[:])
+	}
+	return t.hashSave(ctx, toHashInput(node), [poseidon.CAPLEN]uint64{})
+}
+
+// walkLeaves calls fn with the key and the value of every leaf of the tree with
+// the given root, in key path order. The walk is depth first, so only the
+// nodes of the current path are kept in memory.
+func (t *smt) walkLeaves(ctx context.Context, root []uint64, fn func(key []uint64, value *big.Int) error) error {
+	return t.walkNode(ctx, root, nil, fn)
+}
+
+func (t *smt) walkNode(ctx context.Context, hash []uint64, accKey []uint64, fn func(key []uint64, value *big.Int) error) error {
+	if isZeroH4(hash) {
+		return nil
+	}
+	node, err := t.getNode(ctx, hash)
+	if err != nil {
+		return err
+	}
+	if isLeafNode(node) {
+		value, err := t.getValue(ctx, node[hashLen:2*hashLen])
+		if err != nil {
+			return err
+		}
+		return fn(joinKey(accKey, node[:hashLen]), value)
+	}
+	for bit := uint64(0); bit < poseidon.NROUNDSF/hashLen; bit++ {
+		childKey := append(append(make([]uint64, 0, len(accKey)+1), accKey...), bit)
+		if err := t.walkNode(ctx, node[bit*hashLen:(bit+1)*hashLen], childKey, fn); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// walkPrefix calls fn with the key and the value of every leaf of the tree
+// with the given root whose path starts with the prefix bits, in key path
+// order. Only the nodes of the path to the prefix and of the subtree below it
+// are read.
+func (t *smt) walkPrefix(ctx context.Context, root []uint64, prefix []uint64, fn func(key []uint64, value *big.Int) error) error {
+	hash := root
+	for level, bit := range prefix {
+		if isZeroH4(hash) {
+			return nil
+		}
+		node, err := t.getNode(ctx, hash)
+		if err != nil {
+			return err
+		}
+		if isLeafNode(node) {
+			// the leaf holds the only key below this node, it's under the
+			// prefix when the rest of its path matches
+			key := joinKey(prefix[:level], node[:hashLen])
+			for l := level; l < len(prefix); l++ {
+				if keyBit(key, l) != prefix[l] {
+					return nil
+				}
+			}
+			value, err := t.getValue(ctx, node[hashLen:2*hashLen])
+			if err != nil {
+				return err
+			}
+			return fn(key, value)
+		}
+		hash = node[bit*hashLen : (bit+1)*hashLen]
+	}
+	return t.walkNode(ctx, hash, prefix, fn)
+}
+
+// stats counts the nodes and the leaves of the tree with the given root. The
+// store holds the nodes of every root, so the nodes of the tree can only be
+// told apart by walking it. The values of the leaves are not read.
+func (t *smt) stats(ctx context.Context, root []uint64) (TreeStats, error) {
+	var (
+		stats     TreeStats
+		depthsSum uint64
+	)
+	var walk func(hash []uint64, depth uint64) error
+	walk = func(hash []uint64, depth uint64) error {
+		if isZeroH4(hash) {
+			return nil
+		}
+		node, err := t.getNode(ctx, hash)
+		if err != nil {
+			return err
+		}
+		stats.NodeCount++
+		if isLeafNode(node) {
+			stats.LeafCount++
+			depthsSum += depth
+			if depth > stats.MaxDepth {
+				stats.MaxDepth = depth
+			}
+			return nil
+		}
+		for bit := uint64(0); bit < poseidon.NROUNDSF/hashLen; bit++ {
+			if err := walk(node[bit*hashLen:(bit+1)*hashLen], depth+1); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	if err := walk(root, 0); err != nil {
+		return TreeStats{}, err
+	}
+	if stats.LeafCount > 0 {
+		stats.AvgPathLength = float64(depthsSum) / float64(stats.LeafCount)
+	}
+	return stats, nil
+}
+
+// verify walks the tree with the given root recomputing the hash of every
+// node, including the values of the leaves, and reports the nodes whose
+// content doesn't match their hash and the nodes that are referenced but
+// missing from the store.
+func (t *smt) verify(ctx context.Context, root []uint64) (*VerifyReport, error) {
+	report := &VerifyReport{}
+	// isValue tells whether the node holds the value of a leaf
+	var check func(hash, parent []uint64, isValue bool) error
+	check = func(hash, parent []uint64, isValue bool) error {
+		if isZeroH4(hash) {
+			return nil
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		ref := NodeRef{Hash: hash, Parent: parent}
+		node, err := t.store.Get(ctx, hash)
+		if errors.Is(err, ErrNodeNotFound) {
+			report.Missing = append(report.Missing, ref)
+			return nil
+		} else if err != nil {
+			return fmt.Errorf("failed to get node %s: %w", H4ToString(hash), err)
+		}
+		report.NodeCount++
+
+		if len(node) != nodeLen {
+			report.Corrupted = append(report.Corrupted, ref)
+			return nil
+		}
+		h, err := t.hashFn([poseidon.NROUNDSF]uint64(node[:poseidon.NROUNDSF]), [poseidon.CAPLEN]uint64(node[poseidon.NROUNDSF:]))
+		if err != nil {
+			return err
+		}
+		if !h4Equal(h[:], hash) {
+			report.Corrupted = append(report.Corrupted, ref)
+			return nil
+		}
+
+		switch {
+		case isValue:
+			return nil
+		case isLeafNode(node):
+			return check(node[hashLen:2*hashLen], hash, true)
+		}
+		for bit := uint64(0); bit < poseidon.NROUNDSF/hashLen; bit++ {
+			if err := check(node[bit*hashLen:(bit+1)*hashLen], hash, false); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	if err := check(root, nil, false); err != nil {
+		return nil, err
+	}
+	return report, nil
+}
+
+// mark adds to marked the hashes of the nodes of the tree with the given root,
+// including the value nodes of the leaves. The subtrees whose root is already
+// marked are skipped, so the trees of several roots sharing most of their
+// nodes are only walked once.
+func (t *smt) mark(ctx context.Context, root []uint64, marked map[string]struct{}) error {
+	if isZeroH4(root) {
+		return nil
+	}
+	h := H4ToString(root)
+	if _, found := marked[h]; found {
+		return nil
+	}
+	node, err := t.getNode(ctx, root)
+	if err != nil {
+		return err
+	}
+	marked[h] = struct{}{}
+	if isLeafNode(node) {
+		marked[H4ToString(node[hashLen:2*hashLen])] = struct{}{}
+		return nil
+	}
+	for bit := uint64(0); bit < poseidon.NROUNDSF/hashLen; bit++ {
+		if err := t.mark(ctx, node[bit*hashLen:(bit+1)*hashLen], marked); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// gc deletes from the store the nodes that are not reachable from any of the
+// given roots and returns the number of deleted nodes.
+func (t *smt) gc(ctx context.Context, roots [][]uint64) (int, error) {
+	store, ok := t.store.(SweepStore)
+	if !ok {
+		return 0, ErrGCNotSupported
+	}
+	marked := make(map[string]struct{})
+	for _, root := range roots {
+		if err := t.mark(ctx, root, marked); err != nil {
+			return 0, err
+		}
+	}
+	return store.DeleteExcept(ctx, marked)
+}
+
+// diffLeaves calls fn with the key and both values of every leaf whose value
+// differs between the trees with the given roots, a missing leaf has a zero
+// value. Subtrees with the same hash are skipped without being read, so the
+// cost depends on the size of the difference and not on the size of the trees.
+func (t *smt) diffLeaves(ctx context.Context, rootA, rootB []uint64, fn func(key []uint64, valueA, valueB *big.Int) error) error {
+	return t.diffNodes(ctx, rootA, rootB, nil, fn)
+}
+
+func (t *smt) diffNodes(ctx context.Context, hashA, hashB []uint64, accKey []uint64, fn func(key []uint64, valueA, valueB *big.Int) error) error {
+	if h4Equal(hashA, hashB) {
+		return nil
+	}
+	zero := big.NewInt(0)
+	if isZeroH4(hashA) {
+		return t.walkNode(ctx, hashB, accKey, func(key []uint64, value *big.Int) error {
+			return fn(key, zero, value)
+		})
+	}
+	if isZeroH4(hashB) {
+		return t.walkNode(ctx, hashA, accKey, func(key []uint64, value *big.Int) error {
+			return fn(key, value, zero)
+		})
+	}
+
+	nodeA, err := t.getNode(ctx, hashA)
+	if err != nil {
+		return err
+	}
+	nodeB, err := t.getNode(ctx, hashB)
+	if err != nil {
+		return err
+	}
+	switch {
+	case isLeafNode(nodeA):
+		return t.diffLeafNode(ctx, nodeA, hashB, accKey, func(key []uint64, leafValue, value *big.Int) error {
+			return fn(key, leafValue, value)
+		})
+	case isLeafNode(nodeB):
+		return t.diffLeafNode(ctx, nodeB, hashA, accKey, func(key []uint64, leafValue, value *big.Int) error {
+			return fn(key, value, leafValue)
+		})
+	}
+
+	for bit := uint64(0); bit < poseidon.NROUNDSF/hashLen; bit++ {
+		childKey := append(append(make([]uint64, 0, len(accKey)+1), accKey...), bit)
+		childA := nodeA[bit*hashLen : (bit+1)*hashLen]
+		childB := nodeB[bit*hashLen : (bit+1)*hashLen]
+		if err := t.diffNodes(ctx, childA, childB, childKey, fn); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// diffLeafNode compares a leaf against the subtree with the given hash, both
+// at the same path. It calls fn with the value of the leaf and the value in
+// the subtree of every key that differs.
+func (t *smt) diffLeafNode(ctx context.Context, leaf []uint64, hash []uint64, accKey []uint64, fn func(key []uint64, leafValue, value *big.Int) error) error {
+	leafKey := joinKey(accKey, leaf[:hashLen])
+	leafValue, err := t.getValue(ctx, leaf[hashLen:2*hashLen])
+	if err != nil {
+		return err
+	}
+
+	zero := big.NewInt(0)
+	found := false
+	err = t.walkNode(ctx, hash, accKey, func(key []uint64, value *big.Int) error {
+		if !h4Equal(key, leafKey) {
+			return fn(key, zero, value)
+		}
+		found = true
+		if value.Cmp(leafValue) == 0 {
+			return nil
+		}
+		return fn(key, leafValue, value)
+	})
+	if err != nil {
+		return err
+	}
+	if !found {
+		return fn(leafKey, leafValue, zero)
+	}
+	return nil
+}
+
+// getNode returns a copy of the node with the given hash. It fails with the
+// context error once the context is done, so long walks stop promptly.
+func (t *smt) getNode(ctx context.Context, hash []uint64) ([]uint64, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	node, err := t.store.Get(ctx, hash)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get node %s: %w", H4ToString(hash), err)
+	}
+	if len(node) != nodeLen {
+		return nil, fmt.Errorf("invalid node %s size %d, expected %d", H4ToString(hash), len(node), nodeLen)
+	}
+	return append([]uint64{}, node...), nil
+}
+
+// getNodes returns copies of the nodes with the given hashes indexed by the
+// string representation of their hash. It uses a single round-trip when the
+// store is a BatchStore.
+func (t *smt) getNodes(ctx context.Context, hashes [][]uint64) (map[string][]uint64, error) {
+	batchStore, ok := t.store.(BatchStore)
+	if !ok {
+		nodes := make(map[string][]uint64, len(hashes))
+		for _, hash := range hashes {
+			node, err := t.getNode(ctx, hash)
+			if err != nil {
+				return nil, err
+			}
+			nodes[H4ToString(hash)] = node
+		}
+		return nodes, nil
+	}
+
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	nodes, err := batchStore.GetNodes(ctx, hashes)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get %d nodes: %w", len(hashes), err)
+	}
+	for _, hash := range hashes {
+		h := H4ToString(hash)
+		node, ok := nodes[h]
+		if !ok {
+			return nil, fmt.Errorf("failed to get node %s: %w", h, ErrNodeNotFound)
+		}
+		if len(node) != nodeLen {
+			return nil, fmt.Errorf("invalid node %s size %d, expected %d", h, len(node), nodeLen)
+		}
+	}
+	return nodes, nil
+}
+
+// getValue returns the value stored in the value node with the given hash.
+func (t *smt) getValue(ctx context.Context, valueHash []uint64) (*big.Int, error) {
+	node, err := t.getNode(ctx, valueHash)
+	if err != nil {
+		return nil, err
+	}
+	return fea2scalar(node[:poseidon.NROUNDSF]), nil
+}
+
+// saveLeaf stores the value and the leaf pointing to it and returns the hash
+// of the leaf.
+func (t *smt) saveLeaf(ctx context.Context, remainingKey []uint64, value *big.Int) ([hashLen]uint64, error) {
+	var valueInp [poseidon.NROUNDSF]uint64
+	copy(valueInp[:], scalar2fea(value))
+	valueHash, err := t.hashSave(ctx, valueInp, [poseidon.CAPLEN]uint64{})
+	if err != nil {
+		return [hashLen]uint64{}, err
+	}
+	return t.hashSave(ctx, concatH4(remainingKey, valueHash[:]), [poseidon.CAPLEN]uint64{1})
+}
+
+// hashSave hashes the given input and stores it indexed by its hash.
+func (t *smt) hashSave(ctx context.Context, inp [poseidon.NROUNDSF]uint64, capacity [poseidon.CAPLEN]uint64) ([hashLen]uint64, error) {
+	if err := ctx.Err(); err != nil {
+		return [hashLen]uint64{}, err
+	}
+	h, err := t.hashFn(inp, capacity)
+	if err != nil {
+		return [hashLen]uint64{}, err
+	}
+	node := make([]uint64, 0, nodeLen)
+	node = append(node, inp[:]...)
+	node = append(node, capacity[:]...)
+	if err := t.store.Set(ctx, h[:], node); err != nil {
+		return [hashLen]uint64{}, err
+	}
+	return h, nil
+}
+
+// joinKey rebuilds a full key from the bits used in the path and the
+// remaining key stored in the leaf.
+func joinKey(usedBits []uint64, remainingKey []uint64) []uint64 {
+	var n, accs [hashLen]uint64
+	for i, bit := range usedBits {
+		if bit != 0 {
+			accs[i%hashLen] |= 1 << n[i%hashLen]
+		}
+		n[i%hashLen]++
+	}
+	key := make([]uint64, hashLen)
+	for i := 0; i < hashLen; i++ {
+		key[i] = remainingKey[i]<<n[i] | accs[i]
+	}
+	return key
+}
+
+// uniqueSibling returns the index of the only non-zero child of the node, or
+// -1 if there are none or more than one.
+func uniqueSibling(node []uint64) int {
+	unique := -1
+	for i := 0; i < poseidon.NROUNDSF/hashLen; i++ {
+		if !isZeroH4(node[i*hashLen : (i+1)*hashLen]) {
+			if unique >= 0 {
+				return -1
+			}
+			unique = i
+		}
+	}
+	return unique
+}
+
+func isLeafNode(node []uint64) bool {
+	return node[poseidon.NROUNDSF] == 1
+}
+
+func isZeroH4(h []uint64) bool {
+	for _, e := range h {
+		if e != 0 {
+			return false
+		}
+	}
+	return true
+}
+
+func setChild(node []uint64, bit uint64, child []uint64) {
+	copy(node[bit*hashLen:(bit+1)*hashLen], child)
+}
+
+func concatH4(a, b []uint64) [poseidon.NROUNDSF]uint64 {
+	var inp [poseidon.NROUNDSF]uint64
+	copy(inp[:hashLen], a)
+	copy(inp[hashLen:], b)
+	return inp
+}
+
+func toHashInput(node []uint64) [poseidon.NROUNDSF]uint64 {
+	var inp [poseidon.NROUNDSF]uint64
+	copy(inp[:], node[:poseidon.NROUNDSF])
+	return inp
+}
+
+func toCapacity(node []uint64) [poseidon.CAPLEN]uint64 {
+	var capacity [poseidon.CAPLEN]uint64
+	copy(capacity[:], node[poseidon.NROUNDSF:])
+	return capacity
+}
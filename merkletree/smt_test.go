@@ -0,0 +1,275 @@
+package merkletree
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"os"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	poseidon "github.com/iden3/go-iden3-crypto/goldenposeidon"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type testVectorRaw struct {
+	Keys         []string `json:"keys"`
+	Values       []string `json:"values"`
+	ExpectedRoot string   `json:"expectedRoot"`
+}
+
+// slowStore simulates a remote store adding a fixed latency to every access.
+// It doesn't honor the context, like a stuck query.
+type slowStore struct {
+	Store
+	latency time.Duration
+	gets    atomic.Int64
+}
+
+func (s *slowStore) Get(ctx context.Context, hash []uint64) ([]uint64, error) {
+	s.gets.Add(1)
+	time.Sleep(s.latency)
+	return s.Store.Get(ctx, hash)
+}
+
+// slowBatchStore is a slowStore able to fetch many nodes with the latency of a
+// single access.
+type slowBatchStore struct {
+	*slowStore
+	batch BatchStore
+}
+
+func (s *slowBatchStore) GetNodes(ctx context.Context, hashes [][]uint64) (map[string][]uint64, error) {
+	s.gets.Add(1)
+	time.Sleep(s.latency)
+	return s.batch.GetNodes(ctx, hashes)
+}
+
+func TestSMTRawVectors(t *testing.T) {
+	data, err := os.ReadFile("test/vectors/src/merkle-tree/smt-raw.json")
+	require.NoError(t, err)
+
+	var testVectors []testVectorRaw
+	err = json.Unmarshal(data, &testVectors)
+	require.NoError(t, err)
+
+	ctx := context.Background()
+	for ti, testVector := range testVectors {
+		testVector := testVector
+		t.Run(fmt.Sprintf("Test vector %d", ti), func(t *testing.T) {
+			tree := newSMT(NewMemStore(), poseidon.Hash)
+			root := make([]uint64, hashLen)
+			for i := range testVector.Keys {
+				k, ok := new(big.Int).SetString(testVector.Keys[i], 10)
+				require.True(t, ok)
+				v, ok := new(big.Int).SetString(testVector.Values[i], 10)
+				require.True(t, ok)
+
+				res, err := tree.set(ctx, root, scalarToh4(k), v)
+				require.NoError(t, err)
+				root = res.newRoot
+			}
+			assert.Equal(t, testVector.ExpectedRoot, H4ToString(root))
+
+			for i := range testVector.Keys {
+				k, _ := new(big.Int).SetString(testVector.Keys[i], 10)
+				res, err := tree.get(ctx, root, scalarToh4(k))
+				require.NoError(t, err)
+
+				// the last value set for a key is the one in the tree
+				expected := testVector.Values[i]
+				for j := i + 1; j < len(testVector.Keys); j++ {
+					if testVector.Keys[j] == testVector.Keys[i] {
+						expected = testVector.Values[j]
+					}
+				}
+				assert.Equal(t, expected, res.value.String())
+			}
+		})
+	}
+}
+
+func TestSMTDelete(t *testing.T) {
+	ctx := context.Background()
+	tree := newSMT(NewMemStore(), poseidon.Hash)
+
+	// keys sharing the first bits of the path
+	keys := [][]uint64{
+		{0x10, 0x20, 0x30, 0x40},
+		{0x10, 0x20, 0x31, 0x41},
+		{0x11, 0x20, 0x30, 0x40},
+		{0x10, 0x21, 0x30, 0x40},
+	}
+
+	// roots[i] is the root of the tree with the first i keys
+	roots := [][]uint64{make([]uint64, hashLen)}
+	for i, key := range keys {
+		res, err := tree.set(ctx, roots[i], key, big.NewInt(int64(i+1)))
+		require.NoError(t, err)
+		roots = append(roots, res.newRoot)
+	}
+
+	// the tree doesn't depend on the history, so removing the keys in reverse
+	// order must go through the same roots
+	root := roots[len(keys)]
+	for i := len(keys) - 1; i >= 0; i-- {
+		res, err := tree.set(ctx, root, keys[i], big.NewInt(0))
+		require.NoError(t, err)
+		assert.Equal(t, big.NewInt(int64(i+1)), res.oldValue)
+		assert.Equal(t, roots[i], res.newRoot, "removing key %d", i)
+		root = res.newRoot
+	}
+
+	// removing the first key leaves the same tree as only inserting the rest
+	res, err := tree.set(ctx, roots[len(keys)], keys[0], big.NewInt(0))
+	require.NoError(t, err)
+	root = make([]uint64, hashLen)
+	for i, key := range keys[1:] {
+		r, err := tree.set(ctx, root, key, big.NewInt(int64(i+2)))
+		require.NoError(t, err)
+		root = r.newRoot
+	}
+	assert.Equal(t, root, res.newRoot)
+
+	// removing a key that doesn't exist doesn't change the root
+	res, err = tree.set(ctx, roots[len(keys)], []uint64{0x12, 0x22, 0x32, 0x42}, big.NewInt(0))
+	require.NoError(t, err)
+	assert.Equal(t, "zeroToZero", res.mode)
+	assert.Equal(t, roots[len(keys)], res.newRoot)
+}
+
+func TestSMTProof(t *testing.T) {
+	ctx := context.Background()
+	tree := newSMT(NewMemStore(), poseidon.Hash)
+
+	keys := [][]uint64{
+		{0x10, 0x20, 0x30, 0x40},
+		{0x10, 0x20, 0x31, 0x41},
+		{0x11, 0x20, 0x30, 0x40},
+	}
+	root := make([]uint64, hashLen)
+	for i, key := range keys {
+		res, err := tree.set(ctx, root, key, big.NewInt(int64(i+1)))
+		require.NoError(t, err)
+		root = res.newRoot
+	}
+
+	absent := []uint64{0x10, 0x21, 0x30, 0x40}
+	for _, key := range append(keys, absent) {
+		res, err := tree.get(ctx, root, key)
+		require.NoError(t, err)
+
+		proof := &Proof{
+			Siblings: siblingsFromNodes(key, res.siblings),
+			InsKey:   res.insKey,
+			IsOld0:   res.isOld0,
+		}
+		if res.insValue != nil {
+			proof.InsValue = scalar2fea(res.insValue)
+		}
+		ok, err := VerifyProof(h4ToFilledByteSlice(root), h4ToFilledByteSlice(key), res.value.Bytes(), proof, DefaultArity, poseidon.Hash)
+		require.NoError(t, err)
+		assert.True(t, ok)
+	}
+}
+
+func TestSMTCanceled(t *testing.T) {
+	store := &slowStore{Store: NewMemStore()}
+	tree := newSMT(store, poseidon.Hash)
+
+	// the keys share the first 83 bits, so the path is 83 levels deep
+	key := []uint64{0, 0, 0, 0}
+	root := make([]uint64, hashLen)
+	for _, k := range [][]uint64{key, {0, 0, 0, 1 << 20}} {
+		res, err := tree.set(context.Background(), root, k, big.NewInt(1))
+		require.NoError(t, err)
+		root = res.newRoot
+	}
+
+	store.latency = 5 * time.Millisecond
+	ctx, cancel := context.WithTimeout(context.Background(), 2*store.latency)
+	defer cancel()
+
+	start := time.Now()
+	_, err := tree.get(ctx, root, key)
+	elapsed := time.Since(start)
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+	assert.Less(t, elapsed, 20*store.latency)
+	assert.Less(t, store.gets.Load(), int64(20))
+
+	_, err = tree.set(ctx, root, key, big.NewInt(2))
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+}
+
+func TestSMTGetMany(t *testing.T) {
+	ctx := context.Background()
+	memStore := NewMemStore()
+	tree := newSMT(memStore, poseidon.Hash)
+
+	root := make([]uint64, hashLen)
+	var keys [][]uint64
+	for i := 0; i < 32; i++ {
+		key := scalarToh4(big.NewInt(int64(i * 7)))
+		res, err := tree.set(ctx, root, key, big.NewInt(int64(i+1)))
+		require.NoError(t, err)
+		root = res.newRoot
+		keys = append(keys, key)
+	}
+	// keys that are not in the tree
+	keys = append(keys, scalarToh4(big.NewInt(1)), scalarToh4(big.NewInt(1000)))
+
+	store := &slowBatchStore{slowStore: &slowStore{Store: memStore}, batch: memStore}
+	batchTree := newSMT(store, poseidon.Hash)
+	results, err := batchTree.getMany(ctx, root, keys)
+	require.NoError(t, err)
+	require.Len(t, results, len(keys))
+	for i, key := range keys {
+		expected, err := tree.get(ctx, root, key)
+		require.NoError(t, err)
+		assert.Equal(t, expected, results[i], "key %d", i)
+	}
+	// one round-trip per level plus the value nodes
+	assert.Less(t, store.gets.Load(), int64(len(keys)))
+
+	// a missing node fails the whole batch
+	_, err = batchTree.getMany(ctx, []uint64{1, 2, 3, 4}, keys)
+	assert.ErrorIs(t, err, ErrNodeNotFound)
+}
+
+func BenchmarkSMTGetMany(b *testing.B) {
+	ctx := context.Background()
+	memStore := NewMemStore()
+	tree := newSMT(memStore, poseidon.Hash)
+
+	root := make([]uint64, hashLen)
+	keys := make([][]uint64, 256)
+	for i := range keys {
+		keys[i] = scalarToh4(big.NewInt(int64(i)))
+		res, err := tree.set(ctx, root, keys[i], big.NewInt(int64(i+1)))
+		require.NoError(b, err)
+		root = res.newRoot
+	}
+
+	store := &slowBatchStore{slowStore: &slowStore{Store: memStore, latency: 100 * time.Microsecond}, batch: memStore}
+	b.Run("serial", func(b *testing.B) {
+		serialTree := newSMT(store.slowStore, poseidon.Hash)
+		store.gets.Store(0)
+		for i := 0; i < b.N; i++ {
+			for _, key := range keys {
+				_, _ = serialTree.get(ctx, root, key)
+			}
+		}
+		b.ReportMetric(float64(store.gets.Load())/float64(b.N), "roundtrips/op")
+	})
+	b.Run("batch", func(b *testing.B) {
+		batchTree := newSMT(store, poseidon.Hash)
+		store.gets.Store(0)
+		for i := 0; i < b.N; i++ {
+			_, _ = batchTree.getMany(ctx, root, keys)
+		}
+		b.ReportMetric(float64(store.gets.Load())/float64(b.N), "roundtrips/op")
+	})
+}
@@ -114,6 +114,45 @@ func h4ToFilledByteSlice(h4 []uint64) []byte {
 	return ScalarToFilledByteSlice(h4ToScalar(h4))
 }
 
+// H4ToScalar converts a hash of 4 field elements into a 256 bits scalar.
+// The elements are little endian: h4[0] holds the least significant 64 bits
+// of the scalar and h4[3] the most significant ones. It's the inverse of
+// ScalarToH4.
+func H4ToScalar(h4 [4]uint64) *big.Int {
+	return h4ToScalar(h4[:])
+}
+
+// ScalarToH4 splits a 256 bits scalar into a hash of 4 field elements, see
+// H4ToScalar for the order of the elements. The scalar must be non negative
+// and fit in 256 bits, otherwise it panics like big.Int.FillBytes.
+func ScalarToH4(s *big.Int) [4]uint64 {
+	var h4 [4]uint64
+	copy(h4[:], scalarToh4(s))
+	return h4
+}
+
+// StringToH4 converts a big endian hex string, with or without the 0x prefix
+// and of up to 64 hex characters, into a hash of 4 field elements, see
+// H4ToScalar for the order of the elements. It's the inverse of H4ToString.
+func StringToH4(str string) ([4]uint64, error) {
+	str = strings.TrimPrefix(str, "0x")
+	if len(str) > 2*maxBigIntLen { //nolint:gomnd
+		return [4]uint64{}, fmt.Errorf("could not convert %q into h4, it's longer than %d hex characters", str, 2*maxBigIntLen) //nolint:gomnd
+	}
+	bi, ok := new(big.Int).SetString(str, hex.Base)
+	if !ok {
+		return [4]uint64{}, fmt.Errorf("could not convert %q into big int", str)
+	}
+	return ScalarToH4(bi), nil
+}
+
+// H4ToFilledByteSlice converts a hash of 4 field elements into its big endian
+// representation of maxBigIntLen bytes: h4[3] is encoded in the first 8 bytes
+// and h4[0] in the last 8 ones.
+func H4ToFilledByteSlice(h4 [4]uint64) []byte {
+	return h4ToFilledByteSlice(h4[:])
+}
+
 // string2fea converts an string into an array of 32bit uint64 values.
 func string2fea(s string) ([]uint64, error) {
 	bi, ok := new(big.Int).SetString(s, hex.Base)
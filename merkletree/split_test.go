@@ -2,6 +2,7 @@ package merkletree
 
 import (
 	"fmt"
+	"math"
 	"math/big"
 	"testing"
 
@@ -378,3 +379,60 @@ func Test_fea2string(t *testing.T) {
 		})
 	}
 }
+
+func TestH4Conversions(t *testing.T) {
+	tcs := []struct {
+		description string
+		str         string
+		h4          [4]uint64
+	}{
+		{
+			description: "zero",
+			str:         "0x0000000000000000000000000000000000000000000000000000000000000000",
+			h4:          [4]uint64{0, 0, 0, 0},
+		},
+		{
+			description: "least significant element first",
+			str:         "0x0000000000000003000000000000000200000000000000010000000000000000",
+			h4:          [4]uint64{0, 1, 2, 3},
+		},
+		{
+			description: "max value",
+			str:         "0xffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffff",
+			h4:          [4]uint64{math.MaxUint64, math.MaxUint64, math.MaxUint64, math.MaxUint64},
+		},
+		{
+			description: "poseidon hash of all zeroes",
+			str:         HashPoseidonAllZeroes,
+			h4:          [4]uint64{0x3c18a9786cb0b359, 0xc4055e3364a246c3, 0x7953db0ab48808f4, 0xc71603f33a1144ca},
+		},
+	}
+
+	for _, tc := range tcs {
+		tc := tc
+		t.Run(tc.description, func(t *testing.T) {
+			h4, err := StringToH4(tc.str)
+			require.NoError(t, err)
+			require.Equal(t, tc.h4, h4)
+			require.Equal(t, tc.str, H4ToString(h4[:]))
+
+			scalar := H4ToScalar(h4)
+			require.Equal(t, tc.h4, ScalarToH4(scalar))
+
+			b := H4ToFilledByteSlice(h4)
+			require.Len(t, b, maxBigIntLen)
+			require.Equal(t, hex.EncodeToHex(b), tc.str)
+			require.Zero(t, scalar.Cmp(new(big.Int).SetBytes(b)))
+		})
+	}
+}
+
+func TestStringToH4Errors(t *testing.T) {
+	_, err := StringToH4("yu74")
+	require.Error(t, err)
+	_, err = StringToH4("")
+	require.Error(t, err)
+	// 257 bits
+	_, err = StringToH4("0x10000000000000000000000000000000000000000000000000000000000000000")
+	require.Error(t, err)
+}
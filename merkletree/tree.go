@@ -2,32 +2,155 @@ package merkletree
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"math/big"
 	"strings"
+	"sync"
+	"time"
 
 	"github.com/0xPolygonHermez/zkevm-node/hex"
 	"github.com/0xPolygonHermez/zkevm-node/merkletree/hashdb"
 	"github.com/ethereum/go-ethereum/common"
+	"github.com/google/uuid"
+	poseidon "github.com/iden3/go-iden3-crypto/goldenposeidon"
+	"golang.org/x/sync/errgroup"
 )
 
+// maxParallelProofs is the number of proofs requested at once by GetProofs
+// when the hashdb client can't build them together.
+const maxParallelProofs = 8
+
+var (
+	// ErrSnapshotNotFound is returned when the snapshot doesn't exist or has
+	// already been released or rolled back.
+	ErrSnapshotNotFound = errors.New("snapshot not found")
+	// ErrIterationNotSupported is returned when the hashdb client of the tree
+	// can't walk its leaves, see LocalHashDBClient.
+	ErrIterationNotSupported = errors.New("the hashdb client doesn't support iterating the tree")
+	// ErrGCNotSupported is returned when the hashdb client of the tree, or
+	// its store, can't delete the unreferenced nodes, see SweepStore.
+	ErrGCNotSupported = errors.New("the hashdb client doesn't support collecting the unreferenced nodes")
+	// ErrMaxResultsReached is returned by ScanPrefixLimit when the subtree
+	// has more leaves than the maximum.
+	ErrMaxResultsReached = errors.New("the maximum number of results has been reached")
+)
+
+// treeIterator is implemented by the hashdb clients able to walk the leaves
+// and the programs of the tree.
+type treeIterator interface {
+	ForEachLeaf(ctx context.Context, root []uint64, fn func(key []uint64, value *big.Int) error) error
+	ForEachProgram(ctx context.Context, fn func(hash []uint64, data []byte) error) error
+}
+
+// treePrefixScanner is implemented by the hashdb clients able to walk only the
+// leaves of a subtree.
+type treePrefixScanner interface {
+	ScanPrefix(ctx context.Context, root []uint64, prefixBits []bool, fn func(key []uint64, value *big.Int) error) error
+}
+
+// treeMultiGetter is implemented by the hashdb clients able to read many
+// leaves at once.
+type treeMultiGetter interface {
+	GetMany(ctx context.Context, root []uint64, keys [][]uint64) ([]*big.Int, error)
+}
+
+// treeMultiSetter is implemented by the hashdb clients able to set many
+// leaves at once.
+type treeMultiSetter interface {
+	SetMany(ctx context.Context, root []uint64, keys [][]uint64, values []*big.Int) ([]uint64, error)
+}
+
+// treeProver is implemented by the hashdb clients able to build the proofs of
+// many leaves at once.
+type treeProver interface {
+	GetProofs(ctx context.Context, root []uint64, keys [][]uint64) ([]*hashdb.GetResponse, error)
+}
+
+// treeStatter is implemented by the hashdb clients able to describe the
+// shape of the tree.
+type treeStatter interface {
+	Stats(ctx context.Context, root []uint64) (TreeStats, error)
+}
+
+// treeVerifier is implemented by the hashdb clients able to check the nodes
+// of the tree.
+type treeVerifier interface {
+	Verify(ctx context.Context, root []uint64) (*VerifyReport, error)
+}
+
+// treeCollector is implemented by the hashdb clients able to delete the nodes
+// no longer referenced.
+type treeCollector interface {
+	GC(ctx context.Context, roots [][]uint64) (int, error)
+}
+
+// treePreimageRecorder is implemented by the hashdb clients able to remember
+// what the keys they store are derived from.
+type treePreimageRecorder interface {
+	RecordKeyPreimage(key []uint64, preimage KeyPreimage)
+	KeyPreimage(key []uint64) (KeyPreimage, bool)
+}
+
+// treeDiffer is implemented by the hashdb clients able to compare two trees.
+type treeDiffer interface {
+	DiffLeaves(ctx context.Context, rootA, rootB []uint64, fn func(key []uint64, valueA, valueB *big.Int) error) error
+}
+
 // StateTree provides methods to access and modify state in merkletree
 type StateTree struct {
 	grpcClient hashdb.HashDBServiceClient
+	hashFn     HashFunc
+	metrics    *Collector
+
+	mu       sync.Mutex
+	sessions map[*Session]struct{}
+
+	// gcMu holds off the writes while GC runs, the writes share it
+	gcMu sync.RWMutex
+}
+
+// KeyPreimage is the address, the leaf type and, for storage leaves, the
+// position a key is derived from.
+type KeyPreimage struct {
+	Address  common.Address
+	LeafType LeafType
+	Position common.Hash
+}
+
+// Option configures a StateTree.
+type Option func(*StateTree)
+
+// WithMetrics enables the prometheus metrics of the tree, see Collector.
+func WithMetrics() Option {
+	return func(tree *StateTree) {
+		tree.metrics = NewCollector()
+	}
 }
 
 // NewStateTree creates new StateTree.
-func NewStateTree(client hashdb.HashDBServiceClient) *StateTree {
-	return &StateTree{
+func NewStateTree(client hashdb.HashDBServiceClient, opts ...Option) *StateTree {
+	tree := &StateTree{
 		grpcClient: client,
 	}
+	for _, opt := range opts {
+		opt(tree)
+	}
+	tree.hashFn = tree.metrics.WrapHashFunc(poseidon.Hash)
+	return tree
+}
+
+// Collector returns the metrics collector of the tree, or nil if the tree was
+// created without WithMetrics.
+func (tree *StateTree) Collector() *Collector {
+	return tree.metrics
 }
 
 // GetBalance returns balance.
 func (tree *StateTree) GetBalance(ctx context.Context, address common.Address, root []byte) (*big.Int, error) {
 	r := new(big.Int).SetBytes(root)
 
-	key, err := KeyEthAddrBalance(address)
+	key, err := KeyEthAddrBalanceWithHash(address, tree.hashFn)
 	if err != nil {
 		return nil, err
 	}
@@ -47,7 +170,7 @@ func (tree *StateTree) GetBalance(ctx context.Context, address common.Address, r
 func (tree *StateTree) GetNonce(ctx context.Context, address common.Address, root []byte) (*big.Int, error) {
 	r := new(big.Int).SetBytes(root)
 
-	key, err := KeyEthAddrNonce(address)
+	key, err := KeyEthAddrNonceWithHash(address, tree.hashFn)
 	if err != nil {
 		return nil, err
 	}
@@ -67,7 +190,7 @@ func (tree *StateTree) GetNonce(ctx context.Context, address common.Address, roo
 func (tree *StateTree) GetCodeHash(ctx context.Context, address common.Address, root []byte) ([]byte, error) {
 	r := new(big.Int).SetBytes(root)
 
-	key, err := KeyContractCode(address)
+	key, err := KeyContractCodeWithHash(address, tree.hashFn)
 	if err != nil {
 		return nil, err
 	}
@@ -85,6 +208,95 @@ func (tree *StateTree) GetCodeHash(ctx context.Context, address common.Address,
 	return ScalarToFilledByteSlice(valueBi), nil
 }
 
+// GetMany returns the values of the leaves with the given keys, which are
+// already hashed, in the same order. A missing leaf has a zero value. When the
+// hashdb client supports it the paths of all the keys are walked together,
+// so the nodes they share are read once and the round-trips to the store
+// depend on the depth of the tree and not on the number of keys. Only
+// LocalHashDBClient supports it: with the client of the hashdb service the
+// keys are read with parallel Get calls, see GetProofs, so a few keys cost
+// the latency of a single Get.
+func (tree *StateTree) GetMany(ctx context.Context, root []byte, keys [][]byte) ([]*big.Int, error) {
+	r := scalarToh4(new(big.Int).SetBytes(root))
+	keysH4 := make([][]uint64, len(keys))
+	for i, key := range keys {
+		keysH4[i] = scalarToh4(new(big.Int).SetBytes(key))
+	}
+
+	if mg, ok := tree.grpcClient.(treeMultiGetter); ok {
+		defer tree.metrics.observeDuration(OperationGetMany, time.Now())
+		tree.metrics.inc(OperationNodeGet)
+		return mg.GetMany(ctx, r, keysH4)
+	}
+
+	proofs, err := tree.GetProofs(ctx, root, keys)
+	if err != nil {
+		return nil, err
+	}
+	values := make([]*big.Int, len(keys))
+	for i, proof := range proofs {
+		values[i] = big.NewInt(0)
+		if proof != nil && proof.Value != nil {
+			values[i] = fea2scalar(proof.Value)
+		}
+	}
+	return values, nil
+}
+
+// GetProof returns the proof of the leaf with the given key in the tree with
+// the given root, which is a proof of absence when the key is not in the tree,
+// see VerifyProof. The hashdb service reads the whole path in a single Get.
+// With LocalHashDBClient the path is read node by node, since the hash of each
+// node comes from its parent: a BatchStore saves round-trips when the paths of
+// many keys are read together, see GetProofs.
+func (tree *StateTree) GetProof(ctx context.Context, root []byte, key []byte) (*Proof, error) {
+	return tree.get(ctx, scalarToh4(new(big.Int).SetBytes(root)), scalarToh4(new(big.Int).SetBytes(key)))
+}
+
+// GetProofs returns the proofs of the leaves with the given keys, in the same
+// order, like calling GetProof for each of them. When the hashdb client
+// supports it the paths of all the keys are walked together, so the nodes
+// they share, e.g. the ones close to the root, are read once. Otherwise the
+// proofs are requested in parallel.
+func (tree *StateTree) GetProofs(ctx context.Context, root []byte, keys [][]byte) ([]*Proof, error) {
+	r := scalarToh4(new(big.Int).SetBytes(root))
+	keysH4 := make([][]uint64, len(keys))
+	for i, key := range keys {
+		keysH4[i] = scalarToh4(new(big.Int).SetBytes(key))
+	}
+
+	proofs := make([]*Proof, len(keys))
+	if p, ok := tree.grpcClient.(treeProver); ok {
+		defer tree.metrics.observeDuration(OperationGetProof, time.Now())
+		tree.metrics.inc(OperationNodeGet)
+		results, err := p.GetProofs(ctx, r, keysH4)
+		if err != nil {
+			return nil, err
+		}
+		for i, result := range results {
+			if proofs[i], err = proofFromResponse(r, keysH4[i], result); err != nil {
+				return nil, err
+			}
+		}
+		return proofs, nil
+	}
+
+	g, ctx := errgroup.WithContext(ctx)
+	g.SetLimit(maxParallelProofs)
+	for i := range keysH4 {
+		i := i
+		g.Go(func() error {
+			proof, err := tree.get(ctx, r, keysH4[i])
+			proofs[i] = proof
+			return err
+		})
+	}
+	if err := g.Wait(); err != nil {
+		return nil, err
+	}
+	return proofs, nil
+}
+
 // GetCode returns code.
 func (tree *StateTree) GetCode(ctx context.Context, address common.Address, root []byte) ([]byte, error) {
 	scCodeHash, err := tree.GetCodeHash(ctx, address, root)
@@ -110,7 +322,7 @@ func (tree *StateTree) GetCode(ctx context.Context, address common.Address, root
 func (tree *StateTree) GetStorageAt(ctx context.Context, address common.Address, position *big.Int, root []byte) (*big.Int, error) {
 	r := new(big.Int).SetBytes(root)
 
-	key, err := KeyContractStorage(address, position.Bytes())
+	key, err := KeyContractStorageWithHash(address, position.Bytes(), tree.hashFn)
 	if err != nil {
 		return nil, err
 	}
@@ -133,7 +345,7 @@ func (tree *StateTree) SetBalance(ctx context.Context, address common.Address, b
 	}
 
 	r := new(big.Int).SetBytes(root)
-	key, err := KeyEthAddrBalance(address)
+	key, err := KeyEthAddrBalanceWithHash(address, tree.hashFn)
 	if err != nil {
 		return nil, nil, err
 	}
@@ -145,6 +357,7 @@ func (tree *StateTree) SetBalance(ctx context.Context, address common.Address, b
 	if err != nil {
 		return nil, nil, err
 	}
+	tree.recordPreimage(key, KeyPreimage{Address: address, LeafType: LeafTypeBalance})
 
 	return h4ToFilledByteSlice(updateProof.NewRoot), updateProof, nil
 }
@@ -156,7 +369,7 @@ func (tree *StateTree) SetNonce(ctx context.Context, address common.Address, non
 	}
 
 	r := new(big.Int).SetBytes(root)
-	key, err := KeyEthAddrNonce(address)
+	key, err := KeyEthAddrNonceWithHash(address, tree.hashFn)
 	if err != nil {
 		return nil, nil, err
 	}
@@ -169,6 +382,7 @@ func (tree *StateTree) SetNonce(ctx context.Context, address common.Address, non
 	if err != nil {
 		return nil, nil, err
 	}
+	tree.recordPreimage(key, KeyPreimage{Address: address, LeafType: LeafTypeNonce})
 
 	return h4ToFilledByteSlice(updateProof.NewRoot), updateProof, nil
 }
@@ -189,27 +403,26 @@ func (tree *StateTree) SetCode(ctx context.Context, address common.Address, code
 
 	// set smart contract code hash as a leaf value in merkle tree
 	r := new(big.Int).SetBytes(root)
-	key, err := KeyContractCode(address)
+	key, err := KeyContractCodeWithHash(address, tree.hashFn)
 	if err != nil {
 		return nil, nil, err
 	}
 	k := new(big.Int).SetBytes(key)
 
-	scCodeHash, err := hex.DecodeHex(H4ToString(scCodeHash4))
+	scCodeHashBI, err := codeHashScalar(scCodeHash4)
 	if err != nil {
 		return nil, nil, err
 	}
-
-	scCodeHashBI := new(big.Int).SetBytes(scCodeHash)
 	scCodeHashH8 := scalar2fea(scCodeHashBI)
 
 	updateProof, err := tree.set(ctx, scalarToh4(r), scalarToh4(k), scCodeHashH8, uuid)
 	if err != nil {
 		return nil, nil, err
 	}
+	tree.recordPreimage(key, KeyPreimage{Address: address, LeafType: LeafTypeCode})
 
 	// set code length as a leaf value in merkle tree
-	key, err = KeyCodeLength(address)
+	key, err = KeyCodeLengthWithHash(address, tree.hashFn)
 	if err != nil {
 		return nil, nil, err
 	}
@@ -221,6 +434,7 @@ func (tree *StateTree) SetCode(ctx context.Context, address common.Address, code
 	if err != nil {
 		return nil, nil, err
 	}
+	tree.recordPreimage(key, KeyPreimage{Address: address, LeafType: LeafTypeSCLength})
 
 	return h4ToFilledByteSlice(updateProof.NewRoot), updateProof, nil
 }
@@ -228,7 +442,7 @@ func (tree *StateTree) SetCode(ctx context.Context, address common.Address, code
 // SetStorageAt sets storage value at specified position.
 func (tree *StateTree) SetStorageAt(ctx context.Context, address common.Address, position *big.Int, value *big.Int, root []byte, uuid string) (newRoot []byte, proof *UpdateProof, err error) {
 	r := new(big.Int).SetBytes(root)
-	key, err := KeyContractStorage(address, position.Bytes())
+	key, err := KeyContractStorageWithHash(address, position.Bytes(), tree.hashFn)
 	if err != nil {
 		return nil, nil, err
 	}
@@ -239,28 +453,404 @@ func (tree *StateTree) SetStorageAt(ctx context.Context, address common.Address,
 	if err != nil {
 		return nil, nil, err
 	}
+	tree.recordPreimage(key, KeyPreimage{Address: address, LeafType: LeafTypeStorage, Position: common.BigToHash(position)})
 
 	return h4ToFilledByteSlice(updateProof.NewRoot), updateProof, nil
 }
 
-func (tree *StateTree) get(ctx context.Context, root, key []uint64) (*Proof, error) {
-	result, err := tree.grpcClient.Get(ctx, &hashdb.GetRequest{
-		Root: &hashdb.Fea{Fe0: root[0], Fe1: root[1], Fe2: root[2], Fe3: root[3]},
-		Key:  &hashdb.Fea{Fe0: key[0], Fe1: key[1], Fe2: key[2], Fe3: key[3]},
+// codeHashScalar returns the value of the code hash leaf of a contract.
+func codeHashScalar(scCodeHash4 []uint64) (*big.Int, error) {
+	scCodeHash, err := hex.DecodeHex(H4ToString(scCodeHash4))
+	if err != nil {
+		return nil, err
+	}
+	return new(big.Int).SetBytes(scCodeHash), nil
+}
+
+// LeafUpdate is a leaf set by SetLeaves. Value is the balance, the nonce or
+// the storage value depending on Type, Position is the storage position of
+// LeafTypeStorage updates and Code is the bytecode of LeafTypeCode updates,
+// which also set the code length leaf like SetCode.
+type LeafUpdate struct {
+	Address  common.Address
+	Type     LeafType
+	Position *big.Int
+	Value    *big.Int
+	Code     []byte
+}
+
+// SetLeaves sets the given leaves in the tree with the given root and returns
+// the new root, which is the same as the one of setting them in order with
+// SetBalance, SetNonce, SetCode and SetStorageAt. The keys of all the leaves
+// are computed first and set together, see SetMany.
+func (tree *StateTree) SetLeaves(ctx context.Context, root []byte, updates []LeafUpdate, uuid string) (newRoot []byte, err error) {
+	var (
+		keys      = make([][]byte, 0, len(updates))
+		values    = make([]*big.Int, 0, len(updates))
+		preimages = make([]KeyPreimage, 0, len(updates))
+	)
+	add := func(key []byte, value *big.Int, preimage KeyPreimage) {
+		keys = append(keys, key)
+		values = append(values, value)
+		preimages = append(preimages, preimage)
+	}
+
+	for _, u := range updates {
+		switch u.Type {
+		case LeafTypeBalance, LeafTypeNonce:
+			if u.Value.Sign() < 0 {
+				return nil, fmt.Errorf("invalid %s", u.Type)
+			}
+			keyFn := KeyEthAddrBalanceWithHash
+			if u.Type == LeafTypeNonce {
+				keyFn = KeyEthAddrNonceWithHash
+			}
+			key, err := keyFn(u.Address, tree.hashFn)
+			if err != nil {
+				return nil, err
+			}
+			add(key, u.Value, KeyPreimage{Address: u.Address, LeafType: u.Type})
+		case LeafTypeCode:
+			scCodeHash4, err := HashContractBytecode(u.Code)
+			if err != nil {
+				return nil, err
+			}
+			if err := tree.setProgram(ctx, scCodeHash4, u.Code, true, uuid); err != nil {
+				return nil, err
+			}
+			scCodeHash, err := codeHashScalar(scCodeHash4)
+			if err != nil {
+				return nil, err
+			}
+			key, err := KeyContractCodeWithHash(u.Address, tree.hashFn)
+			if err != nil {
+				return nil, err
+			}
+			add(key, scCodeHash, KeyPreimage{Address: u.Address, LeafType: LeafTypeCode})
+			key, err = KeyCodeLengthWithHash(u.Address, tree.hashFn)
+			if err != nil {
+				return nil, err
+			}
+			add(key, big.NewInt(int64(len(u.Code))), KeyPreimage{Address: u.Address, LeafType: LeafTypeSCLength})
+		case LeafTypeStorage:
+			key, err := KeyContractStorageWithHash(u.Address, u.Position.Bytes(), tree.hashFn)
+			if err != nil {
+				return nil, err
+			}
+			add(key, u.Value, KeyPreimage{Address: u.Address, LeafType: LeafTypeStorage, Position: common.BigToHash(u.Position)})
+		default:
+			return nil, fmt.Errorf("unsupported leaf type %s", u.Type)
+		}
+	}
+
+	newRoot, err = tree.SetMany(ctx, root, keys, values, uuid)
+	if err != nil {
+		return nil, err
+	}
+	for i, key := range keys {
+		tree.recordPreimage(key, preimages[i])
+	}
+	return newRoot, nil
+}
+
+// KeyPreimage returns what the key is derived from, false when it isn't
+// known. The keys are hashes, so the tree can't decode them by itself: only
+// LocalHashDBClient records the preimages of the keys set by SetBalance,
+// SetNonce, SetCode, SetStorageAt and SetLeaves, the keys set with Set or
+// SetMany and all the keys of the hashdb service are unknown.
+func (tree *StateTree) KeyPreimage(key []byte) (KeyPreimage, bool) {
+	r, ok := tree.grpcClient.(treePreimageRecorder)
+	if !ok {
+		return KeyPreimage{}, false
+	}
+	return r.KeyPreimage(scalarToh4(new(big.Int).SetBytes(key)))
+}
+
+// recordPreimage records the preimage of the key when the hashdb client can.
+func (tree *StateTree) recordPreimage(key []byte, preimage KeyPreimage) {
+	r, ok := tree.grpcClient.(treePreimageRecorder)
+	if !ok {
+		return
+	}
+	r.RecordKeyPreimage(scalarToh4(new(big.Int).SetBytes(key)), preimage)
+}
+
+// Delete removes the leaf with the given key. Deleting a key that doesn't
+// exist doesn't change the root.
+func (tree *StateTree) Delete(ctx context.Context, root []byte, key []byte, uuid string) (newRoot []byte, err error) {
+	r := new(big.Int).SetBytes(root)
+	k := new(big.Int).SetBytes(key)
+
+	// setting a leaf to zero removes it from the tree
+	updateProof, err := tree.set(ctx, scalarToh4(r), scalarToh4(k), scalar2fea(big.NewInt(0)), uuid)
+	if err != nil {
+		return nil, err
+	}
+
+	return h4ToFilledByteSlice(updateProof.NewRoot), nil
+}
+
+// Set sets the value of the leaf with the given key, which is already hashed.
+// A zero value removes the leaf.
+func (tree *StateTree) Set(ctx context.Context, root []byte, key []byte, value *big.Int, uuid string) (newRoot []byte, err error) {
+	r := new(big.Int).SetBytes(root)
+	k := new(big.Int).SetBytes(key)
+
+	updateProof, err := tree.set(ctx, scalarToh4(r), scalarToh4(k), scalar2fea(value), uuid)
+	if err != nil {
+		return nil, err
+	}
+
+	return h4ToFilledByteSlice(updateProof.NewRoot), nil
+}
+
+// SetMany sets the values of the leaves with the given keys, which are
+// already hashed, and returns the new root, like calling Set for each key in
+// order. When the hashdb client supports it and the root is empty, e.g. for
+// the genesis, the tree is built bottom up so every node is hashed and stored
+// once. Otherwise the keys are set one by one.
+func (tree *StateTree) SetMany(ctx context.Context, root []byte, keys [][]byte, values []*big.Int, uuid string) (newRoot []byte, err error) {
+	if len(keys) != len(values) {
+		return nil, fmt.Errorf("got %d keys and %d values", len(keys), len(values))
+	}
+
+	r := scalarToh4(new(big.Int).SetBytes(root))
+	if ms, ok := tree.grpcClient.(treeMultiSetter); ok {
+		keysH4 := make([][]uint64, len(keys))
+		for i, key := range keys {
+			keysH4[i] = scalarToh4(new(big.Int).SetBytes(key))
+		}
+		tree.metrics.inc(OperationNodeSet)
+		tree.gcMu.RLock()
+		r, err = ms.SetMany(ctx, r, keysH4, values)
+		tree.gcMu.RUnlock()
+		if err != nil {
+			return nil, err
+		}
+		return h4ToFilledByteSlice(r), nil
+	}
+
+	for i, key := range keys {
+		updateProof, err := tree.set(ctx, r, scalarToh4(new(big.Int).SetBytes(key)), scalar2fea(values[i]), uuid)
+		if err != nil {
+			return nil, err
+		}
+		r = updateProof.NewRoot
+	}
+	return h4ToFilledByteSlice(r), nil
+}
+
+// SetProgram stores the program indexed by its hash.
+func (tree *StateTree) SetProgram(ctx context.Context, data []byte, uuid string) error {
+	key, err := HashContractBytecode(data)
+	if err != nil {
+		return err
+	}
+	return tree.setProgram(ctx, key, data, true, uuid)
+}
+
+// SupportsIteration returns whether the hashdb client of the tree can walk
+// its leaves and programs, see ForEachLeaf. Only LocalHashDBClient can, the
+// hashdb service doesn't expose its nodes.
+func (tree *StateTree) SupportsIteration() bool {
+	_, ok := tree.grpcClient.(treeIterator)
+	return ok
+}
+
+// ForEachLeaf calls fn with the key and the value of every leaf of the tree
+// with the given root. ErrIterationNotSupported is returned when the hashdb
+// client can't walk the tree.
+func (tree *StateTree) ForEachLeaf(ctx context.Context, root []byte, fn func(key []byte, value *big.Int) error) error {
+	it, ok := tree.grpcClient.(treeIterator)
+	if !ok {
+		return ErrIterationNotSupported
+	}
+	r := new(big.Int).SetBytes(root)
+	return it.ForEachLeaf(ctx, scalarToh4(r), func(key []uint64, value *big.Int) error {
+		return fn(h4ToFilledByteSlice(key), value)
 	})
+}
+
+// ScanPrefix calls fn with the key and the value, both 32 bytes long, of
+// every leaf of the tree with the given root whose path starts with the prefix
+// bits, in key path order, e.g. to export a subtree. The path of a key takes
+// its bits alternately from each of its 4 field elements, see ScalarToH4.
+// Only the subtree under the prefix is walked. The hashdb service doesn't
+// expose its nodes, so with its client the subtree is walked with the proofs
+// of its keys, which costs a Get per leaf.
+func (tree *StateTree) ScanPrefix(ctx context.Context, root []byte, prefixBits []bool, fn func(key, value []byte) error) error {
+	return tree.ScanPrefixLimit(ctx, root, prefixBits, 0, fn)
+}
+
+// ScanPrefixLimit is like ScanPrefix but stops after maxResults leaves,
+// returning ErrMaxResultsReached when the subtree has more. There's no limit
+// when maxResults is zero.
+func (tree *StateTree) ScanPrefixLimit(ctx context.Context, root []byte, prefixBits []bool, maxResults int, fn func(key, value []byte) error) error {
+	r := scalarToh4(new(big.Int).SetBytes(root))
+	results := 0
+	cb := func(key []uint64, value *big.Int) error {
+		if maxResults > 0 && results == maxResults {
+			return fmt.Errorf("%w: %d", ErrMaxResultsReached, maxResults)
+		}
+		results++
+		return fn(h4ToFilledByteSlice(key), ScalarToFilledByteSlice(value))
+	}
+	if scanner, ok := tree.grpcClient.(treePrefixScanner); ok {
+		return scanner.ScanPrefix(ctx, r, prefixBits, cb)
+	}
+	prefix := make([]uint64, len(prefixBits))
+	for i, bit := range prefixBits {
+		if bit {
+			prefix[i] = 1
+		}
+	}
+	return tree.proofWalkLeaves(ctx, r, prefix, cb)
+}
+
+// DiffLeaves calls fn with the key and both values of every leaf whose value
+// differs between the trees with the given roots, a leaf missing from one of
+// the trees has a zero value there. The subtrees both trees share are skipped.
+// The hashdb service doesn't expose its nodes, so with its client the trees
+// are compared with the proofs of their keys, which costs a Get per leaf of
+// the subtrees that differ.
+func (tree *StateTree) DiffLeaves(ctx context.Context, rootA, rootB []byte, fn func(key []byte, valueA, valueB *big.Int) error) error {
+	rA := scalarToh4(new(big.Int).SetBytes(rootA))
+	rB := scalarToh4(new(big.Int).SetBytes(rootB))
+	cb := func(key []uint64, valueA, valueB *big.Int) error {
+		return fn(h4ToFilledByteSlice(key), valueA, valueB)
+	}
+	if d, ok := tree.grpcClient.(treeDiffer); ok {
+		return d.DiffLeaves(ctx, rA, rB, cb)
+	}
+	return tree.proofDiffLeaves(ctx, rA, rB, nil, rA, rB, cb)
+}
+
+// Stats returns the number of leaves and nodes and the depth of the tree with
+// the given root. The hashdb service doesn't expose its nodes, so with its
+// client the tree is walked with the proofs of its keys, which costs a Get
+// per leaf.
+func (tree *StateTree) Stats(ctx context.Context, root []byte) (TreeStats, error) {
+	r := scalarToh4(new(big.Int).SetBytes(root))
+	if st, ok := tree.grpcClient.(treeStatter); ok {
+		return st.Stats(ctx, r)
+	}
+	return tree.proofStats(ctx, r)
+}
+
+// Verify recomputes the hash of every node of the tree with the given root and
+// reports the nodes that don't match the hash they are stored with and the
+// nodes referenced by their parent that are missing. The error is only
+// returned when the tree can't be walked. The hashdb service doesn't expose
+// its nodes, so with its client the hashes are recomputed from the proofs of
+// the keys, which costs a Get per leaf. A proof can't tell which node of its
+// path is wrong, so the reported nodes are then the roots of the subtrees
+// whose proof failed or didn't hash to them, see VerifyReport.
+func (tree *StateTree) Verify(ctx context.Context, root []byte) (*VerifyReport, error) {
+	r := scalarToh4(new(big.Int).SetBytes(root))
+	if v, ok := tree.grpcClient.(treeVerifier); ok {
+		return v.Verify(ctx, r)
+	}
+	return tree.proofVerify(ctx, r)
+}
+
+// GC deletes the nodes that are not reachable from the given live roots, the
+// working roots or the roots of the snapshots of the open sessions, and
+// returns the number of deleted nodes. Every other root that may still be
+// read or written on, e.g. the roots of the historical states that are kept
+// or the roots bare writers build on, must be listed. The writes are held off
+// until GC ends, the ones in progress finish before the reachable nodes are
+// marked. Only LocalHashDBClient can delete nodes, ErrGCNotSupported is
+// returned with the client of the hashdb service, which manages its own
+// storage.
+func (tree *StateTree) GC(ctx context.Context, liveRoots [][]byte) (freed int, err error) {
+	c, ok := tree.grpcClient.(treeCollector)
+	if !ok {
+		return 0, ErrGCNotSupported
+	}
+
+	roots := make([][]uint64, 0, len(liveRoots))
+	for _, root := range liveRoots {
+		roots = append(roots, scalarToh4(new(big.Int).SetBytes(root)))
+	}
+
+	// the sessions are locked first, so their writes in progress finish and
+	// their roots don't move until the sweep ends, then the bare writes are
+	// held off
+	tree.mu.Lock()
+	defer tree.mu.Unlock()
+	sessions := make([]*Session, 0, len(tree.sessions))
+	for session := range tree.sessions {
+		session.mu.Lock()
+		sessions = append(sessions, session)
+		roots = append(roots, session.roots()...)
+	}
+	defer func() {
+		for _, session := range sessions {
+			session.mu.Unlock()
+		}
+	}()
+	tree.gcMu.Lock()
+	defer tree.gcMu.Unlock()
+
+	return c.GC(ctx, roots)
+}
+
+// ForEachProgram calls fn with every stored program. ErrIterationNotSupported
+// is returned when the hashdb client can't walk the programs.
+func (tree *StateTree) ForEachProgram(ctx context.Context, fn func(data []byte) error) error {
+	it, ok := tree.grpcClient.(treeIterator)
+	if !ok {
+		return ErrIterationNotSupported
+	}
+	return it.ForEachProgram(ctx, func(_ []uint64, data []byte) error {
+		return fn(data)
+	})
+}
+
+func (tree *StateTree) get(ctx context.Context, root, key []uint64) (*Proof, error) {
+	result, err := tree.getResponse(ctx, root, key)
 	if err != nil {
 		return nil, err
 	}
+	return proofFromResponse(root, key, result)
+}
+
+// getResponse returns the response of the hashdb to the get of the key in the
+// tree with the given root.
+func (tree *StateTree) getResponse(ctx context.Context, root, key []uint64) (*hashdb.GetResponse, error) {
+	defer tree.metrics.observeDuration(OperationGetProof, time.Now())
+	tree.metrics.inc(OperationNodeGet)
 
+	return tree.grpcClient.Get(ctx, &hashdb.GetRequest{
+		Root: &hashdb.Fea{Fe0: root[0], Fe1: root[1], Fe2: root[2], Fe3: root[3]},
+		Key:  &hashdb.Fea{Fe0: key[0], Fe1: key[1], Fe2: key[2], Fe3: key[3]},
+	})
+}
+
+// proofFromResponse builds the proof of the key in the tree with the given
+// root from the response of the hashdb.
+func proofFromResponse(root, key []uint64, result *hashdb.GetResponse) (*Proof, error) {
 	value, err := string2fea(result.Value)
 	if err != nil {
 		return nil, err
 	}
-	return &Proof{
-		Root:  []uint64{root[0], root[1], root[2], root[3]},
-		Key:   key,
-		Value: value,
-	}, nil
+	proof := &Proof{
+		Root:     []uint64{root[0], root[1], root[2], root[3]},
+		Key:      key,
+		Value:    value,
+		Siblings: siblingsFromResponse(key, result.Siblings),
+		IsOld0:   result.IsOld0,
+	}
+	if result.InsKey != nil {
+		proof.InsKey = []uint64{result.InsKey.Fe0, result.InsKey.Fe1, result.InsKey.Fe2, result.InsKey.Fe3}
+	}
+	if result.InsValue != "" {
+		proof.InsValue, err = string2fea(result.InsValue)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return proof, nil
 }
 
 func (tree *StateTree) getProgram(ctx context.Context, key []uint64) (*ProgramProof, error) {
@@ -277,10 +867,14 @@ func (tree *StateTree) getProgram(ctx context.Context, key []uint64) (*ProgramPr
 }
 
 func (tree *StateTree) set(ctx context.Context, oldRoot, key, value []uint64, uuid string) (*UpdateProof, error) {
+	tree.metrics.inc(OperationNodeSet)
+
 	feaValue := fea2string(value)
 	if strings.HasPrefix(feaValue, "0x") { // nolint
 		feaValue = feaValue[2:]
 	}
+	tree.gcMu.RLock()
+	defer tree.gcMu.RUnlock()
 	result, err := tree.grpcClient.Set(ctx, &hashdb.SetRequest{
 		OldRoot:     &hashdb.Fea{Fe0: oldRoot[0], Fe1: oldRoot[1], Fe2: oldRoot[2], Fe3: oldRoot[3]},
 		Key:         &hashdb.Fea{Fe0: key[0], Fe1: key[1], Fe2: key[2], Fe3: key[3]},
@@ -303,12 +897,14 @@ func (tree *StateTree) set(ctx context.Context, oldRoot, key, value []uint64, uu
 		}
 	}
 
-	return &UpdateProof{
+	updateProof := &UpdateProof{
 		OldRoot:  oldRoot,
 		NewRoot:  []uint64{result.NewRoot.Fe0, result.NewRoot.Fe1, result.NewRoot.Fe2, result.NewRoot.Fe3},
 		Key:      key,
 		NewValue: newValue,
-	}, nil
+	}
+
+	return updateProof, nil
 }
 
 func (tree *StateTree) setProgram(ctx context.Context, key []uint64, data []byte, persistent bool, uuid string) error {
@@ -355,3 +951,27 @@ func (tree *StateTree) FinishBlock(ctx context.Context, newRoot common.Hash, uui
 
 	return err
 }
+
+// WithTx runs fn as a single unit of work on top of root and returns the root
+// fn produces. fn gets the uuid its writes must use and the root to build on,
+// and returns the new root, which is flushed with the uuid when fn succeeds.
+// Nothing is flushed when fn fails. The root of the unit of work is scoped to
+// it: WithTx doesn't read nor change any root shared with other writers, e.g.
+// the working roots of the sessions, so the writes done by others while fn
+// runs are neither flushed nor rolled back by it, and they don't move the
+// root fn builds on.
+//
+// Bare Set calls, and the other setters, auto-commit: each one is applied as
+// soon as it's called, on top of the root it's given, and is flushed with the
+// uuid it's given.
+func (tree *StateTree) WithTx(ctx context.Context, root []byte, fn func(uuid string, root []byte) (newRoot []byte, err error)) (newRoot []byte, err error) {
+	txID := uuid.NewString()
+	newRoot, err = fn(txID, root)
+	if err != nil {
+		return nil, err
+	}
+	if err := tree.Flush(ctx, common.BytesToHash(newRoot), txID); err != nil {
+		return nil, err
+	}
+	return newRoot, nil
+}
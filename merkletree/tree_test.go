@@ -2,15 +2,26 @@ package merkletree
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"math/big"
+	"os"
+	"sync"
 	"testing"
+	"time"
 
 	"github.com/0xPolygonHermez/zkevm-node/hex"
+	"github.com/0xPolygonHermez/zkevm-node/merkletree/hashdb"
 	"github.com/0xPolygonHermez/zkevm-node/test/contracts/bin/EmitLog2"
 	"github.com/0xPolygonHermez/zkevm-node/test/testutils"
 	"github.com/ethereum/go-ethereum/common"
 	"github.com/google/uuid"
+	poseidon "github.com/iden3/go-iden3-crypto/goldenposeidon"
+	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+	"golang.org/x/sync/errgroup"
+	"google.golang.org/grpc"
 )
 
 func TestGetCode(t *testing.T) {
@@ -84,3 +95,1176 @@ func TestGetCode(t *testing.T) {
 		})
 	}
 }
+
+type testVectorGenesisAccount struct {
+	Address  string            `json:"address"`
+	Balance  string            `json:"balance"`
+	Nonce    string            `json:"nonce"`
+	Bytecode string            `json:"bytecode"`
+	Storage  map[string]string `json:"storage"`
+}
+
+type testVectorGenesis struct {
+	Addresses    []testVectorGenesisAccount `json:"addresses"`
+	ExpectedRoot string                     `json:"expectedRoot"`
+}
+
+func TestStateTreeMemStore(t *testing.T) {
+	ctx := context.Background()
+
+	for _, testVectorFile := range []string{
+		"test/vectors/src/merkle-tree/smt-genesis.json",
+		"test/vectors/src/merkle-tree/smt-full-genesis.json",
+	} {
+		data, err := os.ReadFile(testVectorFile)
+		require.NoError(t, err)
+
+		var testVectors []testVectorGenesis
+		err = json.Unmarshal(data, &testVectors)
+		require.NoError(t, err)
+
+		for ti, testVector := range testVectors {
+			testVector := testVector
+			t.Run(fmt.Sprintf("%s, test vector %d", testVectorFile, ti), func(t *testing.T) {
+				sTree := NewStateTree(NewLocalHashDBClient(NewMemStore()))
+				txID := uuid.NewString()
+				root := common.Hash{}.Bytes()
+				var err error
+
+				for _, account := range testVector.Addresses {
+					addr := common.HexToAddress(account.Address)
+
+					balance, ok := new(big.Int).SetString(account.Balance, 10)
+					require.True(t, ok)
+					root, _, err = sTree.SetBalance(ctx, addr, balance, root, txID)
+					require.NoError(t, err)
+
+					nonce, ok := new(big.Int).SetString(account.Nonce, 10)
+					require.True(t, ok)
+					root, _, err = sTree.SetNonce(ctx, addr, nonce, root, txID)
+					require.NoError(t, err)
+
+					if account.Bytecode != "" {
+						root, _, err = sTree.SetCode(ctx, addr, common.FromHex(account.Bytecode), root, txID)
+						require.NoError(t, err)
+					}
+
+					for position, value := range account.Storage {
+						p, ok := new(big.Int).SetString(position, 10)
+						require.True(t, ok)
+						v, ok := new(big.Int).SetString(value, 10)
+						require.True(t, ok)
+						root, _, err = sTree.SetStorageAt(ctx, addr, p, v, root, txID)
+						require.NoError(t, err)
+					}
+				}
+
+				expected, ok := new(big.Int).SetString(testVector.ExpectedRoot, 10)
+				require.True(t, ok)
+				assert.Equal(t, expected.String(), new(big.Int).SetBytes(root).String())
+
+				// an address can be repeated, the last account wins
+				accounts := make(map[common.Address]testVectorGenesisAccount)
+				for _, account := range testVector.Addresses {
+					accounts[common.HexToAddress(account.Address)] = account
+				}
+				for addr, account := range accounts {
+					balance, err := sTree.GetBalance(ctx, addr, root)
+					require.NoError(t, err)
+					assert.Equal(t, account.Balance, balance.String())
+					nonce, err := sTree.GetNonce(ctx, addr, root)
+					require.NoError(t, err)
+					assert.Equal(t, account.Nonce, nonce.String())
+				}
+			})
+		}
+	}
+}
+
+func TestDelete(t *testing.T) {
+	ctx := context.Background()
+	sTree := NewStateTree(NewLocalHashDBClient(NewMemStore()))
+	txID := uuid.NewString()
+
+	// the keys share the first two bits of the path
+	keys := [][]uint64{{0x10, 0x20, 0x30, 0x40}, {0x10, 0x20, 0x31, 0x41}}
+	values := []*big.Int{big.NewInt(1), big.NewInt(2)}
+
+	root := make([]uint64, 4)
+	updateProof, err := sTree.set(ctx, root, keys[0], scalar2fea(values[0]), txID)
+	require.NoError(t, err)
+	root1 := updateProof.NewRoot
+	updateProof, err = sTree.set(ctx, root1, keys[1], scalar2fea(values[1]), txID)
+	require.NoError(t, err)
+	root2 := updateProof.NewRoot
+
+	newRoot, err := sTree.Delete(ctx, h4ToFilledByteSlice(root2), h4ToFilledByteSlice(keys[1]), txID)
+	require.NoError(t, err)
+	assert.Equal(t, h4ToFilledByteSlice(root1), newRoot)
+
+	proof, err := sTree.get(ctx, root1, keys[1])
+	require.NoError(t, err)
+	assert.Equal(t, big.NewInt(0), fea2scalar(proof.Value))
+
+	proof, err = sTree.get(ctx, root1, keys[0])
+	require.NoError(t, err)
+	ok, err := VerifyProof(newRoot, h4ToFilledByteSlice(keys[0]), values[0].Bytes(), proof, DefaultArity, nil)
+	require.NoError(t, err)
+	assert.True(t, ok)
+
+	// deleting a key that doesn't exist is a no-op
+	sameRoot, err := sTree.Delete(ctx, newRoot, h4ToFilledByteSlice(keys[1]), txID)
+	require.NoError(t, err)
+	assert.Equal(t, newRoot, sameRoot)
+
+	// deleting the last key leaves an empty tree
+	emptyRoot, err := sTree.Delete(ctx, newRoot, h4ToFilledByteSlice(keys[0]), txID)
+	require.NoError(t, err)
+	assert.Equal(t, common.Hash{}.Bytes(), emptyRoot)
+}
+
+func TestSessionSnapshot(t *testing.T) {
+	ctx := context.Background()
+	sTree := NewStateTree(NewLocalHashDBClient(NewMemStore()))
+	addr := common.HexToAddress("0x1")
+
+	emptyRoot := common.Hash{}.Bytes()
+	session := sTree.NewSession(emptyRoot, uuid.NewString())
+	defer session.Close()
+	assert.Equal(t, emptyRoot, session.Root())
+
+	outer, err := session.Snapshot()
+	require.NoError(t, err)
+
+	require.NoError(t, session.SetBalance(ctx, addr, big.NewInt(1)))
+	root1 := session.Root()
+
+	inner, err := session.Snapshot()
+	require.NoError(t, err)
+
+	require.NoError(t, session.SetBalance(ctx, addr, big.NewInt(2)))
+	assert.NotEqual(t, root1, session.Root())
+
+	// rolling back the inner snapshot keeps the outer one
+	require.NoError(t, session.RollbackToSnapshot(inner))
+	assert.Equal(t, root1, session.Root())
+	balance, err := sTree.GetBalance(ctx, addr, session.Root())
+	require.NoError(t, err)
+	assert.Equal(t, big.NewInt(1), balance)
+
+	// the inner snapshot can be rolled back again
+	require.NoError(t, session.SetBalance(ctx, addr, big.NewInt(3)))
+	require.NoError(t, session.RollbackToSnapshot(inner))
+	assert.Equal(t, root1, session.Root())
+
+	require.NoError(t, session.RollbackToSnapshot(outer))
+	assert.Equal(t, emptyRoot, session.Root())
+
+	// rolling back the outer snapshot discards the inner one
+	assert.ErrorIs(t, session.RollbackToSnapshot(inner), ErrSnapshotNotFound)
+
+	require.NoError(t, session.ReleaseSnapshot(outer))
+	assert.ErrorIs(t, session.RollbackToSnapshot(outer), ErrSnapshotNotFound)
+	assert.ErrorIs(t, session.ReleaseSnapshot(outer), ErrSnapshotNotFound)
+	assert.ErrorIs(t, session.RollbackToSnapshot(100), ErrSnapshotNotFound)
+}
+
+func TestSessionsAreIndependent(t *testing.T) {
+	ctx := context.Background()
+	sTree := NewStateTree(NewLocalHashDBClient(NewMemStore()))
+	addrA, addrB := common.HexToAddress("0x1"), common.HexToAddress("0x2")
+
+	sessionA := sTree.NewSession(common.Hash{}.Bytes(), uuid.NewString())
+	defer sessionA.Close()
+	sessionB := sTree.NewSession(common.Hash{}.Bytes(), uuid.NewString())
+	defer sessionB.Close()
+
+	outerA, err := sessionA.Snapshot()
+	require.NoError(t, err)
+	snapshotB, err := sessionB.Snapshot()
+	require.NoError(t, err)
+	innerA, err := sessionA.Snapshot()
+	require.NoError(t, err)
+
+	require.NoError(t, sessionA.SetBalance(ctx, addrA, big.NewInt(1)))
+	require.NoError(t, sessionB.SetBalance(ctx, addrB, big.NewInt(2)))
+	rootB := sessionB.Root()
+
+	// releasing a snapshot only discards that one, even when the snapshots
+	// of other sessions were taken after it
+	require.NoError(t, sessionA.ReleaseSnapshot(outerA))
+	require.NoError(t, sessionB.RollbackToSnapshot(snapshotB))
+	assert.Equal(t, common.Hash{}.Bytes(), sessionB.Root())
+	require.NoError(t, sessionB.SetBalance(ctx, addrB, big.NewInt(2)))
+	assert.Equal(t, rootB, sessionB.Root())
+
+	// rolling back a session doesn't move the root of the other one
+	rootA := sessionA.Root()
+	require.NoError(t, sessionA.RollbackToSnapshot(innerA))
+	assert.Equal(t, rootB, sessionB.Root())
+	require.NoError(t, sessionB.RollbackToSnapshot(snapshotB))
+	require.NoError(t, sessionA.SetBalance(ctx, addrA, big.NewInt(1)))
+	assert.Equal(t, rootA, sessionA.Root())
+
+	// the snapshot ids are scoped to their session
+	_, err = sessionB.Snapshot()
+	require.NoError(t, err)
+	assert.ErrorIs(t, sessionB.RollbackToSnapshot(innerA+100), ErrSnapshotNotFound)
+}
+
+func TestForEachLeaf(t *testing.T) {
+	ctx := context.Background()
+	sTree := NewStateTree(NewLocalHashDBClient(NewMemStore()))
+	txID := uuid.NewString()
+
+	code := common.FromHex("0x6080604052348015600f57600080fd5b50")
+	addr := common.HexToAddress("0x617b3a3528F9cDd6630fd3301B9c8911F7Bf063D")
+	root := common.Hash{}.Bytes()
+	var err error
+	for i := int64(1); i <= 10; i++ {
+		root, _, err = sTree.SetBalance(ctx, common.BigToAddress(big.NewInt(i)), big.NewInt(i*1000), root, txID)
+		require.NoError(t, err)
+	}
+	root, _, err = sTree.SetCode(ctx, addr, code, root, txID)
+	require.NoError(t, err)
+	root, _, err = sTree.SetStorageAt(ctx, addr, big.NewInt(1), big.NewInt(2), root, txID)
+	require.NoError(t, err)
+
+	// copying every leaf and program to a new tree gives the same root
+	newTree := NewStateTree(NewLocalHashDBClient(NewMemStore()))
+	newRoot := common.Hash{}.Bytes()
+	leaves := 0
+	err = sTree.ForEachLeaf(ctx, root, func(key []byte, value *big.Int) error {
+		leaves++
+		newRoot, err = newTree.Set(ctx, newRoot, key, value, txID)
+		return err
+	})
+	require.NoError(t, err)
+	// 10 balances, code hash, code length and a storage slot
+	assert.Equal(t, 13, leaves)
+	assert.Equal(t, root, newRoot)
+
+	err = sTree.ForEachProgram(ctx, func(data []byte) error {
+		return newTree.SetProgram(ctx, data, txID)
+	})
+	require.NoError(t, err)
+	newCode, err := newTree.GetCode(ctx, addr, newRoot)
+	require.NoError(t, err)
+	assert.Equal(t, code, newCode)
+
+	// an empty tree has no leaves
+	err = sTree.ForEachLeaf(ctx, common.Hash{}.Bytes(), func(key []byte, value *big.Int) error {
+		return fmt.Errorf("unexpected leaf %x", key)
+	})
+	require.NoError(t, err)
+
+	err = NewStateTree(nil).ForEachLeaf(ctx, root, func(key []byte, value *big.Int) error { return nil })
+	assert.ErrorIs(t, err, ErrIterationNotSupported)
+}
+
+func TestKeyPreimage(t *testing.T) {
+	ctx := context.Background()
+	store := NewMemStore()
+	sTree := NewStateTree(NewLocalHashDBClient(store))
+	txID := uuid.NewString()
+	addr := common.HexToAddress("0x617b3a3528F9cDd6630fd3301B9c8911F7Bf063D")
+	other := common.HexToAddress("0x1275fbb540c8efc58b812ba83b0d0b8b9917ae98")
+
+	root, _, err := sTree.SetBalance(ctx, addr, big.NewInt(1), nil, txID)
+	require.NoError(t, err)
+	root, _, err = sTree.SetCode(ctx, addr, []byte{0x60, 0x00}, root, txID)
+	require.NoError(t, err)
+	root, _, err = sTree.SetStorageAt(ctx, addr, big.NewInt(7), big.NewInt(2), root, txID)
+	require.NoError(t, err)
+	_, err = sTree.SetLeaves(ctx, root, []LeafUpdate{
+		{Address: other, Type: LeafTypeNonce, Value: big.NewInt(3)},
+		{Address: other, Type: LeafTypeStorage, Position: big.NewInt(8), Value: big.NewInt(4)},
+	}, txID)
+	require.NoError(t, err)
+
+	key := func(fn func() ([]byte, error)) []byte {
+		k, err := fn()
+		require.NoError(t, err)
+		return k
+	}
+	expected := map[string]KeyPreimage{
+		"balance":     {Address: addr, LeafType: LeafTypeBalance},
+		"code":        {Address: addr, LeafType: LeafTypeCode},
+		"code length": {Address: addr, LeafType: LeafTypeSCLength},
+		"storage":     {Address: addr, LeafType: LeafTypeStorage, Position: common.BigToHash(big.NewInt(7))},
+		"nonce":       {Address: other, LeafType: LeafTypeNonce},
+		"leaves":      {Address: other, LeafType: LeafTypeStorage, Position: common.BigToHash(big.NewInt(8))},
+	}
+	keys := map[string][]byte{
+		"balance":     key(func() ([]byte, error) { return KeyEthAddrBalance(addr) }),
+		"code":        key(func() ([]byte, error) { return KeyContractCode(addr) }),
+		"code length": key(func() ([]byte, error) { return KeyCodeLength(addr) }),
+		"storage":     key(func() ([]byte, error) { return KeyContractStorage(addr, big.NewInt(7).Bytes()) }),
+		"nonce":       key(func() ([]byte, error) { return KeyEthAddrNonce(other) }),
+		"leaves":      key(func() ([]byte, error) { return KeyContractStorage(other, big.NewInt(8).Bytes()) }),
+	}
+	for name, k := range keys {
+		preimage, found := sTree.KeyPreimage(k)
+		require.True(t, found, name)
+		assert.Equal(t, expected[name], preimage, name)
+	}
+
+	// the keys set as they are can't be decoded
+	rawKey := common.HexToHash("0x01").Bytes()
+	_, err = sTree.Set(ctx, root, rawKey, big.NewInt(5), txID)
+	require.NoError(t, err)
+	_, found := sTree.KeyPreimage(rawKey)
+	assert.False(t, found)
+
+	// neither can the ones of the hashdb service
+	_, found = NewStateTree(plainClient{NewLocalHashDBClient(store)}).KeyPreimage(keys["balance"])
+	assert.False(t, found)
+}
+
+func TestScanPrefix(t *testing.T) {
+	ctx := context.Background()
+	sTree := NewStateTree(NewLocalHashDBClient(NewMemStore()))
+	txID := uuid.NewString()
+
+	root := common.Hash{}.Bytes()
+	keys := make([][]uint64, 0, 32)
+	var err error
+	for i := uint64(1); i <= 32; i++ {
+		key := []uint64{i * 0x9e3779b9, i * 0x85ebca6b, i * 0xc2b2ae35, i}
+		keys = append(keys, key)
+		root, err = sTree.Set(ctx, root, h4ToFilledByteSlice(key), new(big.Int).SetUint64(i), txID)
+		require.NoError(t, err)
+	}
+
+	scan := func(prefix []bool) map[string]*big.Int {
+		visited := map[string]*big.Int{}
+		err := sTree.ScanPrefix(ctx, root, prefix, func(key, value []byte) error {
+			assert.Len(t, key, 32)
+			visited[common.Bytes2Hex(key)] = new(big.Int).SetBytes(value)
+			return nil
+		})
+		require.NoError(t, err)
+		return visited
+	}
+	matching := func(prefix []bool) map[string]*big.Int {
+		expected := map[string]*big.Int{}
+		for i, key := range keys {
+			matches := true
+			for level, bit := range prefix {
+				if (keyBit(key, level) == 1) != bit {
+					matches = false
+				}
+			}
+			if matches {
+				expected[common.Bytes2Hex(h4ToFilledByteSlice(key))] = big.NewInt(int64(i + 1))
+			}
+		}
+		return expected
+	}
+
+	// the full path of the first key only matches it
+	fullPath := make([]bool, 64)
+	for level := range fullPath {
+		fullPath[level] = keyBit(keys[0], level) == 1
+	}
+	for _, prefix := range [][]bool{nil, {true}, {false}, {true, false, true}, {false, true, true, false}, fullPath} {
+		expected := matching(prefix)
+		assert.Equal(t, expected, scan(prefix), "prefix %v", prefix)
+	}
+	assert.Len(t, scan(nil), len(keys))
+	assert.Len(t, scan(fullPath), 1)
+
+	// a prefix no key starts with
+	fullPath[len(fullPath)-1] = !fullPath[len(fullPath)-1]
+	assert.Empty(t, scan(fullPath))
+
+	// the scan stops at the maximum number of results
+	visited := 0
+	err = sTree.ScanPrefixLimit(ctx, root, []bool{true}, 2, func(key, value []byte) error {
+		visited++
+		return nil
+	})
+	assert.ErrorIs(t, err, ErrMaxResultsReached)
+	assert.Equal(t, 2, visited)
+	err = sTree.ScanPrefixLimit(ctx, root, []bool{true}, len(matching([]bool{true})), func(key, value []byte) error { return nil })
+	assert.NoError(t, err)
+
+	// the hashdb service is scanned with the proofs of the keys, in key path
+	// order
+	plainTree := NewStateTree(plainClient{sTree.grpcClient})
+	fullPath[len(fullPath)-1] = !fullPath[len(fullPath)-1]
+	for _, prefix := range [][]bool{nil, {true}, {false}, {true, false, true}, {false, true, true, false}, fullPath} {
+		visited := map[string]*big.Int{}
+		var last []uint64
+		err := plainTree.ScanPrefix(ctx, root, prefix, func(key, value []byte) error {
+			k := scalarToh4(new(big.Int).SetBytes(key))
+			if last != nil {
+				assert.True(t, pathLess(last, k))
+			}
+			last = k
+			visited[common.Bytes2Hex(key)] = new(big.Int).SetBytes(value)
+			return nil
+		})
+		require.NoError(t, err)
+		assert.Equal(t, matching(prefix), visited, "prefix %v", prefix)
+	}
+	visited = 0
+	err = plainTree.ScanPrefixLimit(ctx, root, []bool{true}, 2, func(key, value []byte) error {
+		visited++
+		return nil
+	})
+	assert.ErrorIs(t, err, ErrMaxResultsReached)
+	assert.Equal(t, 2, visited)
+	err = plainTree.ScanPrefix(ctx, common.Hash{}.Bytes(), nil, func(key, value []byte) error {
+		return errors.New("unexpected leaf")
+	})
+	assert.NoError(t, err)
+}
+
+func TestDiffLeaves(t *testing.T) {
+	ctx := context.Background()
+	sTree := NewStateTree(NewLocalHashDBClient(NewMemStore()))
+	txID := uuid.NewString()
+
+	leaves := func(root []byte) map[string]*big.Int {
+		values := map[string]*big.Int{}
+		err := sTree.ForEachLeaf(ctx, root, func(key []byte, value *big.Int) error {
+			values[common.Bytes2Hex(key)] = value
+			return nil
+		})
+		require.NoError(t, err)
+		return values
+	}
+
+	rootA := common.Hash{}.Bytes()
+	var err error
+	for i := int64(1); i <= 50; i++ {
+		rootA, _, err = sTree.SetBalance(ctx, common.BigToAddress(big.NewInt(i)), big.NewInt(i), rootA, txID)
+		require.NoError(t, err)
+	}
+	// rootB updates, deletes and adds leaves
+	rootB := rootA
+	for i := int64(1); i <= 50; i += 7 {
+		rootB, _, err = sTree.SetBalance(ctx, common.BigToAddress(big.NewInt(i)), big.NewInt(i+1), rootB, txID)
+		require.NoError(t, err)
+	}
+	for i := int64(3); i <= 50; i += 9 {
+		rootB, _, err = sTree.SetBalance(ctx, common.BigToAddress(big.NewInt(i)), big.NewInt(0), rootB, txID)
+		require.NoError(t, err)
+	}
+	for i := int64(51); i <= 55; i++ {
+		rootB, _, err = sTree.SetNonce(ctx, common.BigToAddress(big.NewInt(i)), big.NewInt(i), rootB, txID)
+		require.NoError(t, err)
+	}
+
+	leavesA, leavesB := leaves(rootA), leaves(rootB)
+	expected := map[string][2]*big.Int{}
+	for key, valueA := range leavesA {
+		valueB, found := leavesB[key]
+		if !found {
+			valueB = big.NewInt(0)
+		}
+		if valueA.Cmp(valueB) != 0 {
+			expected[key] = [2]*big.Int{valueA, valueB}
+		}
+	}
+	for key, valueB := range leavesB {
+		if _, found := leavesA[key]; !found {
+			expected[key] = [2]*big.Int{big.NewInt(0), valueB}
+		}
+	}
+	require.Len(t, expected, 8+6+5)
+
+	diffs := map[string][2]*big.Int{}
+	err = sTree.DiffLeaves(ctx, rootA, rootB, func(key []byte, valueA, valueB *big.Int) error {
+		diffs[common.Bytes2Hex(key)] = [2]*big.Int{valueA, valueB}
+		return nil
+	})
+	require.NoError(t, err)
+	assert.Equal(t, expected, diffs)
+
+	// the hashdb service is compared with the proofs of the keys, in key path
+	// order
+	plainTree := NewStateTree(plainClient{sTree.grpcClient})
+	diff := func(rootA, rootB []byte) map[string][2]*big.Int {
+		diffs := map[string][2]*big.Int{}
+		var last []uint64
+		err := plainTree.DiffLeaves(ctx, rootA, rootB, func(key []byte, valueA, valueB *big.Int) error {
+			k := scalarToh4(new(big.Int).SetBytes(key))
+			if last != nil {
+				assert.True(t, pathLess(last, k))
+			}
+			last = k
+			diffs[common.Bytes2Hex(key)] = [2]*big.Int{valueA, valueB}
+			return nil
+		})
+		require.NoError(t, err)
+		return diffs
+	}
+	assert.Equal(t, expected, diff(rootA, rootB))
+	assert.Len(t, diff(common.Hash{}.Bytes(), rootB), len(leavesB))
+	assert.Len(t, diff(rootA, common.Hash{}.Bytes()), len(leavesA))
+	assert.Empty(t, diff(rootA, rootA))
+	reversed := map[string][2]*big.Int{}
+	for key, values := range expected {
+		reversed[key] = [2]*big.Int{values[1], values[0]}
+	}
+	assert.Equal(t, reversed, diff(rootB, rootA))
+
+	// a single leaf against a whole tree
+	single, _, err := sTree.SetBalance(ctx, common.BigToAddress(big.NewInt(1)), big.NewInt(1), nil, txID)
+	require.NoError(t, err)
+	assert.Len(t, diff(single, rootA), len(leavesA)-1)
+	assert.Len(t, diff(rootB, single), len(leavesB))
+}
+
+func TestStats(t *testing.T) {
+	ctx := context.Background()
+	sTree := NewStateTree(NewLocalHashDBClient(NewMemStore()))
+	txID := uuid.NewString()
+
+	stats, err := sTree.Stats(ctx, common.Hash{}.Bytes())
+	require.NoError(t, err)
+	assert.Equal(t, TreeStats{}, stats)
+
+	// the path of a key takes a bit of each of its elements in turn, so keyA
+	// and keyB split at the root and keyC splits from keyA one level below
+	keyA := h4ToFilledByteSlice([]uint64{0, 0, 0, 0})
+	keyB := h4ToFilledByteSlice([]uint64{1, 0, 0, 0})
+	keyC := h4ToFilledByteSlice([]uint64{0, 1, 0, 0})
+
+	root, err := sTree.Set(ctx, common.Hash{}.Bytes(), keyA, big.NewInt(1), txID)
+	require.NoError(t, err)
+	stats, err = sTree.Stats(ctx, root)
+	require.NoError(t, err)
+	assert.Equal(t, TreeStats{LeafCount: 1, NodeCount: 1}, stats)
+
+	root, err = sTree.Set(ctx, root, keyB, big.NewInt(2), txID)
+	require.NoError(t, err)
+	root, err = sTree.Set(ctx, root, keyC, big.NewInt(3), txID)
+	require.NoError(t, err)
+	stats, err = sTree.Stats(ctx, root)
+	require.NoError(t, err)
+	assert.Equal(t, uint64(3), stats.LeafCount)
+	// the root, the parent of keyA and keyC and the leaves
+	assert.Equal(t, uint64(5), stats.NodeCount)
+	assert.Equal(t, uint64(2), stats.MaxDepth)
+	assert.InDelta(t, 5.0/3, stats.AvgPathLength, 1e-9)
+
+	// the hashdb service is walked with the proofs of the keys
+	plainTree := NewStateTree(plainClient{sTree.grpcClient})
+	plainStats, err := plainTree.Stats(ctx, root)
+	require.NoError(t, err)
+	assert.Equal(t, stats, plainStats)
+	for i := int64(1); i <= 50; i++ {
+		root, _, err = sTree.SetBalance(ctx, common.BigToAddress(big.NewInt(i)), big.NewInt(i), root, txID)
+		require.NoError(t, err)
+	}
+	stats, err = sTree.Stats(ctx, root)
+	require.NoError(t, err)
+	plainStats, err = plainTree.Stats(ctx, root)
+	require.NoError(t, err)
+	assert.Equal(t, stats, plainStats)
+	plainStats, err = plainTree.Stats(ctx, common.Hash{}.Bytes())
+	require.NoError(t, err)
+	assert.Equal(t, TreeStats{}, plainStats)
+}
+
+func TestVerify(t *testing.T) {
+	ctx := context.Background()
+	store := NewMemStore()
+	sTree := NewStateTree(NewLocalHashDBClient(store))
+	txID := uuid.NewString()
+
+	root := common.Hash{}.Bytes()
+	var err error
+	for i := int64(1); i <= 10; i++ {
+		root, _, err = sTree.SetBalance(ctx, common.BigToAddress(big.NewInt(i)), big.NewInt(i*1000), root, txID)
+		require.NoError(t, err)
+	}
+	report, err := sTree.Verify(ctx, root)
+	require.NoError(t, err)
+	assert.True(t, report.Consistent())
+	// the root, 10 leaves with their values and at least 8 more intermediate
+	// nodes to hold them
+	assert.GreaterOrEqual(t, report.NodeCount, uint64(29))
+
+	// the hashdb service is checked with the proofs of the keys
+	plainTree := NewStateTree(plainClient{sTree.grpcClient})
+	plainReport, err := plainTree.Verify(ctx, root)
+	require.NoError(t, err)
+	assert.Equal(t, report, plainReport)
+
+	// corrupting a child of the root flags it, and only it
+	rootH4 := scalarToh4(new(big.Int).SetBytes(root))
+	rootNode, err := store.Get(ctx, rootH4)
+	require.NoError(t, err)
+	child := rootNode[:hashLen]
+	if isZeroH4(child) {
+		child = rootNode[hashLen : 2*hashLen]
+	}
+	childNode, err := store.Get(ctx, child)
+	require.NoError(t, err)
+	childNode[0]++
+	require.NoError(t, store.Set(ctx, child, childNode))
+
+	report, err = sTree.Verify(ctx, root)
+	require.NoError(t, err)
+	assert.False(t, report.Consistent())
+	assert.Equal(t, []NodeRef{{Hash: child, Parent: rootH4}}, report.Corrupted)
+	assert.Empty(t, report.Missing)
+	plainReport, err = plainTree.Verify(ctx, root)
+	require.NoError(t, err)
+	assert.False(t, plainReport.Consistent())
+
+	// a node referencing a child that is not stored
+	missing := []uint64{1, 2, 3, 4}
+	var inp [poseidon.NROUNDSF]uint64
+	copy(inp[:], missing)
+	dangling, err := poseidon.Hash(inp, [poseidon.CAPLEN]uint64{})
+	require.NoError(t, err)
+	require.NoError(t, store.Set(ctx, dangling[:], append(inp[:], 0, 0, 0, 0)))
+
+	report, err = sTree.Verify(ctx, h4ToFilledByteSlice(dangling[:]))
+	require.NoError(t, err)
+	assert.Empty(t, report.Corrupted)
+	assert.Equal(t, []NodeRef{{Hash: missing, Parent: dangling[:]}}, report.Missing)
+
+	// the proofs can't tell which node of the path is missing, the root of the
+	// subtree is reported
+	plainReport, err = plainTree.Verify(ctx, h4ToFilledByteSlice(dangling[:]))
+	require.NoError(t, err)
+	assert.Empty(t, plainReport.Corrupted)
+	assert.Equal(t, []NodeRef{{Hash: dangling[:]}}, plainReport.Missing)
+}
+
+func TestVerifyProofs(t *testing.T) {
+	ctx := context.Background()
+	store := NewMemStore()
+	sTree := NewStateTree(NewLocalHashDBClient(store))
+	plainTree := NewStateTree(plainClient{sTree.grpcClient})
+	txID := uuid.NewString()
+
+	report, err := plainTree.Verify(ctx, common.Hash{}.Bytes())
+	require.NoError(t, err)
+	assert.Equal(t, &VerifyReport{}, report)
+
+	// a value that doesn't match its hash corrupts the leaf, which is the root
+	// of a tree of a single leaf
+	key := h4ToFilledByteSlice([]uint64{0, 0, 0, 0})
+	root, err := sTree.Set(ctx, common.Hash{}.Bytes(), key, big.NewInt(1), txID)
+	require.NoError(t, err)
+	report, err = plainTree.Verify(ctx, root)
+	require.NoError(t, err)
+	assert.True(t, report.Consistent())
+	assert.Equal(t, uint64(2), report.NodeCount)
+
+	rootH4 := scalarToh4(new(big.Int).SetBytes(root))
+	leaf, err := store.Get(ctx, rootH4)
+	require.NoError(t, err)
+	valueHash := leaf[hashLen : 2*hashLen]
+	value, err := store.Get(ctx, valueHash)
+	require.NoError(t, err)
+	value[0]++
+	require.NoError(t, store.Set(ctx, valueHash, value))
+	report, err = plainTree.Verify(ctx, root)
+	require.NoError(t, err)
+	assert.Equal(t, []NodeRef{{Hash: rootH4}}, report.Corrupted)
+	assert.Empty(t, report.Missing)
+
+	// the corrupted subtree of a bigger tree is reported with its parent, the
+	// other subtrees are still checked
+	keyB := h4ToFilledByteSlice([]uint64{1, 0, 0, 0})
+	keyC := h4ToFilledByteSlice([]uint64{1, 1, 0, 0})
+	root, err = sTree.Set(ctx, root, keyB, big.NewInt(2), txID)
+	require.NoError(t, err)
+	root, err = sTree.Set(ctx, root, keyC, big.NewInt(3), txID)
+	require.NoError(t, err)
+	rootH4 = scalarToh4(new(big.Int).SetBytes(root))
+	report, err = plainTree.Verify(ctx, root)
+	require.NoError(t, err)
+	assert.Equal(t, []NodeRef{{Hash: rootH4}}, report.Corrupted)
+
+	rootNode, err := store.Get(ctx, rootH4)
+	require.NoError(t, err)
+	right := rootNode[hashLen : 2*hashLen]
+	rightNode, err := store.Get(ctx, right)
+	require.NoError(t, err)
+	leafB, err := store.Get(ctx, rightNode[:hashLen])
+	require.NoError(t, err)
+	value, err = store.Get(ctx, leafB[hashLen:2*hashLen])
+	require.NoError(t, err)
+	value[0]++
+	require.NoError(t, store.Set(ctx, leafB[hashLen:2*hashLen], value))
+
+	// setting keyA again stores its value node back, the root doesn't change
+	newRoot, err := sTree.Set(ctx, root, key, big.NewInt(1), txID)
+	require.NoError(t, err)
+	require.Equal(t, root, newRoot)
+	report, err = plainTree.Verify(ctx, root)
+	require.NoError(t, err)
+	assert.Equal(t, []NodeRef{{Hash: right, Parent: rootH4}}, report.Corrupted)
+	assert.Empty(t, report.Missing)
+}
+
+func TestGC(t *testing.T) {
+	ctx := context.Background()
+	store := NewMemStore()
+	sTree := NewStateTree(NewLocalHashDBClient(store))
+	txID := uuid.NewString()
+
+	root := common.Hash{}.Bytes()
+	var err error
+	for i := int64(1); i <= 10; i++ {
+		root, _, err = sTree.SetBalance(ctx, common.BigToAddress(big.NewInt(i)), big.NewInt(i*1000), root, txID)
+		require.NoError(t, err)
+	}
+	oldRoot := root
+	for i := int64(1); i <= 10; i++ {
+		root, _, err = sTree.SetBalance(ctx, common.BigToAddress(big.NewInt(i)), big.NewInt(i*2000), root, txID)
+		require.NoError(t, err)
+	}
+	report, err := sTree.Verify(ctx, root)
+	require.NoError(t, err)
+	before := store.Len()
+
+	freed, err := sTree.GC(ctx, [][]byte{root})
+	require.NoError(t, err)
+	assert.Greater(t, freed, 0)
+	assert.Equal(t, before-freed, store.Len())
+	assert.Equal(t, int(report.NodeCount), store.Len())
+
+	// the live tree is intact
+	report, err = sTree.Verify(ctx, root)
+	require.NoError(t, err)
+	assert.True(t, report.Consistent())
+	for i := int64(1); i <= 10; i++ {
+		balance, err := sTree.GetBalance(ctx, common.BigToAddress(big.NewInt(i)), root)
+		require.NoError(t, err)
+		assert.Equal(t, big.NewInt(i*2000).String(), balance.String())
+	}
+
+	// the nodes only referenced by the old root are gone
+	report, err = sTree.Verify(ctx, oldRoot)
+	require.NoError(t, err)
+	assert.NotEmpty(t, report.Missing)
+
+	// nothing else is collected
+	freed, err = sTree.GC(ctx, [][]byte{root})
+	require.NoError(t, err)
+	assert.Zero(t, freed)
+
+	_, err = NewStateTree(nil).GC(ctx, [][]byte{root})
+	assert.ErrorIs(t, err, ErrGCNotSupported)
+}
+
+func TestGCSession(t *testing.T) {
+	ctx := context.Background()
+	store := NewMemStore()
+	sTree := NewStateTree(NewLocalHashDBClient(store))
+
+	session := sTree.NewSession(common.Hash{}.Bytes(), uuid.NewString())
+	require.NoError(t, session.SetBalance(ctx, common.HexToAddress("0x1"), big.NewInt(1)))
+	root := session.Root()
+	report, err := sTree.Verify(ctx, root)
+	require.NoError(t, err)
+
+	// the nodes written after the snapshot are dropped by the next GC once
+	// the session is rolled back
+	snapshot, err := session.Snapshot()
+	require.NoError(t, err)
+	for i := int64(2); i <= 5; i++ {
+		require.NoError(t, session.SetBalance(ctx, common.BigToAddress(big.NewInt(i)), big.NewInt(i)))
+	}
+	require.NoError(t, session.RollbackToSnapshot(snapshot))
+	freed, err := sTree.GC(ctx, nil)
+	require.NoError(t, err)
+	assert.Greater(t, freed, 0)
+	assert.Equal(t, int(report.NodeCount), store.Len())
+	report, err = sTree.Verify(ctx, session.Root())
+	require.NoError(t, err)
+	assert.True(t, report.Consistent())
+
+	// the roots of a closed session are no longer kept
+	session.Close()
+	freed, err = sTree.GC(ctx, nil)
+	require.NoError(t, err)
+	assert.Equal(t, int(report.NodeCount), freed)
+	assert.Zero(t, store.Len())
+}
+
+func TestGCConcurrentWrites(t *testing.T) {
+	ctx := context.Background()
+	sTree := NewStateTree(NewLocalHashDBClient(NewMemStore()))
+	session := sTree.NewSession(common.Hash{}.Bytes(), uuid.NewString())
+	defer session.Close()
+
+	// the writes of the session run along with GC, which keeps their nodes
+	var g errgroup.Group
+	g.Go(func() error {
+		for i := int64(1); i <= 50; i++ {
+			if err := session.SetBalance(ctx, common.BigToAddress(big.NewInt(i)), big.NewInt(i)); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	g.Go(func() error {
+		for i := 0; i < 20; i++ {
+			if _, err := sTree.GC(ctx, nil); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	require.NoError(t, g.Wait())
+
+	report, err := sTree.Verify(ctx, session.Root())
+	require.NoError(t, err)
+	assert.True(t, report.Consistent())
+	for i := int64(1); i <= 50; i++ {
+		balance, err := sTree.GetBalance(ctx, common.BigToAddress(big.NewInt(i)), session.Root())
+		require.NoError(t, err)
+		assert.Equal(t, big.NewInt(i), balance)
+	}
+}
+
+// plainClient hides the optional capabilities of the hashdb client.
+type plainClient struct {
+	hashdb.HashDBServiceClient
+}
+
+func TestGetProofs(t *testing.T) {
+	ctx := context.Background()
+	store := NewMemStore()
+	sTree := NewStateTree(NewLocalHashDBClient(store))
+	txID := uuid.NewString()
+
+	root := common.Hash{}.Bytes()
+	balances := make(map[string]*big.Int)
+	var keys [][]byte
+	var err error
+	for i := int64(1); i <= 20; i++ {
+		addr := common.BigToAddress(big.NewInt(i))
+		root, _, err = sTree.SetBalance(ctx, addr, big.NewInt(i*1000), root, txID)
+		require.NoError(t, err)
+		key, err := KeyEthAddrBalance(addr)
+		require.NoError(t, err)
+		balances[string(key)] = big.NewInt(i * 1000)
+		keys = append(keys, key)
+	}
+	// a missing key and a repeated one
+	missing, err := KeyEthAddrBalance(common.BigToAddress(big.NewInt(100)))
+	require.NoError(t, err)
+	keys = append(keys, missing, keys[0])
+
+	proofs, err := sTree.GetProofs(ctx, root, keys)
+	require.NoError(t, err)
+	require.Len(t, proofs, len(keys))
+	for i, key := range keys {
+		expected, err := sTree.GetProof(ctx, root, key)
+		require.NoError(t, err)
+		assert.Equal(t, expected, proofs[i], "key %d", i)
+
+		var value []byte
+		if balance, found := balances[string(key)]; found {
+			value = balance.Bytes()
+		}
+		ok, err := VerifyProof(root, key, value, proofs[i], DefaultArity, poseidon.Hash)
+		require.NoError(t, err)
+		assert.True(t, ok, "key %d", i)
+	}
+
+	// the clients that can't build many proofs at once get the same ones
+	plainTree := NewStateTree(plainClient{NewLocalHashDBClient(store)})
+	plainProofs, err := plainTree.GetProofs(ctx, root, keys)
+	require.NoError(t, err)
+	assert.Equal(t, proofs, plainProofs)
+}
+
+func TestGetMany(t *testing.T) {
+	ctx := context.Background()
+	store := NewMemStore()
+	sTree := NewStateTree(NewLocalHashDBClient(store))
+	txID := uuid.NewString()
+	addr := common.HexToAddress("0x617b3a3528F9cDd6630fd3301B9c8911F7Bf063D")
+
+	root, _, err := sTree.SetBalance(ctx, addr, big.NewInt(1000), nil, txID)
+	require.NoError(t, err)
+	root, _, err = sTree.SetNonce(ctx, addr, big.NewInt(7), root, txID)
+	require.NoError(t, err)
+	balanceKey, err := KeyEthAddrBalance(addr)
+	require.NoError(t, err)
+	nonceKey, err := KeyEthAddrNonce(addr)
+	require.NoError(t, err)
+	codeKey, err := KeyContractCode(addr)
+	require.NoError(t, err)
+	keys := [][]byte{balanceKey, nonceKey, codeKey}
+
+	values, err := sTree.GetMany(ctx, root, keys)
+	require.NoError(t, err)
+	assert.Equal(t, []*big.Int{big.NewInt(1000), big.NewInt(7), big.NewInt(0)}, values)
+
+	// the client of the hashdb service reads the keys in parallel: each Get
+	// only returns once all of them have been sent
+	client := &barrierClient{plainClient: plainClient{NewLocalHashDBClient(store)}, calls: len(keys), all: make(chan struct{})}
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+	plainValues, err := NewStateTree(client).GetMany(ctx, root, keys)
+	require.NoError(t, err)
+	assert.Equal(t, values, plainValues)
+}
+
+// barrierClient holds every Get until the given number of calls have been
+// made.
+type barrierClient struct {
+	plainClient
+	calls int
+
+	mu      sync.Mutex
+	arrived int
+	all     chan struct{}
+}
+
+func (c *barrierClient) Get(ctx context.Context, in *hashdb.GetRequest, opts ...grpc.CallOption) (*hashdb.GetResponse, error) {
+	c.mu.Lock()
+	c.arrived++
+	if c.arrived == c.calls {
+		close(c.all)
+	}
+	c.mu.Unlock()
+
+	select {
+	case <-c.all:
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+	return c.plainClient.Get(ctx, in, opts...)
+}
+
+func BenchmarkGetProofs(b *testing.B) {
+	ctx := context.Background()
+	memStore := NewMemStore()
+	sTree := NewStateTree(NewLocalHashDBClient(memStore))
+	txID := uuid.NewString()
+
+	root := common.Hash{}.Bytes()
+	accounts := make([][]byte, 64)
+	for i := range accounts {
+		addr := common.BigToAddress(big.NewInt(int64(i + 1)))
+		var err error
+		root, _, err = sTree.SetBalance(ctx, addr, big.NewInt(int64(i+1)), root, txID)
+		require.NoError(b, err)
+		accounts[i], err = KeyEthAddrBalance(addr)
+		require.NoError(b, err)
+	}
+	// pairs of sender and recipient, every account is in several pairs
+	keys := make([][]byte, 0, 2*len(accounts))
+	for i := range accounts {
+		keys = append(keys, accounts[i], accounts[(i*7+1)%len(accounts)])
+	}
+
+	store := &slowBatchStore{slowStore: &slowStore{Store: memStore, latency: 100 * time.Microsecond}, batch: memStore}
+	slowTree := NewStateTree(NewLocalHashDBClient(store))
+	b.Run("loop", func(b *testing.B) {
+		store.gets.Store(0)
+		for i := 0; i < b.N; i++ {
+			for _, key := range keys {
+				_, _ = slowTree.GetProof(ctx, root, key)
+			}
+		}
+		b.ReportMetric(float64(store.gets.Load())/float64(b.N), "roundtrips/op")
+	})
+	b.Run("batch", func(b *testing.B) {
+		store.gets.Store(0)
+		for i := 0; i < b.N; i++ {
+			_, _ = slowTree.GetProofs(ctx, root, keys)
+		}
+		b.ReportMetric(float64(store.gets.Load())/float64(b.N), "roundtrips/op")
+	})
+}
+
+func TestSetMany(t *testing.T) {
+	ctx := context.Background()
+	txID := uuid.NewString()
+
+	var (
+		keys   [][]byte
+		values []*big.Int
+	)
+	for i := int64(1); i <= 300; i++ {
+		key, err := KeyEthAddrBalance(common.BigToAddress(big.NewInt(i)))
+		require.NoError(t, err)
+		keys = append(keys, key)
+		values = append(values, big.NewInt(i*1000))
+	}
+	// an updated key, a removed one and a zero value never set
+	keys = append(keys, keys[0], keys[1], keys[2])
+	values = append(values, big.NewInt(1), big.NewInt(0), big.NewInt(5))
+	keys = append(keys, keys[2])
+	values = append(values, big.NewInt(0))
+
+	expectedTree := NewStateTree(NewLocalHashDBClient(NewMemStore()))
+	expectedRoot := common.Hash{}.Bytes()
+	for i, key := range keys {
+		var err error
+		expectedRoot, err = expectedTree.Set(ctx, expectedRoot, key, values[i], txID)
+		require.NoError(t, err)
+	}
+
+	store := NewMemStore()
+	sTree := NewStateTree(NewLocalHashDBClient(store))
+	root, err := sTree.SetMany(ctx, common.Hash{}.Bytes(), keys, values, txID)
+	require.NoError(t, err)
+	assert.Equal(t, expectedRoot, root)
+	report, err := sTree.Verify(ctx, root)
+	require.NoError(t, err)
+	assert.True(t, report.Consistent())
+
+	// on top of an existing tree the keys are set one by one
+	more := [][]byte{keys[3], keys[1]}
+	moreValues := []*big.Int{big.NewInt(7), big.NewInt(8)}
+	for i, key := range more {
+		expectedRoot, err = expectedTree.Set(ctx, expectedRoot, key, moreValues[i], txID)
+		require.NoError(t, err)
+	}
+	root, err = sTree.SetMany(ctx, root, more, moreValues, txID)
+	require.NoError(t, err)
+	assert.Equal(t, expectedRoot, root)
+
+	// the clients that can't set many leaves at once get the same root
+	plainTree := NewStateTree(plainClient{NewLocalHashDBClient(NewMemStore())})
+	plainRoot, err := plainTree.SetMany(ctx, common.Hash{}.Bytes(), keys, values, txID)
+	require.NoError(t, err)
+	plainRoot, err = plainTree.SetMany(ctx, plainRoot, more, moreValues, txID)
+	require.NoError(t, err)
+	assert.Equal(t, expectedRoot, plainRoot)
+
+	_, err = sTree.SetMany(ctx, root, keys, values[:1], txID)
+	assert.Error(t, err)
+}
+
+func TestSetLeaves(t *testing.T) {
+	ctx := context.Background()
+	txID := uuid.NewString()
+	scAddress := common.HexToAddress("0xae4bb80be56b819606589de61d5ec3b522eeb032")
+	code := common.FromHex("0x6080604052348015600f57600080fd5b50")
+
+	var updates []LeafUpdate
+	for i := int64(1); i <= 100; i++ {
+		addr := common.BigToAddress(big.NewInt(i))
+		updates = append(updates,
+			LeafUpdate{Address: addr, Type: LeafTypeBalance, Value: big.NewInt(i * 1000)},
+			LeafUpdate{Address: addr, Type: LeafTypeNonce, Value: big.NewInt(i)},
+		)
+	}
+	updates = append(updates,
+		LeafUpdate{Address: scAddress, Type: LeafTypeCode, Code: code},
+		LeafUpdate{Address: scAddress, Type: LeafTypeStorage, Position: big.NewInt(2), Value: big.NewInt(42)},
+	)
+
+	expectedTree := NewStateTree(NewLocalHashDBClient(NewMemStore()))
+	expectedRoot := common.Hash{}.Bytes()
+	for _, u := range updates {
+		var err error
+		switch u.Type {
+		case LeafTypeBalance:
+			expectedRoot, _, err = expectedTree.SetBalance(ctx, u.Address, u.Value, expectedRoot, txID)
+		case LeafTypeNonce:
+			expectedRoot, _, err = expectedTree.SetNonce(ctx, u.Address, u.Value, expectedRoot, txID)
+		case LeafTypeCode:
+			expectedRoot, _, err = expectedTree.SetCode(ctx, u.Address, u.Code, expectedRoot, txID)
+		case LeafTypeStorage:
+			expectedRoot, _, err = expectedTree.SetStorageAt(ctx, u.Address, u.Position, u.Value, expectedRoot, txID)
+		}
+		require.NoError(t, err)
+	}
+
+	sTree := NewStateTree(NewLocalHashDBClient(NewMemStore()))
+	root, err := sTree.SetLeaves(ctx, common.Hash{}.Bytes(), updates, txID)
+	require.NoError(t, err)
+	assert.Equal(t, expectedRoot, root)
+
+	actualCode, err := sTree.GetCode(ctx, scAddress, root)
+	require.NoError(t, err)
+	assert.Equal(t, code, actualCode)
+
+	_, err = sTree.SetLeaves(ctx, root, []LeafUpdate{{Type: LeafTypeBalance, Value: big.NewInt(-1)}}, txID)
+	assert.EqualError(t, err, "invalid balance")
+	_, err = sTree.SetLeaves(ctx, root, []LeafUpdate{{Type: LeafTypeSCLength}}, txID)
+	assert.Error(t, err)
+}
+
+func TestWithTx(t *testing.T) {
+	ctx := context.Background()
+	txID := uuid.NewString()
+
+	// expectedRoot returns the root of a tree with the balances of the
+	// addresses in the range
+	expectedRoot := func(from, to int64) []byte {
+		tree := NewStateTree(NewLocalHashDBClient(NewMemStore()))
+		root := common.Hash{}.Bytes()
+		for i := from; i <= to; i++ {
+			var err error
+			root, _, err = tree.SetBalance(ctx, common.BigToAddress(big.NewInt(i)), big.NewInt(i), root, txID)
+			require.NoError(t, err)
+		}
+		return root
+	}
+	setBalances := func(tree *StateTree, from, to int64, root []byte, uuid string) ([]byte, error) {
+		for i := from; i <= to; i++ {
+			var err error
+			root, _, err = tree.SetBalance(ctx, common.BigToAddress(big.NewInt(i)), big.NewInt(i), root, uuid)
+			if err != nil {
+				return nil, err
+			}
+		}
+		return root, nil
+	}
+
+	// a bare writer and a unit of work interleave their writes on top of the
+	// same root, each one builds on its own root so no write is lost
+	tree := NewStateTree(NewLocalHashDBClient(NewMemStore()))
+	var txRoot, bareRoot []byte
+	var g errgroup.Group
+	g.Go(func() error {
+		var err error
+		txRoot, err = tree.WithTx(ctx, common.Hash{}.Bytes(), func(uuid string, root []byte) ([]byte, error) {
+			return setBalances(tree, 1, 10, root, uuid)
+		})
+		return err
+	})
+	g.Go(func() error {
+		var err error
+		bareRoot, err = setBalances(tree, 11, 20, common.Hash{}.Bytes(), txID)
+		return err
+	})
+	require.NoError(t, g.Wait())
+	assert.Equal(t, expectedRoot(1, 10), txRoot)
+	assert.Equal(t, expectedRoot(11, 20), bareRoot)
+
+	// units of work chained on the roots they return are deterministic
+	root, err := tree.WithTx(ctx, txRoot, func(uuid string, root []byte) ([]byte, error) {
+		return setBalances(tree, 11, 20, root, uuid)
+	})
+	require.NoError(t, err)
+	assert.Equal(t, expectedRoot(1, 20), root)
+
+	// a failing unit of work doesn't roll back the bare writes done meanwhile
+	errFailed := errors.New("failed")
+	var lastRoot []byte
+	_, err = tree.WithTx(ctx, root, func(uuid string, txRoot []byte) ([]byte, error) {
+		_, err := setBalances(tree, 21, 21, txRoot, uuid)
+		require.NoError(t, err)
+		lastRoot, err = setBalances(tree, 22, 22, root, txID)
+		require.NoError(t, err)
+		return nil, errFailed
+	})
+	assert.ErrorIs(t, err, errFailed)
+	balance, err := tree.GetBalance(ctx, common.BigToAddress(big.NewInt(22)), lastRoot)
+	require.NoError(t, err)
+	assert.Equal(t, big.NewInt(22), balance)
+	balance, err = tree.GetBalance(ctx, common.BigToAddress(big.NewInt(21)), lastRoot)
+	require.NoError(t, err)
+	assert.Zero(t, balance.Sign())
+}
@@ -1,5 +1,7 @@
 package merkletree
 
+import "fmt"
+
 // ResultCode represents the result code.
 type ResultCode int64
 
@@ -24,6 +26,17 @@ type Proof struct {
 	Key []uint64
 	// Value is the proof value.
 	Value []uint64
+	// Siblings are the hashes of the siblings of the nodes in the path from
+	// the root (first element) down to the leaf (last element).
+	Siblings [][]uint64
+	// InsKey is the key of the leaf found in the path when the proof is a
+	// proof of absence and the path ends in a different leaf.
+	InsKey []uint64
+	// InsValue is the value of the leaf found in the path when the proof is a
+	// proof of absence and the path ends in a different leaf.
+	InsValue []uint64
+	// IsOld0 indicates that the path ends in an empty node.
+	IsOld0 bool
 }
 
 // UpdateProof is a proof generated on Set operation.
@@ -43,3 +56,49 @@ type ProgramProof struct {
 	// Data is the program proof data.
 	Data []byte
 }
+
+// TreeStats describes the shape of a tree.
+type TreeStats struct {
+	// LeafCount is the number of leaves.
+	LeafCount uint64
+	// NodeCount is the number of leaf and intermediate nodes.
+	NodeCount uint64
+	// MaxDepth is the depth of the deepest leaf, the root is at depth zero.
+	MaxDepth uint64
+	// AvgPathLength is the average depth of the leaves, it's the number of
+	// siblings of an average proof.
+	AvgPathLength float64
+}
+
+// VerifyReport lists the inconsistencies found in the nodes of a tree. When
+// the tree is verified with the proofs of the hashdb service, a corrupted or
+// missing node is reported by the root of the smallest subtree found to hold
+// it, along with the parent of that root.
+type VerifyReport struct {
+	// NodeCount is the number of nodes checked.
+	NodeCount uint64
+	// Corrupted are the nodes whose content doesn't hash to the hash they are
+	// stored with. Their children are not checked.
+	Corrupted []NodeRef
+	// Missing are the nodes referenced by their parent but not stored.
+	Missing []NodeRef
+}
+
+// Consistent returns whether no inconsistency was found.
+func (r *VerifyReport) Consistent() bool {
+	return len(r.Corrupted) == 0 && len(r.Missing) == 0
+}
+
+// NodeRef is a node of a tree and the node referencing it, the root has no
+// parent.
+type NodeRef struct {
+	Hash   []uint64
+	Parent []uint64
+}
+
+func (r NodeRef) String() string {
+	if r.Parent == nil {
+		return H4ToString(r.Hash)
+	}
+	return fmt.Sprintf("%s (parent %s)", H4ToString(r.Hash), H4ToString(r.Parent))
+}
@@ -24,6 +24,7 @@ const (
 
 var (
 	BlockTopic = "block"
+	TxTopic    = "tx"
 )
 
 var BlockSubscriptionMessage = Message{
@@ -31,3 +32,9 @@ var BlockSubscriptionMessage = Message{
 	Topic:   BlockTopic,
 	Message: "",
 }
+
+var TxSubscriptionMessage = Message{
+	Action:  subscribe,
+	Topic:   TxTopic,
+	Message: "",
+}
@@ -0,0 +1,98 @@
+package nodekit
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+)
+
+// MsgTxVersion is the version of the wire format written by EncodeMsgTx
+const MsgTxVersion byte = 1
+
+// msgTxHeaderLen is the size of the version and of the length prefixes of the
+// fields of an encoded MsgTx
+const msgTxHeaderLen = 1 + 2 + 4
+
+var (
+	// ErrMalformedMsgTx is returned when the data can't be decoded as a MsgTx
+	ErrMalformedMsgTx = errors.New("malformed msg tx")
+	// ErrUnsupportedMsgTxVersion is returned when the version of an encoded
+	// MsgTx is not MsgTxVersion
+	ErrUnsupportedMsgTxVersion = errors.New("unsupported msg tx version")
+)
+
+// MsgTx is the content of the data submitted with SubmitMsgTx.
+type MsgTx struct {
+	// ChainID identifies the rollup the tx belongs to
+	ChainID []byte
+	// Payload is the tx itself, e.g. a raw L2 tx
+	Payload []byte
+}
+
+// EncodeMsgTx encodes the tx in the format the proxy expects:
+//
+//	version (1 byte) | chain id length (2 bytes) | chain id |
+//	payload length (4 bytes) | payload
+//
+// The lengths are big endian.
+func EncodeMsgTx(tx MsgTx) ([]byte, error) {
+	if len(tx.ChainID) > math.MaxUint16 {
+		return nil, fmt.Errorf("%w: chain id of %d bytes", ErrMalformedMsgTx, len(tx.ChainID))
+	}
+	if uint64(len(tx.Payload)) > math.MaxUint32 {
+		return nil, fmt.Errorf("%w: payload of %d bytes", ErrMalformedMsgTx, len(tx.Payload))
+	}
+
+	data := make([]byte, 0, msgTxHeaderLen+len(tx.ChainID)+len(tx.Payload))
+	data = append(data, MsgTxVersion)
+	data = binary.BigEndian.AppendUint16(data, uint16(len(tx.ChainID)))
+	data = append(data, tx.ChainID...)
+	data = binary.BigEndian.AppendUint32(data, uint32(len(tx.Payload)))
+	data = append(data, tx.Payload...)
+	return data, nil
+}
+
+// DecodeMsgTx decodes a tx encoded with EncodeMsgTx. The data must be exactly
+// one encoded tx, trailing bytes are rejected.
+func DecodeMsgTx(data []byte) (MsgTx, error) {
+	if len(data) == 0 {
+		return MsgTx{}, fmt.Errorf("%w: empty data", ErrMalformedMsgTx)
+	}
+	if data[0] != MsgTxVersion {
+		return MsgTx{}, fmt.Errorf("%w: %d", ErrUnsupportedMsgTxVersion, data[0])
+	}
+	rest := data[1:]
+
+	chainID, rest, err := readMsgTxField(rest, 2) //nolint:gomnd
+	if err != nil {
+		return MsgTx{}, fmt.Errorf("chain id: %w", err)
+	}
+	payload, rest, err := readMsgTxField(rest, 4) //nolint:gomnd
+	if err != nil {
+		return MsgTx{}, fmt.Errorf("payload: %w", err)
+	}
+	if len(rest) > 0 {
+		return MsgTx{}, fmt.Errorf("%w: %d trailing bytes", ErrMalformedMsgTx, len(rest))
+	}
+	return MsgTx{ChainID: chainID, Payload: payload}, nil
+}
+
+// readMsgTxField reads a field prefixed by its big endian length of the given
+// size and returns it along with the remaining data.
+func readMsgTxField(data []byte, prefixLen int) (field, rest []byte, err error) {
+	if len(data) < prefixLen {
+		return nil, nil, fmt.Errorf("%w: truncated length", ErrMalformedMsgTx)
+	}
+	var n uint64
+	if prefixLen == 2 { //nolint:gomnd
+		n = uint64(binary.BigEndian.Uint16(data))
+	} else {
+		n = uint64(binary.BigEndian.Uint32(data))
+	}
+	data = data[prefixLen:]
+	if uint64(len(data)) < n {
+		return nil, nil, fmt.Errorf("%w: %d bytes expected, %d left", ErrMalformedMsgTx, n, len(data))
+	}
+	return append([]byte{}, data[:n]...), data[n:], nil
+}
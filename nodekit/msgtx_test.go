@@ -0,0 +1,56 @@
+package nodekit
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMsgTxRoundTrip(t *testing.T) {
+	tcs := []struct {
+		description string
+		tx          MsgTx
+	}{
+		{"chain id and payload", MsgTx{ChainID: []byte("zkevm"), Payload: []byte{0xf8, 0x6b, 0x01}}},
+		{"empty chain id", MsgTx{ChainID: []byte{}, Payload: []byte{0x01}}},
+		{"empty payload", MsgTx{ChainID: []byte("zkevm"), Payload: []byte{}}},
+		{"large payload", MsgTx{ChainID: []byte("zkevm"), Payload: bytes.Repeat([]byte{0xab}, 70000)}},
+	}
+	for _, tc := range tcs {
+		tc := tc
+		t.Run(tc.description, func(t *testing.T) {
+			data, err := EncodeMsgTx(tc.tx)
+			require.NoError(t, err)
+			assert.Equal(t, MsgTxVersion, data[0])
+			assert.Len(t, data, msgTxHeaderLen+len(tc.tx.ChainID)+len(tc.tx.Payload))
+
+			tx, err := DecodeMsgTx(data)
+			require.NoError(t, err)
+			assert.Equal(t, tc.tx, tx)
+		})
+	}
+
+	_, err := EncodeMsgTx(MsgTx{ChainID: make([]byte, 1<<16)})
+	assert.ErrorIs(t, err, ErrMalformedMsgTx)
+}
+
+func TestDecodeMsgTxInvalid(t *testing.T) {
+	data, err := EncodeMsgTx(MsgTx{ChainID: []byte("zkevm"), Payload: []byte{1, 2, 3}})
+	require.NoError(t, err)
+
+	wrongVersion := append([]byte{}, data...)
+	wrongVersion[0] = MsgTxVersion + 1
+	_, err = DecodeMsgTx(wrongVersion)
+	assert.ErrorIs(t, err, ErrUnsupportedMsgTxVersion)
+
+	// every truncation of the blob is rejected
+	for i := 0; i < len(data); i++ {
+		_, err = DecodeMsgTx(data[:i])
+		assert.ErrorIs(t, err, ErrMalformedMsgTx, "truncated to %d bytes", i)
+	}
+
+	_, err = DecodeMsgTx(append(data, 0))
+	assert.ErrorIs(t, err, ErrMalformedMsgTx)
+}
@@ -2,6 +2,12 @@ package nodekit
 
 import (
 	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"sort"
 	"strings"
 )
 
@@ -11,38 +17,510 @@ const (
 )
 
 type JSONRPCClient struct {
+	// uri is the base uri of the proxy
+	uri       string
 	requester *EndpointRequester
+	// maxTxSize is the maximum encoded size of the txs, see EncodedTxSize,
+	// there's no limit when it's zero
+	maxTxSize int
+	// limiter paces the submissions, they are not paced when it's nil
+	limiter *rateLimiter
 }
 
 func NewJSONRPCClient(uri string) *JSONRPCClient {
 	uri = strings.TrimSuffix(uri, "/")
-	uri += JSONRPCEndpoint
-	req := NewRequester(uri, Name)
-	return &JSONRPCClient{requester: req}
+	req := NewRequester(uri+JSONRPCEndpoint, Name)
+	return &JSONRPCClient{uri: uri, requester: req}
+}
+
+// NewJSONRPCClientWithHeaders creates a client that sets the given headers in
+// every request, e.g. to authenticate against an API gateway.
+func NewJSONRPCClientWithHeaders(uri string, headers map[string]string) *JSONRPCClient {
+	return NewJSONRPCClientWithOptions(uri, ClientOptions{Headers: headers})
+}
+
+// ClientOptions configures a JSONRPCClient.
+type ClientOptions struct {
+	// RatePerSec is the maximum number of txs submitted per second, the
+	// submissions are not paced when it's zero
+	RatePerSec float64
+	// Burst is the number of txs that can be submitted at once before the
+	// rate applies, it defaults to 1
+	Burst int
+	// Headers are set in every request, see NewJSONRPCClientWithHeaders
+	Headers map[string]string
+}
+
+// NewJSONRPCClientWithOptions creates a client configured with the options.
+// When a rate is set, SubmitMsgTx and the rest of the submitting methods block
+// until they are allowed to submit or the context is done. A batch counts as
+// many txs as it holds. When the proxy responds with a 429 status code and a
+// Retry-After header the submissions are held until then.
+func NewJSONRPCClientWithOptions(uri string, opts ClientOptions) *JSONRPCClient {
+	uri = strings.TrimSuffix(uri, "/")
+	req := NewRequesterWithOptions(uri+JSONRPCEndpoint, Name, RequesterOptions{
+		Timeout: DefaultRequestTimeout,
+		Headers: opts.Headers,
+	})
+	cli := &JSONRPCClient{uri: uri, requester: req}
+	if opts.RatePerSec > 0 {
+		cli.limiter = newRateLimiter(opts.RatePerSec, opts.Burst)
+	}
+	return cli
+}
+
+// SetMaxTxSize sets the maximum encoded size of the txs submitted by the
+// client, see EncodedTxSize. There's no limit when it's zero.
+func (j *JSONRPCClient) SetMaxTxSize(size int) {
+	j.maxTxSize = size
+}
+
+// ErrTxTooLarge is returned when the encoded size of a tx exceeds the maximum
+var ErrTxTooLarge = errors.New("tx too large")
+
+// TxTooLargeError is returned by SubmitMsgTx when the encoded size of the tx
+// exceeds the maximum size of the client, it wraps ErrTxTooLarge.
+type TxTooLargeError struct {
+	Size    int
+	MaxSize int
+}
+
+func (e *TxTooLargeError) Error() string {
+	return fmt.Sprintf("%v: encoded size %d exceeds the maximum of %d", ErrTxTooLarge, e.Size, e.MaxSize)
+}
+
+func (e *TxTooLargeError) Unwrap() error {
+	return ErrTxTooLarge
 }
 
 type SubmitMsgTxArgs struct {
 	Data []byte `json:"Data"`
+	// IdempotencyKey identifies the submission, the proxy returns the TxID of
+	// the original tx when a key is submitted again instead of creating a new
+	// tx. It's not sent when it's empty.
+	IdempotencyKey string `json:"idempotencyKey,omitempty"`
+}
+
+// submitMsgTxArgsOverhead is the size of the JSON encoding of SubmitMsgTxArgs
+// without the data
+var submitMsgTxArgsOverhead = len(`{"Data":""}`)
+
+// EncodedTxSize returns the size of the data once encoded in the params of a
+// submitMsgTx request, the bytes are base64 encoded in a JSON string.
+func EncodedTxSize(data []byte) int {
+	return submitMsgTxArgsOverhead + base64.StdEncoding.EncodedLen(len(data))
 }
 
 type SubmitMsgTxReply struct {
 	TxID string `json:"txId"`
+	// Sequence is the position assigned to the tx in the stream of messages
+	// of the proxy, it's only returned by the proxies that support it. Some
+	// of them call it nonce.
+	Sequence *uint64 `json:"sequence,omitempty"`
+	Nonce    *uint64 `json:"nonce,omitempty"`
 }
 
 func (j *JSONRPCClient) SubmitMsgTx(ctx context.Context, data []byte) (string, error) {
+	resp, err := j.submitMsgTxData(ctx, data)
+	if err != nil {
+		return "", err
+	}
+	return resp.TxID, nil
+}
+
+// ErrNoSequence is returned by SubmitMsgTxWithMeta when the proxy doesn't
+// return the sequence of the tx
+var ErrNoSequence = errors.New("the proxy didn't return the sequence of the tx")
+
+// SubmitResult is the outcome of a tx submitted with SubmitMsgTxWithMeta.
+type SubmitResult struct {
+	TxID string
+	// Sequence is the position assigned to the tx by the proxy, consecutive
+	// txs get consecutive sequences so gaps can be detected
+	Sequence uint64
+}
+
+// SubmitMsgTxWithMeta submits the data like SubmitMsgTx and also returns the
+// sequence assigned to the tx by the proxy. When the proxy doesn't return it,
+// ErrNoSequence is returned along with the TxID, as the tx was submitted.
+func (j *JSONRPCClient) SubmitMsgTxWithMeta(ctx context.Context, data []byte) (SubmitResult, error) {
+	resp, err := j.submitMsgTxData(ctx, data)
+	if err != nil {
+		return SubmitResult{}, err
+	}
+
+	result := SubmitResult{TxID: resp.TxID}
+	switch {
+	case resp.Sequence != nil:
+		result.Sequence = *resp.Sequence
+	case resp.Nonce != nil:
+		result.Sequence = *resp.Nonce
+	default:
+		return result, ErrNoSequence
+	}
+	return result, nil
+}
+
+// submitMsgTxData checks the size of the data and submits it.
+func (j *JSONRPCClient) submitMsgTxData(ctx context.Context, data []byte) (*SubmitMsgTxReply, error) {
+	if size := EncodedTxSize(data); j.maxTxSize > 0 && size > j.maxTxSize {
+		return nil, &TxTooLargeError{Size: size, MaxSize: j.maxTxSize}
+	}
+	return j.submitMsgTx(ctx, &SubmitMsgTxArgs{Data: data})
+}
+
+// ErrEmptyIdempotencyKey is returned by SubmitMsgTxIdempotent when the key is
+// empty
+var ErrEmptyIdempotencyKey = errors.New("empty idempotency key")
+
+// SubmitMsgTxIdempotent submits the data like SubmitMsgTx, but the proxy
+// returns the TxID of the original tx when the idempotencyKey was already
+// submitted instead of creating a duplicate. The retries of the requester send
+// the same key, so a request that reached the proxy but whose response was
+// lost is not submitted twice either. The key must be unique per message,
+// e.g. a UUID.
+func (j *JSONRPCClient) SubmitMsgTxIdempotent(ctx context.Context, data []byte, idempotencyKey string) (string, error) {
+	if idempotencyKey == "" {
+		return "", ErrEmptyIdempotencyKey
+	}
+	args := &SubmitMsgTxArgs{
+		Data:           data,
+		IdempotencyKey: idempotencyKey,
+	}
+	if j.maxTxSize > 0 {
+		b, err := json.Marshal(args)
+		if err != nil {
+			return "", err
+		}
+		if len(b) > j.maxTxSize {
+			return "", &TxTooLargeError{Size: len(b), MaxSize: j.maxTxSize}
+		}
+	}
+	resp, err := j.submitMsgTx(ctx, args)
+	if err != nil {
+		return "", err
+	}
+	return resp.TxID, nil
+}
+
+func (j *JSONRPCClient) submitMsgTx(ctx context.Context, args *SubmitMsgTxArgs) (*SubmitMsgTxReply, error) {
+	if err := j.waitToSubmit(ctx, 1); err != nil {
+		return nil, err
+	}
 	resp := new(SubmitMsgTxReply)
 
 	err := j.requester.SendRequest(ctx,
 		"submitMsgTx",
-		&SubmitMsgTxArgs{
-			Data: data,
+		args,
+		resp,
+	)
+
+	if err != nil {
+		j.adaptRate(err)
+		return nil, err
+	}
+
+	return resp, nil
+}
+
+// waitToSubmit blocks until n txs can be submitted, see ClientOptions.
+func (j *JSONRPCClient) waitToSubmit(ctx context.Context, n int) error {
+	if j.limiter == nil {
+		return nil
+	}
+	return j.limiter.wait(ctx, n)
+}
+
+// adaptRate holds the next submissions when the proxy asked so.
+func (j *JSONRPCClient) adaptRate(err error) {
+	if j.limiter != nil {
+		j.limiter.adapt(err)
+	}
+}
+
+const (
+	TxStatePending  = "pending"
+	TxStateAccepted = "accepted"
+	TxStateRejected = "rejected"
+)
+
+var (
+	// ErrUnknownTx is returned by GetTxStatus when the proxy doesn't know the tx
+	ErrUnknownTx = errors.New("unknown tx")
+	// ErrUnhealthy is returned by Ping when the proxy reports it's not healthy
+	ErrUnhealthy = errors.New("proxy is unhealthy")
+)
+
+type GetTxStatusArgs struct {
+	TxID string `json:"txId"`
+}
+
+type TxStatus struct {
+	// State is one of TxStatePending, TxStateAccepted or TxStateRejected
+	State       string `json:"state"`
+	BlockHeight uint64 `json:"blockHeight"`
+	// Error is the reason of the rejection of the tx
+	Error string `json:"error,omitempty"`
+}
+
+func (j *JSONRPCClient) GetTxStatus(ctx context.Context, txID string) (*TxStatus, error) {
+	resp := new(TxStatus)
+
+	err := j.requester.SendRequest(ctx,
+		"getTxStatus",
+		&GetTxStatusArgs{
+			TxID: txID,
 		},
 		resp,
 	)
 
 	if err != nil {
-		return "", err
+		var rpcErr *RPCError
+		if errors.As(err, &rpcErr) && strings.Contains(rpcErr.Message, ErrUnknownTx.Error()) {
+			return nil, fmt.Errorf("%w: %s", ErrUnknownTx, txID)
+		}
+		return nil, err
 	}
 
-	return resp.TxID, nil
+	return resp, nil
+}
+
+// BatchError holds the errors of the elements of a batch that failed, by
+// their index in the batch.
+type BatchError struct {
+	Errors map[int]error
+}
+
+func (e *BatchError) Error() string {
+	indexes := make([]int, 0, len(e.Errors))
+	for i := range e.Errors {
+		indexes = append(indexes, i)
+	}
+	sort.Ints(indexes)
+	msgs := make([]string, 0, len(indexes))
+	for _, i := range indexes {
+		msgs = append(msgs, fmt.Sprintf("%d: %v", i, e.Errors[i]))
+	}
+	return fmt.Sprintf("%d elements of the batch failed: %s", len(indexes), strings.Join(msgs, ", "))
+}
+
+// SubmitMsgTxBatch submits all the datas in a single request and returns the
+// tx ids in the same order. When some of the elements fail their tx ids are
+// empty and a *BatchError is returned along with the tx ids of the rest.
+func (j *JSONRPCClient) SubmitMsgTxBatch(ctx context.Context, datas [][]byte) ([]string, error) {
+	params := make([]interface{}, len(datas))
+	replies := make([]interface{}, len(datas))
+	for i, data := range datas {
+		params[i] = &SubmitMsgTxArgs{
+			Data: data,
+		}
+		replies[i] = new(SubmitMsgTxReply)
+	}
+
+	if err := j.waitToSubmit(ctx, len(datas)); err != nil {
+		return nil, err
+	}
+	errs, err := j.requester.SendBatchRequest(ctx, "submitMsgTx", params, replies)
+	if err != nil {
+		j.adaptRate(err)
+		return nil, err
+	}
+
+	txIDs := make([]string, len(datas))
+	batchErr := &BatchError{Errors: map[int]error{}}
+	for i, err := range errs {
+		if err != nil {
+			batchErr.Errors[i] = err
+			continue
+		}
+		txIDs[i] = replies[i].(*SubmitMsgTxReply).TxID
+	}
+	if len(batchErr.Errors) > 0 {
+		return txIDs, batchErr
+	}
+
+	return txIDs, nil
+}
+
+const HealthStatusOK = "ok"
+
+type PingReply struct {
+	// Status is HealthStatusOK when the proxy is healthy
+	Status string `json:"status"`
+}
+
+// Ping checks that the proxy is reachable and healthy, it returns
+// ErrUnhealthy when the proxy reports a degraded status.
+func (j *JSONRPCClient) Ping(ctx context.Context) error {
+	resp := new(PingReply)
+
+	err := j.requester.SendRequest(ctx,
+		"ping",
+		struct{}{},
+		resp,
+	)
+
+	if err != nil {
+		return err
+	}
+	if resp.Status != HealthStatusOK {
+		return fmt.Errorf("%w: %s", ErrUnhealthy, resp.Status)
+	}
+
+	return nil
+}
+
+// LatestBlock can be passed to GetBlockByNumber to get the latest block
+const LatestBlock = ^uint64(0)
+
+type GetBlockArgs struct {
+	// Height is the height of the block, the latest block is returned when
+	// it's not set
+	Height *uint64 `json:"height,omitempty"`
+	Full   bool    `json:"full"`
+}
+
+type Block struct {
+	Height     uint64 `json:"height"`
+	Hash       string `json:"hash"`
+	ParentHash string `json:"parentHash"`
+	Timestamp  uint64 `json:"timestamp"`
+	// TxIDs are the ids of the txs of the block, only set when the block is
+	// requested with full set
+	TxIDs []string `json:"txIds,omitempty"`
+}
+
+// GetBlockByNumber returns the block with the given height, or the latest one
+// when number is LatestBlock. The ids of the txs are included when full is set.
+func (j *JSONRPCClient) GetBlockByNumber(ctx context.Context, number uint64, full bool) (*Block, error) {
+	resp := new(Block)
+
+	args := &GetBlockArgs{
+		Full: full,
+	}
+	if number != LatestBlock {
+		args.Height = &number
+	}
+	err := j.requester.SendRequest(ctx,
+		"getBlock",
+		args,
+		resp,
+	)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return resp, nil
+}
+
+// unknownAccountMessage is contained in the error returned by the proxies
+// that report the accounts they don't know as an error
+const unknownAccountMessage = "unknown account"
+
+// ErrInvalidBalance is returned by GetBalance when the balance returned by
+// the proxy is not a number
+var ErrInvalidBalance = errors.New("invalid balance")
+
+type GetBalanceArgs struct {
+	Address string `json:"address"`
+}
+
+// GetBalance returns the balance of the account. The proxy may return it as a
+// hex quantity or as a decimal number. The accounts unknown to the proxy have
+// a zero balance.
+func (j *JSONRPCClient) GetBalance(ctx context.Context, addr string) (*big.Int, error) {
+	var resp json.RawMessage
+
+	err := j.requester.SendRequest(ctx,
+		"getBalance",
+		&GetBalanceArgs{
+			Address: addr,
+		},
+		&resp,
+	)
+
+	if err != nil {
+		var rpcErr *RPCError
+		if errors.Is(err, ErrNullResult) ||
+			errors.As(err, &rpcErr) && strings.Contains(rpcErr.Message, unknownAccountMessage) {
+			return new(big.Int), nil
+		}
+		return nil, err
+	}
+
+	return parseBalance(resp)
+}
+
+// parseBalance parses a balance encoded either as a JSON number or as a
+// string holding a 0x prefixed hex quantity or a decimal number.
+func parseBalance(raw json.RawMessage) (*big.Int, error) {
+	balance, ok := parseQuantity(raw)
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrInvalidBalance, raw)
+	}
+	return balance, nil
+}
+
+// parseQuantity parses a non negative number encoded either as a JSON number
+// or as a string holding a 0x prefixed hex quantity or a decimal number.
+func parseQuantity(raw json.RawMessage) (*big.Int, bool) {
+	s := string(raw)
+	if len(raw) > 0 && raw[0] == '"' {
+		if err := json.Unmarshal(raw, &s); err != nil {
+			return nil, false
+		}
+	}
+
+	base := 10
+	digits := s
+	if strings.HasPrefix(s, "0x") || strings.HasPrefix(s, "0X") {
+		base = 16
+		digits = s[2:]
+	}
+	n, ok := new(big.Int).SetString(digits, base)
+	if !ok || n.Sign() < 0 {
+		return nil, false
+	}
+	return n, true
+}
+
+// errCodeMethodNotFound is the JSON-RPC error code returned for the methods
+// the proxy doesn't implement
+const errCodeMethodNotFound = -32601
+
+// ErrInvalidBlockHeight is returned by BlockHeight when the height returned by
+// the proxy is not a number
+var ErrInvalidBlockHeight = errors.New("invalid block height")
+
+// BlockHeight returns the height of the last block accepted by the proxy,
+// e.g. to know how deep the txs submitted before are. It calls lastAccepted,
+// or blockHeight on the proxies that don't implement it. The height may be
+// returned as a hex quantity or as a decimal number.
+func (j *JSONRPCClient) BlockHeight(ctx context.Context) (uint64, error) {
+	var resp json.RawMessage
+
+	err := j.requester.SendRequest(ctx,
+		"lastAccepted",
+		struct{}{},
+		&resp,
+	)
+
+	var rpcErr *RPCError
+	if errors.As(err, &rpcErr) && rpcErr.Code == errCodeMethodNotFound {
+		err = j.requester.SendRequest(ctx,
+			"blockHeight",
+			struct{}{},
+			&resp,
+		)
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	height, ok := parseQuantity(resp)
+	if !ok || !height.IsUint64() {
+		return 0, fmt.Errorf("%w: %s", ErrInvalidBlockHeight, resp)
+	}
+	return height.Uint64(), nil
 }
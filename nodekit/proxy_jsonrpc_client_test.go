@@ -0,0 +1,465 @@
+package nodekit
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type jsonRPCRequest struct {
+	Method string          `json:"method"`
+	Params json.RawMessage `json:"params"`
+	ID     uint64          `json:"id"`
+}
+
+func TestGetTxStatus(t *testing.T) {
+	responses := map[string]string{
+		"pending":  `{"result":{"state":"pending","blockHeight":0}}`,
+		"accepted": `{"result":{"state":"accepted","blockHeight":10}}`,
+		"rejected": `{"result":{"state":"rejected","blockHeight":11,"error":"invalid nonce"}}`,
+		"unknown":  `{"error":{"code":-32000,"message":"unknown tx"}}`,
+	}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req jsonRPCRequest
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&req))
+		assert.Equal(t, JSONRPCEndpoint, r.URL.Path)
+		assert.Equal(t, "proxy.getTxStatus", req.Method)
+
+		var args GetTxStatusArgs
+		require.NoError(t, json.Unmarshal(req.Params, &args))
+		resp, ok := responses[args.TxID]
+		if !ok {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		_, _ = w.Write([]byte(`{"jsonrpc":"2.0","id":1,` + resp[1:]))
+	}))
+	defer srv.Close()
+
+	cli := NewJSONRPCClient(srv.URL)
+	ctx := context.Background()
+
+	status, err := cli.GetTxStatus(ctx, "pending")
+	require.NoError(t, err)
+	assert.Equal(t, &TxStatus{State: TxStatePending}, status)
+
+	status, err = cli.GetTxStatus(ctx, "accepted")
+	require.NoError(t, err)
+	assert.Equal(t, &TxStatus{State: TxStateAccepted, BlockHeight: 10}, status)
+
+	status, err = cli.GetTxStatus(ctx, "rejected")
+	require.NoError(t, err)
+	assert.Equal(t, &TxStatus{State: TxStateRejected, BlockHeight: 11, Error: "invalid nonce"}, status)
+
+	_, err = cli.GetTxStatus(ctx, "unknown")
+	assert.ErrorIs(t, err, ErrUnknownTx)
+
+	_, err = cli.GetTxStatus(ctx, "failing")
+	require.Error(t, err)
+	assert.NotErrorIs(t, err, ErrUnknownTx)
+}
+
+func TestSubmitMsgTxBatch(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var reqs []jsonRPCRequest
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&reqs))
+		require.Len(t, reqs, 3)
+
+		// respond in reverse order, the client must match the responses by id
+		resps := make([]map[string]interface{}, 0, len(reqs))
+		for i := len(reqs) - 1; i >= 0; i-- {
+			req := reqs[i]
+			assert.Equal(t, "proxy.submitMsgTx", req.Method)
+			var args SubmitMsgTxArgs
+			require.NoError(t, json.Unmarshal(req.Params, &args))
+
+			resp := map[string]interface{}{"jsonrpc": "2.0", "id": req.ID}
+			if string(args.Data) == "second" {
+				resp["error"] = map[string]interface{}{"code": -32000, "message": "invalid msg"}
+			} else {
+				resp["result"] = map[string]interface{}{"txId": "tx-" + string(args.Data)}
+			}
+			resps = append(resps, resp)
+		}
+		require.NoError(t, json.NewEncoder(w).Encode(resps))
+	}))
+	defer srv.Close()
+
+	cli := NewJSONRPCClient(srv.URL)
+	txIDs, err := cli.SubmitMsgTxBatch(context.Background(), [][]byte{[]byte("first"), []byte("second"), []byte("third")})
+	assert.Equal(t, []string{"tx-first", "", "tx-third"}, txIDs)
+
+	var batchErr *BatchError
+	require.True(t, errors.As(err, &batchErr))
+	require.Len(t, batchErr.Errors, 1)
+	assert.ErrorContains(t, batchErr.Errors[1], "invalid msg")
+}
+
+func TestPing(t *testing.T) {
+	var status atomic.Value
+	status.Store(HealthStatusOK)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req jsonRPCRequest
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&req))
+		assert.Equal(t, "proxy.ping", req.Method)
+		_, _ = w.Write([]byte(`{"jsonrpc":"2.0","id":1,"result":{"status":"` + status.Load().(string) + `"}}`))
+	}))
+
+	cli := NewJSONRPCClient(srv.URL)
+	ctx := context.Background()
+	require.NoError(t, cli.Ping(ctx))
+
+	status.Store("degraded")
+	err := cli.Ping(ctx)
+	assert.ErrorIs(t, err, ErrUnhealthy)
+	assert.ErrorContains(t, err, "degraded")
+
+	srv.Close()
+	err = cli.Ping(ctx)
+	require.Error(t, err)
+	assert.NotErrorIs(t, err, ErrUnhealthy)
+}
+
+func TestGetBlockByNumber(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req jsonRPCRequest
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&req))
+		assert.Equal(t, "proxy.getBlock", req.Method)
+		var args GetBlockArgs
+		require.NoError(t, json.Unmarshal(req.Params, &args))
+
+		height := uint64(100)
+		if args.Height != nil {
+			height = *args.Height
+		}
+		block := `{"height":` + strconv.FormatUint(height, 10) + `,"hash":"0xaa","parentHash":"0xbb","timestamp":1700000000`
+		if args.Full {
+			block += `,"txIds":["0x01","0x02"]`
+		}
+		_, _ = w.Write([]byte(`{"jsonrpc":"2.0","id":1,"result":` + block + `}}`))
+	}))
+	defer srv.Close()
+
+	cli := NewJSONRPCClient(srv.URL)
+	ctx := context.Background()
+
+	block, err := cli.GetBlockByNumber(ctx, 10, false)
+	require.NoError(t, err)
+	assert.Equal(t, &Block{Height: 10, Hash: "0xaa", ParentHash: "0xbb", Timestamp: 1700000000}, block)
+
+	block, err = cli.GetBlockByNumber(ctx, 10, true)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"0x01", "0x02"}, block.TxIDs)
+
+	block, err = cli.GetBlockByNumber(ctx, LatestBlock, false)
+	require.NoError(t, err)
+	assert.Equal(t, uint64(100), block.Height)
+}
+
+func TestGetBalance(t *testing.T) {
+	results := map[string]string{
+		"0x01": `"result":"0xde0b6b3a7640000"`,
+		"0x02": `"result":"1000000000000000000"`,
+		"0x03": `"result":1000`,
+		"0x04": `"result":null`,
+		"0x05": `"error":{"code":-32000,"message":"unknown account"}`,
+		"0x06": `"result":"not a number"`,
+		"0x07": `"error":{"code":-32000,"message":"internal error"}`,
+	}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req jsonRPCRequest
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&req))
+		assert.Equal(t, "proxy.getBalance", req.Method)
+		var args GetBalanceArgs
+		require.NoError(t, json.Unmarshal(req.Params, &args))
+		_, _ = w.Write([]byte(`{"jsonrpc":"2.0","id":1,` + results[args.Address] + `}`))
+	}))
+	defer srv.Close()
+
+	cli := NewJSONRPCClient(srv.URL)
+	ctx := context.Background()
+
+	oneEther, _ := new(big.Int).SetString("1000000000000000000", 10)
+	for addr, expected := range map[string]*big.Int{
+		"0x01": oneEther,
+		"0x02": oneEther,
+		"0x03": big.NewInt(1000),
+		// unknown accounts
+		"0x04": big.NewInt(0),
+		"0x05": big.NewInt(0),
+	} {
+		balance, err := cli.GetBalance(ctx, addr)
+		require.NoError(t, err, addr)
+		assert.Equal(t, expected.String(), balance.String(), addr)
+	}
+
+	_, err := cli.GetBalance(ctx, "0x06")
+	assert.ErrorIs(t, err, ErrInvalidBalance)
+
+	_, err = cli.GetBalance(ctx, "0x07")
+	var rpcErr *RPCError
+	assert.ErrorAs(t, err, &rpcErr)
+}
+
+func TestBlockHeight(t *testing.T) {
+	var result atomic.Value
+	var lastAcceptedMissing atomic.Bool
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req jsonRPCRequest
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&req))
+		if req.Method == "proxy.lastAccepted" && lastAcceptedMissing.Load() {
+			_, _ = w.Write([]byte(`{"jsonrpc":"2.0","id":1,"error":{"code":-32601,"message":"method not found"}}`))
+			return
+		}
+		if !lastAcceptedMissing.Load() {
+			assert.Equal(t, "proxy.lastAccepted", req.Method)
+		} else {
+			assert.Equal(t, "proxy.blockHeight", req.Method)
+		}
+		_, _ = w.Write([]byte(`{"jsonrpc":"2.0","id":1,"result":` + result.Load().(string) + `}`))
+	}))
+	defer srv.Close()
+
+	cli := NewJSONRPCClient(srv.URL)
+	ctx := context.Background()
+
+	for _, missing := range []bool{false, true} {
+		lastAcceptedMissing.Store(missing)
+		for raw, expected := range map[string]uint64{
+			`"0x2a"`: 42,
+			`"42"`:   42,
+			`42`:     42,
+			`"0x0"`:  0,
+		} {
+			result.Store(raw)
+			height, err := cli.BlockHeight(ctx)
+			require.NoError(t, err, raw)
+			assert.Equal(t, expected, height, raw)
+		}
+	}
+
+	for _, raw := range []string{`"not a number"`, `"-1"`, `"0x10000000000000000"`} {
+		result.Store(raw)
+		_, err := cli.BlockHeight(ctx)
+		assert.ErrorIs(t, err, ErrInvalidBlockHeight, raw)
+	}
+}
+
+func TestEncodedTxSize(t *testing.T) {
+	for _, size := range []int{0, 1, 2, 3, 4, 1000} {
+		b, err := json.Marshal(&SubmitMsgTxArgs{Data: make([]byte, size)})
+		require.NoError(t, err)
+		assert.Equal(t, len(b), EncodedTxSize(make([]byte, size)))
+	}
+}
+
+func TestSubmitMsgTxMaxSize(t *testing.T) {
+	var calls int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		_, _ = w.Write([]byte(`{"jsonrpc":"2.0","id":1,"result":{"txId":"0x01"}}`))
+	}))
+	defer srv.Close()
+
+	cli := NewJSONRPCClient(srv.URL)
+	data := make([]byte, 300)
+	maxSize := EncodedTxSize(data)
+	cli.SetMaxTxSize(maxSize)
+
+	_, err := cli.SubmitMsgTx(context.Background(), data)
+	require.NoError(t, err)
+
+	// the next size that changes the base64 encoding exceeds the maximum
+	_, err = cli.SubmitMsgTx(context.Background(), make([]byte, len(data)+1))
+	assert.ErrorIs(t, err, ErrTxTooLarge)
+	var tooLargeErr *TxTooLargeError
+	require.True(t, errors.As(err, &tooLargeErr))
+	assert.Equal(t, maxSize+4, tooLargeErr.Size)
+	assert.Equal(t, maxSize, tooLargeErr.MaxSize)
+
+	// the request is not sent
+	assert.Equal(t, int32(1), atomic.LoadInt32(&calls))
+}
+
+func TestSubmitMsgTxIdempotent(t *testing.T) {
+	var (
+		mu    sync.Mutex
+		calls int
+		txIDs = map[string]string{}
+	)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req jsonRPCRequest
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&req))
+		assert.Equal(t, "proxy.submitMsgTx", req.Method)
+		var args SubmitMsgTxArgs
+		require.NoError(t, json.Unmarshal(req.Params, &args))
+
+		mu.Lock()
+		defer mu.Unlock()
+		calls++
+		txID, found := txIDs[args.IdempotencyKey]
+		if !found {
+			txID = "0x" + strconv.Itoa(len(txIDs)+1)
+			txIDs[args.IdempotencyKey] = txID
+			// the tx is created but the response of the first call is lost
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		_, _ = w.Write([]byte(`{"jsonrpc":"2.0","id":1,"result":{"txId":"` + txID + `"}}`))
+	}))
+	defer srv.Close()
+
+	cli := &JSONRPCClient{uri: srv.URL, requester: newTestRequester(srv.URL + JSONRPCEndpoint)}
+	ctx := context.Background()
+
+	// the retry reuses the key, so it gets the tx created by the first call
+	txID, err := cli.SubmitMsgTxIdempotent(ctx, []byte("msg"), "key-1")
+	require.NoError(t, err)
+	assert.Equal(t, "0x1", txID)
+	assert.Equal(t, 2, calls)
+
+	// submitting the key again returns the original tx
+	txID, err = cli.SubmitMsgTxIdempotent(ctx, []byte("msg"), "key-1")
+	require.NoError(t, err)
+	assert.Equal(t, "0x1", txID)
+	assert.Len(t, txIDs, 1)
+
+	txID, err = cli.SubmitMsgTxIdempotent(ctx, []byte("msg"), "key-2")
+	require.NoError(t, err)
+	assert.Equal(t, "0x2", txID)
+
+	_, err = cli.SubmitMsgTxIdempotent(ctx, []byte("msg"), "")
+	assert.ErrorIs(t, err, ErrEmptyIdempotencyKey)
+
+	// the key counts towards the maximum size
+	cli.SetMaxTxSize(EncodedTxSize([]byte("msg")))
+	_, err = cli.SubmitMsgTxIdempotent(ctx, []byte("msg"), "key-3")
+	assert.ErrorIs(t, err, ErrTxTooLarge)
+}
+
+func TestSubmitMsgTxWithMeta(t *testing.T) {
+	testCases := []struct {
+		name             string
+		result           string
+		expectedSequence uint64
+		expectedErr      error
+	}{
+		{
+			name:             "sequence",
+			result:           `{"txId":"0x1","sequence":7}`,
+			expectedSequence: 7,
+		},
+		{
+			name:             "nonce",
+			result:           `{"txId":"0x1","nonce":3}`,
+			expectedSequence: 3,
+		},
+		{
+			name:        "no sequence",
+			result:      `{"txId":"0x1"}`,
+			expectedErr: ErrNoSequence,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				var req jsonRPCRequest
+				require.NoError(t, json.NewDecoder(r.Body).Decode(&req))
+				assert.Equal(t, "proxy.submitMsgTx", req.Method)
+				_, _ = w.Write([]byte(`{"jsonrpc":"2.0","id":1,"result":` + tc.result + `}`))
+			}))
+			defer srv.Close()
+
+			cli := &JSONRPCClient{uri: srv.URL, requester: newTestRequester(srv.URL + JSONRPCEndpoint)}
+			result, err := cli.SubmitMsgTxWithMeta(context.Background(), []byte("msg"))
+			if tc.expectedErr != nil {
+				assert.ErrorIs(t, err, tc.expectedErr)
+			} else {
+				require.NoError(t, err)
+			}
+			assert.Equal(t, "0x1", result.TxID)
+			assert.Equal(t, tc.expectedSequence, result.Sequence)
+
+			txID, err := cli.SubmitMsgTx(context.Background(), []byte("msg"))
+			require.NoError(t, err)
+			assert.Equal(t, "0x1", txID)
+		})
+	}
+}
+
+func TestSubmitMsgTxRateLimit(t *testing.T) {
+	var (
+		mu       sync.Mutex
+		received []time.Time
+	)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		received = append(received, time.Now())
+		mu.Unlock()
+		_, _ = w.Write([]byte(`{"jsonrpc":"2.0","id":1,"result":{"txId":"0x1"}}`))
+	}))
+	defer srv.Close()
+
+	const (
+		n        = 5
+		interval = 50 * time.Millisecond
+	)
+	cli := NewJSONRPCClientWithOptions(srv.URL, ClientOptions{RatePerSec: float64(time.Second / interval), Burst: 1})
+	ctx := context.Background()
+	for i := 0; i < n; i++ {
+		_, err := cli.SubmitMsgTx(ctx, []byte("msg"))
+		require.NoError(t, err)
+	}
+
+	require.Len(t, received, n)
+	for i := 1; i < n; i++ {
+		// some slack for the timer resolution
+		assert.GreaterOrEqual(t, received[i].Sub(received[i-1]), interval-5*time.Millisecond, i)
+	}
+
+	// the wait is bounded by the context
+	ctx, cancel := context.WithTimeout(context.Background(), interval/5)
+	defer cancel()
+	_, err := cli.SubmitMsgTx(ctx, []byte("msg"))
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+	assert.Len(t, received, n)
+}
+
+func TestSubmitMsgTxRetryAfter(t *testing.T) {
+	var requests atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if requests.Add(1) == 1 {
+			w.Header().Set("Retry-After", "1")
+			w.WriteHeader(http.StatusTooManyRequests)
+			return
+		}
+		_, _ = w.Write([]byte(`{"jsonrpc":"2.0","id":1,"result":{"txId":"0x1"}}`))
+	}))
+	defer srv.Close()
+
+	cli := NewJSONRPCClientWithOptions(srv.URL, ClientOptions{RatePerSec: 100, Burst: 10})
+	ctx := context.Background()
+	_, err := cli.SubmitMsgTx(ctx, []byte("msg"))
+	var statusErr *StatusCodeError
+	require.ErrorAs(t, err, &statusErr)
+	assert.Equal(t, http.StatusTooManyRequests, statusErr.StatusCode)
+	assert.Equal(t, time.Second, statusErr.RetryAfter)
+
+	// the next submission is held until the proxy accepts requests again
+	start := time.Now()
+	_, err = cli.SubmitMsgTx(ctx, []byte("msg"))
+	require.NoError(t, err)
+	assert.GreaterOrEqual(t, time.Since(start), 900*time.Millisecond)
+}
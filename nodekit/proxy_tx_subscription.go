@@ -0,0 +1,169 @@
+package nodekit
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"time"
+
+	"github.com/0xPolygonHermez/zkevm-node/log"
+	"github.com/gorilla/websocket"
+)
+
+const (
+	// maxReconnectAttempts is the number of times the tx subscription tries to
+	// reconnect before giving up
+	maxReconnectAttempts = 5
+)
+
+// reconnectBackoff is the wait before the first reconnection attempt of the
+// tx subscription, it's doubled after each attempt
+var reconnectBackoff = 500 * time.Millisecond
+
+type TxEvent struct {
+	TxID string `json:"txId"`
+	// State is either TxStateAccepted or TxStateRejected
+	State       string `json:"state"`
+	BlockHeight uint64 `json:"blockHeight"`
+	// Error is the reason of the rejection of the tx
+	Error string `json:"error,omitempty"`
+
+	// Err is set in the last event sent before closing the channel when the
+	// subscription failed and couldn't be recovered
+	Err error `json:"-"`
+}
+
+// SubscribeTxAccepted opens a WebSocket to the proxy and streams the
+// acceptance and rejection events of the txs. The channel is closed when the
+// context is canceled. Disconnections are recovered reconnecting with backoff,
+// when it's not possible an event with Err set is sent before closing the
+// channel.
+func (j *JSONRPCClient) SubscribeTxAccepted(ctx context.Context) (<-chan TxEvent, error) {
+	addr, err := wsURL(j.uri)
+	if err != nil {
+		return nil, err
+	}
+	conn, err := dialTxSubscription(ctx, addr)
+	if err != nil {
+		return nil, err
+	}
+
+	events := make(chan TxEvent)
+	go streamTxEvents(ctx, addr, conn, events)
+	return events, nil
+}
+
+// wsURL returns the uri of the WebSocket endpoint of the proxy.
+func wsURL(uri string) (string, error) {
+	u, err := url.Parse(uri)
+	if err != nil {
+		return "", err
+	}
+	switch u.Scheme {
+	case "https":
+		u.Scheme = "wss"
+	case "http":
+		u.Scheme = "ws"
+	}
+	u.Path += WebsocketEndpoint
+	return u.String(), nil
+}
+
+func dialTxSubscription(ctx context.Context, addr string) (*websocket.Conn, error) {
+	c, _, err := websocket.DefaultDialer.DialContext(ctx, addr, nil)
+	if err != nil {
+		return nil, err
+	}
+	if err := c.WriteJSON(TxSubscriptionMessage); err != nil {
+		_ = c.Close()
+		return nil, err
+	}
+	return c, nil
+}
+
+func streamTxEvents(ctx context.Context, addr string, conn *websocket.Conn, events chan<- TxEvent) {
+	defer close(events)
+	for {
+		err := readTxEvents(ctx, conn, events)
+		_ = conn.Close()
+		if ctx.Err() != nil {
+			return
+		}
+		log.Warnf("tx subscription to %s disconnected, reconnecting: %v", addr, err)
+
+		conn, err = reconnect(ctx, addr)
+		if err != nil {
+			if ctx.Err() != nil {
+				return
+			}
+			select {
+			case events <- TxEvent{Err: err}:
+			case <-ctx.Done():
+			}
+			return
+		}
+	}
+}
+
+// readTxEvents sends the events received through the connection until it
+// fails or the context is canceled.
+func readTxEvents(ctx context.Context, conn *websocket.Conn, events chan<- TxEvent) error {
+	// closing the connection unblocks ReadMessage when the context is canceled
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-ctx.Done():
+			_ = conn.Close()
+		case <-done:
+		}
+	}()
+
+	for {
+		_, rawMsg, err := conn.ReadMessage()
+		if err != nil {
+			return err
+		}
+
+		msg := new(Message)
+		if err := json.Unmarshal(rawMsg, msg); err != nil {
+			log.Errorf("unable to unmarshal msg, err: %v", err)
+			continue
+		}
+		if msg.Topic != TxTopic {
+			continue
+		}
+		var event TxEvent
+		if err := json.Unmarshal([]byte(msg.Message), &event); err != nil {
+			log.Errorf("unable to unmarshal tx event, err: %v", err)
+			continue
+		}
+
+		select {
+		case events <- event:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+func reconnect(ctx context.Context, addr string) (*websocket.Conn, error) {
+	backoff := reconnectBackoff
+	var err error
+	for attempt := 0; attempt < maxReconnectAttempts; attempt++ {
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(backoff):
+		}
+
+		var conn *websocket.Conn
+		conn, err = dialTxSubscription(ctx, addr)
+		if err == nil {
+			return conn, nil
+		}
+		backoff *= 2
+	}
+	return nil, fmt.Errorf("failed to reconnect to %s after %d attempts: %w", addr, maxReconnectAttempts, err)
+}
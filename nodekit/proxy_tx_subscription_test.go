@@ -0,0 +1,109 @@
+package nodekit
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newTxEventsServer creates a WebSocket server that sends the events of the
+// n-th connection and then closes it. When there are no more events the
+// connections are rejected if reject is set, otherwise they are kept open until
+// the client closes them.
+func newTxEventsServer(t *testing.T, eventsByConn [][]TxEvent, reject bool) *httptest.Server {
+	var conns int32
+	upgrader := websocket.Upgrader{}
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, WebsocketEndpoint, r.URL.Path)
+		n := int(atomic.AddInt32(&conns, 1)) - 1
+		if n >= len(eventsByConn) && reject {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+
+		c, err := upgrader.Upgrade(w, r, nil)
+		require.NoError(t, err)
+		defer c.Close()
+
+		var msg Message
+		require.NoError(t, c.ReadJSON(&msg))
+		assert.Equal(t, TxSubscriptionMessage, msg)
+
+		if n >= len(eventsByConn) {
+			// wait for the client to close the connection
+			_, _, _ = c.ReadMessage()
+			return
+		}
+		for _, event := range eventsByConn[n] {
+			b, err := json.Marshal(event)
+			require.NoError(t, err)
+			require.NoError(t, c.WriteJSON(Message{Action: publish, Topic: TxTopic, Message: string(b)}))
+		}
+	}))
+}
+
+func receiveTxEvent(t *testing.T, events <-chan TxEvent) TxEvent {
+	select {
+	case event, ok := <-events:
+		require.True(t, ok, "events channel closed")
+		return event
+	case <-time.After(5 * time.Second):
+		require.FailNow(t, "timeout waiting for a tx event")
+	}
+	return TxEvent{}
+}
+
+func TestSubscribeTxAccepted(t *testing.T) {
+	defer func(backoff time.Duration) { reconnectBackoff = backoff }(reconnectBackoff)
+	reconnectBackoff = time.Millisecond
+
+	expected := []TxEvent{
+		{TxID: "0x01", State: TxStateAccepted, BlockHeight: 1},
+		{TxID: "0x02", State: TxStateRejected, BlockHeight: 1, Error: "invalid nonce"},
+		{TxID: "0x03", State: TxStateAccepted, BlockHeight: 2},
+	}
+	srv := newTxEventsServer(t, [][]TxEvent{expected[:2], expected[2:]}, false)
+	defer srv.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	events, err := NewJSONRPCClient(srv.URL).SubscribeTxAccepted(ctx)
+	require.NoError(t, err)
+
+	// the last event is received after reconnecting
+	for _, e := range expected {
+		assert.Equal(t, e, receiveTxEvent(t, events))
+	}
+
+	cancel()
+	select {
+	case _, ok := <-events:
+		assert.False(t, ok)
+	case <-time.After(5 * time.Second):
+		require.FailNow(t, "events channel not closed")
+	}
+}
+
+func TestSubscribeTxAcceptedReconnectionFailure(t *testing.T) {
+	defer func(backoff time.Duration) { reconnectBackoff = backoff }(reconnectBackoff)
+	reconnectBackoff = time.Millisecond
+
+	event := TxEvent{TxID: "0x01", State: TxStateAccepted, BlockHeight: 1}
+	srv := newTxEventsServer(t, [][]TxEvent{{event}}, true)
+	defer srv.Close()
+
+	events, err := NewJSONRPCClient(srv.URL).SubscribeTxAccepted(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, event, receiveTxEvent(t, events))
+
+	assert.Error(t, receiveTxEvent(t, events).Err)
+	_, ok := <-events
+	assert.False(t, ok)
+}
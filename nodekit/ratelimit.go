@@ -0,0 +1,124 @@
+package nodekit
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// rateLimiter is a token bucket pacing the submissions of a client. The
+// tokens are reserved, so concurrent callers are spaced instead of being woken
+// up at the same time, and the bucket can be paused when the proxy asks so.
+type rateLimiter struct {
+	mu    sync.Mutex
+	rate  float64
+	burst float64
+	// tokens is negative when there are pending reservations
+	tokens float64
+	// last is the time of the last refill, it's in the future while the
+	// limiter is paused
+	last time.Time
+}
+
+func newRateLimiter(ratePerSec float64, burst int) *rateLimiter {
+	if burst <= 0 {
+		burst = 1
+	}
+	return &rateLimiter{
+		rate:   ratePerSec,
+		burst:  float64(burst),
+		tokens: float64(burst),
+		last:   time.Now(),
+	}
+}
+
+// wait blocks until n tokens are available or the context is done, in which
+// case the tokens are given back.
+func (l *rateLimiter) wait(ctx context.Context, n int) error {
+	delay := l.reserve(n)
+	if delay <= 0 {
+		return nil
+	}
+
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		l.mu.Lock()
+		l.tokens += float64(n)
+		l.mu.Unlock()
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+// reserve takes n tokens and returns how long to wait until they are
+// available.
+func (l *rateLimiter) reserve(n int) time.Duration {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := time.Now()
+	if now.After(l.last) {
+		l.tokens += now.Sub(l.last).Seconds() * l.rate
+		if l.tokens > l.burst {
+			l.tokens = l.burst
+		}
+		l.last = now
+	}
+	l.tokens -= float64(n)
+	delay := l.last.Sub(now)
+	if l.tokens < 0 {
+		delay += time.Duration(-l.tokens / l.rate * float64(time.Second))
+	}
+	return delay
+}
+
+// pause empties the bucket and doesn't refill it for d, e.g. after the proxy
+// responded with a Retry-After header.
+func (l *rateLimiter) pause(d time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	until := time.Now().Add(d)
+	if until.After(l.last) {
+		l.last = until
+		if l.tokens > 0 {
+			l.tokens = 0
+		}
+	}
+}
+
+// adapt pauses the limiter when the error is a 429 status code with a
+// Retry-After header.
+func (l *rateLimiter) adapt(err error) {
+	var statusErr *StatusCodeError
+	if errors.As(err, &statusErr) && statusErr.StatusCode == http.StatusTooManyRequests && statusErr.RetryAfter > 0 {
+		l.pause(statusErr.RetryAfter)
+	}
+}
+
+// parseRetryAfter parses the value of a Retry-After header, which is either a
+// number of seconds or an HTTP date. Zero is returned when it's missing or
+// invalid.
+func parseRetryAfter(value string) time.Duration {
+	if value == "" {
+		return 0
+	}
+	if seconds, err := strconv.Atoi(value); err == nil {
+		if seconds < 0 {
+			return 0
+		}
+		return time.Duration(seconds) * time.Second
+	}
+	if date, err := http.ParseTime(value); err == nil {
+		if d := time.Until(date); d > 0 {
+			return d
+		}
+	}
+	return 0
+}
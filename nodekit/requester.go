@@ -2,7 +2,10 @@ package nodekit
 
 import (
 	"bytes"
+	"compress/gzip"
 	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
@@ -17,6 +20,9 @@ type Option func(*Options)
 type Options struct {
 	headers     http.Header
 	queryParams url.Values
+	// compressThreshold is the size above which the request bodies are
+	// compressed, they are never compressed when it's zero
+	compressThreshold int
 }
 
 func NewOptions(ops []Option) *Options {
@@ -54,12 +60,51 @@ func WithQueryParam(key, val string) Option {
 	}
 }
 
+// WithRequestCompression gzips the request bodies bigger than threshold bytes.
+func WithRequestCompression(threshold int) Option {
+	return func(o *Options) {
+		o.compressThreshold = threshold
+	}
+}
+
+const (
+	DefaultRequestTimeout = 10 * time.Second
+	DefaultRetryBackoff   = 100 * time.Millisecond
+)
+
+// RequesterOptions configures the timeout and the retries of the requests of
+// an EndpointRequester.
+type RequesterOptions struct {
+	// Timeout is the maximum duration of each attempt of a request, no
+	// timeout is applied when it's zero
+	Timeout time.Duration
+	// MaxRetries is the number of times a request is retried after a
+	// transient error: a network error or a 5xx status code
+	MaxRetries int
+	// RetryBackoff is the wait before the first retry, it's doubled after
+	// each retry
+	RetryBackoff time.Duration
+	// Headers are set in every request, e.g. an Authorization header
+	Headers map[string]string
+	// CompressThreshold is the size above which the request bodies are
+	// gzipped, they are never compressed when it's zero. Requests rejected by
+	// the endpoint because of the compression are sent again uncompressed.
+	CompressThreshold int
+}
+
 type EndpointRequester struct {
 	cli       *http.Client
 	uri, base string
+	opts      RequesterOptions
 }
 
 func NewRequester(uri, base string) *EndpointRequester {
+	return NewRequesterWithOptions(uri, base, RequesterOptions{
+		Timeout: DefaultRequestTimeout,
+	})
+}
+
+func NewRequesterWithOptions(uri, base string, opts RequesterOptions) *EndpointRequester {
 	t := http.DefaultTransport.(*http.Transport).Clone()
 	t.MaxIdleConns = 100_000
 	t.MaxConnsPerHost = 100_000
@@ -67,11 +112,11 @@ func NewRequester(uri, base string) *EndpointRequester {
 
 	return &EndpointRequester{
 		cli: &http.Client{
-			Timeout:   10 * time.Second,
 			Transport: t,
 		},
 		uri:  uri,
 		base: base,
+		opts: opts,
 	}
 }
 
@@ -86,15 +131,140 @@ func (e *EndpointRequester) SendRequest(
 	if err != nil {
 		return err
 	}
-	return SendJSONRequest(
-		ctx,
-		e.cli,
-		uri,
-		fmt.Sprintf("%s.%s", e.base, method),
-		params,
-		reply,
-		options...,
-	)
+
+	options = e.withOptions(options)
+	return e.withRetries(ctx, func(ctx context.Context) error {
+		return SendJSONRequest(
+			ctx,
+			e.cli,
+			uri,
+			fmt.Sprintf("%s.%s", e.base, method),
+			params,
+			reply,
+			options...,
+		)
+	})
+}
+
+// SendBatchRequest calls the method once for each of the params in a single
+// JSON-RPC batch request and decodes the results into the replies, which must
+// have the same length as the params. The returned slice holds the error of
+// each call, the returned error is only set when the whole batch failed.
+func (e *EndpointRequester) SendBatchRequest(
+	ctx context.Context,
+	method string,
+	params []interface{},
+	replies []interface{},
+	options ...Option,
+) ([]error, error) {
+	uri, err := url.Parse(e.uri)
+	if err != nil {
+		return nil, err
+	}
+
+	options = e.withOptions(options)
+	var errs []error
+	err = e.withRetries(ctx, func(ctx context.Context) error {
+		var err error
+		errs, err = SendJSONBatchRequest(
+			ctx,
+			e.cli,
+			uri,
+			fmt.Sprintf("%s.%s", e.base, method),
+			params,
+			replies,
+			options...,
+		)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return errs, nil
+}
+
+// withOptions prepends the headers and the compression of the requester to
+// the options, so the options of the call take precedence.
+func (e *EndpointRequester) withOptions(options []Option) []Option {
+	ops := make([]Option, 0, len(e.opts.Headers)+len(options)+1)
+	for key, val := range e.opts.Headers {
+		ops = append(ops, WithHeader(key, val))
+	}
+	if e.opts.CompressThreshold > 0 {
+		ops = append(ops, WithRequestCompression(e.opts.CompressThreshold))
+	}
+	return append(ops, options...)
+}
+
+// withRetries calls send, bounded by the timeout, until it succeeds, it fails
+// with an error that is not transient or the retries are exhausted.
+func (e *EndpointRequester) withRetries(ctx context.Context, send func(ctx context.Context) error) error {
+	backoff := e.opts.RetryBackoff
+	if backoff <= 0 {
+		backoff = DefaultRetryBackoff
+	}
+	for attempt := 0; ; attempt++ {
+		err := e.sendWithTimeout(ctx, send)
+		if err == nil || attempt >= e.opts.MaxRetries || !isTransient(err) {
+			return err
+		}
+
+		select {
+		case <-ctx.Done():
+			return err
+		case <-time.After(backoff):
+		}
+		backoff *= 2
+	}
+}
+
+// sendWithTimeout calls send bounded by the timeout.
+func (e *EndpointRequester) sendWithTimeout(ctx context.Context, send func(ctx context.Context) error) error {
+	if e.opts.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, e.opts.Timeout)
+		defer cancel()
+	}
+	return send(ctx)
+}
+
+// StatusCodeError is returned when the endpoint responds with a non
+// successful status code.
+type StatusCodeError struct {
+	StatusCode int
+	Body       []byte
+	URI        string
+	// RetryAfter is the value of the Retry-After header of the response, it's
+	// zero when the header is missing
+	RetryAfter time.Duration
+}
+
+func (e *StatusCodeError) Error() string {
+	return fmt.Sprintf("received status code: %d %s %s", e.StatusCode, e.Body, e.URI)
+}
+
+// requestError is returned when the request couldn't be issued.
+type requestError struct {
+	err error
+}
+
+func (e *requestError) Error() string {
+	return fmt.Sprintf("failed to issue request: %v", e.err)
+}
+
+func (e *requestError) Unwrap() error {
+	return e.err
+}
+
+// isTransient returns whether the error is a network error or a 5xx status
+// code, which are worth retrying. JSON-RPC application errors are not.
+func isTransient(err error) bool {
+	var statusErr *StatusCodeError
+	if errors.As(err, &statusErr) {
+		return statusErr.StatusCode >= http.StatusInternalServerError
+	}
+	var reqErr *requestError
+	return errors.As(err, &reqErr)
 }
 
 func SendJSONRequest(
@@ -111,40 +281,231 @@ func SendJSONRequest(
 		return fmt.Errorf("failed to encode client params: %w", err)
 	}
 
+	resp, err := postJSON(ctx, cli, uri, requestBodyBytes, options...)
+	if err != nil {
+		return err
+	}
+
+	all, err := io.ReadAll(resp.Body)
+	_ = resp.Body.Close()
+	if err != nil {
+		return fmt.Errorf("failed to read client response: %w", err)
+	}
+	var r response
+	if err := json.Unmarshal(all, &r); err != nil {
+		return fmt.Errorf("failed to decode client response: %w %s %s", err, all, uri.String())
+	}
+	return r.decode(reply)
+}
+
+type batchRequest struct {
+	Version string      `json:"jsonrpc"`
+	Method  string      `json:"method"`
+	Params  interface{} `json:"params"`
+	ID      uint64      `json:"id"`
+}
+
+const (
+	// errCodeServer is the code of the errors returned by the endpoint that
+	// are not valid JSON-RPC error objects
+	errCodeServer = -32000
+)
+
+// ErrNullResult is returned when the response has neither a result nor an
+// error.
+var ErrNullResult = errors.New("result is null")
+
+// RPCError is a JSON-RPC error object returned by the endpoint.
+type RPCError struct {
+	Code    int             `json:"code"`
+	Message string          `json:"message"`
+	Data    json.RawMessage `json:"data,omitempty"`
+}
+
+func (e *RPCError) Error() string {
+	return fmt.Sprintf("json-rpc error %d: %s", e.Code, e.Message)
+}
+
+type response struct {
+	Result json.RawMessage `json:"result"`
+	Error  json.RawMessage `json:"error"`
+	ID     uint64          `json:"id"`
+}
+
+// decode decodes the result into the reply, or returns the error of the
+// response as an *RPCError.
+func (r *response) decode(reply interface{}) error {
+	if len(r.Error) != 0 && string(r.Error) != "null" {
+		rpcErr := new(RPCError)
+		if err := json.Unmarshal(r.Error, rpcErr); err != nil {
+			return &RPCError{Code: errCodeServer, Message: string(r.Error)}
+		}
+		return rpcErr
+	}
+	if len(r.Result) == 0 || string(r.Result) == "null" {
+		return ErrNullResult
+	}
+	return json.Unmarshal(r.Result, reply)
+}
+
+// SendJSONBatchRequest calls the method once for each of the params in a
+// single JSON-RPC batch request, see EndpointRequester.SendBatchRequest.
+func SendJSONBatchRequest(
+	ctx context.Context,
+	cli *http.Client,
+	uri *url.URL,
+	method string,
+	params []interface{},
+	replies []interface{},
+	options ...Option,
+) ([]error, error) {
+	if len(params) != len(replies) {
+		return nil, fmt.Errorf("got %d params and %d replies", len(params), len(replies))
+	}
+
+	requests := make([]batchRequest, len(params))
+	for i, p := range params {
+		requests[i] = batchRequest{
+			Version: "2.0",
+			Method:  method,
+			Params:  p,
+			ID:      uint64(i),
+		}
+	}
+	requestBodyBytes, err := json.Marshal(requests)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode client params: %w", err)
+	}
+
+	resp, err := postJSON(ctx, cli, uri, requestBodyBytes, options...)
+	if err != nil {
+		return nil, err
+	}
+	all, err := io.ReadAll(resp.Body)
+	_ = resp.Body.Close()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read client response: %w", err)
+	}
+	var responses []response
+	if err := json.Unmarshal(all, &responses); err != nil {
+		return nil, fmt.Errorf("failed to decode client response: %w %s %s", err, all, uri.String())
+	}
+
+	// the responses may come in any order, so they are matched by id
+	errs := make([]error, len(params))
+	for i := range errs {
+		errs[i] = fmt.Errorf("missing response for request %d", i)
+	}
+	for _, r := range responses {
+		if r.ID >= uint64(len(params)) {
+			return nil, fmt.Errorf("unexpected response id %d %s", r.ID, uri.String())
+		}
+		errs[r.ID] = r.decode(replies[r.ID])
+	}
+	return errs, nil
+}
+
+// postJSON posts the JSON body to the uri and returns the response when its
+// status code is successful. Gzipped responses are decompressed.
+func postJSON(
+	ctx context.Context,
+	cli *http.Client,
+	uri *url.URL,
+	body []byte,
+	options ...Option,
+) (*http.Response, error) {
 	ops := NewOptions(options)
 	uri.RawQuery = ops.queryParams.Encode()
 
+	compress := ops.compressThreshold > 0 && len(body) > ops.compressThreshold
+	resp, err := post(ctx, cli, uri, body, ops.headers, compress)
+	if err == nil && compress && resp.StatusCode == http.StatusUnsupportedMediaType {
+		// the endpoint doesn't accept compressed requests
+		_ = resp.Body.Close()
+		resp, err = post(ctx, cli, uri, body, ops.headers, false)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.Header.Get("Content-Encoding") == "gzip" {
+		zr, err := gzip.NewReader(resp.Body)
+		if err != nil {
+			_ = resp.Body.Close()
+			return nil, fmt.Errorf("failed to decompress response: %w", err)
+		}
+		resp.Body = &gzipReadCloser{Reader: zr, body: resp.Body}
+	}
+
+	// Return an error for any non successful status code
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		// Drop any error during close to report the original error
+		all, _ := io.ReadAll(resp.Body)
+		_ = resp.Body.Close()
+		return nil, &StatusCodeError{
+			StatusCode: resp.StatusCode,
+			Body:       all,
+			URI:        uri.String(),
+			RetryAfter: parseRetryAfter(resp.Header.Get("Retry-After")),
+		}
+	}
+	return resp, nil
+}
+
+// post sends the request, gzipping the body when compress is set. As the
+// Accept-Encoding header is set explicitly, the responses are not decompressed
+// by the transport.
+func post(
+	ctx context.Context,
+	cli *http.Client,
+	uri *url.URL,
+	body []byte,
+	headers http.Header,
+	compress bool,
+) (*http.Response, error) {
+	if compress {
+		var buf bytes.Buffer
+		zw := gzip.NewWriter(&buf)
+		if _, err := zw.Write(body); err != nil {
+			return nil, fmt.Errorf("failed to compress request: %w", err)
+		}
+		if err := zw.Close(); err != nil {
+			return nil, fmt.Errorf("failed to compress request: %w", err)
+		}
+		body = buf.Bytes()
+	}
+
 	request, err := http.NewRequestWithContext(
 		ctx,
 		http.MethodPost,
 		uri.String(),
-		bytes.NewBuffer(requestBodyBytes),
+		bytes.NewBuffer(body),
 	)
 	if err != nil {
-		return fmt.Errorf("failed to create request: %w", err)
+		return nil, fmt.Errorf("failed to create request: %w", err)
 	}
 
-	request.Header = ops.headers
+	request.Header = headers.Clone()
 	request.Header.Set("Content-Type", "application/json")
+	request.Header.Set("Accept-Encoding", "gzip")
+	if compress {
+		request.Header.Set("Content-Encoding", "gzip")
+	}
 
 	resp, err := cli.Do(request)
 	if err != nil {
-		return fmt.Errorf("failed to issue request: %w", err)
+		return nil, &requestError{err: err}
 	}
+	return resp, nil
+}
 
-	// Return an error for any non successful status code
-	if resp.StatusCode < 200 || resp.StatusCode > 299 {
-		// Drop any error during close to report the original error
-		all, _ := io.ReadAll(resp.Body)
-		_ = resp.Body.Close()
-		return fmt.Errorf("received status code: %d %s %s", resp.StatusCode, all, uri.String())
-	}
+// gzipReadCloser decompresses the body of a response.
+type gzipReadCloser struct {
+	*gzip.Reader
+	body io.ReadCloser
+}
 
-	if err := rpc.DecodeClientResponse(resp.Body, reply); err != nil {
-		// Drop any error during close to report the original error
-		all, _ := io.ReadAll(resp.Body)
-		_ = resp.Body.Close()
-		return fmt.Errorf("failed to decode client response: %w %s %s", err, all, uri.String())
-	}
-	return resp.Body.Close()
+func (g *gzipReadCloser) Close() error {
+	_ = g.Reader.Close()
+	return g.body.Close()
 }
@@ -0,0 +1,210 @@
+package nodekit
+
+import (
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestRequester(uri string) *EndpointRequester {
+	return NewRequesterWithOptions(uri, Name, RequesterOptions{
+		Timeout:      100 * time.Millisecond,
+		MaxRetries:   3,
+		RetryBackoff: time.Millisecond,
+	})
+}
+
+func TestSendRequestRetriesTransientErrors(t *testing.T) {
+	var calls int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&calls, 1) <= 2 {
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		_, _ = w.Write([]byte(`{"jsonrpc":"2.0","id":1,"result":{"txId":"0x01"}}`))
+	}))
+	defer srv.Close()
+
+	reply := new(SubmitMsgTxReply)
+	err := newTestRequester(srv.URL).SendRequest(context.Background(), "submitMsgTx", &SubmitMsgTxArgs{}, reply)
+	require.NoError(t, err)
+	assert.Equal(t, "0x01", reply.TxID)
+	assert.Equal(t, int32(3), atomic.LoadInt32(&calls))
+}
+
+func TestSendRequestDoesNotRetryClientErrors(t *testing.T) {
+	var calls int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		w.WriteHeader(http.StatusBadRequest)
+	}))
+	defer srv.Close()
+
+	err := newTestRequester(srv.URL).SendRequest(context.Background(), "submitMsgTx", &SubmitMsgTxArgs{}, new(SubmitMsgTxReply))
+	var statusErr *StatusCodeError
+	require.True(t, errors.As(err, &statusErr))
+	assert.Equal(t, http.StatusBadRequest, statusErr.StatusCode)
+	assert.Equal(t, int32(1), atomic.LoadInt32(&calls))
+}
+
+func TestSendRequestDoesNotRetryApplicationErrors(t *testing.T) {
+	var calls int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		_, _ = w.Write([]byte(`{"jsonrpc":"2.0","id":1,"error":{"code":-32000,"message":"invalid tx"}}`))
+	}))
+	defer srv.Close()
+
+	err := newTestRequester(srv.URL).SendRequest(context.Background(), "submitMsgTx", &SubmitMsgTxArgs{}, new(SubmitMsgTxReply))
+	require.Error(t, err)
+	assert.Equal(t, int32(1), atomic.LoadInt32(&calls))
+}
+
+func TestSendRequestTimeout(t *testing.T) {
+	var calls int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		// the server only notices that the client went away once the body
+		// is read, the fallback keeps srv.Close from blocking anyway
+		_, _ = io.Copy(io.Discard, r.Body)
+		select {
+		case <-r.Context().Done():
+		case <-time.After(5 * time.Second):
+		}
+	}))
+	defer srv.Close()
+
+	start := time.Now()
+	err := newTestRequester(srv.URL).SendRequest(context.Background(), "submitMsgTx", &SubmitMsgTxArgs{}, new(SubmitMsgTxReply))
+	require.ErrorIs(t, err, context.DeadlineExceeded)
+	assert.Less(t, time.Since(start), 2*time.Second)
+	assert.Equal(t, int32(4), atomic.LoadInt32(&calls))
+}
+
+func TestSendRequestHeaders(t *testing.T) {
+	var calls int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer token" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		// the headers must be kept on retries
+		if atomic.AddInt32(&calls, 1) == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		_, _ = w.Write([]byte(`{"jsonrpc":"2.0","id":1,"result":{"txId":"0x01"}}`))
+	}))
+	defer srv.Close()
+
+	headers := map[string]string{"Authorization": "Bearer token"}
+	requester := NewRequesterWithOptions(srv.URL, Name, RequesterOptions{
+		MaxRetries:   1,
+		RetryBackoff: time.Millisecond,
+		Headers:      headers,
+	})
+	reply := new(SubmitMsgTxReply)
+	require.NoError(t, requester.SendRequest(context.Background(), "submitMsgTx", &SubmitMsgTxArgs{}, reply))
+	assert.Equal(t, "0x01", reply.TxID)
+	assert.Equal(t, int32(2), atomic.LoadInt32(&calls))
+
+	txID, err := NewJSONRPCClientWithHeaders(srv.URL, headers).SubmitMsgTx(context.Background(), []byte{1})
+	require.NoError(t, err)
+	assert.Equal(t, "0x01", txID)
+
+	_, err = NewJSONRPCClient(srv.URL).SubmitMsgTx(context.Background(), []byte{1})
+	var statusErr *StatusCodeError
+	require.True(t, errors.As(err, &statusErr))
+	assert.Equal(t, http.StatusUnauthorized, statusErr.StatusCode)
+}
+
+func TestSendRequestRPCError(t *testing.T) {
+	newServer := func(respErr string) *httptest.Server {
+		return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			_, _ = w.Write([]byte(`{"jsonrpc":"2.0","id":1,"error":` + respErr + `}`))
+		}))
+	}
+
+	srv := newServer(`{"code":-32001,"message":"tx already known","data":{"txId":"0x01"}}`)
+	defer srv.Close()
+	_, err := NewJSONRPCClient(srv.URL).SubmitMsgTx(context.Background(), []byte{1})
+	var rpcErr *RPCError
+	require.True(t, errors.As(err, &rpcErr))
+	assert.Equal(t, -32001, rpcErr.Code)
+	assert.Equal(t, "tx already known", rpcErr.Message)
+	assert.JSONEq(t, `{"txId":"0x01"}`, string(rpcErr.Data))
+
+	// errors that are not JSON-RPC error objects are kept as the message
+	srv = newServer(`"invalid signature"`)
+	defer srv.Close()
+	_, err = NewJSONRPCClient(srv.URL).SubmitMsgTx(context.Background(), []byte{1})
+	require.True(t, errors.As(err, &rpcErr))
+	assert.Equal(t, errCodeServer, rpcErr.Code)
+	assert.Equal(t, `"invalid signature"`, rpcErr.Message)
+}
+
+func TestSendRequestGzip(t *testing.T) {
+	var compressedReqs int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body := io.Reader(r.Body)
+		if r.Header.Get("Content-Encoding") == "gzip" {
+			atomic.AddInt32(&compressedReqs, 1)
+			zr, err := gzip.NewReader(r.Body)
+			require.NoError(t, err)
+			body = zr
+		}
+		var req jsonRPCRequest
+		require.NoError(t, json.NewDecoder(body).Decode(&req))
+		var args SubmitMsgTxArgs
+		require.NoError(t, json.Unmarshal(req.Params, &args))
+
+		require.Equal(t, "gzip", r.Header.Get("Accept-Encoding"))
+		w.Header().Set("Content-Encoding", "gzip")
+		zw := gzip.NewWriter(w)
+		_, _ = zw.Write([]byte(`{"jsonrpc":"2.0","id":1,"result":{"txId":"` + fmt.Sprint(len(args.Data)) + `"}}`))
+		require.NoError(t, zw.Close())
+	}))
+	defer srv.Close()
+
+	requester := NewRequesterWithOptions(srv.URL, Name, RequesterOptions{CompressThreshold: 500})
+	for _, size := range []int{10, 1000} {
+		reply := new(SubmitMsgTxReply)
+		err := requester.SendRequest(context.Background(), "submitMsgTx", &SubmitMsgTxArgs{Data: make([]byte, size)}, reply)
+		require.NoError(t, err)
+		assert.Equal(t, fmt.Sprint(size), reply.TxID)
+	}
+	// only the request above the threshold is compressed, the small one is
+	// about 110 bytes once wrapped in the JSON-RPC request
+	assert.Equal(t, int32(1), atomic.LoadInt32(&compressedReqs))
+}
+
+func TestSendRequestGzipNotSupported(t *testing.T) {
+	var calls int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		if r.Header.Get("Content-Encoding") != "" {
+			w.WriteHeader(http.StatusUnsupportedMediaType)
+			return
+		}
+		_, _ = w.Write([]byte(`{"jsonrpc":"2.0","id":1,"result":{"txId":"0x01"}}`))
+	}))
+	defer srv.Close()
+
+	requester := NewRequesterWithOptions(srv.URL, Name, RequesterOptions{CompressThreshold: 500})
+	reply := new(SubmitMsgTxReply)
+	err := requester.SendRequest(context.Background(), "submitMsgTx", &SubmitMsgTxArgs{Data: make([]byte, 1000)}, reply)
+	require.NoError(t, err)
+	assert.Equal(t, "0x01", reply.TxID)
+	assert.Equal(t, int32(2), atomic.LoadInt32(&calls))
+}
@@ -564,6 +564,82 @@ func (s *State) GetLastBatch(ctx context.Context, dbTx pgx.Tx) (*Batch, error) {
 	return batches[0], nil
 }
 
+// GetLastConsolidatedBatch gets the last batch verified on L1. It returns
+// ErrNoConsolidatedBatch when only the genesis batch is verified.
+func (s *State) GetLastConsolidatedBatch(ctx context.Context) (*Batch, error) {
+	lastVerifiedBatch, err := s.GetLastVerifiedBatch(ctx, nil)
+	if errors.Is(err, ErrNotFound) {
+		return nil, ErrNoConsolidatedBatch
+	} else if err != nil {
+		return nil, err
+	}
+	if lastVerifiedBatch.BatchNumber == 0 {
+		return nil, ErrNoConsolidatedBatch
+	}
+	return s.GetBatchByNumber(ctx, lastVerifiedBatch.BatchNumber, nil)
+}
+
+// GetLastVirtualBatch gets the last batch sequenced on L1. It returns
+// ErrNoVirtualBatch when only the genesis batch is virtualized.
+func (s *State) GetLastVirtualBatch(ctx context.Context) (*Batch, error) {
+	lastVirtualBatchNum, err := s.GetLastVirtualBatchNum(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	if lastVirtualBatchNum == 0 {
+		return nil, ErrNoVirtualBatch
+	}
+	return s.GetBatchByNumber(ctx, lastVirtualBatchNum, nil)
+}
+
+// BatchPointers are the numbers of the last batches of the state at each
+// stage, LastConsolidated <= LastVirtual <= LastSeen
+type BatchPointers struct {
+	// LastSeen is the last batch of the state, trusted or not
+	LastSeen uint64
+	// LastVirtual is the last batch sequenced on L1
+	LastVirtual uint64
+	// LastConsolidated is the last batch verified on L1
+	LastConsolidated uint64
+}
+
+// GetBatchPointers returns the last batch of each stage read from a single
+// snapshot of the database, so they are consistent with each other. The
+// pointers only move forward and they are read from the latest stage to the
+// earliest, so they keep their order even if the snapshot can't be taken.
+func (s *State) GetBatchPointers(ctx context.Context) (BatchPointers, error) {
+	dbTx, err := s.BeginStateTransaction(ctx)
+	if err != nil {
+		return BatchPointers{}, err
+	}
+	// nothing is written, so the tx is always rolled back
+	defer func() {
+		if err := dbTx.Rollback(ctx); err != nil {
+			log.Errorf("failed to rollback the tx of the batch pointers: %v", err)
+		}
+	}()
+	if _, err := dbTx.Exec(ctx, "SET TRANSACTION ISOLATION LEVEL REPEATABLE READ READ ONLY"); err != nil {
+		return BatchPointers{}, err
+	}
+
+	var pointers BatchPointers
+	lastVerifiedBatch, err := s.GetLastVerifiedBatch(ctx, dbTx)
+	if err != nil && !errors.Is(err, ErrNotFound) {
+		return BatchPointers{}, err
+	} else if err == nil {
+		pointers.LastConsolidated = lastVerifiedBatch.BatchNumber
+	}
+	pointers.LastVirtual, err = s.GetLastVirtualBatchNum(ctx, dbTx)
+	if err != nil {
+		return BatchPointers{}, err
+	}
+	pointers.LastSeen, err = s.GetLastBatchNumber(ctx, dbTx)
+	if err != nil {
+		return BatchPointers{}, err
+	}
+	return pointers, nil
+}
+
 // GetBatchTimestamp returns the batch timestamp.
 //
 //	   for >= etrog is stored on virtual_batch.batch_timestamp
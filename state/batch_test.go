@@ -0,0 +1,53 @@
+package state_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/0xPolygonHermez/zkevm-node/state"
+	"github.com/0xPolygonHermez/zkevm-node/state/mocks"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGetLastConsolidatedAndVirtualBatchGenesis(t *testing.T) {
+	ctx := context.Background()
+	mockStorage := mocks.NewStorageMock(t)
+	testState := state.NewState(state.Config{}, mockStorage, nil, nil, nil, nil, nil)
+
+	// only the genesis batch is virtualized and verified
+	mockStorage.EXPECT().GetLastVerifiedBatch(ctx, nil).Return(&state.VerifiedBatch{BatchNumber: 0}, nil).Once()
+	mockStorage.EXPECT().GetLastVirtualBatchNum(ctx, nil).Return(uint64(0), nil).Once()
+	_, err := testState.GetLastConsolidatedBatch(ctx)
+	assert.ErrorIs(t, err, state.ErrNoConsolidatedBatch)
+	_, err = testState.GetLastVirtualBatch(ctx)
+	assert.ErrorIs(t, err, state.ErrNoVirtualBatch)
+
+	// nothing is verified
+	mockStorage.EXPECT().GetLastVerifiedBatch(ctx, nil).Return(nil, state.ErrNotFound).Once()
+	_, err = testState.GetLastConsolidatedBatch(ctx)
+	assert.ErrorIs(t, err, state.ErrNoConsolidatedBatch)
+}
+
+func TestGetLastConsolidatedAndVirtualBatch(t *testing.T) {
+	ctx := context.Background()
+	mockStorage := mocks.NewStorageMock(t)
+	testState := state.NewState(state.Config{}, mockStorage, nil, nil, nil, nil, nil)
+
+	verifiedBatch := &state.Batch{BatchNumber: 2, StateRoot: common.HexToHash("0x2"), Timestamp: time.Unix(1700000000, 0)}
+	virtualBatch := &state.Batch{BatchNumber: 3, StateRoot: common.HexToHash("0x3"), Timestamp: time.Unix(1700000010, 0)}
+	mockStorage.EXPECT().GetLastVerifiedBatch(ctx, nil).Return(&state.VerifiedBatch{BatchNumber: 2}, nil).Once()
+	mockStorage.EXPECT().GetLastVirtualBatchNum(ctx, nil).Return(uint64(3), nil).Once()
+	mockStorage.EXPECT().GetBatchByNumber(ctx, uint64(2), nil).Return(verifiedBatch, nil).Once()
+	mockStorage.EXPECT().GetBatchByNumber(ctx, uint64(3), nil).Return(virtualBatch, nil).Once()
+
+	batch, err := testState.GetLastConsolidatedBatch(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, verifiedBatch, batch)
+
+	batch, err = testState.GetLastVirtualBatch(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, virtualBatch, batch)
+}
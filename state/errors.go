@@ -4,6 +4,7 @@ import (
 	"errors"
 	"fmt"
 
+	"github.com/ethereum/go-ethereum/common"
 	"github.com/umbracle/ethgo/abi"
 )
 
@@ -67,6 +68,20 @@ var (
 	// ErrMaxNativeBlockHashBlockRangeLimitExceeded returned when the range between block number range
 	// to filter native block hashes is bigger than the configured limit
 	ErrMaxNativeBlockHashBlockRangeLimitExceeded = errors.New("native block hashes are limited to a %v block range")
+	// ErrInvalidSnapshot indicates the snapshot is malformed or has an unsupported version
+	ErrInvalidSnapshot = errors.New("invalid snapshot")
+	// ErrSnapshotRootMismatch indicates the state root computed from the snapshot
+	// doesn't match the exported one
+	ErrSnapshotRootMismatch = errors.New("snapshot state root mismatch")
+	// ErrNoConsolidatedBatch indicates that no batch but the genesis one has
+	// been verified yet
+	ErrNoConsolidatedBatch = errors.New("no batch consolidated yet")
+	// ErrNoVirtualBatch indicates that no batch but the genesis one has been
+	// sequenced yet
+	ErrNoVirtualBatch = errors.New("no batch virtualized yet")
+	// ErrStopIteration is returned by the callbacks of the iterations to stop
+	// them early without an error
+	ErrStopIteration = errors.New("stop iteration")
 )
 
 // ConstructErrorFromRevert extracts the reverted reason from the provided returnValue
@@ -96,3 +111,18 @@ func (b BatchRemainingResourcesUnderflowError) Error() string {
 func constructErrorMsg(resourceName string) string {
 	return fmt.Sprintf("underflow of remaining resources for current batch. Resource %s", resourceName)
 }
+
+// TxNotFoundError is returned when a transaction is not stored in the state
+type TxNotFoundError struct {
+	Hash common.Hash
+}
+
+// Error returns the error message
+func (e *TxNotFoundError) Error() string {
+	return fmt.Sprintf("transaction %s not found", e.Hash.String())
+}
+
+// Unwrap returns ErrNotFound, so the error can be checked with errors.Is
+func (e *TxNotFoundError) Unwrap() error {
+	return ErrNotFound
+}
@@ -38,6 +38,10 @@ type GenesisAction struct {
 	Root            string `json:"root"`
 }
 
+// genesisBulkThreshold is the number of genesis leaves above which they are
+// set together instead of one by one, see merkletree.StateTree.SetLeaves.
+const genesisBulkThreshold = 1000
+
 // SetGenesis populates state with genesis information
 func (s *State) SetGenesis(ctx context.Context, block Block, genesis Genesis, m metrics.CallerLabel, dbTx pgx.Tx) (common.Hash, error) {
 	var (
@@ -60,56 +64,17 @@ func (s *State) SetGenesis(ctx context.Context, block Block, genesis Genesis, m
 		return common.Hash{}, err
 	}
 
-	for _, action := range genesis.Actions {
-		address := common.HexToAddress(action.Address)
-		switch action.Type {
-		case int(merkletree.LeafTypeBalance):
-			balance, err := encoding.DecodeBigIntHexOrDecimal(action.Value)
-			if err != nil {
-				return common.Hash{}, err
-			}
-			genesisStateRoot, _, err = s.tree.SetBalance(ctx, address, balance, genesisStateRoot, uuid)
-			if err != nil {
-				return common.Hash{}, err
-			}
-		case int(merkletree.LeafTypeNonce):
-			nonce, err := encoding.DecodeBigIntHexOrDecimal(action.Value)
-			if err != nil {
-				return common.Hash{}, err
-			}
-			genesisStateRoot, _, err = s.tree.SetNonce(ctx, address, nonce, genesisStateRoot, uuid)
-			if err != nil {
-				return common.Hash{}, err
-			}
-		case int(merkletree.LeafTypeCode):
-			code, err := hex.DecodeHex(action.Bytecode)
-			if err != nil {
-				return common.Hash{}, fmt.Errorf("could not decode SC bytecode for address %q: %v", address, err)
-			}
-			genesisStateRoot, _, err = s.tree.SetCode(ctx, address, code, genesisStateRoot, uuid)
-			if err != nil {
-				return common.Hash{}, err
-			}
-		case int(merkletree.LeafTypeStorage):
-			// Parse position and value
-			positionBI, err := encoding.DecodeBigIntHexOrDecimal(action.StoragePosition)
-			if err != nil {
-				return common.Hash{}, err
-			}
-			valueBI, err := encoding.DecodeBigIntHexOrDecimal(action.Value)
-			if err != nil {
-				return common.Hash{}, err
-			}
-			// Store
-			genesisStateRoot, _, err = s.tree.SetStorageAt(ctx, address, positionBI, valueBI, genesisStateRoot, uuid)
-			if err != nil {
-				return common.Hash{}, err
-			}
-		case int(merkletree.LeafTypeSCLength):
-			log.Debug("Skipped genesis action of type merkletree.LeafTypeSCLength, these actions will be handled as part of merkletree.LeafTypeCode actions")
-		default:
-			return common.Hash{}, fmt.Errorf("unknown genesis action type %q", action.Type)
-		}
+	leaves, err := genesisLeaves(genesis.Actions)
+	if err != nil {
+		return common.Hash{}, err
+	}
+	if len(leaves) > genesisBulkThreshold {
+		genesisStateRoot, err = s.tree.SetLeaves(ctx, genesisStateRoot, leaves, uuid)
+	} else {
+		genesisStateRoot, err = s.setGenesisLeaves(ctx, genesisStateRoot, leaves, uuid)
+	}
+	if err != nil {
+		return common.Hash{}, err
 	}
 
 	root.SetBytes(genesisStateRoot)
@@ -210,3 +175,63 @@ func (s *State) SetGenesis(ctx context.Context, block Block, genesis Genesis, m
 	}
 	return root, nil
 }
+
+// genesisLeaves returns the leaves set by the genesis actions, in order.
+func genesisLeaves(actions []*GenesisAction) ([]merkletree.LeafUpdate, error) {
+	leaves := make([]merkletree.LeafUpdate, 0, len(actions))
+	for _, action := range actions {
+		address := common.HexToAddress(action.Address)
+		switch action.Type {
+		case int(merkletree.LeafTypeBalance), int(merkletree.LeafTypeNonce):
+			value, err := encoding.DecodeBigIntHexOrDecimal(action.Value)
+			if err != nil {
+				return nil, err
+			}
+			leaves = append(leaves, merkletree.LeafUpdate{Address: address, Type: merkletree.LeafType(action.Type), Value: value})
+		case int(merkletree.LeafTypeCode):
+			code, err := hex.DecodeHex(action.Bytecode)
+			if err != nil {
+				return nil, fmt.Errorf("could not decode SC bytecode for address %q: %v", address, err)
+			}
+			leaves = append(leaves, merkletree.LeafUpdate{Address: address, Type: merkletree.LeafTypeCode, Code: code})
+		case int(merkletree.LeafTypeStorage):
+			// Parse position and value
+			positionBI, err := encoding.DecodeBigIntHexOrDecimal(action.StoragePosition)
+			if err != nil {
+				return nil, err
+			}
+			valueBI, err := encoding.DecodeBigIntHexOrDecimal(action.Value)
+			if err != nil {
+				return nil, err
+			}
+			leaves = append(leaves, merkletree.LeafUpdate{Address: address, Type: merkletree.LeafTypeStorage, Position: positionBI, Value: valueBI})
+		case int(merkletree.LeafTypeSCLength):
+			log.Debug("Skipped genesis action of type merkletree.LeafTypeSCLength, these actions will be handled as part of merkletree.LeafTypeCode actions")
+		default:
+			return nil, fmt.Errorf("unknown genesis action type %q", action.Type)
+		}
+	}
+	return leaves, nil
+}
+
+// setGenesisLeaves sets the genesis leaves one by one and returns the new
+// root.
+func (s *State) setGenesisLeaves(ctx context.Context, root []byte, leaves []merkletree.LeafUpdate, uuid string) ([]byte, error) {
+	var err error
+	for _, leaf := range leaves {
+		switch leaf.Type {
+		case merkletree.LeafTypeBalance:
+			root, _, err = s.tree.SetBalance(ctx, leaf.Address, leaf.Value, root, uuid)
+		case merkletree.LeafTypeNonce:
+			root, _, err = s.tree.SetNonce(ctx, leaf.Address, leaf.Value, root, uuid)
+		case merkletree.LeafTypeCode:
+			root, _, err = s.tree.SetCode(ctx, leaf.Address, leaf.Code, root, uuid)
+		case merkletree.LeafTypeStorage:
+			root, _, err = s.tree.SetStorageAt(ctx, leaf.Address, leaf.Position, leaf.Value, root, uuid)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	return root, nil
+}
@@ -0,0 +1,78 @@
+package state_test
+
+import (
+	"context"
+	"fmt"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/0xPolygonHermez/zkevm-node/merkletree"
+	"github.com/0xPolygonHermez/zkevm-node/state"
+	"github.com/0xPolygonHermez/zkevm-node/state/mocks"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSetGenesisManyAccounts(t *testing.T) {
+	ctx := context.Background()
+	const accounts = 5000
+
+	var actions []*state.GenesisAction
+	for i := 1; i <= accounts; i++ {
+		address := common.BigToAddress(big.NewInt(int64(i))).Hex()
+		actions = append(actions,
+			&state.GenesisAction{Address: address, Type: int(merkletree.LeafTypeBalance), Value: fmt.Sprintf("%d", i*1000)},
+			&state.GenesisAction{Address: address, Type: int(merkletree.LeafTypeNonce), Value: fmt.Sprintf("%d", i%7)},
+		)
+	}
+	scAddress := common.HexToAddress("0xae4bb80be56b819606589de61d5ec3b522eeb032")
+	actions = append(actions,
+		&state.GenesisAction{Address: scAddress.Hex(), Type: int(merkletree.LeafTypeCode), Bytecode: "0x6080604052348015600f57600080fd5b50"},
+		&state.GenesisAction{Address: scAddress.Hex(), Type: int(merkletree.LeafTypeStorage), StoragePosition: "0x02", Value: "0x2a"},
+	)
+
+	// the naive root, setting the leaves one by one
+	naiveTree := merkletree.NewStateTree(merkletree.NewLocalHashDBClient(merkletree.NewMemStore()))
+	txID := uuid.NewString()
+	root := state.ZeroHash.Bytes()
+	start := time.Now()
+	for i := 1; i <= accounts; i++ {
+		var err error
+		address := common.BigToAddress(big.NewInt(int64(i)))
+		root, _, err = naiveTree.SetBalance(ctx, address, big.NewInt(int64(i*1000)), root, txID)
+		require.NoError(t, err)
+		root, _, err = naiveTree.SetNonce(ctx, address, big.NewInt(int64(i%7)), root, txID)
+		require.NoError(t, err)
+	}
+	root, _, err := naiveTree.SetCode(ctx, scAddress, common.FromHex("0x6080604052348015600f57600080fd5b50"), root, txID)
+	require.NoError(t, err)
+	root, _, err = naiveTree.SetStorageAt(ctx, scAddress, big.NewInt(2), big.NewInt(42), root, txID)
+	require.NoError(t, err)
+	naiveDuration := time.Since(start)
+
+	storage := mocks.NewStorageMock(t)
+	dbTx := mocks.NewDbTxMock(t)
+	storage.EXPECT().AddBlock(ctx, mock.Anything, dbTx).Return(nil)
+	storage.EXPECT().StoreGenesisBatch(ctx, mock.Anything, mock.Anything, dbTx).Return(nil)
+	storage.EXPECT().GetForkIDByBatchNumber(uint64(0)).Return(uint64(state.FORKID_ETROG))
+	storage.EXPECT().AddVirtualBatch(ctx, mock.Anything, dbTx).Return(nil)
+	storage.EXPECT().AddVerifiedBatch(ctx, mock.Anything, dbTx).Return(nil)
+	storage.EXPECT().AddL2Block(ctx, uint64(0), mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything, dbTx).Return(nil)
+	tree := merkletree.NewStateTree(merkletree.NewLocalHashDBClient(merkletree.NewMemStore()))
+	st := state.NewState(state.Config{}, storage, nil, tree, nil, nil, nil)
+
+	start = time.Now()
+	genesisRoot, err := st.SetGenesis(ctx, state.Block{ReceivedAt: time.Unix(1700000000, 0)}, state.Genesis{Actions: actions}, "", dbTx)
+	require.NoError(t, err)
+	bulkDuration := time.Since(start)
+	t.Logf("naive genesis took %s, bulk genesis took %s (%.1fx)", naiveDuration, bulkDuration, naiveDuration.Seconds()/bulkDuration.Seconds())
+
+	assert.Equal(t, common.BytesToHash(root), genesisRoot)
+	balance, err := st.GetBalance(ctx, common.BigToAddress(big.NewInt(accounts)), genesisRoot)
+	require.NoError(t, err)
+	assert.Equal(t, big.NewInt(accounts*1000), balance)
+}
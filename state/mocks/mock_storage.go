@@ -178,6 +178,54 @@ func (_c *StorageMock_AddBlock_Call) RunAndReturn(run func(context.Context, *sta
 	return _c
 }
 
+// AddClosedBatch provides a mock function with given fields: ctx, batch, dbTx
+func (_m *StorageMock) AddClosedBatch(ctx context.Context, batch state.Batch, dbTx pgx.Tx) error {
+	ret := _m.Called(ctx, batch, dbTx)
+
+	if len(ret) == 0 {
+		panic("no return value specified for AddClosedBatch")
+	}
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context, state.Batch, pgx.Tx) error); ok {
+		r0 = rf(ctx, batch, dbTx)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// StorageMock_AddClosedBatch_Call is a *mock.Call that shadows Run/Return methods with type explicit version for method 'AddClosedBatch'
+type StorageMock_AddClosedBatch_Call struct {
+	*mock.Call
+}
+
+// AddClosedBatch is a helper method to define mock.On call
+//   - ctx context.Context
+//   - batch state.Batch
+//   - dbTx pgx.Tx
+func (_e *StorageMock_Expecter) AddClosedBatch(ctx interface{}, batch interface{}, dbTx interface{}) *StorageMock_AddClosedBatch_Call {
+	return &StorageMock_AddClosedBatch_Call{Call: _e.mock.On("AddClosedBatch", ctx, batch, dbTx)}
+}
+
+func (_c *StorageMock_AddClosedBatch_Call) Run(run func(ctx context.Context, batch state.Batch, dbTx pgx.Tx)) *StorageMock_AddClosedBatch_Call {
+	_c.Call.Run(func(args mock.Arguments) {
+		run(args[0].(context.Context), args[1].(state.Batch), args[2].(pgx.Tx))
+	})
+	return _c
+}
+
+func (_c *StorageMock_AddClosedBatch_Call) Return(_a0 error) *StorageMock_AddClosedBatch_Call {
+	_c.Call.Return(_a0)
+	return _c
+}
+
+func (_c *StorageMock_AddClosedBatch_Call) RunAndReturn(run func(context.Context, state.Batch, pgx.Tx) error) *StorageMock_AddClosedBatch_Call {
+	_c.Call.Return(run)
+	return _c
+}
+
 // AddForcedBatch provides a mock function with given fields: ctx, forcedBatch, tx
 func (_m *StorageMock) AddForcedBatch(ctx context.Context, forcedBatch *state.ForcedBatch, tx pgx.Tx) error {
 	ret := _m.Called(ctx, forcedBatch, tx)
@@ -1290,6 +1338,65 @@ func (_c *StorageMock_DeleteBatchProofs_Call) RunAndReturn(run func(context.Cont
 	return _c
 }
 
+// DeleteBatchesOlderThanBatchNumber provides a mock function with given fields: ctx, batchNumber, keepVerified, dbTx
+func (_m *StorageMock) DeleteBatchesOlderThanBatchNumber(ctx context.Context, batchNumber uint64, keepVerified bool, dbTx pgx.Tx) (int64, error) {
+	ret := _m.Called(ctx, batchNumber, keepVerified, dbTx)
+
+	if len(ret) == 0 {
+		panic("no return value specified for DeleteBatchesOlderThanBatchNumber")
+	}
+
+	var r0 int64
+	var r1 error
+	if rf, ok := ret.Get(0).(func(context.Context, uint64, bool, pgx.Tx) (int64, error)); ok {
+		return rf(ctx, batchNumber, keepVerified, dbTx)
+	}
+	if rf, ok := ret.Get(0).(func(context.Context, uint64, bool, pgx.Tx) int64); ok {
+		r0 = rf(ctx, batchNumber, keepVerified, dbTx)
+	} else {
+		r0 = ret.Get(0).(int64)
+	}
+
+	if rf, ok := ret.Get(1).(func(context.Context, uint64, bool, pgx.Tx) error); ok {
+		r1 = rf(ctx, batchNumber, keepVerified, dbTx)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// StorageMock_DeleteBatchesOlderThanBatchNumber_Call is a *mock.Call that shadows Run/Return methods with type explicit version for method 'DeleteBatchesOlderThanBatchNumber'
+type StorageMock_DeleteBatchesOlderThanBatchNumber_Call struct {
+	*mock.Call
+}
+
+// DeleteBatchesOlderThanBatchNumber is a helper method to define mock.On call
+//   - ctx context.Context
+//   - batchNumber uint64
+//   - keepVerified bool
+//   - dbTx pgx.Tx
+func (_e *StorageMock_Expecter) DeleteBatchesOlderThanBatchNumber(ctx interface{}, batchNumber interface{}, keepVerified interface{}, dbTx interface{}) *StorageMock_DeleteBatchesOlderThanBatchNumber_Call {
+	return &StorageMock_DeleteBatchesOlderThanBatchNumber_Call{Call: _e.mock.On("DeleteBatchesOlderThanBatchNumber", ctx, batchNumber, keepVerified, dbTx)}
+}
+
+func (_c *StorageMock_DeleteBatchesOlderThanBatchNumber_Call) Run(run func(ctx context.Context, batchNumber uint64, keepVerified bool, dbTx pgx.Tx)) *StorageMock_DeleteBatchesOlderThanBatchNumber_Call {
+	_c.Call.Run(func(args mock.Arguments) {
+		run(args[0].(context.Context), args[1].(uint64), args[2].(bool), args[3].(pgx.Tx))
+	})
+	return _c
+}
+
+func (_c *StorageMock_DeleteBatchesOlderThanBatchNumber_Call) Return(_a0 int64, _a1 error) *StorageMock_DeleteBatchesOlderThanBatchNumber_Call {
+	_c.Call.Return(_a0, _a1)
+	return _c
+}
+
+func (_c *StorageMock_DeleteBatchesOlderThanBatchNumber_Call) RunAndReturn(run func(context.Context, uint64, bool, pgx.Tx) (int64, error)) *StorageMock_DeleteBatchesOlderThanBatchNumber_Call {
+	_c.Call.Return(run)
+	return _c
+}
+
 // DeleteUngeneratedBatchProofs provides a mock function with given fields: ctx, dbTx
 func (_m *StorageMock) DeleteUngeneratedBatchProofs(ctx context.Context, dbTx pgx.Tx) error {
 	ret := _m.Called(ctx, dbTx)
@@ -6156,6 +6263,75 @@ func (_c *StorageMock_GetTimeForLatestBatchVirtualization_Call) RunAndReturn(run
 	return _c
 }
 
+// GetTransactionAndLocationByHash provides a mock function with given fields: ctx, transactionHash, dbTx
+func (_m *StorageMock) GetTransactionAndLocationByHash(ctx context.Context, transactionHash common.Hash, dbTx pgx.Tx) (*types.Transaction, *state.TxLocation, error) {
+	ret := _m.Called(ctx, transactionHash, dbTx)
+
+	if len(ret) == 0 {
+		panic("no return value specified for GetTransactionAndLocationByHash")
+	}
+
+	var r0 *types.Transaction
+	var r1 *state.TxLocation
+	var r2 error
+	if rf, ok := ret.Get(0).(func(context.Context, common.Hash, pgx.Tx) (*types.Transaction, *state.TxLocation, error)); ok {
+		return rf(ctx, transactionHash, dbTx)
+	}
+	if rf, ok := ret.Get(0).(func(context.Context, common.Hash, pgx.Tx) *types.Transaction); ok {
+		r0 = rf(ctx, transactionHash, dbTx)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*types.Transaction)
+		}
+	}
+
+	if rf, ok := ret.Get(1).(func(context.Context, common.Hash, pgx.Tx) *state.TxLocation); ok {
+		r1 = rf(ctx, transactionHash, dbTx)
+	} else {
+		if ret.Get(1) != nil {
+			r1 = ret.Get(1).(*state.TxLocation)
+		}
+	}
+
+	if rf, ok := ret.Get(2).(func(context.Context, common.Hash, pgx.Tx) error); ok {
+		r2 = rf(ctx, transactionHash, dbTx)
+	} else {
+		r2 = ret.Error(2)
+	}
+
+	return r0, r1, r2
+}
+
+// StorageMock_GetTransactionAndLocationByHash_Call is a *mock.Call that shadows Run/Return methods with type explicit version for method 'GetTransactionAndLocationByHash'
+type StorageMock_GetTransactionAndLocationByHash_Call struct {
+	*mock.Call
+}
+
+// GetTransactionAndLocationByHash is a helper method to define mock.On call
+//   - ctx context.Context
+//   - transactionHash common.Hash
+//   - dbTx pgx.Tx
+func (_e *StorageMock_Expecter) GetTransactionAndLocationByHash(ctx interface{}, transactionHash interface{}, dbTx interface{}) *StorageMock_GetTransactionAndLocationByHash_Call {
+	return &StorageMock_GetTransactionAndLocationByHash_Call{Call: _e.mock.On("GetTransactionAndLocationByHash", ctx, transactionHash, dbTx)}
+}
+
+func (_c *StorageMock_GetTransactionAndLocationByHash_Call) Run(run func(ctx context.Context, transactionHash common.Hash, dbTx pgx.Tx)) *StorageMock_GetTransactionAndLocationByHash_Call {
+	_c.Call.Run(func(args mock.Arguments) {
+		run(args[0].(context.Context), args[1].(common.Hash), args[2].(pgx.Tx))
+	})
+	return _c
+}
+
+func (_c *StorageMock_GetTransactionAndLocationByHash_Call) Return(_a0 *types.Transaction, _a1 *state.TxLocation, _a2 error) *StorageMock_GetTransactionAndLocationByHash_Call {
+	_c.Call.Return(_a0, _a1, _a2)
+	return _c
+}
+
+func (_c *StorageMock_GetTransactionAndLocationByHash_Call) RunAndReturn(run func(context.Context, common.Hash, pgx.Tx) (*types.Transaction, *state.TxLocation, error)) *StorageMock_GetTransactionAndLocationByHash_Call {
+	_c.Call.Return(run)
+	return _c
+}
+
 // GetTransactionByHash provides a mock function with given fields: ctx, transactionHash, dbTx
 func (_m *StorageMock) GetTransactionByHash(ctx context.Context, transactionHash common.Hash, dbTx pgx.Tx) (*types.Transaction, error) {
 	ret := _m.Called(ctx, transactionHash, dbTx)
@@ -7881,6 +8057,54 @@ func (_c *StorageMock_QueryRow_Call) RunAndReturn(run func(context.Context, stri
 	return _c
 }
 
+// ResetBatchesVirtualizedAfterL1Block provides a mock function with given fields: ctx, blockNumber, dbTx
+func (_m *StorageMock) ResetBatchesVirtualizedAfterL1Block(ctx context.Context, blockNumber uint64, dbTx pgx.Tx) error {
+	ret := _m.Called(ctx, blockNumber, dbTx)
+
+	if len(ret) == 0 {
+		panic("no return value specified for ResetBatchesVirtualizedAfterL1Block")
+	}
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context, uint64, pgx.Tx) error); ok {
+		r0 = rf(ctx, blockNumber, dbTx)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// StorageMock_ResetBatchesVirtualizedAfterL1Block_Call is a *mock.Call that shadows Run/Return methods with type explicit version for method 'ResetBatchesVirtualizedAfterL1Block'
+type StorageMock_ResetBatchesVirtualizedAfterL1Block_Call struct {
+	*mock.Call
+}
+
+// ResetBatchesVirtualizedAfterL1Block is a helper method to define mock.On call
+//   - ctx context.Context
+//   - blockNumber uint64
+//   - dbTx pgx.Tx
+func (_e *StorageMock_Expecter) ResetBatchesVirtualizedAfterL1Block(ctx interface{}, blockNumber interface{}, dbTx interface{}) *StorageMock_ResetBatchesVirtualizedAfterL1Block_Call {
+	return &StorageMock_ResetBatchesVirtualizedAfterL1Block_Call{Call: _e.mock.On("ResetBatchesVirtualizedAfterL1Block", ctx, blockNumber, dbTx)}
+}
+
+func (_c *StorageMock_ResetBatchesVirtualizedAfterL1Block_Call) Run(run func(ctx context.Context, blockNumber uint64, dbTx pgx.Tx)) *StorageMock_ResetBatchesVirtualizedAfterL1Block_Call {
+	_c.Call.Run(func(args mock.Arguments) {
+		run(args[0].(context.Context), args[1].(uint64), args[2].(pgx.Tx))
+	})
+	return _c
+}
+
+func (_c *StorageMock_ResetBatchesVirtualizedAfterL1Block_Call) Return(_a0 error) *StorageMock_ResetBatchesVirtualizedAfterL1Block_Call {
+	_c.Call.Return(_a0)
+	return _c
+}
+
+func (_c *StorageMock_ResetBatchesVirtualizedAfterL1Block_Call) RunAndReturn(run func(context.Context, uint64, pgx.Tx) error) *StorageMock_ResetBatchesVirtualizedAfterL1Block_Call {
+	_c.Call.Return(run)
+	return _c
+}
+
 // ResetForkID provides a mock function with given fields: ctx, batchNumber, dbTx
 func (_m *StorageMock) ResetForkID(ctx context.Context, batchNumber uint64, dbTx pgx.Tx) error {
 	ret := _m.Called(ctx, batchNumber, dbTx)
@@ -582,6 +582,26 @@ func (p *PostgresStorage) StoreGenesisBatch(ctx context.Context, batch state.Bat
 	return err
 }
 
+// AddClosedBatch adds a closed batch with its metadata, without txs.
+func (p *PostgresStorage) AddClosedBatch(ctx context.Context, batch state.Batch, dbTx pgx.Tx) error {
+	const addClosedBatchSQL = "INSERT INTO state.batch (batch_num, global_exit_root, local_exit_root, acc_input_hash, state_root, timestamp, coinbase, wip) VALUES ($1, $2, $3, $4, $5, $6, $7, FALSE)"
+
+	e := p.getExecQuerier(dbTx)
+	_, err := e.Exec(
+		ctx,
+		addClosedBatchSQL,
+		batch.BatchNumber,
+		batch.GlobalExitRoot.String(),
+		batch.LocalExitRoot.String(),
+		batch.AccInputHash.String(),
+		batch.StateRoot.String(),
+		batch.Timestamp.UTC(),
+		batch.Coinbase.String(),
+	)
+
+	return err
+}
+
 // OpenBatchInStorage adds a new batch into the state storage, with the necessary data to start processing transactions within it.
 // It's meant to be used by sequencers, since they don't necessarily know what transactions are going to be added
 // in this batch yet. In other words it's the creation of a WIP batch.
@@ -45,6 +45,18 @@ func (p *PostgresStorage) ResetToL1BlockNumber(ctx context.Context, blockNumber
 	return nil
 }
 
+// ResetBatchesVirtualizedAfterL1Block removes the first batch virtualized in a
+// block newer than the given one and all the batches after it
+func (p *PostgresStorage) ResetBatchesVirtualizedAfterL1Block(ctx context.Context, blockNumber uint64, dbTx pgx.Tx) error {
+	e := p.getExecQuerier(dbTx)
+	const resetSQL = "DELETE FROM state.batch WHERE batch_num >= (SELECT MIN(batch_num) FROM state.virtual_batch WHERE block_num > $1)"
+	if _, err := e.Exec(ctx, resetSQL, blockNumber); err != nil {
+		return err
+	}
+
+	return nil
+}
+
 // ResetForkID resets the state to reprocess the newer batches with the correct forkID
 func (p *PostgresStorage) ResetForkID(ctx context.Context, batchNumber uint64, dbTx pgx.Tx) error {
 	e := p.getExecQuerier(dbTx)
@@ -77,6 +89,23 @@ func (p *PostgresStorage) ResetTrustedState(ctx context.Context, batchNumber uin
 	return nil
 }
 
+// DeleteBatchesOlderThanBatchNumber removes the batches, except the genesis
+// one, with number lower than the given one from the database. When keepVerified
+// is true, the batches with a verification are kept. It returns the number of
+// deleted batches.
+func (p *PostgresStorage) DeleteBatchesOlderThanBatchNumber(ctx context.Context, batchNumber uint64, keepVerified bool, dbTx pgx.Tx) (int64, error) {
+	const deleteBatchesSQL = `
+		DELETE FROM state.batch
+		 WHERE batch_num > 0 AND batch_num < $1
+		   AND (NOT $2 OR batch_num NOT IN (SELECT batch_num FROM state.verified_batch))`
+	e := p.getExecQuerier(dbTx)
+	commandTag, err := e.Exec(ctx, deleteBatchesSQL, batchNumber, keepVerified)
+	if err != nil {
+		return 0, err
+	}
+	return commandTag.RowsAffected(), nil
+}
+
 // GetProcessingContext returns the processing context for the given batch.
 func (p *PostgresStorage) GetProcessingContext(ctx context.Context, batchNumber uint64, dbTx pgx.Tx) (*state.ProcessingContext, error) {
 	const getProcessingContextSQL = "SELECT batch_num, global_exit_root, timestamp, coinbase, forced_batch_num from state.batch WHERE batch_num = $1"
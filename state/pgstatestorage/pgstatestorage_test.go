@@ -2,6 +2,7 @@ package pgstatestorage_test
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"math"
 	"math/big"
@@ -25,9 +26,11 @@ import (
 	"github.com/ethereum/go-ethereum/common"
 	"github.com/ethereum/go-ethereum/core/types"
 	"github.com/ethereum/go-ethereum/trie"
+	"github.com/jackc/pgx/v4"
 	"github.com/jackc/pgx/v4/pgxpool"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+	"golang.org/x/sync/errgroup"
 	"google.golang.org/grpc"
 )
 
@@ -215,6 +218,90 @@ func TestGetBatchByL2BlockNumber(t *testing.T) {
 	require.NoError(t, dbTx.Commit(ctx))
 }
 
+func TestGetTransactionWithLocationByHash(t *testing.T) {
+	initOrResetDB()
+	ctx := context.Background()
+	dbTx, err := testState.BeginStateTransaction(ctx)
+	require.NoError(t, err)
+	err = testState.AddBlock(ctx, block, dbTx)
+	assert.NoError(t, err)
+
+	batchNumber := uint64(2)
+	for _, bn := range []uint64{1, batchNumber} {
+		_, err = testState.Exec(ctx, "INSERT INTO state.batch (batch_num, wip) VALUES ($1,FALSE)", bn)
+		require.NoError(t, err)
+	}
+
+	header := state.NewL2Header(&types.Header{
+		Number:     big.NewInt(1),
+		ParentHash: state.ZeroHash,
+		Coinbase:   state.ZeroAddress,
+		Root:       state.ZeroHash,
+		GasUsed:    1,
+		GasLimit:   10,
+		Time:       uint64(time.Now().Unix()),
+	})
+
+	transactions := []*types.Transaction{}
+	receipts := []*types.Receipt{}
+	imStateRoots := []common.Hash{}
+	for i := 0; i < 2; i++ {
+		tx := types.NewTx(&types.LegacyTx{
+			Nonce:    uint64(i),
+			To:       nil,
+			Value:    new(big.Int),
+			Gas:      0,
+			GasPrice: big.NewInt(0),
+		})
+		transactions = append(transactions, tx)
+		receipts = append(receipts, &types.Receipt{
+			Type:              tx.Type(),
+			PostState:         state.ZeroHash.Bytes(),
+			CumulativeGasUsed: 0,
+			EffectiveGasPrice: big.NewInt(0),
+			BlockNumber:       header.Number,
+			GasUsed:           tx.Gas(),
+			TxHash:            tx.Hash(),
+			TransactionIndex:  uint(i),
+			Status:            types.ReceiptStatusSuccessful,
+		})
+		imStateRoots = append(imStateRoots, state.ZeroHash)
+	}
+
+	// Create block to be able to calculate its hash
+	st := trie.NewStackTrie(nil)
+	l2Block := state.NewL2Block(header, transactions, []*state.L2Header{}, receipts, st)
+	for _, receipt := range receipts {
+		receipt.BlockHash = l2Block.Hash()
+	}
+
+	storeTxsEGPData := make([]state.StoreTxEGPData, len(transactions))
+	txsL2Hash := make([]common.Hash, len(transactions))
+	for i := range transactions {
+		storeTxsEGPData[i] = state.StoreTxEGPData{EGPLog: nil, EffectivePercentage: state.MaxEffectivePercentage}
+		txsL2Hash[i] = common.HexToHash(fmt.Sprintf("0x%d", i))
+	}
+
+	err = testState.AddL2Block(ctx, batchNumber, l2Block, receipts, txsL2Hash, storeTxsEGPData, imStateRoots, dbTx)
+	require.NoError(t, err)
+
+	tx, location, err := testState.GetTransactionWithLocationByHash(ctx, transactions[1].Hash(), dbTx)
+	require.NoError(t, err)
+	assert.Equal(t, transactions[1].Hash(), tx.Hash())
+	assert.Equal(t, batchNumber, location.BatchNumber)
+	assert.Equal(t, l2Block.Number().Uint64(), location.L2BlockNumber)
+	assert.Equal(t, uint64(1), location.Index)
+
+	unknownHash := common.HexToHash("0x1234")
+	_, _, err = testState.GetTransactionWithLocationByHash(ctx, unknownHash, dbTx)
+	var txNotFoundErr *state.TxNotFoundError
+	require.ErrorAs(t, err, &txNotFoundErr)
+	assert.Equal(t, unknownHash, txNotFoundErr.Hash)
+	assert.ErrorIs(t, err, state.ErrNotFound)
+
+	require.NoError(t, dbTx.Commit(ctx))
+}
+
 func TestAddAndGetSequences(t *testing.T) {
 	initOrResetDB()
 
@@ -381,6 +468,229 @@ func TestVerifiedBatch(t *testing.T) {
 	require.NoError(t, dbTx.Commit(ctx))
 }
 
+func TestPruneBatchesBefore(t *testing.T) {
+	initOrResetDB()
+	ctx := context.Background()
+
+	dbTx, err := testState.BeginStateTransaction(ctx)
+	require.NoError(t, err)
+	block := &state.Block{
+		BlockNumber: 1,
+		BlockHash:   common.HexToHash("0x29e885edaf8e4b51e1d2e05f9da28161d2fb4f6b1d53827d9b80a23cf2d7d9f1"),
+		ParentHash:  common.HexToHash("0x29e885edaf8e4b51e1d2e05f9da28161d2fb4f6b1d53827d9b80a23cf2d7d9f1"),
+		ReceivedAt:  time.Now(),
+	}
+	require.NoError(t, testState.AddBlock(ctx, block, dbTx))
+
+	// batches 0 to 6, virtualized up to 5 and verified at 2 and 4
+	stateRoot := func(batchNumber uint64) common.Hash {
+		return common.BigToHash(new(big.Int).SetUint64(batchNumber + 100))
+	}
+	for batchNumber := uint64(0); batchNumber <= 6; batchNumber++ {
+		_, err = dbTx.Exec(ctx, "INSERT INTO state.batch (batch_num, state_root, wip) VALUES ($1, $2, FALSE)", batchNumber, stateRoot(batchNumber).String())
+		require.NoError(t, err)
+		if batchNumber == 0 || batchNumber > 5 {
+			continue
+		}
+		require.NoError(t, testState.AddVirtualBatch(ctx, &state.VirtualBatch{BlockNumber: 1, BatchNumber: batchNumber}, dbTx))
+		if batchNumber%2 == 0 {
+			require.NoError(t, testState.AddVerifiedBatch(ctx, &state.VerifiedBatch{BlockNumber: 1, BatchNumber: batchNumber, StateRoot: stateRoot(batchNumber)}, dbTx))
+		}
+	}
+	require.NoError(t, dbTx.Commit(ctx))
+
+	batchExists := func(batchNumber uint64) bool {
+		_, err := testState.GetBatchByNumber(ctx, batchNumber, nil)
+		if errors.Is(err, state.ErrNotFound) {
+			return false
+		}
+		require.NoError(t, err)
+		return true
+	}
+
+	// the threshold is lowered to the last verified batch and the verified ones are kept
+	pruned, err := testState.PruneBatchesBefore(ctx, 10, true)
+	require.NoError(t, err)
+	assert.Equal(t, 2, pruned)
+	for batchNumber, exists := range []bool{true, false, true, false, true, true, true} {
+		assert.Equal(t, exists, batchExists(uint64(batchNumber)), "batch %d", batchNumber)
+	}
+
+	pruned, err = testState.PruneBatchesBefore(ctx, 10, false)
+	require.NoError(t, err)
+	assert.Equal(t, 1, pruned)
+	for batchNumber, exists := range []bool{true, false, false, false, true, true, true} {
+		assert.Equal(t, exists, batchExists(uint64(batchNumber)), "batch %d", batchNumber)
+	}
+
+	// pruning again is a no-op
+	pruned, err = testState.PruneBatchesBefore(ctx, 10, false)
+	require.NoError(t, err)
+	assert.Equal(t, 0, pruned)
+
+	// the latest state and the last consolidated root survive
+	lastBatch, err := testState.GetLastBatch(ctx, nil)
+	require.NoError(t, err)
+	assert.Equal(t, uint64(6), lastBatch.BatchNumber)
+	assert.Equal(t, stateRoot(6), lastBatch.StateRoot)
+	lastVerifiedBatch, err := testState.GetLastVerifiedBatch(ctx, nil)
+	require.NoError(t, err)
+	assert.Equal(t, uint64(4), lastVerifiedBatch.BatchNumber)
+	verifiedBatch, err := testState.GetVerifiedBatch(ctx, 4, nil)
+	require.NoError(t, err)
+	assert.Equal(t, stateRoot(4), verifiedBatch.StateRoot)
+}
+
+func TestResetToL1Block(t *testing.T) {
+	initOrResetDB()
+	ctx := context.Background()
+
+	dbTx, err := testState.BeginStateTransaction(ctx)
+	require.NoError(t, err)
+	stateRoots := []common.Hash{
+		common.HexToHash("0x100"),
+		common.HexToHash("0x101"),
+		common.HexToHash("0x102"),
+	}
+	_, err = dbTx.Exec(ctx, "INSERT INTO state.batch (batch_num, state_root, wip) VALUES (0, $1, FALSE)", stateRoots[0].String())
+	require.NoError(t, err)
+	// batch N is virtualized and verified in L1 block N
+	for blockNumber := uint64(1); blockNumber <= 2; blockNumber++ {
+		block := &state.Block{
+			BlockNumber: blockNumber,
+			BlockHash:   common.BigToHash(new(big.Int).SetUint64(blockNumber)),
+			ParentHash:  common.BigToHash(new(big.Int).SetUint64(blockNumber - 1)),
+			ReceivedAt:  time.Now(),
+		}
+		require.NoError(t, testState.AddBlock(ctx, block, dbTx))
+		_, err = dbTx.Exec(ctx, "INSERT INTO state.batch (batch_num, state_root, wip) VALUES ($1, $2, FALSE)", blockNumber, stateRoots[blockNumber].String())
+		require.NoError(t, err)
+		require.NoError(t, testState.AddVirtualBatch(ctx, &state.VirtualBatch{BlockNumber: blockNumber, BatchNumber: blockNumber}, dbTx))
+		require.NoError(t, testState.AddVerifiedBatch(ctx, &state.VerifiedBatch{BlockNumber: blockNumber, BatchNumber: blockNumber, StateRoot: stateRoots[blockNumber]}, dbTx))
+	}
+	require.NoError(t, dbTx.Commit(ctx))
+
+	lastVerifiedBatch, err := testState.GetLastVerifiedBatch(ctx, nil)
+	require.NoError(t, err)
+	assert.Equal(t, uint64(2), lastVerifiedBatch.BatchNumber)
+
+	// resetting twice leaves the same state
+	for i := 0; i < 2; i++ {
+		require.NoError(t, testState.ResetToL1Block(ctx, 2))
+
+		lastBlock, err := testState.GetLastBlock(ctx, nil)
+		require.NoError(t, err)
+		assert.Equal(t, uint64(1), lastBlock.BlockNumber)
+
+		_, err = testState.GetBatchByNumber(ctx, 2, nil)
+		assert.ErrorIs(t, err, state.ErrNotFound)
+
+		lastBatch, err := testState.GetLastBatch(ctx, nil)
+		require.NoError(t, err)
+		assert.Equal(t, uint64(1), lastBatch.BatchNumber)
+		assert.Equal(t, stateRoots[1], lastBatch.StateRoot)
+
+		lastVerifiedBatch, err = testState.GetLastVerifiedBatch(ctx, nil)
+		require.NoError(t, err)
+		assert.Equal(t, uint64(1), lastVerifiedBatch.BatchNumber)
+	}
+
+	assert.Error(t, testState.ResetToL1Block(ctx, 0))
+}
+
+func TestGetBatchPointers(t *testing.T) {
+	initOrResetDB()
+	ctx := context.Background()
+
+	dbTx, err := testState.BeginStateTransaction(ctx)
+	require.NoError(t, err)
+	block := &state.Block{
+		BlockNumber: 1,
+		BlockHash:   common.HexToHash("0x29e885edaf8e4b51e1d2e05f9da28161d2fb4f6b1d53827d9b80a23cf2d7d9f1"),
+		ParentHash:  common.HexToHash("0x29e885edaf8e4b51e1d2e05f9da28161d2fb4f6b1d53827d9b80a23cf2d7d9f1"),
+		ReceivedAt:  time.Now(),
+	}
+	require.NoError(t, testState.AddBlock(ctx, block, dbTx))
+	_, err = dbTx.Exec(ctx, "INSERT INTO state.batch (batch_num, state_root, wip) VALUES (0, $1, FALSE)", common.HexToHash("0x100").String())
+	require.NoError(t, err)
+	require.NoError(t, dbTx.Commit(ctx))
+
+	pointers, err := testState.GetBatchPointers(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, state.BatchPointers{}, pointers)
+
+	// the writer commits each stage of a batch in its own tx while the
+	// pointers are read
+	const lastBatch = 50
+	done := make(chan struct{})
+	var g errgroup.Group
+	g.Go(func() error {
+		defer close(done)
+		commit := func(fn func(dbTx pgx.Tx) error) error {
+			dbTx, err := testState.BeginStateTransaction(ctx)
+			if err != nil {
+				return err
+			}
+			if err := fn(dbTx); err != nil {
+				_ = dbTx.Rollback(ctx)
+				return err
+			}
+			return dbTx.Commit(ctx)
+		}
+		for batchNumber := uint64(1); batchNumber <= lastBatch; batchNumber++ {
+			stateRoot := common.BigToHash(new(big.Int).SetUint64(batchNumber + 100))
+			err := commit(func(dbTx pgx.Tx) error {
+				_, err := dbTx.Exec(ctx, "INSERT INTO state.batch (batch_num, state_root, wip) VALUES ($1, $2, FALSE)", batchNumber, stateRoot.String())
+				return err
+			})
+			if err != nil {
+				return err
+			}
+			err = commit(func(dbTx pgx.Tx) error {
+				return testState.AddVirtualBatch(ctx, &state.VirtualBatch{BlockNumber: 1, BatchNumber: batchNumber}, dbTx)
+			})
+			if err != nil {
+				return err
+			}
+			err = commit(func(dbTx pgx.Tx) error {
+				return testState.AddVerifiedBatch(ctx, &state.VerifiedBatch{BlockNumber: 1, BatchNumber: batchNumber, StateRoot: stateRoot}, dbTx)
+			})
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	for i := 0; i < 4; i++ {
+		g.Go(func() error {
+			var last state.BatchPointers
+			for {
+				select {
+				case <-done:
+					return nil
+				default:
+				}
+				pointers, err := testState.GetBatchPointers(ctx)
+				if err != nil {
+					return err
+				}
+				if pointers.LastConsolidated > pointers.LastVirtual || pointers.LastVirtual > pointers.LastSeen {
+					return fmt.Errorf("inconsistent pointers %+v", pointers)
+				}
+				if pointers.LastConsolidated < last.LastConsolidated || pointers.LastVirtual < last.LastVirtual || pointers.LastSeen < last.LastSeen {
+					return fmt.Errorf("pointers %+v moved back from %+v", pointers, last)
+				}
+				last = pointers
+			}
+		})
+	}
+	require.NoError(t, g.Wait())
+
+	pointers, err = testState.GetBatchPointers(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, state.BatchPointers{LastSeen: lastBatch, LastVirtual: lastBatch, LastConsolidated: lastBatch}, pointers)
+}
+
 func TestAddAccumulatedInputHash(t *testing.T) {
 	initOrResetDB()
 
@@ -226,6 +226,35 @@ func (p *PostgresStorage) GetTransactionByHash(ctx context.Context, transactionH
 	return tx, nil
 }
 
+// GetTransactionAndLocationByHash gets a transaction accordingly to the provided transaction hash
+// along with the batch, the L2 block and the index in the L2 block where it was included
+func (p *PostgresStorage) GetTransactionAndLocationByHash(ctx context.Context, transactionHash common.Hash, dbTx pgx.Tx) (*types.Transaction, *state.TxLocation, error) {
+	var encoded string
+	var location state.TxLocation
+	const getTransactionAndLocationByHashSQL = `
+		SELECT t.encoded, b.batch_num, t.l2_block_num, r.tx_index
+		  FROM state.transaction t
+		 INNER JOIN state.receipt r ON r.tx_hash = t.hash
+		 INNER JOIN state.l2block b ON b.block_num = t.l2_block_num
+		 WHERE t.hash = $1`
+
+	q := p.getExecQuerier(dbTx)
+	err := q.QueryRow(ctx, getTransactionAndLocationByHashSQL, transactionHash.String()).Scan(&encoded, &location.BatchNumber, &location.L2BlockNumber, &location.Index)
+
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, nil, state.ErrNotFound
+	} else if err != nil {
+		return nil, nil, err
+	}
+
+	tx, err := state.DecodeTx(encoded)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return tx, &location, nil
+}
+
 // GetTransactionByL2Hash gets a transaction accordingly to the provided transaction l2 hash
 func (p *PostgresStorage) GetTransactionByL2Hash(ctx context.Context, l2TxHash common.Hash, dbTx pgx.Tx) (*types.Transaction, error) {
 	var encoded string
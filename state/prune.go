@@ -0,0 +1,64 @@
+package state
+
+import (
+	"context"
+	"errors"
+
+	"github.com/0xPolygonHermez/zkevm-node/log"
+	"github.com/jackc/pgx/v4"
+)
+
+// PruneBatchesBefore removes the batches older than the given batch number,
+// along with their L2 blocks, txs, receipts and logs, to reclaim storage.
+//
+// The genesis batch, the last verified batch (whose root is the starting point
+// of the next proof) and every batch after it are never removed, so the
+// threshold is lowered to the last verified batch when needed. When
+// keepConsolidated is true, the batches that close a verification on L1 are
+// also kept, preserving the history of consolidated roots.
+//
+// The batches are deleted within a single db transaction, so an interrupted
+// prune leaves the state untouched. The nodes of the state tree are not
+// pruned.
+func (s *State) PruneBatchesBefore(ctx context.Context, batchNumber uint64, keepConsolidated bool) (pruned int, err error) {
+	dbTx, err := s.BeginStateTransaction(ctx)
+	if err != nil {
+		return 0, err
+	}
+	defer func() {
+		if err != nil {
+			if rollbackErr := dbTx.Rollback(ctx); rollbackErr != nil {
+				log.Errorf("error rolling back the pruning of batches before %d: %v", batchNumber, rollbackErr)
+			}
+		}
+	}()
+
+	pruned, err = s.pruneBatchesBefore(ctx, batchNumber, keepConsolidated, dbTx)
+	if err != nil {
+		return 0, err
+	}
+	if err = dbTx.Commit(ctx); err != nil {
+		return 0, err
+	}
+	log.Infof("pruned %d batches before batch %d", pruned, batchNumber)
+	return pruned, nil
+}
+
+func (s *State) pruneBatchesBefore(ctx context.Context, batchNumber uint64, keepConsolidated bool, dbTx pgx.Tx) (int, error) {
+	lastVerifiedBatch, err := s.GetLastVerifiedBatch(ctx, dbTx)
+	if errors.Is(err, ErrNotFound) {
+		// nothing has been consolidated yet, so every batch is still needed
+		return 0, nil
+	} else if err != nil {
+		return 0, err
+	}
+	if batchNumber > lastVerifiedBatch.BatchNumber {
+		batchNumber = lastVerifiedBatch.BatchNumber
+	}
+
+	pruned, err := s.DeleteBatchesOlderThanBatchNumber(ctx, batchNumber, keepConsolidated, dbTx)
+	if err != nil {
+		return 0, err
+	}
+	return int(pruned), nil
+}
@@ -2,6 +2,7 @@ package state
 
 import (
 	"context"
+	"fmt"
 
 	"github.com/0xPolygonHermez/zkevm-node/log"
 	"github.com/jackc/pgx/v4"
@@ -28,3 +29,39 @@ func (s *State) Reset(ctx context.Context, blockNumber uint64, dbTx pgx.Tx) erro
 	s.l1InfoTreeRecursive = nil
 	return nil
 }
+
+// ResetToL1Block discards everything the state recorded at or after the given
+// L1 block, as needed when L1 reorganizes: the L1 blocks, the virtual and
+// verified batches tied to them and the batches from the first one virtualized
+// in those blocks onwards, with their L2 blocks and txs. The last consolidated
+// batch goes back to the last one verified before the given L1 block.
+//
+// It runs within its own db transaction, so it's applied entirely or not at
+// all, and resetting twice to the same L1 block is a no-op.
+func (s *State) ResetToL1Block(ctx context.Context, l1BlockNumber uint64) (err error) {
+	if l1BlockNumber == 0 {
+		return fmt.Errorf("can't reset the state to L1 block 0")
+	}
+	dbTx, err := s.BeginStateTransaction(ctx)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			if rollbackErr := dbTx.Rollback(ctx); rollbackErr != nil {
+				log.Errorf("error rolling back the reset to L1 block %d: %v", l1BlockNumber, rollbackErr)
+			}
+		}
+	}()
+
+	// The batches must be removed before the L1 blocks, as they are found
+	// through the virtual batches of those blocks
+	if err = s.ResetBatchesVirtualizedAfterL1Block(ctx, l1BlockNumber-1, dbTx); err != nil {
+		log.Errorf("error resetting the batches virtualized from L1 block %d: %v", l1BlockNumber, err)
+		return err
+	}
+	if err = s.Reset(ctx, l1BlockNumber-1, dbTx); err != nil {
+		return err
+	}
+	return dbTx.Commit(ctx)
+}
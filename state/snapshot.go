@@ -0,0 +1,421 @@
+package state
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"time"
+
+	"github.com/0xPolygonHermez/zkevm-node/log"
+	"github.com/0xPolygonHermez/zkevm-node/merkletree"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v4"
+)
+
+// A snapshot starts with snapshotMagic and the version of the format as a big
+// endian uint16, followed by a sequence of records. Each record is the kind of
+// record as a byte, the length of the payload as an uvarint and the payload:
+//
+//	header:  state root (32 bytes) | last batch number (uint64)
+//	leaves:  count (uvarint) | count * (key (32 bytes) | value length (uvarint) | value)
+//	program: bytecode
+//	batches: count (uvarint) | count * batch, see encodeSnapshotBatch
+//	end:     empty
+//
+// The records come in that order. Leaves and batches are split in chunks of up
+// to snapshotChunkSize items and every program has its own record, so a
+// snapshot is written and read without loading the whole state in memory.
+const (
+	snapshotMagic = "ZKEVMSNP"
+	// SnapshotVersion is the version of the format written by ExportSnapshot
+	SnapshotVersion uint16 = 1
+
+	snapshotChunkSize     = 1000
+	maxSnapshotRecordSize = 64 * 1024 * 1024
+	snapshotBatchSize     = 8 + 4*common.HashLength + 8 + common.AddressLength
+)
+
+const (
+	snapshotRecordEnd byte = iota
+	snapshotRecordHeader
+	snapshotRecordLeaves
+	snapshotRecordProgram
+	snapshotRecordBatches
+)
+
+// ExportSnapshot writes the state tree at the last closed batch, the code of
+// the contracts it holds and the metadata of the batches up to the last
+// closed one, genesis included, to w. The state tree must support iterating
+// its leaves, which the hashdb service of a running node doesn't, so it's
+// meant for the trees of a merkletree.LocalHashDBClient; an error wrapping
+// merkletree.ErrIterationNotSupported is returned before writing anything
+// otherwise.
+func (s *State) ExportSnapshot(ctx context.Context, w io.Writer) error {
+	if s.tree == nil {
+		return ErrStateTreeNil
+	}
+	if !s.tree.SupportsIteration() {
+		return fmt.Errorf("%w: the snapshots can only be exported from a local state tree", merkletree.ErrIterationNotSupported)
+	}
+	lastBatchNumber, err := s.GetLastClosedBatchNumber(ctx, nil)
+	if err != nil {
+		return err
+	}
+	lastBatch, err := s.GetBatchByNumber(ctx, lastBatchNumber, nil)
+	if err != nil {
+		return err
+	}
+
+	// the store holds the programs of every root, only the ones whose hash
+	// is the value of a leaf of the exported tree are written
+	programs := map[string]bool{}
+	err = s.tree.ForEachProgram(ctx, func(data []byte) error {
+		hash, err := programHash(data)
+		if err != nil {
+			return err
+		}
+		programs[hash] = false
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("error exporting the contracts code: %w", err)
+	}
+
+	sw := &snapshotWriter{w: bufio.NewWriter(w)}
+	sw.writeHeader(lastBatch.StateRoot, lastBatchNumber)
+
+	err = s.tree.ForEachLeaf(ctx, lastBatch.StateRoot.Bytes(), func(key []byte, value *big.Int) error {
+		if _, found := programs[value.String()]; found {
+			programs[value.String()] = true
+		}
+		sw.chunk.Write(key)
+		valueBytes := value.Bytes()
+		sw.chunk.Write(binary.AppendUvarint(nil, uint64(len(valueBytes))))
+		sw.chunk.Write(valueBytes)
+		return sw.addToChunk(snapshotRecordLeaves)
+	})
+	if err != nil {
+		return fmt.Errorf("error exporting the state tree: %w", err)
+	}
+	if err := sw.flushChunk(snapshotRecordLeaves); err != nil {
+		return err
+	}
+
+	err = s.tree.ForEachProgram(ctx, func(data []byte) error {
+		hash, err := programHash(data)
+		if err != nil {
+			return err
+		}
+		if !programs[hash] {
+			return nil
+		}
+		return sw.writeRecord(snapshotRecordProgram, data)
+	})
+	if err != nil {
+		return fmt.Errorf("error exporting the contracts code: %w", err)
+	}
+
+	for batchNumber := uint64(0); batchNumber <= lastBatchNumber; batchNumber++ {
+		batch, err := s.GetBatchByNumber(ctx, batchNumber, nil)
+		if errors.Is(err, ErrNotFound) {
+			// pruned batch
+			continue
+		} else if err != nil {
+			return err
+		}
+		sw.chunk.Write(encodeSnapshotBatch(batch))
+		if err := sw.addToChunk(snapshotRecordBatches); err != nil {
+			return err
+		}
+	}
+	if err := sw.flushChunk(snapshotRecordBatches); err != nil {
+		return err
+	}
+
+	if err := sw.writeRecord(snapshotRecordEnd, nil); err != nil {
+		return err
+	}
+	return sw.w.Flush()
+}
+
+// ImportSnapshot restores a snapshot written by ExportSnapshot. The state root
+// is recomputed from the leaves and the snapshot is rejected with
+// ErrSnapshotRootMismatch before storing any batch when it doesn't match the
+// exported one. The batches are stored within a single db transaction, so the
+// state must not contain any of them.
+func (s *State) ImportSnapshot(ctx context.Context, r io.Reader) (err error) {
+	if s.tree == nil {
+		return ErrStateTreeNil
+	}
+	sr := &snapshotReader{r: bufio.NewReader(r)}
+	if err := sr.readPreamble(); err != nil {
+		return err
+	}
+	kind, payload, err := sr.readRecord()
+	if err != nil {
+		return err
+	}
+	if kind != snapshotRecordHeader || len(payload) != common.HashLength+8 {
+		return fmt.Errorf("%w: missing header", ErrInvalidSnapshot)
+	}
+	stateRoot := common.BytesToHash(payload[:common.HashLength])
+	lastBatchNumber := binary.BigEndian.Uint64(payload[common.HashLength:])
+
+	uuid := uuid.New().String()
+	if err := s.tree.StartBlock(ctx, ZeroHash, uuid); err != nil {
+		return err
+	}
+	root := ZeroHash.Bytes()
+	rootChecked := false
+
+	var dbTx pgx.Tx
+	defer func() {
+		if err != nil && dbTx != nil {
+			if rollbackErr := dbTx.Rollback(ctx); rollbackErr != nil {
+				log.Errorf("error rolling back the import of the snapshot: %v", rollbackErr)
+			}
+		}
+	}()
+
+	lastKind := snapshotRecordHeader
+	for kind != snapshotRecordEnd {
+		kind, payload, err = sr.readRecord()
+		if err != nil {
+			return err
+		}
+		if kind < lastKind && kind != snapshotRecordEnd {
+			return fmt.Errorf("%w: record of kind %d after kind %d", ErrInvalidSnapshot, kind, lastKind)
+		}
+		lastKind = kind
+
+		if kind != snapshotRecordLeaves && !rootChecked {
+			if common.BytesToHash(root) != stateRoot {
+				return fmt.Errorf("%w: expected %s, got %s", ErrSnapshotRootMismatch, stateRoot, common.BytesToHash(root))
+			}
+			rootChecked = true
+		}
+
+		switch kind {
+		case snapshotRecordLeaves:
+			root, err = s.importSnapshotLeaves(ctx, root, payload, uuid)
+			if err != nil {
+				return err
+			}
+		case snapshotRecordProgram:
+			if err := s.tree.SetProgram(ctx, payload, uuid); err != nil {
+				return err
+			}
+		case snapshotRecordBatches:
+			if dbTx == nil {
+				if dbTx, err = s.BeginStateTransaction(ctx); err != nil {
+					return err
+				}
+			}
+			if err := s.importSnapshotBatches(ctx, payload, stateRoot, lastBatchNumber, dbTx); err != nil {
+				return err
+			}
+		case snapshotRecordEnd:
+		default:
+			return fmt.Errorf("%w: unexpected record kind %d", ErrInvalidSnapshot, kind)
+		}
+	}
+
+	if err := s.tree.FinishBlock(ctx, stateRoot, uuid); err != nil {
+		return err
+	}
+	if err := s.tree.Flush(ctx, stateRoot, uuid); err != nil {
+		return err
+	}
+	if dbTx != nil {
+		return dbTx.Commit(ctx)
+	}
+	return nil
+}
+
+// programHash returns the hash of the program as the decimal string of the
+// value of the code hash leaves.
+func programHash(data []byte) (string, error) {
+	hash, err := merkletree.HashContractBytecode(data)
+	if err != nil {
+		return "", err
+	}
+	return merkletree.H4ToScalar([4]uint64(hash)).String(), nil
+}
+
+func (s *State) importSnapshotLeaves(ctx context.Context, root []byte, payload []byte, uuid string) ([]byte, error) {
+	pr := bytes.NewReader(payload)
+	count, err := binary.ReadUvarint(pr)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidSnapshot, err)
+	}
+	key := make([]byte, common.HashLength)
+	for i := uint64(0); i < count; i++ {
+		if _, err := io.ReadFull(pr, key); err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrInvalidSnapshot, err)
+		}
+		valueLen, err := binary.ReadUvarint(pr)
+		if err != nil || valueLen > uint64(pr.Len()) {
+			return nil, fmt.Errorf("%w: invalid value of leaf %x", ErrInvalidSnapshot, key)
+		}
+		value := make([]byte, valueLen)
+		if _, err := io.ReadFull(pr, value); err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrInvalidSnapshot, err)
+		}
+		root, err = s.tree.Set(ctx, root, key, new(big.Int).SetBytes(value), uuid)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return root, nil
+}
+
+func (s *State) importSnapshotBatches(ctx context.Context, payload []byte, stateRoot common.Hash, lastBatchNumber uint64, dbTx pgx.Tx) error {
+	pr := bytes.NewReader(payload)
+	count, err := binary.ReadUvarint(pr)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidSnapshot, err)
+	}
+	if count*snapshotBatchSize != uint64(pr.Len()) {
+		return fmt.Errorf("%w: invalid batches record", ErrInvalidSnapshot)
+	}
+	data := make([]byte, snapshotBatchSize)
+	for i := uint64(0); i < count; i++ {
+		if _, err := io.ReadFull(pr, data); err != nil {
+			return fmt.Errorf("%w: %v", ErrInvalidSnapshot, err)
+		}
+		batch := decodeSnapshotBatch(data)
+		if batch.BatchNumber == lastBatchNumber && batch.StateRoot != stateRoot {
+			return fmt.Errorf("%w: batch %d has state root %s, expected %s", ErrSnapshotRootMismatch, batch.BatchNumber, batch.StateRoot, stateRoot)
+		}
+		if err := s.AddClosedBatch(ctx, batch, dbTx); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// encodeSnapshotBatch encodes the metadata of the batch as
+// number | GER | local exit root | acc input hash | state root | timestamp | coinbase
+func encodeSnapshotBatch(batch *Batch) []byte {
+	data := make([]byte, 0, snapshotBatchSize)
+	data = binary.BigEndian.AppendUint64(data, batch.BatchNumber)
+	data = append(data, batch.GlobalExitRoot.Bytes()...)
+	data = append(data, batch.LocalExitRoot.Bytes()...)
+	data = append(data, batch.AccInputHash.Bytes()...)
+	data = append(data, batch.StateRoot.Bytes()...)
+	data = binary.BigEndian.AppendUint64(data, uint64(batch.Timestamp.Unix()))
+	return append(data, batch.Coinbase.Bytes()...)
+}
+
+func decodeSnapshotBatch(data []byte) Batch {
+	const hashesOffset = 8
+	const timestampOffset = hashesOffset + 4*common.HashLength
+	hash := func(i int) common.Hash {
+		return common.BytesToHash(data[hashesOffset+i*common.HashLength : hashesOffset+(i+1)*common.HashLength])
+	}
+	return Batch{
+		BatchNumber:    binary.BigEndian.Uint64(data),
+		GlobalExitRoot: hash(0),
+		LocalExitRoot:  hash(1),
+		AccInputHash:   hash(2),
+		StateRoot:      hash(3),
+		Timestamp:      time.Unix(int64(binary.BigEndian.Uint64(data[timestampOffset:])), 0).UTC(),
+		Coinbase:       common.BytesToAddress(data[timestampOffset+8:]),
+	}
+}
+
+type snapshotWriter struct {
+	w          *bufio.Writer
+	chunk      bytes.Buffer
+	chunkItems uint64
+	err        error
+}
+
+func (sw *snapshotWriter) writeHeader(stateRoot common.Hash, lastBatchNumber uint64) {
+	_, sw.err = sw.w.WriteString(snapshotMagic)
+	if sw.err == nil {
+		sw.err = binary.Write(sw.w, binary.BigEndian, SnapshotVersion)
+	}
+	payload := binary.BigEndian.AppendUint64(stateRoot.Bytes(), lastBatchNumber)
+	_ = sw.writeRecord(snapshotRecordHeader, payload)
+}
+
+// addToChunk counts the item just written to the chunk and writes the chunk
+// once it's full.
+func (sw *snapshotWriter) addToChunk(kind byte) error {
+	sw.chunkItems++
+	if sw.chunkItems < snapshotChunkSize {
+		return nil
+	}
+	return sw.flushChunk(kind)
+}
+
+func (sw *snapshotWriter) flushChunk(kind byte) error {
+	if sw.chunkItems == 0 {
+		return sw.err
+	}
+	payload := binary.AppendUvarint(nil, sw.chunkItems)
+	payload = append(payload, sw.chunk.Bytes()...)
+	sw.chunk.Reset()
+	sw.chunkItems = 0
+	return sw.writeRecord(kind, payload)
+}
+
+func (sw *snapshotWriter) writeRecord(kind byte, payload []byte) error {
+	if sw.err != nil {
+		return sw.err
+	}
+	if err := sw.w.WriteByte(kind); err != nil {
+		sw.err = err
+		return err
+	}
+	if _, err := sw.w.Write(binary.AppendUvarint(nil, uint64(len(payload)))); err != nil {
+		sw.err = err
+		return err
+	}
+	_, sw.err = sw.w.Write(payload)
+	return sw.err
+}
+
+type snapshotReader struct {
+	r *bufio.Reader
+}
+
+func (sr *snapshotReader) readPreamble() error {
+	preamble := make([]byte, len(snapshotMagic)+2)
+	if _, err := io.ReadFull(sr.r, preamble); err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidSnapshot, err)
+	}
+	if string(preamble[:len(snapshotMagic)]) != snapshotMagic {
+		return fmt.Errorf("%w: unknown format", ErrInvalidSnapshot)
+	}
+	if version := binary.BigEndian.Uint16(preamble[len(snapshotMagic):]); version != SnapshotVersion {
+		return fmt.Errorf("%w: unsupported version %d", ErrInvalidSnapshot, version)
+	}
+	return nil
+}
+
+func (sr *snapshotReader) readRecord() (byte, []byte, error) {
+	kind, err := sr.r.ReadByte()
+	if err != nil {
+		return 0, nil, fmt.Errorf("%w: %v", ErrInvalidSnapshot, err)
+	}
+	size, err := binary.ReadUvarint(sr.r)
+	if err != nil {
+		return 0, nil, fmt.Errorf("%w: %v", ErrInvalidSnapshot, err)
+	}
+	if size > maxSnapshotRecordSize {
+		return 0, nil, fmt.Errorf("%w: record of %d bytes exceeds the maximum of %d", ErrInvalidSnapshot, size, maxSnapshotRecordSize)
+	}
+	payload := make([]byte, size)
+	if _, err := io.ReadFull(sr.r, payload); err != nil {
+		return 0, nil, fmt.Errorf("%w: %v", ErrInvalidSnapshot, err)
+	}
+	return kind, payload, nil
+}
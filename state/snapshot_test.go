@@ -0,0 +1,144 @@
+package state_test
+
+import (
+	"bytes"
+	"context"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/0xPolygonHermez/zkevm-node/merkletree"
+	"github.com/0xPolygonHermez/zkevm-node/state"
+	"github.com/0xPolygonHermez/zkevm-node/state/mocks"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSnapshotRoundTrip(t *testing.T) {
+	ctx := context.Background()
+	tree := merkletree.NewStateTree(merkletree.NewLocalHashDBClient(merkletree.NewMemStore()))
+	txID := uuid.NewString()
+
+	// more accounts than fit in a single chunk
+	root := state.ZeroHash.Bytes()
+	var err error
+	for i := int64(1); i <= 1200; i++ {
+		root, _, err = tree.SetBalance(ctx, common.BigToAddress(big.NewInt(i)), big.NewInt(i*1000), root, txID)
+		require.NoError(t, err)
+	}
+	scAddress := common.HexToAddress("0xae4bb80be56b819606589de61d5ec3b522eeb032")
+	code := common.FromHex("0x6080604052348015600f57600080fd5b50")
+	root, _, err = tree.SetCode(ctx, scAddress, code, root, txID)
+	require.NoError(t, err)
+	root, _, err = tree.SetStorageAt(ctx, scAddress, big.NewInt(2), big.NewInt(42), root, txID)
+	require.NoError(t, err)
+	stateRoot := common.BytesToHash(root)
+	// a program of another root isn't exported
+	require.NoError(t, tree.SetProgram(ctx, common.FromHex("0x60016002"), txID))
+
+	genesisBatch := state.Batch{
+		BatchNumber: 0,
+		StateRoot:   common.HexToHash("0x1"),
+		Timestamp:   time.Unix(1700000000, 0).UTC(),
+	}
+	lastBatch := state.Batch{
+		BatchNumber:    1,
+		Coinbase:       common.HexToAddress("0x617b3a3528F9cDd6630fd3301B9c8911F7Bf063D"),
+		StateRoot:      stateRoot,
+		LocalExitRoot:  common.HexToHash("0x2"),
+		AccInputHash:   common.HexToHash("0x3"),
+		GlobalExitRoot: common.HexToHash("0x4"),
+		Timestamp:      time.Unix(1700000100, 0).UTC(),
+	}
+
+	exportStorage := mocks.NewStorageMock(t)
+	exportStorage.EXPECT().GetLastClosedBatchNumber(ctx, nil).Return(uint64(1), nil).Once()
+	exportStorage.EXPECT().GetBatchByNumber(ctx, uint64(0), nil).Return(&genesisBatch, nil).Once()
+	exportStorage.EXPECT().GetBatchByNumber(ctx, uint64(1), nil).Return(&lastBatch, nil).Twice()
+	exporter := state.NewState(state.Config{}, exportStorage, nil, tree, nil, nil, nil)
+
+	var buf bytes.Buffer
+	require.NoError(t, exporter.ExportSnapshot(ctx, &buf))
+	snapshot := buf.Bytes()
+
+	importTree := merkletree.NewStateTree(merkletree.NewLocalHashDBClient(merkletree.NewMemStore()))
+	importStorage := mocks.NewStorageMock(t)
+	dbTx := mocks.NewDbTxMock(t)
+	importStorage.EXPECT().Begin(ctx).Return(dbTx, nil).Once()
+	importStorage.EXPECT().AddClosedBatch(ctx, genesisBatch, dbTx).Return(nil).Once()
+	importStorage.EXPECT().AddClosedBatch(ctx, lastBatch, dbTx).Return(nil).Once()
+	dbTx.EXPECT().Commit(ctx).Return(nil).Once()
+	importer := state.NewState(state.Config{}, importStorage, nil, importTree, nil, nil, nil)
+
+	require.NoError(t, importer.ImportSnapshot(ctx, bytes.NewReader(snapshot)))
+
+	// the imported tree has the exported root
+	newRoot := state.ZeroHash.Bytes()
+	err = importTree.ForEachLeaf(ctx, stateRoot.Bytes(), func(key []byte, value *big.Int) error {
+		newRoot, err = importTree.Set(ctx, newRoot, key, value, txID)
+		return err
+	})
+	require.NoError(t, err)
+	assert.Equal(t, stateRoot, common.BytesToHash(newRoot))
+
+	balance, err := importer.GetBalance(ctx, common.BigToAddress(big.NewInt(1200)), stateRoot)
+	require.NoError(t, err)
+	assert.Equal(t, "1200000", balance.String())
+	importedCode, err := importer.GetCode(ctx, scAddress, stateRoot)
+	require.NoError(t, err)
+	assert.Equal(t, code, importedCode)
+	value, err := importer.GetStorageAt(ctx, scAddress, big.NewInt(2), stateRoot)
+	require.NoError(t, err)
+	assert.Equal(t, "42", value.String())
+
+	var programs [][]byte
+	err = importTree.ForEachProgram(ctx, func(data []byte) error {
+		programs = append(programs, data)
+		return nil
+	})
+	require.NoError(t, err)
+	assert.Equal(t, [][]byte{code}, programs)
+}
+
+func TestExportSnapshotNotSupported(t *testing.T) {
+	// the hashdb service can't walk the tree
+	st := state.NewState(state.Config{}, mocks.NewStorageMock(t), nil, merkletree.NewStateTree(nil), nil, nil, nil)
+	var buf bytes.Buffer
+	err := st.ExportSnapshot(context.Background(), &buf)
+	assert.ErrorIs(t, err, merkletree.ErrIterationNotSupported)
+	assert.Zero(t, buf.Len())
+}
+
+func TestImportSnapshotErrors(t *testing.T) {
+	ctx := context.Background()
+	tree := merkletree.NewStateTree(merkletree.NewLocalHashDBClient(merkletree.NewMemStore()))
+	root, _, err := tree.SetBalance(ctx, common.HexToAddress("0x1"), big.NewInt(1000), state.ZeroHash.Bytes(), uuid.NewString())
+	require.NoError(t, err)
+	batch := state.Batch{BatchNumber: 0, StateRoot: common.BytesToHash(root), Timestamp: time.Unix(0, 0).UTC()}
+
+	exportStorage := mocks.NewStorageMock(t)
+	exportStorage.EXPECT().GetLastClosedBatchNumber(ctx, nil).Return(uint64(0), nil).Once()
+	exportStorage.EXPECT().GetBatchByNumber(ctx, uint64(0), nil).Return(&batch, nil).Twice()
+	exporter := state.NewState(state.Config{}, exportStorage, nil, tree, nil, nil, nil)
+	var buf bytes.Buffer
+	require.NoError(t, exporter.ExportSnapshot(ctx, &buf))
+
+	// no batch is stored when the snapshot is rejected
+	importer := state.NewState(state.Config{}, mocks.NewStorageMock(t), nil, merkletree.NewStateTree(merkletree.NewLocalHashDBClient(merkletree.NewMemStore())), nil, nil, nil)
+
+	// the last byte of the exported state root in the header
+	tampered := bytes.Clone(buf.Bytes())
+	tampered[len("ZKEVMSNP")+2+2+common.HashLength-1] ^= 0xff
+	err = importer.ImportSnapshot(ctx, bytes.NewReader(tampered))
+	assert.ErrorIs(t, err, state.ErrSnapshotRootMismatch)
+
+	err = importer.ImportSnapshot(ctx, bytes.NewReader([]byte("not a snapshot")))
+	assert.ErrorIs(t, err, state.ErrInvalidSnapshot)
+
+	// cut in the middle of the first leaves record
+	truncated := buf.Bytes()[:len("ZKEVMSNP")+2+2+common.HashLength+8+10]
+	err = importer.ImportSnapshot(ctx, bytes.NewReader(truncated))
+	assert.ErrorIs(t, err, state.ErrInvalidSnapshot)
+}
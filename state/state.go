@@ -2,6 +2,7 @@ package state
 
 import (
 	"context"
+	"errors"
 	"math/big"
 	"sync"
 
@@ -89,6 +90,38 @@ func (s *State) GetCode(ctx context.Context, address common.Address, root common
 	return s.tree.GetCode(ctx, address, root.Bytes())
 }
 
+// GetAccount returns the balance, the nonce and the code hash of the account
+// at the given root. The three leaves are read together with
+// merkletree.StateTree.GetMany, which falls back to three parallel Get calls
+// with the client of the hashdb service.
+func (s *State) GetAccount(ctx context.Context, addr common.Address, root []byte) (*Account, error) {
+	if s.tree == nil {
+		return nil, ErrStateTreeNil
+	}
+	balanceKey, err := merkletree.KeyEthAddrBalance(addr)
+	if err != nil {
+		return nil, err
+	}
+	nonceKey, err := merkletree.KeyEthAddrNonce(addr)
+	if err != nil {
+		return nil, err
+	}
+	codeKey, err := merkletree.KeyContractCode(addr)
+	if err != nil {
+		return nil, err
+	}
+
+	values, err := s.tree.GetMany(ctx, root, [][]byte{balanceKey, nonceKey, codeKey})
+	if err != nil {
+		return nil, err
+	}
+	return &Account{
+		Balance:  values[0],
+		Nonce:    values[1].Uint64(),
+		CodeHash: common.BigToHash(values[2]),
+	}, nil
+}
+
 // GetNonce returns the nonce of the given account at the given block number
 func (s *State) GetNonce(ctx context.Context, address common.Address, root common.Hash) (uint64, error) {
 	if s.tree == nil {
@@ -130,6 +163,130 @@ func (s *State) GetBalanceByStateRoot(ctx context.Context, address common.Addres
 	return balance, err
 }
 
+// GetBalanceAtBatch gets the balance of the address from the MT Service using
+// the state root of the provided batch. Accounts that didn't exist at that
+// batch have a zero balance.
+func (s *State) GetBalanceAtBatch(ctx context.Context, addr common.Address, batchNumber uint64) (*big.Int, error) {
+	if s.tree == nil {
+		return nil, ErrStateTreeNil
+	}
+	root, err := s.stateRootAtBatch(ctx, batchNumber)
+	if err != nil {
+		return nil, err
+	}
+	balance, err := s.tree.GetBalance(ctx, addr, root.Bytes())
+	if err != nil {
+		return nil, err
+	}
+	if balance == nil {
+		balance = big.NewInt(0)
+	}
+	return balance, nil
+}
+
+// GetCodeAtBatch gets the bytecode of the contract from the MT Service using the
+// state root of the provided batch. The bytecode is empty for addresses that
+// weren't a contract at that batch.
+func (s *State) GetCodeAtBatch(ctx context.Context, addr common.Address, batchNumber uint64) ([]byte, error) {
+	if s.tree == nil {
+		return nil, ErrStateTreeNil
+	}
+	root, err := s.stateRootAtBatch(ctx, batchNumber)
+	if err != nil {
+		return nil, err
+	}
+	code, err := s.tree.GetCode(ctx, addr, root.Bytes())
+	if err != nil {
+		return nil, err
+	}
+	if code == nil {
+		code = []byte{}
+	}
+	return code, nil
+}
+
+// GetStorageAtBatch gets the value of the storage slot of the contract from the
+// MT Service using the state root of the provided batch. Slots that weren't set
+// at that batch are zero.
+func (s *State) GetStorageAtBatch(ctx context.Context, addr common.Address, slot *big.Int, batchNumber uint64) (*big.Int, error) {
+	if s.tree == nil {
+		return nil, ErrStateTreeNil
+	}
+	root, err := s.stateRootAtBatch(ctx, batchNumber)
+	if err != nil {
+		return nil, err
+	}
+	value, err := s.tree.GetStorageAt(ctx, addr, slot, root.Bytes())
+	if err != nil {
+		return nil, err
+	}
+	if value == nil {
+		value = big.NewInt(0)
+	}
+	return value, nil
+}
+
+// IterateContractStorage calls fn with the slot and the value, as 32 bytes
+// big endian, of every populated storage slot of the contract in the state
+// with the given root. The iteration stops without error when fn returns
+// ErrStopIteration. The leaves of the tree are walked and the storage ones of
+// the contract are told apart by their key preimages, so only the state tree
+// backed by merkletree.LocalHashDBClient can be iterated, and only the slots
+// set through it are visited, see merkletree.StateTree.KeyPreimage.
+// merkletree.ErrIterationNotSupported is returned with the hashdb service.
+func (s *State) IterateContractStorage(ctx context.Context, addr common.Address, root []byte, fn func(slot, value []byte) error) error {
+	if s.tree == nil {
+		return ErrStateTreeNil
+	}
+	err := s.tree.ForEachLeaf(ctx, root, func(key []byte, value *big.Int) error {
+		preimage, found := s.tree.KeyPreimage(key)
+		if !found || preimage.LeafType != merkletree.LeafTypeStorage || preimage.Address != addr {
+			return nil
+		}
+		return fn(preimage.Position.Bytes(), common.BigToHash(value).Bytes())
+	})
+	if errors.Is(err, ErrStopIteration) {
+		return nil
+	}
+	return err
+}
+
+// DiffRoots returns the leaves whose value differs between the states with the
+// given roots, in key path order. Only the subtrees that differ are read. The
+// keys are decoded with the preimages recorded by the state tree, which only
+// merkletree.LocalHashDBClient does: with the hashdb service the leaves are
+// returned undecoded, see merkletree.StateTree.KeyPreimage.
+func (s *State) DiffRoots(ctx context.Context, rootA, rootB []byte) ([]LeafDiff, error) {
+	if s.tree == nil {
+		return nil, ErrStateTreeNil
+	}
+	var diffs []LeafDiff
+	err := s.tree.DiffLeaves(ctx, rootA, rootB, func(key []byte, valueA, valueB *big.Int) error {
+		diff := LeafDiff{Key: key, ValueA: valueA, ValueB: valueB}
+		if preimage, found := s.tree.KeyPreimage(key); found {
+			diff.Decoded = true
+			diff.Address = preimage.Address
+			diff.LeafType = preimage.LeafType
+			diff.Position = preimage.Position
+		}
+		diffs = append(diffs, diff)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return diffs, nil
+}
+
+// stateRootAtBatch returns the state root of the provided batch
+func (s *State) stateRootAtBatch(ctx context.Context, batchNumber uint64) (common.Hash, error) {
+	batch, err := s.GetBatchByNumber(ctx, batchNumber, nil)
+	if err != nil {
+		return common.Hash{}, err
+	}
+	return batch.StateRoot, nil
+}
+
 // GetNonceByStateRoot gets nonce from the MT Service using the provided state root
 func (s *State) GetNonceByStateRoot(ctx context.Context, address common.Address, root common.Hash) (*big.Int, error) {
 	if s.tree == nil {
@@ -0,0 +1,157 @@
+package state_test
+
+import (
+	"context"
+	"math/big"
+	"testing"
+
+	"github.com/0xPolygonHermez/zkevm-node/merkletree"
+	"github.com/0xPolygonHermez/zkevm-node/merkletree/hashdb"
+	"github.com/0xPolygonHermez/zkevm-node/state"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestIterateContractStorage(t *testing.T) {
+	ctx := context.Background()
+	tree := merkletree.NewStateTree(merkletree.NewLocalHashDBClient(merkletree.NewMemStore()))
+	txID := uuid.NewString()
+	contract := common.HexToAddress("0x1275fbb540c8efc58b812ba83b0d0b8b9917ae98")
+	other := common.HexToAddress("0x617b3a3528F9cDd6630fd3301B9c8911F7Bf063D")
+
+	slots := map[common.Hash]*big.Int{
+		common.BigToHash(big.NewInt(0)):  big.NewInt(100),
+		common.BigToHash(big.NewInt(1)):  big.NewInt(200),
+		common.HexToHash("0xabcdef0123"): big.NewInt(300),
+	}
+	root := state.ZeroHash.Bytes()
+	var err error
+	for slot, value := range slots {
+		root, _, err = tree.SetStorageAt(ctx, contract, slot.Big(), value, root, txID)
+		require.NoError(t, err)
+	}
+	// the slots and the balance of other addresses are not visited
+	root, _, err = tree.SetStorageAt(ctx, other, big.NewInt(0), big.NewInt(400), root, txID)
+	require.NoError(t, err)
+	root, _, err = tree.SetBalance(ctx, contract, big.NewInt(500), root, txID)
+	require.NoError(t, err)
+
+	// the emptied slots are not visited
+	root, _, err = tree.SetStorageAt(ctx, contract, big.NewInt(2), big.NewInt(600), root, txID)
+	require.NoError(t, err)
+	root, _, err = tree.SetStorageAt(ctx, contract, big.NewInt(2), big.NewInt(0), root, txID)
+	require.NoError(t, err)
+
+	st := state.NewState(state.Config{}, nil, nil, tree, nil, nil, nil)
+	visited := map[common.Hash]*big.Int{}
+	err = st.IterateContractStorage(ctx, contract, root, func(slot, value []byte) error {
+		require.Len(t, slot, common.HashLength)
+		require.Len(t, value, common.HashLength)
+		visited[common.BytesToHash(slot)] = new(big.Int).SetBytes(value)
+		return nil
+	})
+	require.NoError(t, err)
+	assert.Equal(t, slots, visited)
+
+	// the iteration stops when the callback returns ErrStopIteration
+	calls := 0
+	err = st.IterateContractStorage(ctx, contract, root, func(slot, value []byte) error {
+		calls++
+		return state.ErrStopIteration
+	})
+	require.NoError(t, err)
+	assert.Equal(t, 1, calls)
+
+	// the hashdb service can't be iterated
+	st = state.NewState(state.Config{}, nil, nil, merkletree.NewStateTree(hashDBClient{merkletree.NewLocalHashDBClient(merkletree.NewMemStore())}), nil, nil, nil)
+	err = st.IterateContractStorage(ctx, contract, root, func(slot, value []byte) error {
+		return nil
+	})
+	assert.ErrorIs(t, err, merkletree.ErrIterationNotSupported)
+}
+
+// hashDBClient hides the optional capabilities of the local hashdb client, like
+// the client of the hashdb service.
+type hashDBClient struct {
+	hashdb.HashDBServiceClient
+}
+
+func TestDiffRoots(t *testing.T) {
+	ctx := context.Background()
+	store := merkletree.NewMemStore()
+	tree := merkletree.NewStateTree(merkletree.NewLocalHashDBClient(store))
+	txID := uuid.NewString()
+	changed := common.HexToAddress("0x617b3a3528F9cDd6630fd3301B9c8911F7Bf063D")
+
+	rootA := state.ZeroHash.Bytes()
+	var err error
+	for i := int64(1); i <= 20; i++ {
+		addr := common.BigToAddress(big.NewInt(i))
+		rootA, _, err = tree.SetBalance(ctx, addr, big.NewInt(i*1000), rootA, txID)
+		require.NoError(t, err)
+		rootA, _, err = tree.SetNonce(ctx, addr, big.NewInt(i), rootA, txID)
+		require.NoError(t, err)
+	}
+	rootA, _, err = tree.SetBalance(ctx, changed, big.NewInt(100), rootA, txID)
+	require.NoError(t, err)
+	rootB, _, err := tree.SetBalance(ctx, changed, big.NewInt(150), rootA, txID)
+	require.NoError(t, err)
+
+	st := state.NewState(state.Config{}, nil, nil, tree, nil, nil, nil)
+	diffs, err := st.DiffRoots(ctx, rootA, rootB)
+	require.NoError(t, err)
+	require.Len(t, diffs, 1)
+	assert.True(t, diffs[0].Decoded)
+	assert.Equal(t, changed, diffs[0].Address)
+	assert.Equal(t, merkletree.LeafTypeBalance, diffs[0].LeafType)
+	assert.Equal(t, big.NewInt(100), diffs[0].ValueA)
+	assert.Equal(t, big.NewInt(150), diffs[0].ValueB)
+
+	diffs, err = st.DiffRoots(ctx, rootA, rootA)
+	require.NoError(t, err)
+	assert.Empty(t, diffs)
+
+	// the hashdb service finds the same leaves but can't decode them
+	st = state.NewState(state.Config{}, nil, nil, merkletree.NewStateTree(hashDBClient{merkletree.NewLocalHashDBClient(store)}), nil, nil, nil)
+	diffs, err = st.DiffRoots(ctx, rootA, rootB)
+	require.NoError(t, err)
+	require.Len(t, diffs, 1)
+	assert.False(t, diffs[0].Decoded)
+	assert.Equal(t, common.Address{}, diffs[0].Address)
+	assert.Equal(t, big.NewInt(100), diffs[0].ValueA)
+	assert.Equal(t, big.NewInt(150), diffs[0].ValueB)
+}
+
+func TestGetAccount(t *testing.T) {
+	ctx := context.Background()
+	tree := merkletree.NewStateTree(merkletree.NewLocalHashDBClient(merkletree.NewMemStore()))
+	txID := uuid.NewString()
+	addr := common.HexToAddress("0x617b3a3528F9cDd6630fd3301B9c8911F7Bf063D")
+	contract := common.HexToAddress("0x1275fbb540c8efc58b812ba83b0d0b8b9917ae98")
+
+	root := state.ZeroHash.Bytes()
+	var err error
+	root, _, err = tree.SetBalance(ctx, addr, big.NewInt(1000), root, txID)
+	require.NoError(t, err)
+	root, _, err = tree.SetNonce(ctx, addr, big.NewInt(7), root, txID)
+	require.NoError(t, err)
+	root, _, err = tree.SetCode(ctx, contract, common.FromHex("0x6080604052348015600f57600080fd5b50"), root, txID)
+	require.NoError(t, err)
+
+	st := state.NewState(state.Config{}, nil, nil, tree, nil, nil, nil)
+	account, err := st.GetAccount(ctx, addr, root)
+	require.NoError(t, err)
+	assert.Equal(t, "1000", account.Balance.String())
+	assert.Equal(t, uint64(7), account.Nonce)
+	assert.Equal(t, common.Hash{}, account.CodeHash)
+
+	account, err = st.GetAccount(ctx, contract, root)
+	require.NoError(t, err)
+	codeHash, err := tree.GetCodeHash(ctx, contract, root)
+	require.NoError(t, err)
+	assert.Equal(t, common.BytesToHash(codeHash), account.CodeHash)
+	assert.Equal(t, "0", account.Balance.String())
+	assert.Zero(t, account.Nonce)
+}
@@ -18,6 +18,7 @@ import (
 	"github.com/ethereum/go-ethereum/common"
 	"github.com/ethereum/go-ethereum/core/types"
 	"github.com/ethereum/go-ethereum/trie"
+	"github.com/google/uuid"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
@@ -758,6 +759,135 @@ func TestGenesis(t *testing.T) {
 	require.NoError(t, err)
 }
 
+func TestGetBalanceAtBatch(t *testing.T) {
+	ctx := context.Background()
+	block := state.Block{
+		BlockNumber: 1,
+		BlockHash:   state.ZeroHash,
+		ParentHash:  state.ZeroHash,
+		ReceivedAt:  time.Now(),
+	}
+	address := common.HexToAddress("0xb1D0Dc8E2Ce3a93EB2b32f4C7c3fD9dDAf1211FA")
+	newAddress := common.HexToAddress("0xb1D0Dc8E2Ce3a93EB2b32f4C7c3fD9dDAf1211FB")
+
+	test.InitOrResetDB(test.StateDBCfg)
+
+	dbTx, err := testState.BeginStateTransaction(ctx)
+	require.NoError(t, err)
+	test.Genesis.Actions = []*state.GenesisAction{
+		{
+			Address: address.String(),
+			Type:    int(merkletree.LeafTypeBalance),
+			Value:   "1000",
+		},
+	}
+	stateRoot, err := testState.SetGenesis(ctx, block, test.Genesis, metrics.SynchronizerCallerLabel, dbTx)
+	require.NoError(t, err)
+	require.NoError(t, dbTx.Commit(ctx))
+
+	// fund the account in batch 1 and fund it again along with a new account in batch 2
+	stateTree := testState.GetTree()
+	fund := func(oldRoot common.Hash, balances map[common.Address]int64) common.Hash {
+		uuid := uuid.New().String()
+		require.NoError(t, stateTree.StartBlock(ctx, oldRoot, uuid))
+		root := oldRoot.Bytes()
+		for addr, balance := range balances {
+			root, _, err = stateTree.SetBalance(ctx, addr, big.NewInt(balance), root, uuid)
+			require.NoError(t, err)
+		}
+		newRoot := common.BytesToHash(root)
+		require.NoError(t, stateTree.FinishBlock(ctx, newRoot, uuid))
+		require.NoError(t, stateTree.Flush(ctx, newRoot, uuid))
+		return newRoot
+	}
+	batch1Root := fund(stateRoot, map[common.Address]int64{address: 1500})
+	batch2Root := fund(batch1Root, map[common.Address]int64{address: 2500, newAddress: 100})
+
+	for batchNumber, root := range []common.Hash{batch1Root, batch2Root} {
+		_, err = testState.Exec(ctx, "INSERT INTO state.batch (batch_num, state_root, wip) VALUES ($1, $2, FALSE)", batchNumber+1, root.String())
+		require.NoError(t, err)
+	}
+
+	balance, err := testState.GetBalanceAtBatch(ctx, address, 0)
+	require.NoError(t, err)
+	assert.Equal(t, "1000", balance.String())
+
+	balance, err = testState.GetBalanceAtBatch(ctx, address, 1)
+	require.NoError(t, err)
+	assert.Equal(t, "1500", balance.String())
+
+	balance, err = testState.GetBalanceAtBatch(ctx, address, 2)
+	require.NoError(t, err)
+	assert.Equal(t, "2500", balance.String())
+
+	// the new account didn't exist before batch 2
+	balance, err = testState.GetBalanceAtBatch(ctx, newAddress, 1)
+	require.NoError(t, err)
+	assert.Equal(t, "0", balance.String())
+
+	balance, err = testState.GetBalanceAtBatch(ctx, newAddress, 2)
+	require.NoError(t, err)
+	assert.Equal(t, "100", balance.String())
+
+	_, err = testState.GetBalanceAtBatch(ctx, address, 3)
+	assert.ErrorIs(t, err, state.ErrNotFound)
+}
+
+func TestGetCodeAndStorageAtBatch(t *testing.T) {
+	ctx := context.Background()
+	block := state.Block{
+		BlockNumber: 1,
+		BlockHash:   state.ZeroHash,
+		ParentHash:  state.ZeroHash,
+		ReceivedAt:  time.Now(),
+	}
+	scAddress := common.HexToAddress("0xae4bb80be56b819606589de61d5ec3b522eeb032")
+	// returns the value of the storage slot 0
+	bytecode := "60005460005260206000f3"
+
+	test.InitOrResetDB(test.StateDBCfg)
+
+	dbTx, err := testState.BeginStateTransaction(ctx)
+	require.NoError(t, err)
+	test.Genesis.Actions = []*state.GenesisAction{
+		{
+			Address:  scAddress.String(),
+			Type:     int(merkletree.LeafTypeCode),
+			Bytecode: bytecode,
+		},
+		{
+			Address:         scAddress.String(),
+			Type:            int(merkletree.LeafTypeStorage),
+			StoragePosition: "0x0000000000000000000000000000000000000000000000000000000000000000",
+			Value:           "0x2a",
+		},
+	}
+	_, err = testState.SetGenesis(ctx, block, test.Genesis, metrics.SynchronizerCallerLabel, dbTx)
+	require.NoError(t, err)
+	require.NoError(t, dbTx.Commit(ctx))
+
+	code, err := testState.GetCodeAtBatch(ctx, scAddress, 0)
+	require.NoError(t, err)
+	assert.Equal(t, common.Hex2Bytes(bytecode), code)
+
+	value, err := testState.GetStorageAtBatch(ctx, scAddress, big.NewInt(0), 0)
+	require.NoError(t, err)
+	assert.Equal(t, "42", value.String())
+
+	// missing entries are empty
+	value, err = testState.GetStorageAtBatch(ctx, scAddress, big.NewInt(1), 0)
+	require.NoError(t, err)
+	assert.Equal(t, "0", value.String())
+
+	eoa := common.HexToAddress("0xb1D0Dc8E2Ce3a93EB2b32f4C7c3fD9dDAf1211FA")
+	code, err = testState.GetCodeAtBatch(ctx, eoa, 0)
+	require.NoError(t, err)
+	assert.Empty(t, code)
+
+	_, err = testState.GetCodeAtBatch(ctx, scAddress, 1)
+	assert.ErrorIs(t, err, state.ErrNotFound)
+}
+
 func TestGetForkIDforGenesisBatch(t *testing.T) {
 	type testCase struct {
 		name           string
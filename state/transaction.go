@@ -102,6 +102,19 @@ func RlpFieldsToLegacyTx(fields [][]byte, v, r, s []byte) (tx *types.LegacyTx, e
 	}, nil
 }
 
+// GetTransactionWithLocationByHash returns the transaction with the provided hash
+// along with the batch, the L2 block and the index in the L2 block where it was
+// included. A *TxNotFoundError is returned when the transaction is not stored.
+func (s *State) GetTransactionWithLocationByHash(ctx context.Context, hash common.Hash, dbTx pgx.Tx) (*types.Transaction, *TxLocation, error) {
+	tx, location, err := s.GetTransactionAndLocationByHash(ctx, hash, dbTx)
+	if errors.Is(err, ErrNotFound) {
+		return nil, nil, &TxNotFoundError{Hash: hash}
+	} else if err != nil {
+		return nil, nil, err
+	}
+	return tx, location, nil
+}
+
 // StoreTransactions is used by the synchronizer through the method ProcessAndStoreClosedBatch.
 func (s *State) StoreTransactions(ctx context.Context, batchNumber uint64, processedBlocks []*ProcessBlockResponse, txsEGPLog []*EffectiveGasPriceLog, dbTx pgx.Tx) error {
 	if dbTx == nil {
@@ -346,6 +346,39 @@ type TrustedReorg struct {
 	Reason      string
 }
 
+// TxLocation is the position of a transaction in the L2
+type TxLocation struct {
+	BatchNumber   uint64
+	L2BlockNumber uint64
+	// Index is the position of the tx in the L2 block
+	Index uint64
+}
+
+// Account is the state of an account stored in the state tree
+type Account struct {
+	Balance *big.Int
+	Nonce   uint64
+	// CodeHash is the hash of the code of the contract, empty for the
+	// accounts without code
+	CodeHash common.Hash
+}
+
+// LeafDiff is a leaf of the state tree whose value differs between two roots
+type LeafDiff struct {
+	Key []byte
+	// Decoded tells whether the preimage of the key is known, otherwise
+	// Address, LeafType and Position are empty
+	Decoded  bool
+	Address  common.Address
+	LeafType merkletree.LeafType
+	// Position is the storage position of the storage leaves
+	Position common.Hash
+	// ValueA and ValueB are the values at both roots, zero when the leaf is
+	// missing
+	ValueA *big.Int
+	ValueB *big.Int
+}
+
 // HexToAddressPtr create an address from a hex and returns its pointer
 func HexToAddressPtr(hex string) *common.Address {
 	a := common.HexToAddress(hex)
@@ -5,4 +5,12 @@ const (
 	ENV_ZKPROVER_URI = "ZKPROVER_URI"
 	//ENV_MERKLETREE_URI environment variable name for MERKLETREE URI
 	ENV_MERKLETREE_URI = "MERKLETREE_URI"
+	//ENV_OPS_INTERVAL environment variable name for the polling interval of the operations package
+	ENV_OPS_INTERVAL = "ZKEVM_OPS_INTERVAL"
+	//ENV_OPS_DEADLINE environment variable name for the polling deadline of the operations package
+	ENV_OPS_DEADLINE = "ZKEVM_OPS_DEADLINE"
+	//ENV_OPS_TX_MINED_DEADLINE environment variable name for the deadline of the txs to be mined in the operations package
+	ENV_OPS_TX_MINED_DEADLINE = "ZKEVM_OPS_TX_MINED_DEADLINE"
+	//ENV_OPS_PRINT_ROOTS environment variable name to print the state roots to stdout after the txs applied by the operations package
+	ENV_OPS_PRINT_ROOTS = "ZKEVM_OPS_PRINT_ROOTS"
 )
@@ -75,6 +75,51 @@ type l2Stuff struct {
 	checkThatPreviousTxsWereProcessedWithinPreviousClosedBatch(ctx, t, l2.opsman.State(), l2BlockNumbersTxsBeforeForcedBatch, forcedBatch.BatchNumber)
 }*/
 
+func TestManagerForceBatch(t *testing.T) {
+	if testing.Short() {
+		t.Skip()
+	}
+	if !dockersArePreLaunched {
+		defer func() {
+			require.NoError(t, operations.Teardown())
+		}()
+	}
+
+	ctx := context.Background()
+	l2 := setupEnvironment(ctx, t)
+	l1 := setupEnvironmentL1(ctx, t)
+	st := l2.opsman.State()
+
+	lastVirtualBatchNum, err := st.GetLastVirtualBatchNum(ctx, nil)
+	require.NoError(t, err)
+
+	encodedTxs := generateSignedAndEncodedTxForForcedBatch(ctx, t, l2)
+	txHash, err := l2.opsman.ForceBatch(ctx, encodedTxs)
+	require.NoError(t, err)
+	receipt, err := l1.ethClient.TransactionReceipt(ctx, txHash)
+	require.NoError(t, err)
+	require.Equal(t, types.ReceiptStatusSuccessful, receipt.Status)
+
+	forcedBatchNum, err := l1.zkEvm.LastForceBatch(&bind.CallOpts{Pending: false})
+	require.NoError(t, err)
+
+	var forcedBatch *state.Batch
+	err = operations.Poll(operations.DefaultInterval, 4*time.Minute, func() (bool, error) {
+		forcedBatch, err = st.GetBatchByForcedBatchNum(ctx, forcedBatchNum, nil)
+		if err == state.ErrStateNotSynchronized || err == state.ErrNotFound {
+			return false, nil
+		}
+		return err == nil, err
+	})
+	require.NoError(t, err)
+
+	err = operations.WaitBatchToBeVirtualized(forcedBatch.BatchNumber, 4*time.Minute, st)
+	require.NoError(t, err)
+	newLastVirtualBatchNum, err := st.GetLastVirtualBatchNum(ctx, nil)
+	require.NoError(t, err)
+	require.Greater(t, newLastVirtualBatchNum, lastVirtualBatchNum)
+}
+
 func generateTxsBeforeSendingForcedBatch(ctx context.Context, t *testing.T, nTxs int, l2 *l2Stuff) []*big.Int {
 	txs := make([]*types.Transaction, 0, nTxs)
 	for i := 0; i < nTxs; i++ {
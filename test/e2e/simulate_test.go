@@ -0,0 +1,76 @@
+package e2e
+
+import (
+	"context"
+	"math/big"
+	"testing"
+
+	"github.com/0xPolygonHermez/zkevm-node/config"
+	"github.com/0xPolygonHermez/zkevm-node/state"
+	"github.com/0xPolygonHermez/zkevm-node/test/operations"
+	"github.com/0xPolygonHermez/zkevm-node/test/vectors"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/stretchr/testify/require"
+)
+
+// TestSimulateTxs checks that simulating the txs of the vector gives the same
+// results as sending them. The state root is not compared since the
+// timestamp of the L2 blocks closed by the sequencer is part of it.
+func TestSimulateTxs(t *testing.T) {
+	if testing.Short() {
+		t.Skip()
+	}
+
+	defer func() {
+		require.NoError(t, operations.Teardown())
+	}()
+
+	testCases, err := vectors.LoadStateTransitionTestCases("./../vectors/src/state-transition/no-data/general.json")
+	require.NoError(t, err)
+	genesisFileAsStr, err := config.LoadGenesisFileAsString("../config/test.genesis.config.json")
+	require.NoError(t, err)
+	genesisConfig, err := config.LoadGenesisFromJSONString(genesisFileAsStr)
+	require.NoError(t, err)
+	testCase := testCases[0]
+
+	ctx := context.Background()
+	opsCfg := operations.GetDefaultOperationsConfig()
+	opsCfg.SequenceSender.SenderAddress = testCase.SequencerAddress
+	opsCfg.SequenceSender.PrivateKey = testCase.SequencerPrivateKey
+	opsman, err := operations.NewManager(ctx, opsCfg)
+	require.NoError(t, err)
+
+	genesisAccounts := make(map[string]big.Int)
+	for _, gacc := range testCase.GenesisAccounts {
+		genesisAccounts[gacc.Address] = gacc.Balance.Int
+	}
+	require.NoError(t, opsman.SetGenesisAccountsBalance(genesisConfig.Genesis.BlockNumber, genesisAccounts))
+	require.NoError(t, opsman.Setup())
+
+	// the simulation doesn't change the state
+	st := opsman.State()
+	lastBatch, err := st.GetLastBatch(ctx, nil)
+	require.NoError(t, err)
+	simulatedRoot, results, err := opsman.SimulateTxs(ctx, testCase.Txs, lastBatch.StateRoot.String())
+	require.NoError(t, err)
+	require.NotEqual(t, lastBatch.StateRoot.String(), simulatedRoot)
+	lastBatchAfter, err := st.GetLastBatch(ctx, nil)
+	require.NoError(t, err)
+	require.Equal(t, lastBatch.BatchNumber, lastBatchAfter.BatchNumber)
+	require.Equal(t, lastBatch.StateRoot, lastBatchAfter.StateRoot)
+
+	txs := make([]*types.Transaction, 0, len(testCase.Txs))
+	for _, vecTx := range testCase.Txs {
+		tx, err := state.DecodeTx(vecTx.RawTx)
+		require.NoError(t, err)
+		txs = append(txs, tx)
+	}
+	receipts, err := opsman.ApplyL2Txs(txs, nil, operations.VerifiedConfirmationLevel)
+	require.NoError(t, err)
+
+	require.Len(t, results, len(receipts))
+	for i, receipt := range receipts {
+		require.Equal(t, receipt.Status == types.ReceiptStatusSuccessful, results[i].Success, results[i].Err)
+		require.Equal(t, receipt.GasUsed, results[i].GasUsed)
+	}
+}
@@ -0,0 +1,66 @@
+package operations
+
+import (
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/accounts/keystore"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGetAuthFromKeystore(t *testing.T) {
+	privateKey, err := crypto.GenerateKey()
+	require.NoError(t, err)
+	key := &keystore.Key{
+		Id:         uuid.New(),
+		Address:    crypto.PubkeyToAddress(privateKey.PublicKey),
+		PrivateKey: privateKey,
+	}
+	keyJSON, err := keystore.EncryptKey(key, "testonly", keystore.LightScryptN, keystore.LightScryptP)
+	require.NoError(t, err)
+	path := filepath.Join(t.TempDir(), "test.keystore")
+	require.NoError(t, os.WriteFile(path, keyJSON, 0600))
+
+	chainID := new(big.Int).SetUint64(DefaultL2ChainID)
+	auth, err := GetAuthFromKeystore(path, "testonly", chainID)
+	require.NoError(t, err)
+	assert.Equal(t, key.Address, auth.From)
+
+	_, err = GetAuthFromKeystore(path, "wrong", chainID)
+	assert.ErrorIs(t, err, keystore.ErrDecrypt)
+
+	_, err = GetAuthFromKeystore(filepath.Join(t.TempDir(), "missing.keystore"), "testonly", chainID)
+	assert.ErrorIs(t, err, os.ErrNotExist)
+}
+
+func TestGetAuthAutoChain(t *testing.T) {
+	l1URL := freeLocalURL(t)
+	l1, err := startSimulatedL1(l1URL)
+	require.NoError(t, err)
+	defer func() {
+		require.NoError(t, l1.stop())
+	}()
+	client, err := GetClient(l1URL)
+	require.NoError(t, err)
+	defer client.Close()
+
+	auth, err := GetAuthAutoChain(DefaultSequencerPrivateKey, client)
+	require.NoError(t, err)
+	assert.Equal(t, common.HexToAddress(DefaultSequencerAddress), auth.From)
+
+	// the txs are signed for the chain of the client
+	to := common.HexToAddress("0x1")
+	tx, err := auth.Signer(auth.From, types.NewTx(&types.LegacyTx{To: &to, Gas: 21000, GasPrice: big.NewInt(1)}))
+	require.NoError(t, err)
+	assert.Equal(t, new(big.Int).SetUint64(DefaultL1ChainID), tx.ChainId())
+
+	_, err = GetAuthAutoChain("0xnotakey", client)
+	assert.ErrorContains(t, err, "invalid private key")
+}
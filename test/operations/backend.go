@@ -0,0 +1,144 @@
+package operations
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/big"
+	"net"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core"
+	"github.com/ethereum/go-ethereum/eth/ethconfig"
+	"github.com/ethereum/go-ethereum/ethclient"
+	"github.com/ethereum/go-ethereum/ethclient/simulated"
+	"github.com/ethereum/go-ethereum/node"
+)
+
+// Backend selects where the components of the environment run.
+type Backend string
+
+const (
+	// DockerBackend runs every component in a docker-compose container
+	// started with the Makefile of the test folder. It's the default.
+	DockerBackend Backend = "docker"
+	// SimulatedL1Backend only provides the L1 network: it runs an in-process
+	// simulated geth served over HTTP at the L1 URL of the manager, so
+	// neither Docker nor the Makefile are needed. The L1 chain ID is
+	// DefaultL1ChainID and the default sequencer and forced batches accounts
+	// are funded in genesis.
+	//
+	// There is no in-process state nor sequencer: the state needs the
+	// executor, the merkletree and the state database, which only run in
+	// containers. So the following features return ErrUnsupportedByBackend:
+	//   - the state: State is nil, NewManager doesn't reset the databases and
+	//     CheckVirtualRoot, CheckConsolidatedRoot, GetStateRoot, PrintRoots,
+	//     CheckBalance, WaitForRootsToConverge, SimulateTxs, DumpState,
+	//     SetGenesis, SetForkID and BeginStateTransaction fail
+	//   - the L2 network: the node, the prover, the sequencer and the
+	//     sequence sender aren't started, so L2Client and everything sending
+	//     to or waiting on L2, like ApplyL2Txs, fail unless L2URL points to a
+	//     node running elsewhere
+	//   - the components needing docker, see Setup
+	// The L1 smart contracts of the rollup are not deployed either, so
+	// PoEAddress and MaticAddress don't point to any code.
+	SimulatedL1Backend Backend = "simulated-l1"
+
+	// simulatedBlockPeriod is the time between the blocks of the simulated
+	// L1 network.
+	simulatedBlockPeriod = 100 * time.Millisecond
+)
+
+// ErrUnsupportedByBackend is returned when the operation needs a component
+// that the backend of the manager doesn't provide.
+var ErrUnsupportedByBackend = errors.New("operation not supported by the backend")
+
+// simulatedL1 is an in-process L1 network that mines a block every
+// simulatedBlockPeriod.
+type simulatedL1 struct {
+	backend *simulated.Backend
+	done    chan struct{}
+	stopped chan struct{}
+}
+
+// startSimulatedL1 starts a simulated L1 network serving its JSON RPC API at
+// the host and port of the given URL.
+func startSimulatedL1(l1NetworkURL string) (*simulatedL1, error) {
+	u, err := url.Parse(l1NetworkURL)
+	if err != nil {
+		return nil, err
+	}
+	host, portStr, err := net.SplitHostPort(u.Host)
+	if err != nil {
+		return nil, fmt.Errorf("the L1 URL %s must have a host and a port: %w", l1NetworkURL, err)
+	}
+	port, err := strconv.Atoi(portStr)
+	if err != nil {
+		return nil, fmt.Errorf("invalid port in the L1 URL %s: %w", l1NetworkURL, err)
+	}
+
+	// 10000000 ETH in wei
+	balance, _ := new(big.Int).SetString("10000000000000000000000000", 10) //nolint:gomnd
+	alloc := core.GenesisAlloc{
+		common.HexToAddress(DefaultSequencerAddress):     {Balance: balance},
+		common.HexToAddress(DefaultForcedBatchesAddress): {Balance: balance},
+	}
+	backend := simulated.NewBackend(alloc, func(nodeConf *node.Config, ethConf *ethconfig.Config) {
+		nodeConf.HTTPHost = host
+		nodeConf.HTTPPort = port
+		nodeConf.HTTPModules = []string{"eth", "net", "web3"}
+		nodeConf.HTTPVirtualHosts = []string{"*"}
+	})
+
+	l1 := &simulatedL1{
+		backend: backend,
+		done:    make(chan struct{}),
+		stopped: make(chan struct{}),
+	}
+	go l1.mine()
+
+	// the txs can't be looked up by hash until the indexer is done, so the
+	// network isn't ready before
+	client, err := ethclient.Dial(l1NetworkURL)
+	if err != nil {
+		return nil, errors.Join(err, l1.stop())
+	}
+	defer client.Close()
+	err = Poll(DefaultInterval, DefaultDeadline, func() (bool, error) {
+		progress, err := client.SyncProgress(context.Background())
+		if err != nil {
+			return false, err
+		}
+		return progress == nil || progress.Done(), nil
+	})
+	if err != nil {
+		return nil, errors.Join(err, l1.stop())
+	}
+	return l1, nil
+}
+
+// mine commits a block every simulatedBlockPeriod until the network is
+// stopped.
+func (l1 *simulatedL1) mine() {
+	defer close(l1.stopped)
+	ticker := time.NewTicker(simulatedBlockPeriod)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-l1.done:
+			return
+		case <-ticker.C:
+			l1.backend.Commit()
+		}
+	}
+}
+
+// stop stops mining and shuts the network down.
+func (l1 *simulatedL1) stop() error {
+	close(l1.done)
+	<-l1.stopped
+	return l1.backend.Close()
+}
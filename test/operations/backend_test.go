@@ -0,0 +1,103 @@
+package operations
+
+import (
+	"context"
+	"fmt"
+	"math/big"
+	"net"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// freeLocalURL returns the URL of a local port that is not in use.
+func freeLocalURL(t *testing.T) string {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	addr := l.Addr().String()
+	require.NoError(t, l.Close())
+	return fmt.Sprintf("http://%s", addr)
+}
+
+func TestSimulatedL1Backend(t *testing.T) {
+	ctx := context.Background()
+	cfg := GetDefaultOperationsConfig()
+	cfg.Backend = SimulatedL1Backend
+	cfg.L1URL = freeLocalURL(t)
+	m, err := NewManager(ctx, cfg)
+	require.NoError(t, err)
+	assert.Nil(t, m.State())
+
+	require.NoError(t, m.Setup())
+	defer func() {
+		require.NoError(t, m.StopNetwork())
+	}()
+
+	client, err := GetClient(m.L1NetworkURL())
+	require.NoError(t, err)
+	chainID, err := client.ChainID(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, DefaultL1ChainID, chainID.Uint64())
+
+	auth, err := GetAuth(DefaultSequencerPrivateKey, DefaultL1ChainID)
+	require.NoError(t, err)
+	nonce, err := client.PendingNonceAt(ctx, auth.From)
+	require.NoError(t, err)
+	gasPrice, err := client.SuggestGasPrice(ctx)
+	require.NoError(t, err)
+	to := common.HexToAddress("0x1111111111111111111111111111111111111111")
+	tx := types.NewTx(&types.LegacyTx{Nonce: nonce, To: &to, Gas: 21000, GasPrice: gasPrice, Value: big.NewInt(1000)})
+	require.NoError(t, ApplyL1Txs(ctx, []*types.Transaction{tx}, auth, client))
+
+	balance, err := client.BalanceAt(ctx, to, nil)
+	require.NoError(t, err)
+	assert.Equal(t, "1000", balance.String())
+
+	// the components needing docker are not available
+	err = m.StartProver()
+	assert.ErrorIs(t, err, ErrUnsupportedByBackend)
+	var setupErr *SetupError
+	require.ErrorAs(t, err, &setupErr)
+	assert.Equal(t, ComponentProver, setupErr.Component)
+	assert.ErrorIs(t, m.StartSequencer(), ErrUnsupportedByBackend)
+	assert.ErrorIs(t, m.InitNetwork(), ErrUnsupportedByBackend)
+
+	// neither are the state and the L2 network
+	assert.ErrorIs(t, m.CheckVirtualRoot(""), ErrUnsupportedByBackend)
+	assert.ErrorIs(t, m.CheckConsolidatedRoot(""), ErrUnsupportedByBackend)
+	assert.ErrorIs(t, m.WaitForRootsToConverge(ctx, time.Second), ErrUnsupportedByBackend)
+	assert.ErrorIs(t, m.SetGenesis(0, nil), ErrUnsupportedByBackend)
+	assert.ErrorIs(t, m.DumpState(filepath.Join(t.TempDir(), "state.json")), ErrUnsupportedByBackend)
+	_, _, err = m.SimulateTxs(ctx, nil, "")
+	assert.ErrorIs(t, err, ErrUnsupportedByBackend)
+	_, err = m.ApplyL2Txs([]*types.Transaction{tx}, auth, TrustedConfirmationLevel)
+	assert.ErrorIs(t, err, ErrUnsupportedByBackend)
+	_, err = m.WaitForBatchVirtualization(ctx, 1, time.Second)
+	assert.ErrorIs(t, err, ErrUnsupportedByBackend)
+}
+
+func TestSimulatedL1BackendL2URL(t *testing.T) {
+	cfg := &Config{Backend: SimulatedL1Backend, L2URL: freeLocalURL(t)}
+	m, err := NewManagerNoInitDB(context.Background(), cfg)
+	require.NoError(t, err)
+
+	// a node running elsewhere can be used as the L2 network
+	client, err := m.L2Client()
+	require.NoError(t, err)
+	client.Close()
+	assert.ErrorIs(t, m.CheckVirtualRoot(""), ErrUnsupportedByBackend)
+}
+
+func TestConfigValidateBackend(t *testing.T) {
+	for _, backend := range []Backend{"", DockerBackend, SimulatedL1Backend} {
+		cfg := &Config{Backend: backend}
+		assert.NoError(t, cfg.validate(), backend)
+	}
+	cfg := &Config{Backend: "kubernetes"}
+	assert.Error(t, cfg.validate())
+}
@@ -0,0 +1,62 @@
+package operations
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+// ErrEmptyBytecode is returned when deploying a contract without bytecode.
+var ErrEmptyBytecode = errors.New("empty contract bytecode")
+
+// DeployContract deploys the contract with the given bytecode in the L2
+// network of the manager, waits for the creation tx to be mined and returns
+// the address of the contract taken from the receipt. The constructor args
+// are encoded with the ABI of the contract, see DeployContractWithABI, so they
+// can't be given here.
+func (m *Manager) DeployContract(ctx context.Context, auth *bind.TransactOpts, bytecode []byte, args ...interface{}) (common.Address, *types.Transaction, error) {
+	return m.DeployContractWithABI(ctx, auth, nil, bytecode, args...)
+}
+
+// DeployContractWithABI is DeployContract encoding the args with the
+// constructor of the given ABI. The ABI may be nil when the constructor has no
+// args.
+func (m *Manager) DeployContractWithABI(ctx context.Context, auth *bind.TransactOpts, contractABI *abi.ABI, bytecode []byte, args ...interface{}) (common.Address, *types.Transaction, error) {
+	if len(bytecode) == 0 {
+		return common.Address{}, nil, ErrEmptyBytecode
+	}
+	if contractABI == nil {
+		if len(args) > 0 {
+			return common.Address{}, nil, fmt.Errorf("the ABI of the contract is needed to encode %d constructor args", len(args))
+		}
+		contractABI = &abi.ABI{}
+	}
+	client, err := m.L2Client()
+	if err != nil {
+		return common.Address{}, nil, err
+	}
+
+	opts := *auth
+	opts.Context = ctx
+	_, tx, _, err := bind.DeployContract(&opts, *contractABI, bytecode, client, args...)
+	if err != nil {
+		return common.Address{}, nil, fmt.Errorf("failed to send the creation tx: %w", err)
+	}
+	logger := m.logger("txHash", tx.Hash(), "nonce", tx.Nonce())
+	logger.Infow("contract creation tx sent")
+
+	if err := WaitTxToBeMined(ctx, client, tx, DefaultTxMinedDeadline); err != nil {
+		return common.Address{}, tx, err
+	}
+	receipt, err := client.TransactionReceipt(ctx, tx.Hash())
+	if err != nil {
+		return common.Address{}, tx, err
+	}
+	logger.Infow("contract deployed", "address", receipt.ContractAddress)
+	return receipt.ContractAddress, tx, nil
+}
@@ -0,0 +1,56 @@
+package operations
+
+import (
+	"context"
+	"testing"
+
+	"github.com/0xPolygonHermez/zkevm-node/test/contracts/bin/ERC20"
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDeployContract(t *testing.T) {
+	ctx := context.Background()
+	// the simulated L1 network stands in for the L2 one
+	url := freeLocalURL(t)
+	l1, err := startSimulatedL1(url)
+	require.NoError(t, err)
+	defer func() {
+		require.NoError(t, l1.stop())
+	}()
+	m := &Manager{cfg: &Config{L2URL: url}}
+	client, err := m.L2Client()
+	require.NoError(t, err)
+	auth, err := GetAuthAutoChain(DefaultSequencerPrivateKey, client)
+	require.NoError(t, err)
+
+	addr, tx, err := m.DeployContract(ctx, auth, common.FromHex(TokenBin))
+	require.NoError(t, err)
+	assert.Nil(t, tx.To())
+	token, err := NewToken(addr, client)
+	require.NoError(t, err)
+	code, err := client.CodeAt(ctx, addr, nil)
+	require.NoError(t, err)
+	assert.NotEmpty(t, code)
+	_, err = token.TotalSupply(&bind.CallOpts{Context: ctx})
+	require.NoError(t, err)
+
+	// the constructor args need the ABI
+	_, _, err = m.DeployContract(ctx, auth, common.FromHex(ERC20.ERC20Bin), "Test", "TST")
+	assert.Error(t, err)
+
+	erc20ABI, err := ERC20.ERC20MetaData.GetAbi()
+	require.NoError(t, err)
+	addr, _, err = m.DeployContractWithABI(ctx, auth, erc20ABI, common.FromHex(ERC20.ERC20Bin), "Test", "TST")
+	require.NoError(t, err)
+	erc20, err := ERC20.NewERC20(addr, client)
+	require.NoError(t, err)
+	name, err := erc20.Name(&bind.CallOpts{Context: ctx})
+	require.NoError(t, err)
+	assert.Equal(t, "Test", name)
+
+	_, _, err = m.DeployContract(ctx, auth, nil)
+	assert.ErrorIs(t, err, ErrEmptyBytecode)
+}
@@ -0,0 +1,81 @@
+package operations
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"time"
+
+	"github.com/0xPolygonHermez/zkevm-node/state"
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// stateDump is the content of the file written by DumpState.
+type stateDump struct {
+	LastBatchNumber         uint64      `json:"lastBatchNumber"`
+	LastVirtualBatchNumber  uint64      `json:"lastVirtualBatchNumber"`
+	LastVerifiedBatchNumber uint64      `json:"lastVerifiedBatchNumber"`
+	Batches                 []batchDump `json:"batches"`
+}
+
+// batchDump are the roots of a batch.
+type batchDump struct {
+	BatchNumber    uint64      `json:"batchNumber"`
+	StateRoot      common.Hash `json:"stateRoot"`
+	LocalExitRoot  common.Hash `json:"localExitRoot"`
+	AccInputHash   common.Hash `json:"accInputHash"`
+	GlobalExitRoot common.Hash `json:"globalExitRoot"`
+	Timestamp      time.Time   `json:"timestamp"`
+	WIP            bool        `json:"wip"`
+}
+
+// DumpState writes the batches of the state along with their roots to the
+// given file as JSON, to inspect the state after a failed test.
+func (m *Manager) DumpState(path string) error {
+	var (
+		dump stateDump
+		err  error
+	)
+	if err = m.checkState("DumpState"); err != nil {
+		return err
+	}
+
+	dump.LastBatchNumber, err = m.st.GetLastBatchNumber(m.ctx, nil)
+	if err != nil {
+		return err
+	}
+	dump.LastVirtualBatchNumber, err = m.st.GetLastVirtualBatchNum(m.ctx, nil)
+	if err != nil {
+		return err
+	}
+	verifiedBatch, err := m.st.GetLastVerifiedBatch(m.ctx, nil)
+	if err != nil && !errors.Is(err, state.ErrNotFound) {
+		return err
+	} else if err == nil {
+		dump.LastVerifiedBatchNumber = verifiedBatch.BatchNumber
+	}
+
+	for batchNumber := uint64(0); batchNumber <= dump.LastBatchNumber; batchNumber++ {
+		batch, err := m.st.GetBatchByNumber(m.ctx, batchNumber, nil)
+		if errors.Is(err, state.ErrNotFound) {
+			continue
+		} else if err != nil {
+			return err
+		}
+		dump.Batches = append(dump.Batches, batchDump{
+			BatchNumber:    batch.BatchNumber,
+			StateRoot:      batch.StateRoot,
+			LocalExitRoot:  batch.LocalExitRoot,
+			AccInputHash:   batch.AccInputHash,
+			GlobalExitRoot: batch.GlobalExitRoot,
+			Timestamp:      batch.Timestamp,
+			WIP:            batch.WIP,
+		})
+	}
+
+	data, err := json.MarshalIndent(dump, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, data, 0644) //nolint:gosec
+}
@@ -0,0 +1,85 @@
+package operations
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/0xPolygonHermez/zkevm-node/state"
+	"github.com/0xPolygonHermez/zkevm-node/state/mocks"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDumpState(t *testing.T) {
+	ctx := context.Background()
+	timestamp := time.Unix(1700000000, 0).UTC()
+	batches := []*state.Batch{
+		{BatchNumber: 0, StateRoot: common.HexToHash("0x10"), Timestamp: timestamp},
+		nil,
+		{BatchNumber: 2, StateRoot: common.HexToHash("0x12"), LocalExitRoot: common.HexToHash("0x22"), AccInputHash: common.HexToHash("0x32"), GlobalExitRoot: common.HexToHash("0x42"), Timestamp: timestamp, WIP: true},
+	}
+
+	storage := mocks.NewStorageMock(t)
+	storage.EXPECT().GetLastBatchNumber(ctx, nil).Return(uint64(2), nil)
+	storage.EXPECT().GetLastVirtualBatchNum(ctx, nil).Return(uint64(1), nil)
+	storage.EXPECT().GetLastVerifiedBatch(ctx, nil).Return(&state.VerifiedBatch{BatchNumber: 1}, nil)
+	for i, batch := range batches {
+		if batch == nil {
+			// missing batches are skipped
+			storage.EXPECT().GetBatchByNumber(ctx, uint64(i), nil).Return(nil, state.ErrNotFound)
+			continue
+		}
+		storage.EXPECT().GetBatchByNumber(ctx, uint64(i), nil).Return(batch, nil)
+	}
+
+	m := &Manager{
+		cfg: &Config{},
+		ctx: ctx,
+		st:  state.NewState(state.Config{}, storage, mocks.NewExecutorServiceClientMock(t), nil, nil, nil, nil),
+	}
+	path := filepath.Join(t.TempDir(), "state.json")
+	require.NoError(t, m.DumpState(path))
+
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	var dump stateDump
+	require.NoError(t, json.Unmarshal(data, &dump))
+	assert.Equal(t, stateDump{
+		LastBatchNumber:         2,
+		LastVirtualBatchNumber:  1,
+		LastVerifiedBatchNumber: 1,
+		Batches: []batchDump{
+			{BatchNumber: 0, StateRoot: common.HexToHash("0x10"), Timestamp: timestamp},
+			{BatchNumber: 2, StateRoot: common.HexToHash("0x12"), LocalExitRoot: common.HexToHash("0x22"), AccInputHash: common.HexToHash("0x32"), GlobalExitRoot: common.HexToHash("0x42"), Timestamp: timestamp, WIP: true},
+		},
+	}, dump)
+}
+
+func TestDumpStateWithoutVerifiedBatch(t *testing.T) {
+	ctx := context.Background()
+	storage := mocks.NewStorageMock(t)
+	storage.EXPECT().GetLastBatchNumber(ctx, nil).Return(uint64(0), nil)
+	storage.EXPECT().GetLastVirtualBatchNum(ctx, nil).Return(uint64(0), nil)
+	storage.EXPECT().GetLastVerifiedBatch(ctx, nil).Return(nil, state.ErrNotFound)
+	storage.EXPECT().GetBatchByNumber(ctx, uint64(0), nil).Return(&state.Batch{}, nil)
+
+	m := &Manager{
+		cfg: &Config{},
+		ctx: ctx,
+		st:  state.NewState(state.Config{}, storage, mocks.NewExecutorServiceClientMock(t), nil, nil, nil, nil),
+	}
+	path := filepath.Join(t.TempDir(), "state.json")
+	require.NoError(t, m.DumpState(path))
+
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	var dump stateDump
+	require.NoError(t, json.Unmarshal(data, &dump))
+	assert.Zero(t, dump.LastVerifiedBatchNumber)
+	assert.Len(t, dump.Batches, 1)
+}
@@ -0,0 +1,77 @@
+package operations
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Names of the components started by the Manager.
+const (
+	ComponentNetwork        = "network"
+	ComponentProver         = "zkprover"
+	ComponentApprovePol     = "approve-pol"
+	ComponentNode           = "node"
+	ComponentPermissionless = "permissionless"
+)
+
+// ErrComponentNotReady is returned when a component was started but its
+// readiness conditions were not met.
+var ErrComponentNotReady = errors.New("component not ready")
+
+// ErrBalanceMismatch is returned by Manager.CheckBalance and
+// Manager.CheckTokenBalance when the balance of the account is not the
+// expected one.
+var ErrBalanceMismatch = errors.New("balance mismatch")
+
+// ErrTxNotRejected is returned by Manager.ExpectTxRejected when the tx is
+// mined.
+var ErrTxNotRejected = errors.New("tx not rejected")
+
+// ErrRootMismatch is returned by Manager.CheckVirtualRoot and
+// Manager.CheckConsolidatedRoot when the state root is not the expected one.
+var ErrRootMismatch = errors.New("state root mismatch")
+
+// ErrTracingDisabled is returned by Manager.TraceTransaction when the debug
+// endpoints are not enabled in the L2 node.
+var ErrTracingDisabled = errors.New("tracing disabled")
+
+// SetupError is returned when a component fails to start or stop, so callers
+// can use errors.As to know which component failed.
+type SetupError struct {
+	// Component is the name of the failing component
+	Component string
+	// Err is the underlying error
+	Err error
+	// TeardownAttempted is true when the components started before the
+	// failure were stopped
+	TeardownAttempted bool
+	// Logs is the tail of the logs of the component when it didn't get
+	// ready, see Config.LogTailLines
+	Logs string
+}
+
+// Error returns the error message.
+func (e *SetupError) Error() string {
+	msg := fmt.Sprintf("component %s failed: %v", e.Component, e.Err)
+	if e.TeardownAttempted {
+		msg += " (teardown attempted)"
+	}
+	if e.Logs != "" {
+		msg += "\nlast logs:\n" + e.Logs
+	}
+	return msg
+}
+
+// Unwrap returns the underlying error.
+func (e *SetupError) Unwrap() error {
+	return e.Err
+}
+
+// componentError tags the error with the component, nil errors are returned
+// as nil.
+func componentError(component string, err error) error {
+	if err == nil {
+		return nil
+	}
+	return &SetupError{Component: component, Err: err}
+}
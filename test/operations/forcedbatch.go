@@ -0,0 +1,116 @@
+package operations
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/0xPolygonHermez/zkevm-node/etherman/smartcontracts/etrogpolygonrollupmanager"
+	"github.com/0xPolygonHermez/zkevm-node/etherman/smartcontracts/etrogpolygonzkevm"
+	"github.com/0xPolygonHermez/zkevm-node/etherman/smartcontracts/pol"
+	"github.com/0xPolygonHermez/zkevm-node/log"
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/ethclient"
+)
+
+// ForceBatch submits a forced batch with the given encoded txs to the zkEVM
+// smart contract from the well-known forced batches account, waits for it to
+// be mined on L1 and returns the hash of the L1 tx. The Pol fee required by
+// the rollup manager is transferred from the sequencer account and approved
+// when the forced batches account doesn't have enough of it, and forced
+// batches are allowed for everyone when they are restricted to another
+// address.
+func (m *Manager) ForceBatch(ctx context.Context, txs []byte) (common.Hash, error) {
+	client, err := ethclient.Dial(m.L1NetworkURL())
+	if err != nil {
+		return common.Hash{}, err
+	}
+	defer client.Close()
+
+	authSequencer, err := GetAuth(DefaultSequencerPrivateKey, DefaultL1ChainID)
+	if err != nil {
+		return common.Hash{}, err
+	}
+	authForcedBatch, err := GetAuth(DefaultForcedBatchesPrivateKey, DefaultL1ChainID)
+	if err != nil {
+		return common.Hash{}, err
+	}
+	authSequencer.Context = ctx
+	authForcedBatch.Context = ctx
+
+	zkEvm, err := etrogpolygonzkevm.NewEtrogpolygonzkevm(m.PoEAddress(), client)
+	if err != nil {
+		return common.Hash{}, err
+	}
+	callOpts := &bind.CallOpts{Context: ctx}
+	rollupManagerAddr, err := zkEvm.RollupManager(callOpts)
+	if err != nil {
+		return common.Hash{}, err
+	}
+	rollupManager, err := etrogpolygonrollupmanager.NewEtrogpolygonrollupmanager(rollupManagerAddr, client)
+	if err != nil {
+		return common.Hash{}, err
+	}
+	fee, err := rollupManager.GetForcedBatchFee(callOpts)
+	if err != nil {
+		return common.Hash{}, fmt.Errorf("failed to get the forced batch fee: %w", err)
+	}
+	log.Debugf("forced batch fee: %v", fee)
+
+	polSC, err := pol.NewPol(m.MaticAddress(), client)
+	if err != nil {
+		return common.Hash{}, err
+	}
+	balance, err := polSC.BalanceOf(callOpts, authForcedBatch.From)
+	if err != nil {
+		return common.Hash{}, err
+	}
+	if balance.Cmp(fee) < 0 {
+		log.Debugf("transferring %v pol to the forced batches account %s", fee, authForcedBatch.From)
+		tx, err := polSC.Transfer(authSequencer, authForcedBatch.From, fee)
+		if err != nil {
+			return common.Hash{}, fmt.Errorf("failed to transfer pol to %s: %w", authForcedBatch.From, err)
+		}
+		if err := WaitTxToBeMined(ctx, client, tx, DefaultTimeoutTxToBeMined); err != nil {
+			return common.Hash{}, err
+		}
+	}
+	allowance, err := polSC.Allowance(callOpts, authForcedBatch.From, m.PoEAddress())
+	if err != nil {
+		return common.Hash{}, err
+	}
+	if allowance.Cmp(fee) < 0 {
+		tx, err := polSC.Approve(authForcedBatch, m.PoEAddress(), fee)
+		if err != nil {
+			return common.Hash{}, fmt.Errorf("failed to approve the forced batch fee: %w", err)
+		}
+		if err := WaitTxToBeMined(ctx, client, tx, DefaultTimeoutTxToBeMined); err != nil {
+			return common.Hash{}, err
+		}
+	}
+
+	forceBatchAddr, err := zkEvm.ForceBatchAddress(callOpts)
+	if err != nil {
+		return common.Hash{}, err
+	}
+	if forceBatchAddr != (common.Address{}) && forceBatchAddr != authForcedBatch.From {
+		log.Debugf("allowing forced batches from any address, they were restricted to %s", forceBatchAddr)
+		tx, err := zkEvm.SetForceBatchAddress(authSequencer, common.Address{})
+		if err != nil {
+			return common.Hash{}, fmt.Errorf("failed to allow forced batches: %w", err)
+		}
+		if err := WaitTxToBeMined(ctx, client, tx, DefaultTimeoutTxToBeMined); err != nil {
+			return common.Hash{}, err
+		}
+	}
+
+	tx, err := zkEvm.ForceBatch(authForcedBatch, txs, fee)
+	if err != nil {
+		return common.Hash{}, fmt.Errorf("failed to send the forced batch: %w", err)
+	}
+	log.Infof("forced batch sent in L1 tx %s", tx.Hash())
+	if err := WaitTxToBeMined(ctx, client, tx, DefaultTimeoutTxToBeMined); err != nil {
+		return common.Hash{}, err
+	}
+	return tx.Hash(), nil
+}
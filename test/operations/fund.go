@@ -0,0 +1,109 @@
+package operations
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"math/big"
+	"sort"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/ethclient"
+)
+
+// fundClient is the client needed to fund accounts.
+type fundClient interface {
+	ethClienter
+	bind.ContractTransactor
+	ethereum.ChainStateReader
+	ethereum.ChainIDReader
+}
+
+// FundAccounts sends the requested amounts from the well-known L1 faucet
+// account to each recipient in the L1 network, waits for the transfers to be
+// mined and checks the balances of the recipients.
+func (m *Manager) FundAccounts(ctx context.Context, recipients map[common.Address]*big.Int) error {
+	client, err := ethclient.Dial(m.L1NetworkURL())
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+
+	auth, err := GetAuth(DefaultSequencerPrivateKey, DefaultL1ChainID)
+	if err != nil {
+		return err
+	}
+	return fundAccounts(ctx, client, auth, m.gasConfig(), recipients)
+}
+
+func fundAccounts(ctx context.Context, client fundClient, auth *bind.TransactOpts, gasCfg GasConfig, recipients map[common.Address]*big.Int) error {
+	addrs := make([]common.Address, 0, len(recipients))
+	for addr := range recipients {
+		if addr == auth.From {
+			return fmt.Errorf("can't fund the faucet account %s", addr)
+		}
+		addrs = append(addrs, addr)
+	}
+	sort.Slice(addrs, func(i, j int) bool {
+		return bytes.Compare(addrs[i].Bytes(), addrs[j].Bytes()) < 0
+	})
+
+	chainID, err := client.ChainID(ctx)
+	if err != nil {
+		return err
+	}
+	// the nonce is tracked locally so the transfers can be sent without
+	// waiting for the previous ones to be mined
+	nonce, err := client.PendingNonceAt(ctx, auth.From)
+	if err != nil {
+		return err
+	}
+
+	expectedBalances := make(map[common.Address]*big.Int, len(addrs))
+	sentTxs := make([]*types.Transaction, 0, len(addrs))
+	for _, addr := range addrs {
+		balance, err := client.BalanceAt(ctx, addr, nil)
+		if err != nil {
+			return err
+		}
+		amount := recipients[addr]
+		expectedBalances[addr] = new(big.Int).Add(balance, amount)
+
+		to := addr
+		tx, err := newTx(ctx, client, gasCfg, chainID, nonce, auth.From, &to, amount, nil)
+		if err != nil {
+			return err
+		}
+		signedTx, err := auth.Signer(auth.From, tx)
+		if err != nil {
+			return err
+		}
+		err = client.SendTransaction(ctx, signedTx)
+		if err != nil {
+			return fmt.Errorf("failed to fund %s: %w", addr, err)
+		}
+		sentTxs = append(sentTxs, signedTx)
+		nonce++
+	}
+
+	for _, tx := range sentTxs {
+		err := WaitTxToBeMined(ctx, client, tx, DefaultTimeoutTxToBeMined)
+		if err != nil {
+			return err
+		}
+	}
+
+	for _, addr := range addrs {
+		balance, err := client.BalanceAt(ctx, addr, nil)
+		if err != nil {
+			return err
+		}
+		if balance.Cmp(expectedBalances[addr]) != 0 {
+			return fmt.Errorf("unexpected balance of %s, expected %v, got %v", addr, expectedBalances[addr], balance)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,71 @@
+package operations
+
+import (
+	"context"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/ethclient/simulated"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFundAccounts(t *testing.T) {
+	ctx := context.Background()
+	privateKey, err := crypto.GenerateKey()
+	require.NoError(t, err)
+	faucet := crypto.PubkeyToAddress(privateKey.PublicKey)
+	balance, _ := new(big.Int).SetString("10000000000000000000000", 10)
+	backend := simulated.NewBackend(core.GenesisAlloc{faucet: {Balance: balance}})
+	defer backend.Close()
+	client := backend.Client()
+
+	chainID, err := client.ChainID(ctx)
+	require.NoError(t, err)
+	auth, err := bind.NewKeyedTransactorWithChainID(privateKey, chainID)
+	require.NoError(t, err)
+
+	// mine the sent txs
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		ticker := time.NewTicker(10 * time.Millisecond)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				backend.Commit()
+			}
+		}
+	}()
+
+	recipients := map[common.Address]*big.Int{
+		common.HexToAddress("0x1111111111111111111111111111111111111111"): big.NewInt(1000),
+		common.HexToAddress("0x2222222222222222222222222222222222222222"): big.NewInt(2000),
+		common.HexToAddress("0x3333333333333333333333333333333333333333"): big.NewInt(3000),
+	}
+	require.NoError(t, fundAccounts(ctx, client, auth, GasConfig{}, recipients))
+	for addr, amount := range recipients {
+		balance, err := client.BalanceAt(ctx, addr, nil)
+		require.NoError(t, err)
+		assert.Equal(t, amount, balance, addr)
+	}
+
+	// funding again adds to the balances
+	require.NoError(t, fundAccounts(ctx, client, auth, GasConfig{Limit: 21000}, recipients))
+	for addr, amount := range recipients {
+		balance, err := client.BalanceAt(ctx, addr, nil)
+		require.NoError(t, err)
+		assert.Equal(t, new(big.Int).Mul(amount, big.NewInt(2)), balance, addr)
+	}
+
+	err = fundAccounts(ctx, client, auth, GasConfig{}, map[common.Address]*big.Int{faucet: big.NewInt(1)})
+	assert.Error(t, err)
+}
@@ -0,0 +1,83 @@
+package operations
+
+import (
+	"context"
+	"math/big"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+// GasConfig overrides the gas settings of the L1 txs sent by the operations.
+type GasConfig struct {
+	// Limit is the gas limit of the txs, the gas is estimated when zero
+	Limit uint64
+	// PriceMultiplier multiplies the suggested gas price of legacy txs and the
+	// base fee part of the fee cap of dynamic fee txs. It's ignored when lower
+	// or equal than zero.
+	PriceMultiplier float64
+	// TipCap is the gas tip cap. When set the txs are dynamic fee (type 2)
+	// txs, otherwise they are legacy txs.
+	TipCap *big.Int
+}
+
+// newTx builds an unsigned tx according to the gas configuration.
+func newTx(ctx context.Context, client bind.ContractTransactor, cfg GasConfig, chainID *big.Int, nonce uint64, from common.Address, to *common.Address, value *big.Int, data []byte) (*types.Transaction, error) {
+	gasLimit := cfg.Limit
+	if gasLimit == 0 {
+		var err error
+		gasLimit, err = client.EstimateGas(ctx, ethereum.CallMsg{From: from, To: to, Value: value, Data: data})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if cfg.TipCap == nil {
+		gasPrice, err := client.SuggestGasPrice(ctx)
+		if err != nil {
+			return nil, err
+		}
+		return types.NewTx(&types.LegacyTx{
+			Nonce:    nonce,
+			GasPrice: applyMultiplier(gasPrice, cfg.PriceMultiplier),
+			Gas:      gasLimit,
+			To:       to,
+			Value:    value,
+			Data:     data,
+		}), nil
+	}
+
+	head, err := client.HeaderByNumber(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	baseFee := big.NewInt(0)
+	if head.BaseFee != nil {
+		baseFee = head.BaseFee
+	}
+	// leave room for the base fee to grow in the next blocks
+	feeCap := applyMultiplier(new(big.Int).Mul(baseFee, big.NewInt(2)), cfg.PriceMultiplier) //nolint:gomnd
+	feeCap.Add(feeCap, cfg.TipCap)
+	return types.NewTx(&types.DynamicFeeTx{
+		ChainID:   chainID,
+		Nonce:     nonce,
+		GasTipCap: new(big.Int).Set(cfg.TipCap),
+		GasFeeCap: feeCap,
+		Gas:       gasLimit,
+		To:        to,
+		Value:     value,
+		Data:      data,
+	}), nil
+}
+
+// applyMultiplier returns the value multiplied by the given factor, or a copy
+// of the value when the factor is lower or equal than zero.
+func applyMultiplier(value *big.Int, multiplier float64) *big.Int {
+	if multiplier <= 0 {
+		return new(big.Int).Set(value)
+	}
+	res, _ := new(big.Float).Mul(new(big.Float).SetInt(value), big.NewFloat(multiplier)).Int(nil)
+	return res
+}
@@ -0,0 +1,93 @@
+package operations
+
+import (
+	"context"
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/ethclient/simulated"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewTx(t *testing.T) {
+	ctx := context.Background()
+	privateKey, err := crypto.GenerateKey()
+	require.NoError(t, err)
+	from := crypto.PubkeyToAddress(privateKey.PublicKey)
+	balance, _ := new(big.Int).SetString("10000000000000000000000", 10)
+	backend := simulated.NewBackend(core.GenesisAlloc{from: {Balance: balance}})
+	defer backend.Close()
+	client := backend.Client()
+
+	chainID, err := client.ChainID(ctx)
+	require.NoError(t, err)
+	signer := types.LatestSignerForChainID(chainID)
+	to := common.HexToAddress("0x1111111111111111111111111111111111111111")
+	value := big.NewInt(1000)
+
+	tcs := []struct {
+		description string
+		cfg         GasConfig
+		check       func(t *testing.T, tx *types.Transaction, suggestedGasPrice, baseFee *big.Int)
+	}{
+		{
+			description: "legacy with estimated gas",
+			cfg:         GasConfig{},
+			check: func(t *testing.T, tx *types.Transaction, suggestedGasPrice, baseFee *big.Int) {
+				assert.Equal(t, uint8(types.LegacyTxType), tx.Type())
+				assert.Equal(t, uint64(21000), tx.Gas())
+				assert.Equal(t, suggestedGasPrice, tx.GasPrice())
+			},
+		},
+		{
+			description: "legacy with multiplier",
+			cfg:         GasConfig{Limit: 30000, PriceMultiplier: 2},
+			check: func(t *testing.T, tx *types.Transaction, suggestedGasPrice, baseFee *big.Int) {
+				assert.Equal(t, uint8(types.LegacyTxType), tx.Type())
+				assert.Equal(t, uint64(30000), tx.Gas())
+				assert.Equal(t, new(big.Int).Mul(suggestedGasPrice, big.NewInt(2)), tx.GasPrice())
+			},
+		},
+		{
+			description: "dynamic fee",
+			cfg:         GasConfig{Limit: 25000, TipCap: big.NewInt(2000000000)},
+			check: func(t *testing.T, tx *types.Transaction, suggestedGasPrice, baseFee *big.Int) {
+				assert.Equal(t, uint8(types.DynamicFeeTxType), tx.Type())
+				assert.Equal(t, uint64(25000), tx.Gas())
+				assert.Equal(t, big.NewInt(2000000000), tx.GasTipCap())
+				expectedFeeCap := new(big.Int).Mul(baseFee, big.NewInt(2))
+				expectedFeeCap.Add(expectedFeeCap, big.NewInt(2000000000))
+				assert.Equal(t, expectedFeeCap, tx.GasFeeCap())
+			},
+		},
+	}
+	for _, tc := range tcs {
+		tc := tc
+		t.Run(tc.description, func(t *testing.T) {
+			nonce, err := client.PendingNonceAt(ctx, from)
+			require.NoError(t, err)
+			suggestedGasPrice, err := client.SuggestGasPrice(ctx)
+			require.NoError(t, err)
+			head, err := client.HeaderByNumber(ctx, nil)
+			require.NoError(t, err)
+
+			tx, err := newTx(ctx, client, tc.cfg, chainID, nonce, from, &to, value, nil)
+			require.NoError(t, err)
+			tc.check(t, tx, suggestedGasPrice, head.BaseFee)
+
+			// the node accepts the tx
+			signedTx, err := types.SignTx(tx, signer, privateKey)
+			require.NoError(t, err)
+			require.NoError(t, client.SendTransaction(ctx, signedTx))
+			backend.Commit()
+			receipt, err := client.TransactionReceipt(ctx, signedTx.Hash())
+			require.NoError(t, err)
+			assert.Equal(t, types.ReceiptStatusSuccessful, receipt.Status)
+		})
+	}
+}
@@ -0,0 +1,97 @@
+package operations
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math/big"
+	"os"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// LoadGenesisAccounts parses a JSON file made of an object mapping addresses
+// to balances, which can be base-10 or 0x prefixed hex strings:
+//
+//	{ "0x617b3a3528F9cDd6630fd3301B9c8911F7Bf063D": "100000000000000000000" }
+//
+// The returned map is indexed by the checksummed address.
+func LoadGenesisAccounts(path string) (map[string]big.Int, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	dec := json.NewDecoder(bytes.NewReader(data))
+	// line returns the line of the last read token
+	line := func() int {
+		return bytes.Count(data[:dec.InputOffset()], []byte("\n")) + 1
+	}
+
+	if tok, err := dec.Token(); err != nil || tok != json.Delim('{') {
+		return nil, fmt.Errorf("%s:%d: expected an object of address to balance", path, line())
+	}
+
+	accounts := make(map[string]big.Int)
+	for dec.More() {
+		tok, err := dec.Token()
+		if err != nil {
+			return nil, fmt.Errorf("%s:%d: %w", path, line(), err)
+		}
+		key := tok.(string)
+		if !common.IsHexAddress(key) {
+			return nil, fmt.Errorf("%s:%d: invalid address %q", path, line(), key)
+		}
+		address := common.HexToAddress(key).String()
+		if _, found := accounts[address]; found {
+			return nil, fmt.Errorf("%s:%d: duplicated address %s", path, line(), address)
+		}
+
+		tok, err = dec.Token()
+		if err != nil {
+			return nil, fmt.Errorf("%s:%d: %w", path, line(), err)
+		}
+		value, ok := tok.(string)
+		if !ok {
+			return nil, fmt.Errorf("%s:%d: balance of %s must be a string, got %v", path, line(), key, tok)
+		}
+		balance, ok := parseBalance(value)
+		if !ok {
+			return nil, fmt.Errorf("%s:%d: invalid balance %q for address %s", path, line(), value, key)
+		}
+		accounts[address] = *balance
+	}
+
+	if _, err := dec.Token(); err != nil {
+		return nil, fmt.Errorf("%s:%d: %w", path, line(), err)
+	}
+	if _, err := dec.Token(); err != io.EOF {
+		return nil, fmt.Errorf("%s:%d: unexpected data after the accounts", path, line())
+	}
+	return accounts, nil
+}
+
+// parseBalance parses a non negative base-10 or 0x prefixed hex number.
+func parseBalance(value string) (*big.Int, bool) {
+	base := 10
+	if strings.HasPrefix(value, "0x") || strings.HasPrefix(value, "0X") {
+		value, base = value[2:], 16
+	}
+	balance, ok := new(big.Int).SetString(value, base)
+	if !ok || balance.Sign() < 0 {
+		return nil, false
+	}
+	return balance, true
+}
+
+// SetGenesisFromFile creates the genesis block in the state with the balances
+// of the accounts in the given file, see LoadGenesisAccounts.
+func (m *Manager) SetGenesisFromFile(path string) error {
+	accounts, err := LoadGenesisAccounts(path)
+	if err != nil {
+		return err
+	}
+	return m.SetGenesisAccountsBalance(0, accounts)
+}
@@ -0,0 +1,61 @@
+package operations
+
+import (
+	"context"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/0xPolygonHermez/zkevm-node/merkletree"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLoadGenesisAccounts(t *testing.T) {
+	accounts, err := LoadGenesisAccounts("../config/test.genesis-accounts.json")
+	require.NoError(t, err)
+	require.Len(t, accounts, 2)
+
+	// the root of the same accounts in smt-genesis.json
+	ctx := context.Background()
+	tree := merkletree.NewStateTree(merkletree.NewLocalHashDBClient(merkletree.NewMemStore()))
+	txID := uuid.NewString()
+	root := common.Hash{}.Bytes()
+	for _, address := range []string{"0x617b3a3528F9cDd6630fd3301B9c8911F7Bf063D", "0x4d5Cf5032B2a844602278b01199ED191A86c93ff"} {
+		balance, found := accounts[address]
+		require.True(t, found, address)
+		root, _, err = tree.SetBalance(ctx, common.HexToAddress(address), &balance, root, txID)
+		require.NoError(t, err)
+	}
+	assert.Equal(t, "33746756112715549509799501069416620287488781321139344085581028504667736843869", new(big.Int).SetBytes(root).String())
+}
+
+func TestLoadGenesisAccountsErrors(t *testing.T) {
+	tcs := []struct {
+		description   string
+		content       string
+		expectedError string
+	}{
+		{"not an object", `["0x617b3a3528F9cDd6630fd3301B9c8911F7Bf063D"]`, ":1: expected an object"},
+		{"invalid address", "{\n\"0x1234\": \"1\"\n}", `:2: invalid address "0x1234"`},
+		{"invalid decimal balance", "{\n\"0x617b3a3528F9cDd6630fd3301B9c8911F7Bf063D\": \"1\",\n\"0x4d5Cf5032B2a844602278b01199ED191A86c93ff\": \"12a\"\n}", `:3: invalid balance "12a" for address 0x4d5Cf5032B2a844602278b01199ED191A86c93ff`},
+		{"invalid hex balance", "{\"0x617b3a3528F9cDd6630fd3301B9c8911F7Bf063D\": \"0xzz\"}", `:1: invalid balance "0xzz"`},
+		{"negative balance", "{\"0x617b3a3528F9cDd6630fd3301B9c8911F7Bf063D\": \"-1\"}", `invalid balance "-1"`},
+		{"number balance", "{\"0x617b3a3528F9cDd6630fd3301B9c8911F7Bf063D\": 1}", "must be a string"},
+		{"duplicated address", "{\"0x617b3a3528F9cDd6630fd3301B9c8911F7Bf063D\": \"1\", \"0x617b3a3528f9cdd6630fd3301b9c8911f7bf063d\": \"2\"}", "duplicated address"},
+	}
+	for _, tc := range tcs {
+		tc := tc
+		t.Run(tc.description, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "genesis.json")
+			require.NoError(t, os.WriteFile(path, []byte(tc.content), 0600))
+
+			_, err := LoadGenesisAccounts(path)
+			require.Error(t, err)
+			assert.Contains(t, err.Error(), tc.expectedError)
+		})
+	}
+}
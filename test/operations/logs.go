@@ -0,0 +1,85 @@
+package operations
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/0xPolygonHermez/zkevm-node/log"
+)
+
+// DefaultLogTailLines is the number of lines of the logs of a component that
+// didn't get ready attached to its SetupError.
+const DefaultLogTailLines = 50
+
+// componentServices are the docker-compose services started by each component.
+var componentServices = map[string][]string{
+	ComponentNetwork:        {"zkevm-mock-l1-network"},
+	ComponentProver:         {"zkevm-prover"},
+	ComponentApprovePol:     {"zkevm-approve"},
+	ComponentNode:           {"zkevm-sync", "zkevm-eth-tx-manager", "zkevm-sequencer", "zkevm-sequence-sender", "zkevm-l2gaspricer", "zkevm-aggregator", "zkevm-json-rpc"},
+	ComponentPermissionless: {"zkevm-permissionless-db", "zkevm-permissionless-prover", "zkevm-permissionless-node"},
+}
+
+// attachLogs adds the tail of the logs of the component to the given error
+// when it's a SetupError caused by the component not getting ready. The full
+// logs are written to Config.LogsDir when it's set. Failing to get the logs
+// is only logged, so the original error is always returned.
+func (m *Manager) attachLogs(component string, err error) error {
+	var setupErr *SetupError
+	if !errors.Is(err, ErrComponentNotReady) || !errors.As(err, &setupErr) {
+		return err
+	}
+
+	logs, logsErr := m.componentLogs(component)
+	if logsErr != nil {
+		log.Errorf("failed to get the logs of %s: %v", component, logsErr)
+		return err
+	}
+	if m.cfg != nil && m.cfg.LogsDir != "" {
+		fileName := filepath.Join(m.cfg.LogsDir, fmt.Sprintf("%s-%s.log", component, time.Now().UTC().Format("20060102T150405")))
+		if writeErr := os.WriteFile(fileName, logs, 0644); writeErr != nil { //nolint:gosec,gomnd
+			log.Errorf("failed to write the logs of %s: %v", component, writeErr)
+		} else {
+			log.Infof("logs of %s written to %s", component, fileName)
+		}
+	}
+	setupErr.Logs = tailLines(string(logs), m.logTailLines())
+	return err
+}
+
+// componentLogs returns the logs of the docker-compose services of the
+// component.
+func (m *Manager) componentLogs(component string) ([]byte, error) {
+	services, found := componentServices[component]
+	if !found {
+		return nil, fmt.Errorf("unknown services of component %s", component)
+	}
+	args := append([]string{"compose", "-f", "docker-compose.yml", "logs", "--no-color"}, services...)
+	c := exec.Command("docker", args...)
+	if m.runOutputFn != nil {
+		return m.runOutputFn(c)
+	}
+	return runCmdOutput(c)
+}
+
+// logTailLines returns the number of log lines attached to the errors.
+func (m *Manager) logTailLines() int {
+	if m.cfg == nil || m.cfg.LogTailLines <= 0 {
+		return DefaultLogTailLines
+	}
+	return m.cfg.LogTailLines
+}
+
+// tailLines returns the last n lines of the text.
+func tailLines(text string, n int) string {
+	lines := strings.Split(strings.TrimRight(text, "\n"), "\n")
+	if len(lines) > n {
+		lines = lines[len(lines)-n:]
+	}
+	return strings.Join(lines, "\n")
+}
@@ -2,16 +2,27 @@ package operations
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"math"
 	"math/big"
+	"net"
+	"net/url"
 	"os"
 	"os/exec"
 	"path/filepath"
+	"sort"
+	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/0xPolygonHermez/zkevm-node/db"
+	"github.com/0xPolygonHermez/zkevm-node/etherman/smartcontracts/etrogpolygonrollupmanager"
+	"github.com/0xPolygonHermez/zkevm-node/etherman/smartcontracts/etrogpolygonzkevm"
+	"github.com/0xPolygonHermez/zkevm-node/etherman/smartcontracts/pol"
 	"github.com/0xPolygonHermez/zkevm-node/event"
 	"github.com/0xPolygonHermez/zkevm-node/event/nileventstorage"
 	"github.com/0xPolygonHermez/zkevm-node/l1infotree"
@@ -24,11 +35,15 @@ import (
 	"github.com/0xPolygonHermez/zkevm-node/test/constants"
 	"github.com/0xPolygonHermez/zkevm-node/test/dbutils"
 	"github.com/0xPolygonHermez/zkevm-node/test/testutils"
+	"github.com/ethereum/go-ethereum"
 	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/ethereum/go-ethereum/accounts/keystore"
+	"github.com/ethereum/go-ethereum/common"
 	"github.com/ethereum/go-ethereum/core/types"
 	"github.com/ethereum/go-ethereum/crypto"
 	"github.com/ethereum/go-ethereum/ethclient"
 	"github.com/jackc/pgx/v4"
+	"golang.org/x/sync/errgroup"
 )
 
 const (
@@ -61,6 +76,10 @@ const (
 	DefaultWaitPeriodSendSequence                          = "15s"
 	DefaultLastBatchVirtualizationTimeMaxWaitPeriod        = "10s"
 	DefaultMaxTxSizeForL1                           uint64 = 131072
+
+	// DefaultApprovedBatches is the number of batches whose collateral Setup
+	// and Reset approve for the sequencer when the config doesn't set it
+	DefaultApprovedBatches uint64 = 100000
 )
 
 var (
@@ -81,6 +100,8 @@ type SequenceSenderConfig struct {
 	MaxTxSizeForL1                           uint64
 	SenderAddress                            string
 	PrivateKey                               string
+	// Gas overrides the gas settings of the L1 txs sent by the operations
+	Gas GasConfig
 }
 
 // Config is the main Manager configuration.
@@ -88,6 +109,97 @@ type Config struct {
 	State          *state.Config
 	SequenceSender *SequenceSenderConfig
 	Genesis        state.Genesis
+	// L1URL is the URL of the L1 network, DefaultL1NetworkURL is used when empty
+	L1URL string
+	// L2URL is the URL of the L2 network, DefaultL2NetworkURL is used when empty
+	L2URL string
+	// PoEAddress is the address of the zkEVM smart contract on L1,
+	// DefaultL1ZkEVMSmartContract is used when unset. It's required when L1URL
+	// is not a local network.
+	PoEAddress common.Address
+	// PreserveDBOnTeardown keeps the content of the databases when a new
+	// Manager is created, so the state left by a previous run torn down with
+	// Teardown, which doesn't stop the databases, can be inspected. When it's
+	// not set NewManager resets the databases.
+	PreserveDBOnTeardown bool
+	// MaticAddress is the address of the Pol token smart contract on L1,
+	// DefaultL1PolSmartContract is used when unset. It's required when L1URL is
+	// not a local network.
+	MaticAddress common.Address
+	// Backend selects where the components run, DockerBackend is used when
+	// empty. See SimulatedL1Backend for the features it doesn't provide.
+	Backend Backend
+	// LogTailLines is the number of lines of the logs of a component that
+	// didn't get ready attached to its SetupError, DefaultLogTailLines is
+	// used when zero.
+	LogTailLines int
+	// LogsDir is the directory the full logs of a component that didn't get
+	// ready are written to, they are not written when empty.
+	LogsDir string
+	// Runner runs the Makefile targets that start and stop the components,
+	// the commands are executed in the folder of the Makefile when nil.
+	Runner CommandRunner
+	// LogFields are added to every log of the manager, e.g. a correlation id
+	// of the test run.
+	LogFields map[string]string
+	// SendTxRetries is the number of times a tx send that failed because the
+	// node was unreachable is retried, DefaultSendTxRetries is used when zero
+	// and the sends are not retried when negative.
+	SendTxRetries int
+	// ReuseEnvironment keeps the components running between the tests of a
+	// suite: Setup starts them the first time and only resets the state the
+	// following times, see Reset.
+	ReuseEnvironment bool
+	// SkipDBReset attaches the manager to an environment that is already
+	// running, e.g. to iterate on a test scenario: NewManager connects to the
+	// databases without resetting them and the genesis is not created again
+	// when the state already has one.
+	SkipDBReset bool
+	// SequencerCollateral returns the Pol the sequencer pays for each batch,
+	// e.g. an etherman.Client. When nil it's read from the rollup manager of
+	// the zkEVM smart contract.
+	SequencerCollateral SequencerCollateralGetter
+	// ApprovedBatches is the number of batches whose collateral Setup and
+	// Reset approve for the sequencer, DefaultApprovedBatches is used when
+	// zero.
+	ApprovedBatches uint64
+}
+
+// resetsDB tells whether NewManager resets the databases.
+func (cfg *Config) resetsDB() bool {
+	return !cfg.PreserveDBOnTeardown && !cfg.SkipDBReset && cfg.Backend != SimulatedL1Backend
+}
+
+// validate checks that the contract addresses are set when the L1 network is
+// not local, since the defaults only match the local deployment.
+func (cfg *Config) validate() error {
+	if cfg.Backend != "" && cfg.Backend != DockerBackend && cfg.Backend != SimulatedL1Backend {
+		return fmt.Errorf("unknown backend %q", cfg.Backend)
+	}
+	if cfg.L1URL == "" || isLocalURL(cfg.L1URL) {
+		return nil
+	}
+	if cfg.PoEAddress == (common.Address{}) {
+		return fmt.Errorf("PoEAddress must be set when targeting the non-local L1 network %s", cfg.L1URL)
+	}
+	if cfg.MaticAddress == (common.Address{}) {
+		return fmt.Errorf("MaticAddress must be set when targeting the non-local L1 network %s", cfg.L1URL)
+	}
+	return nil
+}
+
+// isLocalURL returns whether the host of the given URL is the local host.
+func isLocalURL(rawURL string) bool {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return false
+	}
+	host := u.Hostname()
+	if host == "localhost" {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
 }
 
 // Manager controls operations and has knowledge about how to set up and tear
@@ -98,22 +210,51 @@ type Manager struct {
 
 	st   *state.State
 	wait *Wait
+
+	// simL1 is the running L1 network of SimulatedL1Backend
+	simL1 *simulatedL1
+
+	l2ClientMu sync.Mutex
+	l2Client   *ethclient.Client
+
+	// startComponentFn and stopComponentFn replace StartComponent and
+	// StopComponent when set
+	startComponentFn func(component string, conditions ...ConditionFunc) error
+	stopComponentFn  func(component string) error
+	// runOutputFn replaces runCmdOutput when set
+	runOutputFn func(c *exec.Cmd) ([]byte, error)
+	// resetStateFn replaces resetState when set
+	resetStateFn func() error
+	// approvePolFn replaces ApproveSequencerPol in Setup and Reset when set
+	approvePolFn func(numBatches uint64) error
+
+	// environmentUp is set once Setup succeeds with ReuseEnvironment
+	environmentUp bool
 }
 
 // NewManager returns a manager ready to be used and a potential error caused
 // during its creation (which can come from the setup of the db connection).
 func NewManager(ctx context.Context, cfg *Config) (*Manager, error) {
 	// Init database instance
-	initOrResetDB()
+	if cfg.resetsDB() {
+		initOrResetDB()
+	}
 	return NewManagerNoInitDB(ctx, cfg)
 }
 
 func NewManagerNoInitDB(ctx context.Context, cfg *Config) (*Manager, error) {
+	if err := cfg.validate(); err != nil {
+		return nil, err
+	}
 	opsman := &Manager{
 		cfg:  cfg,
 		ctx:  ctx,
 		wait: NewWait(),
 	}
+	if opsman.backend() == SimulatedL1Backend {
+		// there is no executor nor merkletree to build the state with
+		return opsman, nil
+	}
 	st, err := initState(*cfg.State)
 	if err != nil {
 		return nil, err
@@ -123,31 +264,335 @@ func NewManagerNoInitDB(ctx context.Context, cfg *Config) (*Manager, error) {
 	return opsman, nil
 }
 
-// State is a getter for the st field.
+// backend returns the backend of the manager, DockerBackend by default.
+func (m *Manager) backend() Backend {
+	if m.cfg == nil || m.cfg.Backend == "" {
+		return DockerBackend
+	}
+	return m.cfg.Backend
+}
+
+// checkDocker returns ErrUnsupportedByBackend when the operation needs the
+// docker-compose environment and the manager uses another backend.
+func (m *Manager) checkDocker(operation string) error {
+	if backend := m.backend(); backend != DockerBackend {
+		return fmt.Errorf("%w: %s needs %s, the manager uses %s", ErrUnsupportedByBackend, operation, DockerBackend, backend)
+	}
+	return nil
+}
+
+// checkState returns ErrUnsupportedByBackend when the operation needs the
+// state and the backend of the manager doesn't build it.
+func (m *Manager) checkState(operation string) error {
+	if m.st == nil {
+		return fmt.Errorf("%w: %s needs the state, the manager uses %s", ErrUnsupportedByBackend, operation, m.backend())
+	}
+	return nil
+}
+
+// checkL2 returns ErrUnsupportedByBackend when the operation needs the L2
+// network and the backend of the manager doesn't run it, unless L2URL points
+// to a node running elsewhere.
+func (m *Manager) checkL2(operation string) error {
+	if backend := m.backend(); backend == SimulatedL1Backend && m.cfg.L2URL == "" {
+		return fmt.Errorf("%w: %s needs the L2 network, the manager uses %s without L2URL", ErrUnsupportedByBackend, operation, backend)
+	}
+	return nil
+}
+
+// logger returns a logger with the LogFields of the config followed by the
+// given key value pairs.
+func (m *Manager) logger(keyValuePairs ...interface{}) *log.Logger {
+	var fields []interface{}
+	if m.cfg != nil && len(m.cfg.LogFields) > 0 {
+		keys := make([]string, 0, len(m.cfg.LogFields))
+		for key := range m.cfg.LogFields {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			fields = append(fields, key, m.cfg.LogFields[key])
+		}
+	}
+	return log.WithFields(append(fields, keyValuePairs...)...)
+}
+
+// L1NetworkURL returns the URL of the L1 network.
+func (m *Manager) L1NetworkURL() string {
+	if m.cfg == nil || m.cfg.L1URL == "" {
+		return DefaultL1NetworkURL
+	}
+	return m.cfg.L1URL
+}
+
+// L2NetworkURL returns the URL of the L2 network.
+func (m *Manager) L2NetworkURL() string {
+	if m.cfg == nil || m.cfg.L2URL == "" {
+		return DefaultL2NetworkURL
+	}
+	return m.cfg.L2URL
+}
+
+// gasConfig returns the gas settings of the L1 txs.
+func (m *Manager) gasConfig() GasConfig {
+	if m.cfg == nil || m.cfg.SequenceSender == nil {
+		return GasConfig{}
+	}
+	return m.cfg.SequenceSender.Gas
+}
+
+// L2Client returns a client of the L2 network of the manager. The client is
+// dialed the first time and reused afterwards.
+func (m *Manager) L2Client() (*ethclient.Client, error) {
+	if err := m.checkL2("L2Client"); err != nil {
+		return nil, err
+	}
+
+	m.l2ClientMu.Lock()
+	defer m.l2ClientMu.Unlock()
+
+	if m.l2Client == nil {
+		client, err := ethclient.Dial(m.L2NetworkURL())
+		if err != nil {
+			return nil, err
+		}
+		m.l2Client = client
+	}
+	return m.l2Client, nil
+}
+
+// GetL2Balance returns the balance of the given account in the L2 network at
+// the given block number, nil means the latest block.
+func (m *Manager) GetL2Balance(ctx context.Context, addr common.Address, blockNumber *big.Int) (*big.Int, error) {
+	client, err := m.L2Client()
+	if err != nil {
+		return nil, err
+	}
+	return client.BalanceAt(ctx, addr, blockNumber)
+}
+
+// GetL2Nonce returns the nonce of the given account in the L2 network at the
+// given block number, nil means the latest block.
+func (m *Manager) GetL2Nonce(ctx context.Context, addr common.Address, blockNumber *big.Int) (uint64, error) {
+	client, err := m.L2Client()
+	if err != nil {
+		return 0, err
+	}
+	return client.NonceAt(ctx, addr, blockNumber)
+}
+
+// PoEAddress returns the address of the zkEVM smart contract on L1.
+func (m *Manager) PoEAddress() common.Address {
+	if m.cfg == nil || m.cfg.PoEAddress == (common.Address{}) {
+		return common.HexToAddress(DefaultL1ZkEVMSmartContract)
+	}
+	return m.cfg.PoEAddress
+}
+
+// MaticAddress returns the address of the Pol token smart contract on L1.
+func (m *Manager) MaticAddress() common.Address {
+	if m.cfg == nil || m.cfg.MaticAddress == (common.Address{}) {
+		return common.HexToAddress(DefaultL1PolSmartContract)
+	}
+	return m.cfg.MaticAddress
+}
+
+// State is a getter for the st field, nil with SimulatedL1Backend.
 func (m *Manager) State() *state.State {
 	return m.st
 }
 
 // CheckVirtualRoot verifies if the given root is the current root of the
-// merkletree for virtual state.
+// merkletree for virtual state. An empty expected root means the empty tree,
+// see merkletree.EmptyRoot.
 func (m *Manager) CheckVirtualRoot(expectedRoot string) error {
-	panic("not implemented yet")
-	// root, err := m.st.Getroot(m.ctx, true, "")
-	// if err != nil {
-	// 	return err
-	// }
-	// return m.checkRoot(root, expectedRoot)
+	root, err := m.GetStateRoot(m.ctx, true)
+	if err != nil {
+		return err
+	}
+	return checkRoot(root, expectedRoot)
 }
 
 // CheckConsolidatedRoot verifies if the given root is the current root of the
-// merkletree for consolidated state.
+// merkletree for consolidated state. An empty expected root means the empty
+// tree, see merkletree.EmptyRoot.
 func (m *Manager) CheckConsolidatedRoot(expectedRoot string) error {
-	panic("not implemented yet")
-	// root, err := m.st.GetStateRoot(m.ctx, false, "")
-	// if err != nil {
-	// 	return err
-	// }
-	// return m.checkRoot(root, expectedRoot)
+	root, err := m.GetStateRoot(m.ctx, false)
+	if err != nil {
+		return err
+	}
+	return checkRoot(root, expectedRoot)
+}
+
+// checkRoot compares the root with the expected hex encoded one, the empty
+// string standing for the root of the empty tree.
+func checkRoot(root common.Hash, expectedRoot string) error {
+	expected := merkletree.DefaultEmptyRoot
+	if expectedRoot != "" {
+		expected = common.HexToHash(expectedRoot)
+	}
+	if root != expected {
+		return fmt.Errorf("%w: got %s, expected %s", ErrRootMismatch, root, expected)
+	}
+	return nil
+}
+
+// CheckBalance verifies that the address has the expected balance at the
+// state root of the last virtual batch, or of the last verified batch when
+// virtual is false.
+func (m *Manager) CheckBalance(ctx context.Context, addr common.Address, expected *big.Int, virtual bool) error {
+	if err := m.checkState("CheckBalance"); err != nil {
+		return err
+	}
+
+	batchNumber, err := m.lastBatchNumber(ctx, virtual)
+	if err != nil {
+		return err
+	}
+	balance, err := m.st.GetBalanceAtBatch(ctx, addr, batchNumber)
+	if err != nil {
+		return err
+	}
+	if balance.Cmp(expected) != 0 {
+		return fmt.Errorf("%w: address %s has balance %s at the last %s batch %d, expected %s", ErrBalanceMismatch, addr, balance, batchStage(virtual), batchNumber, expected)
+	}
+	return nil
+}
+
+// CheckTokenBalance verifies that the holder has the expected balance of the
+// ERC-20 token deployed on L2 at the given address, read at the latest L2
+// block.
+func (m *Manager) CheckTokenBalance(ctx context.Context, token, holder common.Address, expected *big.Int) error {
+	client, err := m.L2Client()
+	if err != nil {
+		return err
+	}
+	erc20, err := NewToken(token, client)
+	if err != nil {
+		return err
+	}
+	balance, err := erc20.BalanceOf(&bind.CallOpts{Context: ctx}, holder)
+	if err != nil {
+		return err
+	}
+	if balance.Cmp(expected) != 0 {
+		return fmt.Errorf("%w: address %s has a balance of %s of the token %s, expected %s", ErrBalanceMismatch, holder, balance, token, expected)
+	}
+	return nil
+}
+
+// GetStateRoot returns the state root of the last virtual batch, or of the
+// last verified batch when virtual is false.
+func (m *Manager) GetStateRoot(ctx context.Context, virtual bool) (common.Hash, error) {
+	if err := m.checkState("GetStateRoot"); err != nil {
+		return common.Hash{}, err
+	}
+
+	batchNumber, err := m.lastBatchNumber(ctx, virtual)
+	if err != nil {
+		return common.Hash{}, err
+	}
+	return m.stateRootAtBatch(ctx, batchNumber)
+}
+
+// stateRootAtBatch returns the state root of the given batch.
+func (m *Manager) stateRootAtBatch(ctx context.Context, batchNumber uint64) (common.Hash, error) {
+	batch, err := m.st.GetBatchByNumber(ctx, batchNumber, nil)
+	if err != nil {
+		return common.Hash{}, err
+	}
+	return batch.StateRoot, nil
+}
+
+// WaitForRootsToConverge polls the state roots of the last virtual and the
+// last verified batches until they are equal, i.e. until every sequenced batch
+// has been verified. Both batches are read from the same snapshot of the
+// state, see state.State.GetBatchPointers. On timeout the returned error wraps
+// ErrTimeoutReached and includes both roots.
+func (m *Manager) WaitForRootsToConverge(ctx context.Context, timeout time.Duration) error {
+	if err := m.checkState("WaitForRootsToConverge"); err != nil {
+		return err
+	}
+
+	var virtualRoot, verifiedRoot common.Hash
+	w := NewWaitWithConfig(WaitConfig{
+		Interval:    DefaultInterval,
+		MaxInterval: time.Second,
+		Deadline:    timeout,
+		Backoff:     2, //nolint:gomnd
+	})
+	err := w.Poll(func() (bool, error) {
+		if err := ctx.Err(); err != nil {
+			return false, err
+		}
+		pointers, err := m.st.GetBatchPointers(ctx)
+		if err != nil {
+			return false, err
+		}
+		virtualRoot, err = m.stateRootAtBatch(ctx, pointers.LastVirtual)
+		if err != nil {
+			return false, err
+		}
+		verifiedRoot, err = m.stateRootAtBatch(ctx, pointers.LastConsolidated)
+		if err != nil {
+			return false, err
+		}
+		return virtualRoot == verifiedRoot, nil
+	})
+	if errors.Is(err, ErrTimeoutReached) {
+		return fmt.Errorf("%w: virtual root %s and verified root %s didn't converge", err, virtualRoot, verifiedRoot)
+	}
+	return err
+}
+
+// Roots are the state roots printed by PrintRoots.
+type Roots struct {
+	Virtual      common.Hash `json:"virtualRoot"`
+	Consolidated common.Hash `json:"consolidatedRoot"`
+}
+
+// PrintRoots writes the state roots of the last virtual and the last verified
+// batches to w as a JSON object in a single line, e.g. for scripts diffing the
+// roots. ApplyL2Txs prints them to stdout when the ZKEVM_OPS_PRINT_ROOTS
+// environment variable is set to true.
+func (m *Manager) PrintRoots(w io.Writer) error {
+	virtualRoot, err := m.GetStateRoot(m.ctx, true)
+	if err != nil {
+		return err
+	}
+	consolidatedRoot, err := m.GetStateRoot(m.ctx, false)
+	if err != nil {
+		return err
+	}
+	return json.NewEncoder(w).Encode(Roots{Virtual: virtualRoot, Consolidated: consolidatedRoot})
+}
+
+// printRootsEnabled returns whether the roots are printed after the txs are
+// applied, see PrintRoots.
+func printRootsEnabled() bool {
+	enabled, _ := strconv.ParseBool(os.Getenv(constants.ENV_OPS_PRINT_ROOTS))
+	return enabled
+}
+
+// lastBatchNumber returns the number of the last virtual batch, or of the
+// last verified batch when virtual is false.
+func (m *Manager) lastBatchNumber(ctx context.Context, virtual bool) (uint64, error) {
+	if virtual {
+		return m.st.GetLastVirtualBatchNum(ctx, nil)
+	}
+	lastVerifiedBatch, err := m.st.GetLastVerifiedBatch(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	return lastVerifiedBatch.BatchNumber, nil
+}
+
+// batchStage names the stage of the batches returned by lastBatchNumber.
+func batchStage(virtual bool) string {
+	if virtual {
+		return "virtual"
+	}
+	return "verified"
 }
 
 // SetGenesisAccountsBalance creates the genesis block in the state.
@@ -165,12 +610,53 @@ func (m *Manager) SetGenesisAccountsBalance(genesisBlockNumber uint64, genesisAc
 	return m.SetGenesis(genesisBlockNumber, genesisActions)
 }
 
+// SetGenesis creates the genesis block in the state at the given L1 block,
+// received at the current time.
 func (m *Manager) SetGenesis(genesisBlockNumber uint64, genesisActions []*state.GenesisAction) error {
+	return m.SetGenesisWithHeader(genesisActions, GenesisHeader{Number: genesisBlockNumber})
+}
+
+// GenesisHeader describes the L1 block the genesis is created at, see
+// SetGenesisWithHeader.
+type GenesisHeader struct {
+	// Number is the number of the L1 block
+	Number uint64
+	// Timestamp is the time the block was received at, which is also the
+	// timestamp of the genesis batch and L2 block. The current time is used
+	// when it's zero.
+	Timestamp time.Time
+	// ParentHash is the hash of the parent of the L1 block, it defaults to
+	// the zero hash
+	ParentHash common.Hash
+}
+
+// SetGenesisWithHeader creates the genesis block in the state at the given
+// header. Unlike SetGenesis, the genesis L2 block is reproducible across runs
+// when the timestamp is set, so the roots can be compared with golden ones.
+func (m *Manager) SetGenesisWithHeader(genesisActions []*state.GenesisAction, header GenesisHeader) error {
+	if err := m.checkState("SetGenesis"); err != nil {
+		return err
+	}
+	if m.cfg != nil && m.cfg.SkipDBReset {
+		found, err := m.hasGenesis()
+		if err != nil {
+			return err
+		}
+		if found {
+			m.logger().Infow("keeping the genesis of the state")
+			return nil
+		}
+	}
+
+	receivedAt := header.Timestamp
+	if receivedAt.IsZero() {
+		receivedAt = time.Now()
+	}
 	genesisBlock := state.Block{
-		BlockNumber: genesisBlockNumber,
+		BlockNumber: header.Number,
 		BlockHash:   state.ZeroHash,
-		ParentHash:  state.ZeroHash,
-		ReceivedAt:  time.Now(),
+		ParentHash:  header.ParentHash,
+		ReceivedAt:  receivedAt,
 	}
 	genesis := state.Genesis{
 		Actions: genesisActions,
@@ -191,8 +677,20 @@ func (m *Manager) SetGenesis(genesisBlockNumber uint64, genesisActions []*state.
 	return err
 }
 
+// hasGenesis tells whether the state already has the genesis batch.
+func (m *Manager) hasGenesis() (bool, error) {
+	_, err := m.st.GetBatchByNumber(m.ctx, 0, nil)
+	if errors.Is(err, state.ErrNotFound) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
 // SetForkID sets the initial forkID in db for testing purposes
 func (m *Manager) SetForkID(blockNum uint64, forkID uint64) error {
+	if err := m.checkState("SetForkID"); err != nil {
+		return err
+	}
 	dbTx, err := m.st.BeginStateTransaction(m.ctx)
 	if err != nil {
 		return err
@@ -219,7 +717,7 @@ func (m *Manager) SetForkID(blockNum uint64, forkID uint64) error {
 // ApplyL1Txs sends the given L1 txs, waits for them to be consolidated and
 // checks the final state.
 func ApplyL1Txs(ctx context.Context, txs []*types.Transaction, auth *bind.TransactOpts, client *ethclient.Client) error {
-	_, err := applyTxs(ctx, txs, auth, client, true)
+	_, err := applyTxs(ctx, txs, auth, client, true, DefaultSendTxRetries, log.WithFields())
 	return err
 }
 
@@ -241,6 +739,43 @@ const VerifiedConfirmationLevel ConfirmationLevel = 3
 // ApplyL2Txs sends the given L2 txs, waits for them to be consolidated and
 // checks the final state.
 func ApplyL2Txs(ctx context.Context, txs []*types.Transaction, auth *bind.TransactOpts, client *ethclient.Client, confirmationLevel ConfirmationLevel) ([]*big.Int, error) {
+	receipts, err := applyL2Txs(ctx, txs, auth, client, DefaultL2NetworkURL, confirmationLevel, DefaultSendTxRetries, log.WithFields())
+	if err != nil || receipts == nil {
+		return nil, err
+	}
+
+	l2BlockNumbers := make([]*big.Int, 0, len(receipts))
+	for _, receipt := range receipts {
+		if receipt != nil {
+			l2BlockNumbers = append(l2BlockNumbers, receipt.BlockNumber)
+		}
+	}
+	return l2BlockNumbers, nil
+}
+
+// ApplyL2Txs sends the given L2 txs to the L2 network of the manager, waits for
+// them to be consolidated and checks the final state. The receipts are
+// returned in the same order as the txs, nil txs are skipped and get a nil
+// receipt. No receipts are returned for PoolConfirmationLevel. The state roots
+// are printed afterwards when enabled, see PrintRoots.
+func (m *Manager) ApplyL2Txs(txs []*types.Transaction, auth *bind.TransactOpts, confirmationLevel ConfirmationLevel) ([]*types.Receipt, error) {
+	client, err := m.L2Client()
+	if err != nil {
+		return nil, err
+	}
+	receipts, err := applyL2Txs(m.ctx, txs, auth, client, m.L2NetworkURL(), confirmationLevel, m.sendTxRetries(), m.logger())
+	if err != nil {
+		return nil, err
+	}
+	if printRootsEnabled() {
+		if err := m.PrintRoots(os.Stdout); err != nil {
+			return nil, err
+		}
+	}
+	return receipts, nil
+}
+
+func applyL2Txs(ctx context.Context, txs []*types.Transaction, auth *bind.TransactOpts, client *ethclient.Client, l2NetworkURL string, confirmationLevel ConfirmationLevel, sendRetries int, logger *log.Logger) ([]*types.Receipt, error) {
 	var err error
 	if auth == nil {
 		auth, err = GetAuth(DefaultSequencerPrivateKey, DefaultL2ChainID)
@@ -250,13 +785,25 @@ func ApplyL2Txs(ctx context.Context, txs []*types.Transaction, auth *bind.Transa
 	}
 
 	if client == nil {
-		client, err = ethclient.Dial(DefaultL2NetworkURL)
+		client, err = ethclient.Dial(l2NetworkURL)
 		if err != nil {
 			return nil, err
 		}
 	}
+
+	// indexes keeps the position in txs of each tx that is sent
+	toSend := make([]*types.Transaction, 0, len(txs))
+	indexes := make([]int, 0, len(txs))
+	for i, tx := range txs {
+		if tx == nil {
+			continue
+		}
+		toSend = append(toSend, tx)
+		indexes = append(indexes, i)
+	}
+
 	waitToBeMined := confirmationLevel != PoolConfirmationLevel
-	sentTxs, err := applyTxs(ctx, txs, auth, client, waitToBeMined)
+	sentTxs, err := applyTxs(ctx, toSend, auth, client, waitToBeMined, sendRetries, logger)
 	if err != nil {
 		return nil, err
 	}
@@ -264,42 +811,239 @@ func ApplyL2Txs(ctx context.Context, txs []*types.Transaction, auth *bind.Transa
 		return nil, nil
 	}
 
-	l2BlockNumbers := make([]*big.Int, 0, len(sentTxs))
-	for _, tx := range sentTxs {
+	receipts := make([]*types.Receipt, len(txs))
+	for i, tx := range sentTxs {
 		// check transaction nonce against transaction reported L2 block number
 		receipt, err := client.TransactionReceipt(ctx, tx.Hash())
 		if err != nil {
 			return nil, err
 		}
+		receipts[indexes[i]] = receipt
 
-		// get L2 block number
-		l2BlockNumbers = append(l2BlockNumbers, receipt.BlockNumber)
-		if confirmationLevel == TrustedConfirmationLevel {
-			continue
-		}
-
-		// wait for l2 block to be virtualized
-		log.Infof("waiting for the block number %v to be virtualized", receipt.BlockNumber.String())
-		err = WaitL2BlockToBeVirtualized(receipt.BlockNumber, 4*time.Minute) //nolint:gomnd
+		err = waitL2BlockConfirmation(ctx, receipt.BlockNumber, l2NetworkURL, confirmationLevel, logger)
 		if err != nil {
 			return nil, err
 		}
-		if confirmationLevel == VirtualConfirmationLevel {
+	}
+
+	return receipts, nil
+}
+
+// WaitForTransactionReceipt polls the L2 network of the manager until the
+// receipt of the given tx is available or the timeout elapses. Polling goes on
+// while the tx is not mined yet, any other error is returned straight away.
+func (m *Manager) WaitForTransactionReceipt(ctx context.Context, txHash common.Hash, timeout time.Duration) (*types.Receipt, error) {
+	client, err := m.L2Client()
+	if err != nil {
+		return nil, err
+	}
+
+	var receipt *types.Receipt
+	w := NewWaitWithConfig(WaitConfig{
+		Interval:    DefaultInterval,
+		MaxInterval: time.Second,
+		Deadline:    timeout,
+		Backoff:     2, //nolint:gomnd
+	})
+	err = w.Poll(func() (bool, error) {
+		if err := ctx.Err(); err != nil {
+			return false, err
+		}
+		var err error
+		receipt, err = client.TransactionReceipt(ctx, txHash)
+		if errors.Is(err, ethereum.NotFound) {
+			return false, nil
+		}
+		return err == nil, err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return receipt, nil
+}
+
+// waitL2BlockConfirmation waits for the given L2 block to reach the given
+// confirmation level.
+func waitL2BlockConfirmation(ctx context.Context, l2BlockNumber *big.Int, l2NetworkURL string, confirmationLevel ConfirmationLevel, logger *log.Logger) error {
+	if confirmationLevel == PoolConfirmationLevel || confirmationLevel == TrustedConfirmationLevel {
+		return nil
+	}
+
+	batchNumber, err := l2BatchNumberOfBlock(l2BlockNumber, l2NetworkURL)
+	if err != nil {
+		return err
+	}
+
+	// wait for the batch of the l2 block to be virtualized
+	logger = logger.WithFields("batchNumber", batchNumber, "l2BlockNumber", l2BlockNumber.String())
+	logger.Infow("waiting for the batch to be virtualized")
+	err = waitBatchVirtualization(ctx, l2NetworkURL, batchNumber, 4*time.Minute) //nolint:gomnd
+	if err != nil {
+		return err
+	}
+	if confirmationLevel == VirtualConfirmationLevel {
+		return nil
+	}
+
+	// wait for the batch of the l2 block to be consolidated
+	logger.Infow("waiting for the batch to be consolidated")
+	return waitBatchConsolidation(ctx, l2NetworkURL, batchNumber, 4*time.Minute) //nolint:gomnd
+}
+
+// WaitForBatchConsolidation polls the L2 network of the manager until the last
+// batch consolidated on L1 is at least minBatchNumber. It doesn't send
+// anything, so it can be used after txs were sent by other means, like forced
+// batches. On timeout the returned error wraps ErrTimeoutReached and includes
+// the last consolidated batch observed.
+func (m *Manager) WaitForBatchConsolidation(ctx context.Context, minBatchNumber uint64, timeout time.Duration) error {
+	if err := m.checkL2("WaitForBatchConsolidation"); err != nil {
+		return err
+	}
+	m.logger("batchNumber", minBatchNumber).Infow("waiting for the batch to be consolidated")
+	return waitBatchConsolidation(ctx, m.L2NetworkURL(), minBatchNumber, timeout)
+}
+
+// WaitForTxConsolidated waits for the receipt of the L2 tx and then for the
+// batch containing its block to be consolidated on L1, and returns the number
+// of that batch. The timeout bounds the whole wait, on timeout the returned
+// error wraps ErrTimeoutReached.
+func (m *Manager) WaitForTxConsolidated(ctx context.Context, txHash common.Hash, timeout time.Duration) (uint64, error) {
+	start := time.Now()
+	receipt, err := m.WaitForTransactionReceipt(ctx, txHash, timeout)
+	if err != nil {
+		return 0, err
+	}
+	batchNumber, err := l2BatchNumberOfBlock(receipt.BlockNumber, m.L2NetworkURL())
+	if err != nil {
+		return 0, err
+	}
+
+	m.logger("txHash", txHash, "batchNumber", batchNumber).Infow("waiting for the batch of the tx to be consolidated")
+	if err := waitBatchConsolidation(ctx, m.L2NetworkURL(), batchNumber, timeout-time.Since(start)); err != nil {
+		return 0, err
+	}
+	return batchNumber, nil
+}
+
+// WaitForBatchVirtualization polls the L2 network of the manager until the
+// last batch sequenced on L1 is at least minBatchNumber. The returned level
+// tells whether the batch is only sequenced, VirtualConfirmationLevel, or
+// already verified too, VerifiedConfirmationLevel. On timeout the returned
+// error wraps ErrTimeoutReached and includes the last virtualized batch
+// observed.
+func (m *Manager) WaitForBatchVirtualization(ctx context.Context, minBatchNumber uint64, timeout time.Duration) (ConfirmationLevel, error) {
+	if err := m.checkL2("WaitForBatchVirtualization"); err != nil {
+		return TrustedConfirmationLevel, err
+	}
+	m.logger("batchNumber", minBatchNumber).Infow("waiting for the batch to be virtualized")
+	err := waitBatchVirtualization(ctx, m.L2NetworkURL(), minBatchNumber, timeout)
+	if err != nil {
+		return TrustedConfirmationLevel, err
+	}
+	lastConsolidated, err := GetLastBatchNumberConsolidatedOnEthereum(m.L2NetworkURL())
+	if err != nil {
+		return TrustedConfirmationLevel, err
+	}
+	if lastConsolidated >= minBatchNumber {
+		return VerifiedConfirmationLevel, nil
+	}
+	return VirtualConfirmationLevel, nil
+}
+
+// ApplyL2TxsConcurrent sends the given signed L2 txs to the L2 network of the
+// manager. The txs of different senders are sent in parallel, up to
+// maxInflight senders at a time, while the txs of each sender are sent in
+// order. The send errors are returned by tx hash; once a tx fails the next txs
+// of the same sender are not sent. The txs that were sent are waited to be
+// mined and then the highest L2 block they were included in is waited to
+// reach the confirmation level.
+func (m *Manager) ApplyL2TxsConcurrent(txs []*types.Transaction, maxInflight int, confirmationLevel ConfirmationLevel) (map[common.Hash]error, error) {
+	client, err := m.L2Client()
+	if err != nil {
+		return nil, err
+	}
+
+	sendErrs := make(map[common.Hash]error)
+	var senders []common.Address
+	txsBySender := make(map[common.Address][]*types.Transaction)
+	for _, tx := range txs {
+		from, err := types.Sender(types.LatestSignerForChainID(tx.ChainId()), tx)
+		if err != nil {
+			sendErrs[tx.Hash()] = err
 			continue
 		}
+		if _, found := txsBySender[from]; !found {
+			senders = append(senders, from)
+		}
+		txsBySender[from] = append(txsBySender[from], tx)
+	}
 
-		// wait for l2 block number to be consolidated
-		log.Infof("waiting for the block number %v to be consolidated", receipt.BlockNumber.String())
-		err = WaitL2BlockToBeConsolidated(receipt.BlockNumber, 4*time.Minute) //nolint:gomnd
+	var (
+		mu      sync.Mutex
+		sentTxs []*types.Transaction
+		g       errgroup.Group
+	)
+	if maxInflight > 0 {
+		g.SetLimit(maxInflight)
+	}
+	for _, sender := range senders {
+		senderTxs := txsBySender[sender]
+		g.Go(func() error {
+			for i, tx := range senderTxs {
+				m.logger("txHash", tx.Hash(), "nonce", tx.Nonce()).Infow("sending tx")
+				err := sendTx(m.ctx, client, tx, m.sendTxRetries(), m.logger())
+
+				mu.Lock()
+				if err != nil {
+					sendErrs[tx.Hash()] = err
+					for _, skipped := range senderTxs[i+1:] {
+						sendErrs[skipped.Hash()] = fmt.Errorf("not sent, tx %s of the same sender failed", tx.Hash())
+					}
+					mu.Unlock()
+					return nil
+				}
+				sentTxs = append(sentTxs, tx)
+				mu.Unlock()
+			}
+			return nil
+		})
+	}
+	_ = g.Wait()
+
+	if confirmationLevel == PoolConfirmationLevel {
+		return sendErrs, nil
+	}
+
+	var highestBlock *big.Int
+	timeout := 180 * time.Second //nolint:gomnd
+	for _, tx := range sentTxs {
+		err := WaitTxToBeMined(m.ctx, client, tx, timeout)
 		if err != nil {
-			return nil, err
+			return sendErrs, err
+		}
+		receipt, err := client.TransactionReceipt(m.ctx, tx.Hash())
+		if err != nil {
+			return sendErrs, err
+		}
+		if highestBlock == nil || receipt.BlockNumber.Cmp(highestBlock) > 0 {
+			highestBlock = receipt.BlockNumber
 		}
 	}
+	if highestBlock == nil {
+		return sendErrs, nil
+	}
 
-	return l2BlockNumbers, nil
+	return sendErrs, waitL2BlockConfirmation(m.ctx, highestBlock, m.L2NetworkURL(), confirmationLevel, m.logger())
 }
 
-func applyTxs(ctx context.Context, txs []*types.Transaction, auth *bind.TransactOpts, client *ethclient.Client, waitToBeMined bool) ([]*types.Transaction, error) {
+// applyTxsClient is the client needed to send txs and wait for them to be
+// mined.
+type applyTxsClient interface {
+	ethClienter
+	txSender
+}
+
+func applyTxs(ctx context.Context, txs []*types.Transaction, auth *bind.TransactOpts, client applyTxsClient, waitToBeMined bool, sendRetries int, logger *log.Logger) ([]*types.Transaction, error) {
 	var sentTxs []*types.Transaction
 
 	for i := 0; i < len(txs); i++ {
@@ -307,8 +1051,8 @@ func applyTxs(ctx context.Context, txs []*types.Transaction, auth *bind.Transact
 		if err != nil {
 			return nil, err
 		}
-		log.Infof("Sending Tx %v Nonce %v", signedTx.Hash(), signedTx.Nonce())
-		err = client.SendTransaction(context.Background(), signedTx)
+		logger.Infow("sending tx", "txHash", signedTx.Hash(), "nonce", signedTx.Nonce())
+		err = sendTx(context.Background(), client, signedTx, sendRetries, logger)
 		if err != nil {
 			return nil, err
 		}
@@ -322,19 +1066,14 @@ func applyTxs(ctx context.Context, txs []*types.Transaction, auth *bind.Transact
 	// wait for TX to be mined
 	timeout := 180 * time.Second //nolint:gomnd
 	for _, tx := range sentTxs {
-		log.Infof("Waiting Tx %s to be mined", tx.Hash())
+		logger.Infow("waiting for the tx to be mined", "txHash", tx.Hash())
 		err := WaitTxToBeMined(ctx, client, tx, timeout)
 		if err != nil {
 			return nil, err
 		}
-		log.Infof("Tx %s mined successfully", tx.Hash())
-	}
-	nTxs := len(txs)
-	if nTxs > 1 {
-		log.Infof("%d transactions added into the trusted state successfully.", nTxs)
-	} else {
-		log.Info("transaction added into the trusted state successfully.")
+		logger.Infow("tx mined", "txHash", tx.Hash())
 	}
+	logger.Infow("txs added into the trusted state", "count", len(txs))
 
 	return sentTxs, nil
 }
@@ -349,6 +1088,34 @@ func GetAuth(privateKeyStr string, chainID uint64) (*bind.TransactOpts, error) {
 	return bind.NewKeyedTransactorWithChainID(privateKey, big.NewInt(0).SetUint64(chainID))
 }
 
+// GetAuthAutoChain configures and returns an auth object for the chain of the
+// given client, so the txs it signs can't be rejected for a wrong chain id.
+func GetAuthAutoChain(privateKeyStr string, client *ethclient.Client) (*bind.TransactOpts, error) {
+	privateKey, err := crypto.HexToECDSA(strings.TrimPrefix(privateKeyStr, "0x"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid private key: %w", err)
+	}
+	chainID, err := client.ChainID(context.Background())
+	if err != nil {
+		return nil, fmt.Errorf("failed to get the chain id: %w", err)
+	}
+	return bind.NewKeyedTransactorWithChainID(privateKey, chainID)
+}
+
+// GetAuthFromKeystore decrypts the private key of the given go-ethereum
+// keystore file and returns an auth object for it.
+func GetAuthFromKeystore(keystorePath, password string, chainID *big.Int) (*bind.TransactOpts, error) {
+	keystoreEncrypted, err := os.ReadFile(filepath.Clean(keystorePath))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read keystore %s: %w", keystorePath, err)
+	}
+	key, err := keystore.DecryptKey(keystoreEncrypted, password)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decrypt keystore %s: %w", keystorePath, err)
+	}
+	return bind.NewKeyedTransactorWithChainID(key.PrivateKey, chainID)
+}
+
 // MustGetAuth GetAuth but panics if err
 func MustGetAuth(privateKeyStr string, chainID uint64) *bind.TransactOpts {
 	auth, err := GetAuth(privateKeyStr, chainID)
@@ -359,32 +1126,183 @@ func MustGetAuth(privateKeyStr string, chainID uint64) *bind.TransactOpts {
 }
 
 // Setup creates all the required components and initializes them according to
-// the manager config.
+// the manager config. The network and the prover don't depend on each other,
+// so they are started concurrently, and the node is started once both are
+// ready and Pol has been approved. On failure the components started so far
+// are stopped and the first error is returned. With SimulatedL1Backend only the
+// L1 network is started. Teardown stops the prover along with the rest.
 func (m *Manager) Setup() error {
-	// Run network container
-	err := m.StartNetwork()
-	if err != nil {
-		return err
+	if m.backend() == SimulatedL1Backend {
+		return m.StartNetwork()
+	}
+	if m.environmentUp {
+		return m.Reset()
 	}
 
+	// Run network and prover containers
+	var g errgroup.Group
+	g.Go(m.StartNetwork)
+	g.Go(m.StartProver)
+	err := g.Wait()
+
 	// Approve pol
-	err = ApprovePol()
-	if err != nil {
-		return err
+	if err == nil {
+		err = m.approveSequencerPol()
 	}
 
 	// Run node container
-	err = m.StartNode()
+	if err == nil {
+		err = m.StartNode()
+	}
+
 	if err != nil {
+		for _, component := range []string{ComponentNode, ComponentProver, ComponentNetwork} {
+			if stopErr := m.stopComponent(component); stopErr != nil {
+				log.Errorf("failed to stop %s after a failed setup: %v", component, stopErr)
+			}
+		}
+		var setupErr *SetupError
+		if errors.As(err, &setupErr) {
+			setupErr.TeardownAttempted = true
+		}
 		return err
 	}
-
+	m.environmentUp = m.cfg != nil && m.cfg.ReuseEnvironment
 	return nil
 }
 
+// Reset wipes the databases, sets the genesis of the config and approves Pol
+// for the sequencer again, without stopping the components, so the tests of a
+// suite can share the environment started by a single Setup. The components
+// keep what they cached in memory, so the tests must not rely on it.
+func (m *Manager) Reset() error {
+	if err := m.checkDocker("Reset"); err != nil {
+		return err
+	}
+	m.logger().Infow("resetting the environment")
+	if err := m.resetState(); err != nil {
+		return fmt.Errorf("failed to reset the state: %w", err)
+	}
+	return m.approveSequencerPol()
+}
+
+// SequencerCollateralGetter returns the Pol the sequencer pays for each batch
+// it sequences. etherman.Client implements it, this package can't depend on
+// etherman because etherman imports it.
+type SequencerCollateralGetter interface {
+	GetSequencerCollateral(ctx context.Context) (*big.Int, error)
+}
+
+// rollupManagerCollateral reads the collateral of the sequencer from the
+// rollup manager of the zkEVM smart contract, like
+// etherman.Client.GetSequencerCollateral.
+type rollupManagerCollateral struct {
+	client    *ethclient.Client
+	zkEVMAddr common.Address
+}
+
+// GetSequencerCollateral implements SequencerCollateralGetter.
+func (c *rollupManagerCollateral) GetSequencerCollateral(ctx context.Context) (*big.Int, error) {
+	zkEvm, err := etrogpolygonzkevm.NewEtrogpolygonzkevm(c.zkEVMAddr, c.client)
+	if err != nil {
+		return nil, err
+	}
+	callOpts := &bind.CallOpts{Context: ctx}
+	rollupManagerAddr, err := zkEvm.RollupManager(callOpts)
+	if err != nil {
+		return nil, err
+	}
+	rollupManager, err := etrogpolygonrollupmanager.NewEtrogpolygonrollupmanager(rollupManagerAddr, c.client)
+	if err != nil {
+		return nil, err
+	}
+	return rollupManager.GetBatchFee(callOpts)
+}
+
+// ApproveSequencerPol approves the zkEVM smart contract to spend the Pol of
+// the sequencer account needed to sequence numBatches batches, and returns
+// the approved amount. The collateral of each batch is read with the
+// SequencerCollateral of the config, so the amount follows the contract
+// parameters.
+func (m *Manager) ApproveSequencerPol(ctx context.Context, numBatches uint64) (*big.Int, error) {
+	client, err := ethclient.Dial(m.L1NetworkURL())
+	if err != nil {
+		return nil, err
+	}
+	defer client.Close()
+
+	authSequencer, err := GetAuth(DefaultSequencerPrivateKey, DefaultL1ChainID)
+	if err != nil {
+		return nil, err
+	}
+	authSequencer.Context = ctx
+
+	var collateral SequencerCollateralGetter = &rollupManagerCollateral{client: client, zkEVMAddr: m.PoEAddress()}
+	if m.cfg != nil && m.cfg.SequencerCollateral != nil {
+		collateral = m.cfg.SequencerCollateral
+	}
+	batchFee, err := collateral.GetSequencerCollateral(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get the sequencer collateral: %w", err)
+	}
+	amount := new(big.Int).Mul(batchFee, new(big.Int).SetUint64(numBatches))
+
+	polSC, err := pol.NewPol(m.MaticAddress(), client)
+	if err != nil {
+		return nil, err
+	}
+	tx, err := polSC.Approve(authSequencer, m.PoEAddress(), amount)
+	if err != nil {
+		return nil, fmt.Errorf("failed to approve the pol of the sequencer: %w", err)
+	}
+	log.Infof("approved %v pol for %d batches in L1 tx %s", amount, numBatches, tx.Hash())
+	if err := WaitTxToBeMined(ctx, client, tx, DefaultTimeoutTxToBeMined); err != nil {
+		return nil, err
+	}
+	return amount, nil
+}
+
+// approveSequencerPol approves the Pol of the ApprovedBatches of the config
+// for the sequencer with the function of the manager, which defaults to
+// ApproveSequencerPol. Errors are tagged with ComponentApprovePol.
+func (m *Manager) approveSequencerPol() error {
+	numBatches := DefaultApprovedBatches
+	if m.cfg != nil && m.cfg.ApprovedBatches != 0 {
+		numBatches = m.cfg.ApprovedBatches
+	}
+	m.logger("component", ComponentApprovePol).Infow("approving the pol of the sequencer", "batches", numBatches)
+	if m.approvePolFn != nil {
+		return componentError(ComponentApprovePol, m.approvePolFn(numBatches))
+	}
+	ctx := m.ctx
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	_, err := m.ApproveSequencerPol(ctx, numBatches)
+	return componentError(ComponentApprovePol, err)
+}
+
+// resetState wipes the databases and sets the genesis of the config.
+func (m *Manager) resetState() error {
+	if m.resetStateFn != nil {
+		return m.resetStateFn()
+	}
+	if err := resetDB(); err != nil {
+		return err
+	}
+	if m.cfg == nil || len(m.cfg.Genesis.Actions) == 0 {
+		return nil
+	}
+	return m.SetGenesis(m.cfg.Genesis.BlockNumber, m.cfg.Genesis.Actions)
+}
+
 // SetupWithPermissionless creates all the required components for both trusted and permissionless nodes
 // and initializes them according to the manager config.
 func (m *Manager) SetupWithPermissionless() error {
+	if err := m.checkDocker("SetupWithPermissionless"); err != nil {
+		return err
+	}
+
 	// Run network container
 	err := m.StartNetwork()
 	if err != nil {
@@ -392,7 +1310,7 @@ func (m *Manager) SetupWithPermissionless() error {
 	}
 
 	// Approve Pol
-	err = ApprovePol()
+	err = m.approveSequencerPol()
 	if err != nil {
 		return err
 	}
@@ -408,50 +1326,79 @@ func (m *Manager) SetupWithPermissionless() error {
 
 // StartEthTxSender stops the eth tx sender service
 func (m *Manager) StartEthTxSender() error {
-	return StartComponent("eth-tx-manager")
+	if err := m.checkDocker("StartEthTxSender"); err != nil {
+		return err
+	}
+	return startComponentWith(m.runner(), "eth-tx-manager")
 }
 
 // StopEthTxSender stops the eth tx sender service
 func (m *Manager) StopEthTxSender() error {
-	return StopComponent("eth-tx-manager")
+	if err := m.checkDocker("StopEthTxSender"); err != nil {
+		return err
+	}
+	return stopComponentWith(m.runner(), "eth-tx-manager")
 }
 
 // StartSequencer starts the sequencer
 func (m *Manager) StartSequencer() error {
-	return StartComponent("seq")
+	if err := m.checkDocker("StartSequencer"); err != nil {
+		return err
+	}
+	return startComponentWith(m.runner(), "seq")
 }
 
 // StopSequencer stops the sequencer
 func (m *Manager) StopSequencer() error {
-	return StopComponent("seq")
+	if err := m.checkDocker("StopSequencer"); err != nil {
+		return err
+	}
+	return stopComponentWith(m.runner(), "seq")
 }
 
 // StartSequenceSender starts the sequence sender
 func (m *Manager) StartSequenceSender() error {
-	return StartComponent("seqsender")
+	if err := m.checkDocker("StartSequenceSender"); err != nil {
+		return err
+	}
+	return startComponentWith(m.runner(), "seqsender")
 }
 
 // StopSequenceSender stops the sequence sender
 func (m *Manager) StopSequenceSender() error {
-	return StopComponent("seqsender")
+	if err := m.checkDocker("StopSequenceSender"); err != nil {
+		return err
+	}
+	return stopComponentWith(m.runner(), "seqsender")
 }
 
 // ShowDockerLogs for running dockers
 func (m *Manager) ShowDockerLogs() error {
+	if err := m.checkDocker("ShowDockerLogs"); err != nil {
+		return err
+	}
 	cmdLogs := "show-logs"
-	if err := RunMakeTarget(cmdLogs); err != nil {
+	if err := m.runMakeTarget(cmdLogs); err != nil {
 		return err
 	}
 	return nil
 }
 
-// Teardown stops all the components.
+// Teardown stops all the components, including the prover started by Setup.
+// The databases are left running with their content, so to inspect the state
+// of a failed test, e.g. with DumpState, the next Manager must be created
+// with Config.PreserveDBOnTeardown set, otherwise NewManager resets them.
 func Teardown() error {
 	err := stopNode()
 	if err != nil {
 		return err
 	}
 
+	err = stopProver()
+	if err != nil {
+		return err
+	}
+
 	err = stopNetwork()
 	if err != nil {
 		return err
@@ -460,6 +1407,15 @@ func Teardown() error {
 	return nil
 }
 
+// TeardownWithContext stops the node, the prover and the network like
+// Teardown, but each stop command is killed when it doesn't finish before its
+// share of the time left until the deadline of the context. All the stops are
+// attempted even when some of them fail, the returned error joins their
+// errors.
+func TeardownWithContext(ctx context.Context) error {
+	return stopComponentsWithContext(ctx, execRunner{}, ComponentNode, ComponentProver, ComponentNetwork)
+}
+
 // TeardownPermissionless stops all the components.
 func TeardownPermissionless() error {
 	err := stopPermissionlessNode()
@@ -512,45 +1468,94 @@ func initState(cfg state.Config) (*state.State, error) {
 }
 
 func (m *Manager) BeginStateTransaction() (pgx.Tx, error) {
+	if err := m.checkState("BeginStateTransaction"); err != nil {
+		return nil, err
+	}
 	return m.st.BeginStateTransaction(m.ctx)
 }
 
-// StartNetwork starts the L1 network container
+// StartNetwork starts the L1 network container, or the in-process L1 network
+// with SimulatedL1Backend, restarting it when it's already running.
 func (m *Manager) StartNetwork() error {
-	return StartComponent("network", networkUpCondition)
+	if m.backend() != SimulatedL1Backend {
+		return m.startComponent(ComponentNetwork, m.networkUpCondition)
+	}
+	if err := m.StopNetwork(); err != nil {
+		return err
+	}
+	l1, err := startSimulatedL1(m.L1NetworkURL())
+	if err != nil {
+		return componentError(ComponentNetwork, err)
+	}
+	m.simL1 = l1
+	return componentError(ComponentNetwork, Poll(DefaultInterval, DefaultDeadline, m.networkUpCondition))
+}
+
+// StopNetwork stops the L1 network container, or the in-process L1 network
+// with SimulatedL1Backend.
+func (m *Manager) StopNetwork() error {
+	if m.backend() != SimulatedL1Backend {
+		return m.stopComponent(ComponentNetwork)
+	}
+	if m.simL1 == nil {
+		return nil
+	}
+	err := m.simL1.stop()
+	m.simL1 = nil
+	return componentError(ComponentNetwork, err)
+}
+
+// StartProver starts the prover container
+func (m *Manager) StartProver() error {
+	if err := m.checkDocker("StartProver"); err != nil {
+		return componentError(ComponentProver, err)
+	}
+	return m.startComponent(ComponentProver, m.proverUpCondition)
 }
 
 // InitNetwork Initializes the L2 network registering the sequencer and adding funds via the bridge
 func (m *Manager) InitNetwork() error {
-	if err := RunMakeTarget("init-network"); err != nil {
+	if err := m.checkDocker("InitNetwork"); err != nil {
+		return err
+	}
+	if err := m.runMakeTarget("init-network"); err != nil {
 		return err
 	}
 
 	// Wait network to be ready
-	return Poll(DefaultInterval, DefaultDeadline, networkUpCondition)
+	return Poll(DefaultInterval, DefaultDeadline, m.networkUpCondition)
 }
 
 // DeployUniswap deploys a uniswap environment and perform swaps
 func (m *Manager) DeployUniswap() error {
-	if err := RunMakeTarget("deploy-uniswap"); err != nil {
+	if err := m.checkDocker("DeployUniswap"); err != nil {
+		return err
+	}
+	if err := m.runMakeTarget("deploy-uniswap"); err != nil {
 		return err
 	}
 	// Wait network to be ready
-	return Poll(DefaultInterval, DefaultDeadline, networkUpCondition)
+	return Poll(DefaultInterval, DefaultDeadline, m.networkUpCondition)
 }
 
 func stopNetwork() error {
-	return StopComponent("network")
+	return componentError(ComponentNetwork, StopComponent(ComponentNetwork))
 }
 
 // StartNode starts the node container
 func (m *Manager) StartNode() error {
-	return StartComponent("node", nodeUpCondition)
+	if err := m.checkDocker("StartNode"); err != nil {
+		return componentError(ComponentNode, err)
+	}
+	return m.startComponent(ComponentNode, m.nodeUpCondition)
 }
 
 // StartTrustedAndPermissionlessNode starts the node container
 func (m *Manager) StartTrustedAndPermissionlessNode() error {
-	return StartComponent("permissionless", nodeUpCondition)
+	if err := m.checkDocker("StartTrustedAndPermissionlessNode"); err != nil {
+		return componentError(ComponentPermissionless, err)
+	}
+	return m.startComponent(ComponentPermissionless, m.nodeUpCondition)
 }
 
 // ApprovePol runs the approving Pol command
@@ -559,14 +1564,34 @@ func ApprovePol() error {
 }
 
 func stopNode() error {
-	return StopComponent("node")
+	return componentError(ComponentNode, StopComponent(ComponentNode))
+}
+
+func stopProver() error {
+	return componentError(ComponentProver, StopComponent(ComponentProver))
 }
 
 func stopPermissionlessNode() error {
-	return StopComponent("permissionless")
+	return componentError(ComponentPermissionless, StopComponent(ComponentPermissionless))
 }
 
 func runCmd(c *exec.Cmd) error {
+	c.Dir = cmdDir()
+	c.Stdout = os.Stdout
+	c.Stderr = os.Stderr
+	return c.Run()
+}
+
+// runCmdOutput runs the command in the folder of the Makefile and returns its
+// combined output.
+func runCmdOutput(c *exec.Cmd) ([]byte, error) {
+	c.Dir = cmdDir()
+	return c.CombinedOutput()
+}
+
+// cmdDir returns the folder of the Makefile, looking for it from the current
+// work directory.
+func cmdDir() string {
 	dir, err := os.Getwd()
 	if err != nil {
 		log.Fatalf("failed to get current work directory: %v", err)
@@ -582,43 +1607,51 @@ func runCmd(c *exec.Cmd) error {
 	} else {
 		dir = fmt.Sprintf("../../%s", cmdFolder)
 	}
-	c.Dir = dir
-
-	c.Stdout = os.Stdout
-	c.Stderr = os.Stderr
-	return c.Run()
+	return dir
 }
 
 // StartComponent starts a docker-compose component.
 func StartComponent(component string, conditions ...ConditionFunc) error {
-	cmdDown := fmt.Sprintf("stop-%s", component)
-	if err := RunMakeTarget(cmdDown); err != nil {
-		return err
+	return startComponentWith(execRunner{}, component, conditions...)
+}
+
+// startComponent starts a component with the function of the manager, which
+// defaults to starting it with the runner of the manager. Errors are tagged with the component, and carry
+// the tail of its logs when the component didn't get ready.
+func (m *Manager) startComponent(component string, conditions ...ConditionFunc) error {
+	logger := m.logger("component", component)
+	logger.Infow("starting component")
+	var err error
+	if m.startComponentFn != nil {
+		err = m.startComponentFn(component, conditions...)
+	} else {
+		err = startComponentWith(m.runner(), component, conditions...)
 	}
-	cmdUp := fmt.Sprintf("run-%s", component)
-	if err := RunMakeTarget(cmdUp); err != nil {
-		return err
+	if err != nil {
+		logger.Errorw("failed to start component", "error", err)
 	}
+	return m.attachLogs(component, componentError(component, err))
+}
 
-	// Wait component to be ready
-	for _, condition := range conditions {
-		if err := Poll(DefaultInterval, DefaultDeadline, condition); err != nil {
-			return err
-		}
+// stopComponent stops a component with the function of the manager, which
+// defaults to stopping it with the runner of the manager. Errors are tagged
+// with the component.
+func (m *Manager) stopComponent(component string) error {
+	m.logger("component", component).Infow("stopping component")
+	if m.stopComponentFn != nil {
+		return componentError(component, m.stopComponentFn(component))
 	}
-	return nil
+	return componentError(component, stopComponentWith(m.runner(), component))
 }
 
 // StopComponent stops a docker-compose component.
 func StopComponent(component string) error {
-	cmdDown := fmt.Sprintf("stop-%s", component)
-	return RunMakeTarget(cmdDown)
+	return stopComponentWith(execRunner{}, component)
 }
 
 // RunMakeTarget runs a Makefile target.
 func RunMakeTarget(target string) error {
-	cmd := exec.Command("make", target)
-	return runCmd(cmd)
+	return runMakeTarget(execRunner{}, target)
 }
 
 // GetDefaultOperationsConfig provides a default configuration to run the environment
@@ -659,10 +1692,15 @@ func MustGetClient(URL string) *ethclient.Client {
 }
 
 func initOrResetDB() {
-	if err := dbutils.InitOrResetState(stateDBCfg); err != nil {
+	if err := resetDB(); err != nil {
 		panic(err)
 	}
-	if err := dbutils.InitOrResetPool(poolDBCfg); err != nil {
-		panic(err)
+}
+
+// resetDB initializes or resets the state and the pool databases.
+func resetDB() error {
+	if err := dbutils.InitOrResetState(stateDBCfg); err != nil {
+		return err
 	}
+	return dbutils.InitOrResetPool(poolDBCfg)
 }
@@ -0,0 +1,820 @@
+package operations
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/0xPolygonHermez/zkevm-node/etherman/smartcontracts/pol"
+	"github.com/0xPolygonHermez/zkevm-node/log"
+	"github.com/0xPolygonHermez/zkevm-node/merkletree"
+	"github.com/0xPolygonHermez/zkevm-node/state"
+	"github.com/0xPolygonHermez/zkevm-node/state/mocks"
+	"github.com/0xPolygonHermez/zkevm-node/test/constants"
+	"github.com/0xPolygonHermez/zkevm-node/test/contracts/bin/ERC20"
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/google/uuid"
+	"github.com/jackc/pgconn"
+	"github.com/jackc/pgx/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+// rpcRecorder is a fake JSON RPC server that records the called methods.
+type rpcRecorder struct {
+	mu      sync.Mutex
+	methods []string
+	params  [][]json.RawMessage
+	results map[string]interface{}
+	// fail makes the call return an error when it returns true
+	fail func(method string, params []json.RawMessage) bool
+}
+
+func newRPCRecorder(t *testing.T, results map[string]interface{}) (*rpcRecorder, *httptest.Server) {
+	r := &rpcRecorder{results: results}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		var request struct {
+			ID     json.RawMessage   `json:"id"`
+			Method string            `json:"method"`
+			Params []json.RawMessage `json:"params"`
+		}
+		require.NoError(t, json.NewDecoder(req.Body).Decode(&request))
+
+		r.mu.Lock()
+		r.methods = append(r.methods, request.Method)
+		r.params = append(r.params, request.Params)
+		fail := r.fail != nil && r.fail(request.Method, request.Params)
+		result := r.results[request.Method]
+		r.mu.Unlock()
+
+		response := map[string]interface{}{
+			"jsonrpc": "2.0",
+			"id":      request.ID,
+		}
+		if fail {
+			response["error"] = map[string]interface{}{"code": -32000, "message": "call failed"}
+		} else {
+			response["result"] = result
+		}
+		w.Header().Set("Content-Type", "application/json")
+		require.NoError(t, json.NewEncoder(w).Encode(response))
+	}))
+	t.Cleanup(srv.Close)
+	return r, srv
+}
+
+func (r *rpcRecorder) calls() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]string{}, r.methods...)
+}
+
+func TestManagerNetworkURLs(t *testing.T) {
+	m := &Manager{cfg: &Config{}}
+	assert.Equal(t, DefaultL1NetworkURL, m.L1NetworkURL())
+	assert.Equal(t, DefaultL2NetworkURL, m.L2NetworkURL())
+
+	m = &Manager{cfg: &Config{L1URL: "http://l1:8545", L2URL: "http://l2:8123"}}
+	assert.Equal(t, "http://l1:8545", m.L1NetworkURL())
+	assert.Equal(t, "http://l2:8123", m.L2NetworkURL())
+}
+
+func TestManagerApplyL2TxsOverriddenURL(t *testing.T) {
+	recorder, srv := newRPCRecorder(t, map[string]interface{}{
+		"eth_sendRawTransaction": common.Hash{}.Hex(),
+	})
+	m := &Manager{
+		cfg: &Config{L2URL: srv.URL},
+		ctx: context.Background(),
+	}
+
+	to := common.HexToAddress("0x1")
+	tx := types.NewTx(&types.LegacyTx{To: &to, Gas: 21000, GasPrice: big.NewInt(1), Value: big.NewInt(1)})
+	_, err := m.ApplyL2Txs([]*types.Transaction{tx}, nil, PoolConfirmationLevel)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"eth_sendRawTransaction"}, recorder.calls())
+}
+
+func TestManagerContractAddresses(t *testing.T) {
+	m := &Manager{cfg: &Config{}}
+	assert.Equal(t, common.HexToAddress(DefaultL1ZkEVMSmartContract), m.PoEAddress())
+	assert.Equal(t, common.HexToAddress(DefaultL1PolSmartContract), m.MaticAddress())
+
+	poe, matic := common.HexToAddress("0x1"), common.HexToAddress("0x2")
+	m = &Manager{cfg: &Config{PoEAddress: poe, MaticAddress: matic}}
+	assert.Equal(t, poe, m.PoEAddress())
+	assert.Equal(t, matic, m.MaticAddress())
+}
+
+func TestConfigValidate(t *testing.T) {
+	poe, matic := common.HexToAddress("0x1"), common.HexToAddress("0x2")
+	tcs := []struct {
+		description   string
+		cfg           Config
+		expectedError string
+	}{
+		{"default L1", Config{}, ""},
+		{"localhost L1", Config{L1URL: "http://localhost:18545"}, ""},
+		{"loopback L1", Config{L1URL: "http://127.0.0.1:8545"}, ""},
+		{"remote L1 with addresses", Config{L1URL: "https://rpc.devnet.io", PoEAddress: poe, MaticAddress: matic}, ""},
+		{"remote L1 without PoE", Config{L1URL: "https://rpc.devnet.io", MaticAddress: matic}, "PoEAddress must be set"},
+		{"remote L1 without Matic", Config{L1URL: "https://rpc.devnet.io", PoEAddress: poe}, "MaticAddress must be set"},
+	}
+	for _, tc := range tcs {
+		tc := tc
+		t.Run(tc.description, func(t *testing.T) {
+			err := tc.cfg.validate()
+			if tc.expectedError == "" {
+				assert.NoError(t, err)
+				return
+			}
+			require.Error(t, err)
+			assert.Contains(t, err.Error(), tc.expectedError)
+		})
+	}
+}
+
+func TestManagerApplyL2TxsReceipts(t *testing.T) {
+	expected := &types.Receipt{
+		Status:            types.ReceiptStatusSuccessful,
+		CumulativeGasUsed: 21000,
+		GasUsed:           21000,
+		Logs:              []*types.Log{},
+		BlockNumber:       big.NewInt(5),
+	}
+	_, srv := newRPCRecorder(t, map[string]interface{}{
+		"eth_sendRawTransaction":    common.Hash{}.Hex(),
+		"eth_getTransactionReceipt": expected,
+	})
+	m := &Manager{
+		cfg: &Config{L2URL: srv.URL},
+		ctx: context.Background(),
+	}
+
+	to := common.HexToAddress("0x1")
+	txs := []*types.Transaction{
+		types.NewTx(&types.LegacyTx{Nonce: 0, To: &to, Gas: 21000, GasPrice: big.NewInt(1)}),
+		nil,
+		types.NewTx(&types.LegacyTx{Nonce: 1, To: &to, Gas: 21000, GasPrice: big.NewInt(1)}),
+	}
+	receipts, err := m.ApplyL2Txs(txs, nil, TrustedConfirmationLevel)
+	require.NoError(t, err)
+	require.Len(t, receipts, len(txs))
+	for i, receipt := range receipts {
+		if txs[i] == nil {
+			assert.Nil(t, receipt)
+			continue
+		}
+		require.NotNil(t, receipt)
+		assert.Equal(t, expected.GasUsed, receipt.GasUsed)
+		assert.Equal(t, expected.Status, receipt.Status)
+		assert.Equal(t, expected.BlockNumber, receipt.BlockNumber)
+	}
+}
+
+// decodeRawTx decodes the tx sent as the param of eth_sendRawTransaction.
+func decodeRawTx(t *testing.T, param json.RawMessage) *types.Transaction {
+	var raw hexutil.Bytes
+	require.NoError(t, json.Unmarshal(param, &raw))
+	tx := new(types.Transaction)
+	require.NoError(t, tx.UnmarshalBinary(raw))
+	return tx
+}
+
+func TestManagerApplyL2TxsConcurrent(t *testing.T) {
+	recorder, srv := newRPCRecorder(t, map[string]interface{}{
+		"eth_sendRawTransaction": common.Hash{}.Hex(),
+	})
+	m := &Manager{
+		cfg: &Config{L2URL: srv.URL},
+		ctx: context.Background(),
+	}
+
+	to := common.HexToAddress("0x1")
+	senders := []string{DefaultSequencerPrivateKey, DefaultForcedBatchesPrivateKey}
+	var txs []*types.Transaction
+	for nonce := uint64(0); nonce < 5; nonce++ {
+		for _, privateKey := range senders {
+			auth, err := GetAuth(privateKey, DefaultL2ChainID)
+			require.NoError(t, err)
+			tx, err := auth.Signer(auth.From, types.NewTx(&types.LegacyTx{Nonce: nonce, To: &to, Gas: 21000, GasPrice: big.NewInt(1)}))
+			require.NoError(t, err)
+			txs = append(txs, tx)
+		}
+	}
+
+	// the tx with nonce 2 of the second sender fails
+	failingSender := common.HexToAddress(DefaultForcedBatchesAddress)
+	recorder.fail = func(method string, params []json.RawMessage) bool {
+		tx := decodeRawTx(t, params[0])
+		from, err := types.Sender(types.LatestSignerForChainID(tx.ChainId()), tx)
+		require.NoError(t, err)
+		return from == failingSender && tx.Nonce() == 2
+	}
+
+	sendErrs, err := m.ApplyL2TxsConcurrent(txs, 2, PoolConfirmationLevel)
+	require.NoError(t, err)
+
+	lastNonce := make(map[common.Address]int64)
+	recorder.mu.Lock()
+	for _, params := range recorder.params {
+		tx := decodeRawTx(t, params[0])
+		from, err := types.Sender(types.LatestSignerForChainID(tx.ChainId()), tx)
+		require.NoError(t, err)
+		last, found := lastNonce[from]
+		if found {
+			assert.Equal(t, last+1, int64(tx.Nonce()), "txs of %s sent out of order", from)
+		}
+		lastNonce[from] = int64(tx.Nonce())
+	}
+	recorder.mu.Unlock()
+	assert.Equal(t, int64(4), lastNonce[common.HexToAddress(DefaultSequencerAddress)])
+	assert.Equal(t, int64(2), lastNonce[failingSender])
+
+	// the failing tx and the next ones of the same sender are reported
+	require.Len(t, sendErrs, 3)
+	for _, tx := range txs {
+		from, err := types.Sender(types.LatestSignerForChainID(tx.ChainId()), tx)
+		require.NoError(t, err)
+		if from == failingSender && tx.Nonce() >= 2 {
+			assert.Error(t, sendErrs[tx.Hash()])
+		} else {
+			assert.NoError(t, sendErrs[tx.Hash()])
+		}
+	}
+}
+
+func TestManagerWaitForTransactionReceipt(t *testing.T) {
+	minedHash := common.HexToHash("0x1")
+	failingHash := common.HexToHash("0x2")
+	expected := &types.Receipt{
+		Status:            types.ReceiptStatusSuccessful,
+		CumulativeGasUsed: 21000,
+		GasUsed:           21000,
+		Logs:              []*types.Log{},
+		TxHash:            minedHash,
+		BlockNumber:       big.NewInt(5),
+	}
+
+	recorder, srv := newRPCRecorder(t, nil)
+	recorder.fail = func(method string, params []json.RawMessage) bool {
+		var hash common.Hash
+		require.NoError(t, json.Unmarshal(params[0], &hash))
+		return hash == failingHash
+	}
+	m := &Manager{
+		cfg: &Config{L2URL: srv.URL},
+		ctx: context.Background(),
+	}
+	ctx := context.Background()
+
+	// unknown txs get a null receipt until the deadline
+	start := time.Now()
+	_, err := m.WaitForTransactionReceipt(ctx, minedHash, 100*time.Millisecond)
+	assert.ErrorIs(t, err, ErrTimeoutReached)
+	assert.GreaterOrEqual(t, time.Since(start), 100*time.Millisecond)
+
+	recorder.mu.Lock()
+	recorder.results = map[string]interface{}{"eth_getTransactionReceipt": expected}
+	recorder.mu.Unlock()
+	receipt, err := m.WaitForTransactionReceipt(ctx, minedHash, time.Second)
+	require.NoError(t, err)
+	assert.Equal(t, minedHash, receipt.TxHash)
+	assert.Equal(t, expected.BlockNumber, receipt.BlockNumber)
+
+	// hard RPC errors are returned without waiting for the deadline
+	start = time.Now()
+	_, err = m.WaitForTransactionReceipt(ctx, failingHash, time.Minute)
+	require.Error(t, err)
+	assert.NotErrorIs(t, err, ErrTimeoutReached)
+	assert.Less(t, time.Since(start), time.Second)
+}
+
+func TestManagerGetL2BalanceAndNonce(t *testing.T) {
+	// the account funded in the genesis of the node
+	addr := common.HexToAddress(DefaultSequencerAddress)
+	balance, ok := new(big.Int).SetString("100000000000000000000000", 10)
+	require.True(t, ok)
+
+	recorder, srv := newRPCRecorder(t, map[string]interface{}{
+		"eth_getBalance":          hexutil.EncodeBig(balance),
+		"eth_getTransactionCount": hexutil.EncodeUint64(5),
+	})
+	m := &Manager{cfg: &Config{L2URL: srv.URL}}
+	ctx := context.Background()
+
+	client, err := m.L2Client()
+	require.NoError(t, err)
+	sameClient, err := m.L2Client()
+	require.NoError(t, err)
+	assert.Same(t, client, sameClient)
+
+	actualBalance, err := m.GetL2Balance(ctx, addr, nil)
+	require.NoError(t, err)
+	assert.Equal(t, balance, actualBalance)
+
+	nonce, err := m.GetL2Nonce(ctx, addr, big.NewInt(10))
+	require.NoError(t, err)
+	assert.Equal(t, uint64(5), nonce)
+
+	recorder.mu.Lock()
+	defer recorder.mu.Unlock()
+	require.Len(t, recorder.params, 2)
+	assert.JSONEq(t, `"latest"`, string(recorder.params[0][1]))
+	assert.JSONEq(t, `"0xa"`, string(recorder.params[1][1]))
+}
+
+func TestManagerCheckTokenBalance(t *testing.T) {
+	ctx := context.Background()
+	// the simulated L1 network stands in for the L2 one
+	url := freeLocalURL(t)
+	l1, err := startSimulatedL1(url)
+	require.NoError(t, err)
+	defer func() {
+		require.NoError(t, l1.stop())
+	}()
+	m := &Manager{cfg: &Config{L2URL: url}}
+	client, err := m.L2Client()
+	require.NoError(t, err)
+	auth, err := GetAuthAutoChain(DefaultSequencerPrivateKey, client)
+	require.NoError(t, err)
+
+	erc20ABI, err := ERC20.ERC20MetaData.GetAbi()
+	require.NoError(t, err)
+	token, _, err := m.DeployContractWithABI(ctx, auth, erc20ABI, common.FromHex(ERC20.ERC20Bin), "Test", "TST")
+	require.NoError(t, err)
+	erc20, err := ERC20.NewERC20(token, client)
+	require.NoError(t, err)
+
+	// mint to the deployer and send part of it to another account
+	holder := common.HexToAddress("0x1234")
+	tx, err := erc20.Mint(auth, big.NewInt(1000))
+	require.NoError(t, err)
+	require.NoError(t, WaitTxToBeMined(ctx, client, tx, DefaultTxMinedDeadline))
+	tx, err = erc20.Transfer(auth, holder, big.NewInt(300))
+	require.NoError(t, err)
+	require.NoError(t, WaitTxToBeMined(ctx, client, tx, DefaultTxMinedDeadline))
+
+	require.NoError(t, m.CheckTokenBalance(ctx, token, auth.From, big.NewInt(700)))
+	require.NoError(t, m.CheckTokenBalance(ctx, token, holder, big.NewInt(300)))
+	require.NoError(t, m.CheckTokenBalance(ctx, token, common.HexToAddress("0x5678"), big.NewInt(0)))
+
+	err = m.CheckTokenBalance(ctx, token, holder, big.NewInt(1000))
+	assert.ErrorIs(t, err, ErrBalanceMismatch)
+	assert.ErrorContains(t, err, "balance of 300")
+}
+
+func TestManagerWaitForBatchConsolidation(t *testing.T) {
+	recorder, srv := newRPCRecorder(t, map[string]interface{}{
+		"zkevm_verifiedBatchNumber": hexutil.EncodeUint64(3),
+	})
+	m := &Manager{cfg: &Config{L2URL: srv.URL}}
+	ctx := context.Background()
+
+	require.NoError(t, m.WaitForBatchConsolidation(ctx, 3, time.Second))
+
+	// the timeout error reports the last consolidated batch
+	err := m.WaitForBatchConsolidation(ctx, 5, 100*time.Millisecond)
+	assert.ErrorIs(t, err, ErrTimeoutReached)
+	assert.ErrorContains(t, err, "last consolidated batch is 3")
+
+	// RPC errors are returned without waiting for the deadline
+	recorder.mu.Lock()
+	recorder.fail = func(method string, params []json.RawMessage) bool { return true }
+	recorder.mu.Unlock()
+	start := time.Now()
+	err = m.WaitForBatchConsolidation(ctx, 5, time.Minute)
+	require.Error(t, err)
+	assert.NotErrorIs(t, err, ErrTimeoutReached)
+	assert.Less(t, time.Since(start), time.Second)
+	assert.Equal(t, "zkevm_verifiedBatchNumber", recorder.calls()[0])
+}
+
+func TestManagerWaitForTxConsolidated(t *testing.T) {
+	recorder, srv := newRPCRecorder(t, map[string]interface{}{
+		"eth_getTransactionReceipt": &types.Receipt{
+			Status:            types.ReceiptStatusSuccessful,
+			CumulativeGasUsed: 21000,
+			GasUsed:           21000,
+			Logs:              []*types.Log{},
+			BlockNumber:       big.NewInt(5),
+		},
+		"zkevm_batchNumberByBlockNumber": hexutil.EncodeUint64(2),
+		"zkevm_verifiedBatchNumber":      hexutil.EncodeUint64(1),
+	})
+	m := &Manager{cfg: &Config{L2URL: srv.URL}}
+	ctx := context.Background()
+	txHash := common.HexToHash("0x1")
+
+	// the batch of the tx is not consolidated yet
+	_, err := m.WaitForTxConsolidated(ctx, txHash, 100*time.Millisecond)
+	assert.ErrorIs(t, err, ErrTimeoutReached)
+	assert.ErrorContains(t, err, "batch 2 not consolidated")
+
+	recorder.mu.Lock()
+	recorder.results["zkevm_verifiedBatchNumber"] = hexutil.EncodeUint64(3)
+	recorder.mu.Unlock()
+	batchNumber, err := m.WaitForTxConsolidated(ctx, txHash, time.Second)
+	require.NoError(t, err)
+	assert.Equal(t, uint64(2), batchNumber)
+	consolidated, err := GetLastBatchNumberConsolidatedOnEthereum(srv.URL)
+	require.NoError(t, err)
+	assert.LessOrEqual(t, batchNumber, consolidated)
+}
+
+func TestManagerWaitForBatchVirtualization(t *testing.T) {
+	recorder, srv := newRPCRecorder(t, map[string]interface{}{
+		"eth_sendRawTransaction": common.Hash{}.Hex(),
+		"eth_getTransactionReceipt": &types.Receipt{
+			Status:            types.ReceiptStatusSuccessful,
+			CumulativeGasUsed: 21000,
+			GasUsed:           21000,
+			Logs:              []*types.Log{},
+			BlockNumber:       big.NewInt(5),
+		},
+		"zkevm_batchNumberByBlockNumber": hexutil.EncodeUint64(2),
+		"zkevm_virtualBatchNumber":       hexutil.EncodeUint64(2),
+		"zkevm_verifiedBatchNumber":      hexutil.EncodeUint64(1),
+	})
+	m := &Manager{
+		cfg: &Config{L2URL: srv.URL},
+		ctx: context.Background(),
+	}
+	ctx := context.Background()
+
+	to := common.HexToAddress("0x1")
+	tx := types.NewTx(&types.LegacyTx{To: &to, Gas: 21000, GasPrice: big.NewInt(1)})
+	_, err := m.ApplyL2Txs([]*types.Transaction{tx}, nil, VirtualConfirmationLevel)
+	require.NoError(t, err)
+	assert.Contains(t, recorder.calls(), "zkevm_virtualBatchNumber")
+	assert.NotContains(t, recorder.calls(), "zkevm_verifiedBatchNumber")
+
+	// sequenced but not verified yet
+	level, err := m.WaitForBatchVirtualization(ctx, 2, time.Second)
+	require.NoError(t, err)
+	assert.Equal(t, VirtualConfirmationLevel, level)
+	err = m.WaitForBatchConsolidation(ctx, 2, 100*time.Millisecond)
+	assert.ErrorIs(t, err, ErrTimeoutReached)
+
+	_, err = m.WaitForBatchVirtualization(ctx, 3, 100*time.Millisecond)
+	assert.ErrorIs(t, err, ErrTimeoutReached)
+	assert.ErrorContains(t, err, "last virtualized batch is 2")
+
+	recorder.mu.Lock()
+	recorder.results["zkevm_verifiedBatchNumber"] = hexutil.EncodeUint64(2)
+	recorder.mu.Unlock()
+	level, err = m.WaitForBatchVirtualization(ctx, 2, time.Second)
+	require.NoError(t, err)
+	assert.Equal(t, VerifiedConfirmationLevel, level)
+	require.NoError(t, m.WaitForBatchConsolidation(ctx, 2, time.Second))
+}
+
+func TestManagerCheckBalance(t *testing.T) {
+	ctx := context.Background()
+	tree := merkletree.NewStateTree(merkletree.NewLocalHashDBClient(merkletree.NewMemStore()))
+	txID := uuid.NewString()
+
+	// the genesis balances
+	balances := map[common.Address]*big.Int{
+		common.HexToAddress(DefaultSequencerAddress):     big.NewInt(1000),
+		common.HexToAddress(DefaultForcedBatchesAddress): big.NewInt(2000),
+	}
+	root := state.ZeroHash.Bytes()
+	for addr, balance := range balances {
+		var err error
+		root, _, err = tree.SetBalance(ctx, addr, balance, root, txID)
+		require.NoError(t, err)
+	}
+	genesisBatch := &state.Batch{BatchNumber: 0, StateRoot: common.BytesToHash(root)}
+	// the balance of the sequencer changes in the virtual batch 1
+	root, _, err := tree.SetBalance(ctx, common.HexToAddress(DefaultSequencerAddress), big.NewInt(500), root, txID)
+	require.NoError(t, err)
+	virtualBatch := &state.Batch{BatchNumber: 1, StateRoot: common.BytesToHash(root)}
+
+	storage := mocks.NewStorageMock(t)
+	storage.EXPECT().GetLastVerifiedBatch(ctx, nil).Return(&state.VerifiedBatch{BatchNumber: 0}, nil)
+	storage.EXPECT().GetLastVirtualBatchNum(ctx, nil).Return(uint64(1), nil)
+	storage.EXPECT().GetBatchByNumber(ctx, uint64(0), nil).Return(genesisBatch, nil)
+	storage.EXPECT().GetBatchByNumber(ctx, uint64(1), nil).Return(virtualBatch, nil)
+	m := &Manager{
+		cfg: &Config{},
+		st:  state.NewState(state.Config{}, storage, nil, tree, nil, nil, nil),
+	}
+
+	for addr, balance := range balances {
+		assert.NoError(t, m.CheckBalance(ctx, addr, balance, false), addr)
+	}
+	assert.NoError(t, m.CheckBalance(ctx, common.HexToAddress(DefaultSequencerAddress), big.NewInt(500), true))
+	assert.NoError(t, m.CheckBalance(ctx, common.HexToAddress(DefaultForcedBatchesAddress), big.NewInt(2000), true))
+	assert.NoError(t, m.CheckBalance(ctx, common.HexToAddress("0x1"), big.NewInt(0), true))
+
+	err = m.CheckBalance(ctx, common.HexToAddress(DefaultSequencerAddress), big.NewInt(1000), true)
+	assert.ErrorIs(t, err, ErrBalanceMismatch)
+	assert.ErrorContains(t, err, "has balance 500 at the last virtual batch 1, expected 1000")
+}
+
+// expectBatchPointersTx expects the read only txs of
+// state.State.GetBatchPointers and returns the tx.
+// genesisResult holds what a genesis stores in the state.
+type genesisResult struct {
+	block     *state.Block
+	batch     state.Batch
+	l2BlockID common.Hash
+}
+
+// setGenesisWithMocks runs SetGenesisWithHeader on a manager backed by a
+// storage mock and an in memory tree.
+func setGenesisWithMocks(t *testing.T, actions []*state.GenesisAction, header GenesisHeader) genesisResult {
+	ctx := context.Background()
+	storage := mocks.NewStorageMock(t)
+	dbTx := mocks.NewDbTxMock(t)
+	var result genesisResult
+	storage.EXPECT().Begin(ctx).Return(dbTx, nil)
+	storage.EXPECT().AddBlock(ctx, mock.Anything, dbTx).Run(func(ctx context.Context, block *state.Block, dbTx pgx.Tx) {
+		result.block = block
+	}).Return(nil)
+	storage.EXPECT().StoreGenesisBatch(ctx, mock.Anything, mock.Anything, dbTx).Run(func(ctx context.Context, batch state.Batch, closingReason string, dbTx pgx.Tx) {
+		result.batch = batch
+	}).Return(nil)
+	storage.EXPECT().GetForkIDByBatchNumber(uint64(0)).Return(uint64(state.FORKID_ETROG))
+	storage.EXPECT().AddVirtualBatch(ctx, mock.Anything, dbTx).Return(nil)
+	storage.EXPECT().AddVerifiedBatch(ctx, mock.Anything, dbTx).Return(nil)
+	storage.EXPECT().AddL2Block(ctx, uint64(0), mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything, dbTx).
+		Run(func(ctx context.Context, batchNumber uint64, l2Block *state.L2Block, receipts []*types.Receipt, txsL2Hash []common.Hash, txsEGPData []state.StoreTxEGPData, imStateRoots []common.Hash, dbTx pgx.Tx) {
+			result.l2BlockID = l2Block.Hash()
+		}).Return(nil)
+	dbTx.EXPECT().Commit(ctx).Return(nil)
+
+	tree := merkletree.NewStateTree(merkletree.NewLocalHashDBClient(merkletree.NewMemStore()))
+	m := &Manager{
+		ctx: ctx,
+		cfg: &Config{},
+		st:  state.NewState(state.Config{}, storage, nil, tree, nil, nil, nil),
+	}
+	require.NoError(t, m.SetGenesisWithHeader(actions, header))
+	return result
+}
+
+func TestManagerSetGenesisWithHeader(t *testing.T) {
+	actions := []*state.GenesisAction{
+		{Address: "0x1", Type: int(merkletree.LeafTypeBalance), Value: "1000"},
+		{Address: "0x2", Type: int(merkletree.LeafTypeNonce), Value: "5"},
+	}
+	header := GenesisHeader{
+		Number:     10,
+		Timestamp:  time.Unix(1700000000, 0),
+		ParentHash: common.HexToHash("0xaa"),
+	}
+
+	first := setGenesisWithMocks(t, actions, header)
+	second := setGenesisWithMocks(t, actions, header)
+	assert.NotEqual(t, common.Hash{}, first.batch.StateRoot)
+	assert.Equal(t, first.batch.StateRoot, second.batch.StateRoot)
+	assert.Equal(t, first.l2BlockID, second.l2BlockID)
+	assert.Equal(t, first.block, second.block)
+	assert.Equal(t, uint64(10), first.block.BlockNumber)
+	assert.Equal(t, header.ParentHash, first.block.ParentHash)
+	assert.True(t, header.Timestamp.Equal(first.batch.Timestamp))
+
+	// another timestamp changes the genesis L2 block but not the state
+	header.Timestamp = header.Timestamp.Add(time.Second)
+	third := setGenesisWithMocks(t, actions, header)
+	assert.Equal(t, first.batch.StateRoot, third.batch.StateRoot)
+	assert.NotEqual(t, first.l2BlockID, third.l2BlockID)
+}
+
+func TestConfigResetsDB(t *testing.T) {
+	assert.True(t, (&Config{}).resetsDB())
+	assert.False(t, (&Config{SkipDBReset: true}).resetsDB())
+	assert.False(t, (&Config{PreserveDBOnTeardown: true}).resetsDB())
+	assert.False(t, (&Config{Backend: SimulatedL1Backend}).resetsDB())
+}
+
+func TestManagerSkipDBResetKeepsGenesis(t *testing.T) {
+	ctx := context.Background()
+	actions := []*state.GenesisAction{
+		{Address: "0x1", Type: int(merkletree.LeafTypeBalance), Value: "1000"},
+	}
+	// the genesis of a previous run is in the state, the storage mock fails
+	// the test on any write
+	storage := mocks.NewStorageMock(t)
+	storage.EXPECT().GetBatchByNumber(ctx, uint64(0), nil).Return(&state.Batch{BatchNumber: 0, StateRoot: common.HexToHash("0x1")}, nil)
+	m := &Manager{
+		ctx: ctx,
+		cfg: &Config{SkipDBReset: true},
+		st:  state.NewState(state.Config{}, storage, nil, nil, nil, nil, nil),
+	}
+	require.NoError(t, m.SetGenesis(0, actions))
+
+	// other errors are returned
+	errDB := errors.New("db down")
+	storage = mocks.NewStorageMock(t)
+	storage.EXPECT().GetBatchByNumber(ctx, uint64(0), nil).Return(nil, errDB)
+	m.st = state.NewState(state.Config{}, storage, nil, nil, nil, nil, nil)
+	assert.ErrorIs(t, m.SetGenesis(0, actions), errDB)
+}
+
+func expectBatchPointersTx(ctx context.Context, t *testing.T, storage *mocks.StorageMock) *mocks.DbTxMock {
+	dbTx := mocks.NewDbTxMock(t)
+	storage.EXPECT().Begin(ctx).Return(dbTx, nil)
+	dbTx.EXPECT().Exec(ctx, mock.Anything).Return(pgconn.CommandTag("SET"), nil)
+	dbTx.EXPECT().Rollback(ctx).Return(nil)
+	return dbTx
+}
+
+func TestManagerWaitForRootsToConverge(t *testing.T) {
+	ctx := context.Background()
+	batch1 := &state.Batch{BatchNumber: 1, StateRoot: common.HexToHash("0x1")}
+	batch2 := &state.Batch{BatchNumber: 2, StateRoot: common.HexToHash("0x2")}
+
+	storage := mocks.NewStorageMock(t)
+	dbTx := expectBatchPointersTx(ctx, t, storage)
+	storage.EXPECT().GetLastBatchNumber(ctx, dbTx).Return(uint64(2), nil)
+	storage.EXPECT().GetLastVirtualBatchNum(ctx, dbTx).Return(uint64(2), nil)
+	storage.EXPECT().GetBatchByNumber(ctx, uint64(1), nil).Return(batch1, nil)
+	storage.EXPECT().GetBatchByNumber(ctx, uint64(2), nil).Return(batch2, nil)
+	// the batch 2 is verified after the first poll
+	storage.EXPECT().GetLastVerifiedBatch(ctx, dbTx).Return(&state.VerifiedBatch{BatchNumber: 1}, nil).Once()
+	storage.EXPECT().GetLastVerifiedBatch(ctx, dbTx).Return(&state.VerifiedBatch{BatchNumber: 2}, nil)
+	storage.EXPECT().GetLastVerifiedBatch(ctx, nil).Return(&state.VerifiedBatch{BatchNumber: 2}, nil)
+	m := &Manager{
+		cfg: &Config{},
+		st:  state.NewState(state.Config{}, storage, nil, nil, nil, nil, nil),
+	}
+	require.NoError(t, m.WaitForRootsToConverge(ctx, 10*time.Second))
+
+	root, err := m.GetStateRoot(ctx, false)
+	require.NoError(t, err)
+	assert.Equal(t, batch2.StateRoot, root)
+}
+
+func TestManagerCheckRoot(t *testing.T) {
+	ctx := context.Background()
+	storage := mocks.NewStorageMock(t)
+	storage.EXPECT().GetLastVerifiedBatch(ctx, nil).Return(&state.VerifiedBatch{BatchNumber: 0}, nil)
+	storage.EXPECT().GetLastVirtualBatchNum(ctx, nil).Return(uint64(1), nil)
+	storage.EXPECT().GetBatchByNumber(ctx, uint64(0), nil).Return(&state.Batch{BatchNumber: 0}, nil)
+	storage.EXPECT().GetBatchByNumber(ctx, uint64(1), nil).Return(&state.Batch{BatchNumber: 1, StateRoot: common.HexToHash("0x1")}, nil)
+	m := &Manager{
+		ctx: ctx,
+		cfg: &Config{},
+		st:  state.NewState(state.Config{}, storage, nil, nil, nil, nil, nil),
+	}
+
+	// the empty expected root is the root of the empty tree
+	assert.NoError(t, m.CheckConsolidatedRoot(""))
+	assert.NoError(t, m.CheckConsolidatedRoot(merkletree.DefaultEmptyRoot.String()))
+	assert.ErrorIs(t, m.CheckVirtualRoot(""), ErrRootMismatch)
+	assert.NoError(t, m.CheckVirtualRoot("0x1"))
+	assert.ErrorIs(t, m.CheckConsolidatedRoot("0x1"), ErrRootMismatch)
+}
+
+func TestManagerPrintRoots(t *testing.T) {
+	ctx := context.Background()
+	storage := mocks.NewStorageMock(t)
+	storage.EXPECT().GetLastVerifiedBatch(ctx, nil).Return(&state.VerifiedBatch{BatchNumber: 1}, nil)
+	storage.EXPECT().GetLastVirtualBatchNum(ctx, nil).Return(uint64(2), nil)
+	storage.EXPECT().GetBatchByNumber(ctx, uint64(1), nil).Return(&state.Batch{BatchNumber: 1, StateRoot: common.HexToHash("0x1")}, nil)
+	storage.EXPECT().GetBatchByNumber(ctx, uint64(2), nil).Return(&state.Batch{BatchNumber: 2, StateRoot: common.HexToHash("0x2")}, nil)
+	m := &Manager{
+		ctx: ctx,
+		cfg: &Config{},
+		st:  state.NewState(state.Config{}, storage, nil, nil, nil, nil, nil),
+	}
+
+	var out bytes.Buffer
+	require.NoError(t, m.PrintRoots(&out))
+	var roots map[string]string
+	require.NoError(t, json.Unmarshal(out.Bytes(), &roots))
+	assert.Equal(t, map[string]string{
+		"virtualRoot":      common.HexToHash("0x2").String(),
+		"consolidatedRoot": common.HexToHash("0x1").String(),
+	}, roots)
+	assert.Regexp(t, "^0x[0-9a-f]{64}$", roots["virtualRoot"])
+	assert.True(t, strings.HasSuffix(out.String(), "}\n"))
+
+	t.Setenv(constants.ENV_OPS_PRINT_ROOTS, "")
+	assert.False(t, printRootsEnabled())
+	t.Setenv(constants.ENV_OPS_PRINT_ROOTS, "true")
+	assert.True(t, printRootsEnabled())
+
+	// the roots need the state
+	m = &Manager{ctx: ctx, cfg: &Config{}}
+	assert.ErrorIs(t, m.PrintRoots(&out), ErrUnsupportedByBackend)
+}
+
+func TestManagerWaitForRootsToConvergeTimeout(t *testing.T) {
+	ctx := context.Background()
+	storage := mocks.NewStorageMock(t)
+	dbTx := expectBatchPointersTx(ctx, t, storage)
+	storage.EXPECT().GetLastBatchNumber(ctx, dbTx).Return(uint64(2), nil)
+	storage.EXPECT().GetLastVirtualBatchNum(ctx, dbTx).Return(uint64(2), nil)
+	storage.EXPECT().GetLastVerifiedBatch(ctx, dbTx).Return(&state.VerifiedBatch{BatchNumber: 1}, nil)
+	storage.EXPECT().GetBatchByNumber(ctx, uint64(1), nil).Return(&state.Batch{BatchNumber: 1, StateRoot: common.HexToHash("0x1")}, nil)
+	storage.EXPECT().GetBatchByNumber(ctx, uint64(2), nil).Return(&state.Batch{BatchNumber: 2, StateRoot: common.HexToHash("0x2")}, nil)
+	m := &Manager{
+		cfg: &Config{},
+		st:  state.NewState(state.Config{}, storage, nil, nil, nil, nil, nil),
+	}
+
+	err := m.WaitForRootsToConverge(ctx, 500*time.Millisecond)
+	assert.ErrorIs(t, err, ErrTimeoutReached)
+	assert.ErrorContains(t, err, "virtual root "+common.HexToHash("0x2").String())
+	assert.ErrorContains(t, err, "verified root "+common.HexToHash("0x1").String())
+}
+
+func TestManagerLogFields(t *testing.T) {
+	logFile := filepath.Join(t.TempDir(), "operations.log")
+	log.Init(log.Config{Environment: log.EnvironmentProduction, Level: "debug", Outputs: []string{logFile}})
+	t.Cleanup(func() {
+		log.Init(log.Config{Environment: log.EnvironmentDevelopment, Level: "debug", Outputs: []string{"stderr"}})
+	})
+
+	_, srv := newRPCRecorder(t, map[string]interface{}{
+		"zkevm_verifiedBatchNumber": hexutil.EncodeUint64(3),
+	})
+	r := &componentsRecorder{}
+	m := newSetupManager(r)
+	m.cfg.L2URL = srv.URL
+	m.cfg.LogFields = map[string]string{"runID": "run-1"}
+
+	require.NoError(t, m.startComponent(ComponentNode))
+	require.NoError(t, m.WaitForBatchConsolidation(context.Background(), 3, time.Second))
+
+	content, err := os.ReadFile(logFile)
+	require.NoError(t, err)
+	entries := map[string]map[string]interface{}{}
+	for _, line := range strings.Split(strings.TrimSpace(string(content)), "\n") {
+		var entry map[string]interface{}
+		require.NoError(t, json.Unmarshal([]byte(line), &entry), line)
+		entries[entry["msg"].(string)] = entry
+	}
+
+	started := entries["starting component"]
+	require.NotNil(t, started)
+	assert.Equal(t, "run-1", started["runID"])
+	assert.Equal(t, ComponentNode, started["component"])
+
+	waiting := entries["waiting for the batch to be consolidated"]
+	require.NotNil(t, waiting)
+	assert.Equal(t, "run-1", waiting["runID"])
+	assert.Equal(t, float64(3), waiting["batchNumber"])
+}
+
+// fixedCollateral is a SequencerCollateralGetter with a fixed collateral.
+type fixedCollateral int64
+
+func (c fixedCollateral) GetSequencerCollateral(ctx context.Context) (*big.Int, error) {
+	return big.NewInt(int64(c)), nil
+}
+
+func TestApproveSequencerPol(t *testing.T) {
+	ctx := context.Background()
+	cfg := GetDefaultOperationsConfig()
+	cfg.Backend = SimulatedL1Backend
+	cfg.L1URL = freeLocalURL(t)
+	cfg.SequencerCollateral = fixedCollateral(5)
+	m, err := NewManager(ctx, cfg)
+	require.NoError(t, err)
+	require.NoError(t, m.Setup())
+	defer func() {
+		require.NoError(t, m.StopNetwork())
+	}()
+
+	client, err := GetClient(m.L1NetworkURL())
+	require.NoError(t, err)
+	auth, err := GetAuth(DefaultSequencerPrivateKey, DefaultL1ChainID)
+	require.NoError(t, err)
+	polAddr, tx, polSC, err := pol.DeployPol(auth, client, "Pol Token", "POL", 18, big.NewInt(1000))
+	require.NoError(t, err)
+	require.NoError(t, WaitTxToBeMined(ctx, client, tx, DefaultTimeoutTxToBeMined))
+	cfg.MaticAddress = polAddr
+
+	// the zkEVM smart contract can spend the collateral of the batches
+	amount, err := m.ApproveSequencerPol(ctx, 3)
+	require.NoError(t, err)
+	assert.Equal(t, big.NewInt(15), amount)
+	allowance, err := polSC.Allowance(&bind.CallOpts{Context: ctx}, auth.From, m.PoEAddress())
+	require.NoError(t, err)
+	assert.Equal(t, big.NewInt(15), allowance)
+
+	// without a getter the collateral is read from the rollup manager, which
+	// isn't deployed on the simulated L1 network
+	cfg.SequencerCollateral = nil
+	_, err = m.ApproveSequencerPol(ctx, 3)
+	assert.ErrorContains(t, err, "failed to get the sequencer collateral")
+}
@@ -0,0 +1,138 @@
+package operations
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os/exec"
+	"time"
+)
+
+// CommandRunner runs the commands the manager uses to start and stop the
+// docker-compose components, e.g. `make run-node`.
+type CommandRunner interface {
+	Run(name string, args ...string) error
+}
+
+// ContextCommandRunner is a CommandRunner able to abort a command when the
+// context is done, it's used by TeardownWithContext when the runner
+// implements it.
+type ContextCommandRunner interface {
+	CommandRunner
+	RunContext(ctx context.Context, name string, args ...string) error
+}
+
+// execRunner is the default CommandRunner, it runs the commands in the folder
+// of the Makefile forwarding their output to the standard output and error.
+type execRunner struct{}
+
+// Run runs the command and waits for it to finish.
+func (execRunner) Run(name string, args ...string) error {
+	return runCmd(exec.Command(name, args...))
+}
+
+// RunContext runs the command and waits for it to finish, the process is
+// killed when the context is done.
+func (execRunner) RunContext(ctx context.Context, name string, args ...string) error {
+	if err := runCmd(exec.CommandContext(ctx, name, args...)); err != nil {
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			return fmt.Errorf("%w: %w", ctxErr, err)
+		}
+		return err
+	}
+	return nil
+}
+
+// runner returns the CommandRunner of the config, which defaults to the exec
+// based one.
+func (m *Manager) runner() CommandRunner {
+	if m.cfg == nil || m.cfg.Runner == nil {
+		return execRunner{}
+	}
+	return m.cfg.Runner
+}
+
+// runMakeTarget runs a Makefile target with the runner of the manager.
+func (m *Manager) runMakeTarget(target string) error {
+	return runMakeTarget(m.runner(), target)
+}
+
+// runMakeTarget runs a Makefile target with the given runner.
+func runMakeTarget(runner CommandRunner, target string) error {
+	return runner.Run("make", target)
+}
+
+// runContext runs the command with the runner until the context is done. The
+// runners that are not a ContextCommandRunner can't be aborted, their command
+// is left running in the background when the context is done first.
+func runContext(ctx context.Context, runner CommandRunner, name string, args ...string) error {
+	if r, ok := runner.(ContextCommandRunner); ok {
+		return r.RunContext(ctx, name, args...)
+	}
+
+	done := make(chan error, 1)
+	go func() {
+		done <- runner.Run(name, args...)
+	}()
+	select {
+	case err := <-done:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// stopComponentsWithContext stops the components in order with the given
+// runner. Each stop gets an equal share of the time left until the deadline
+// of the context, so a hung stop doesn't prevent the next ones from running.
+// All the stops are attempted, the returned error joins their errors.
+func stopComponentsWithContext(ctx context.Context, runner CommandRunner, components ...string) error {
+	var errs []error
+	for i, component := range components {
+		stopCtx, cancel := shareDeadline(ctx, len(components)-i)
+		err := runContext(stopCtx, runner, "make", fmt.Sprintf("stop-%s", component))
+		cancel()
+		if err != nil {
+			errs = append(errs, componentError(component, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// shareDeadline returns a context whose deadline is the share of the time left
+// until the deadline of ctx for one of n commands.
+func shareDeadline(ctx context.Context, n int) (context.Context, context.CancelFunc) {
+	deadline, ok := ctx.Deadline()
+	if !ok {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeout(ctx, time.Until(deadline)/time.Duration(n))
+}
+
+// startComponentWith starts a docker-compose component running its Makefile
+// targets with the given runner, see StartComponent.
+func startComponentWith(runner CommandRunner, component string, conditions ...ConditionFunc) error {
+	cmdDown := fmt.Sprintf("stop-%s", component)
+	if err := runMakeTarget(runner, cmdDown); err != nil {
+		return err
+	}
+	cmdUp := fmt.Sprintf("run-%s", component)
+	if err := runMakeTarget(runner, cmdUp); err != nil {
+		return err
+	}
+
+	// Wait component to be ready
+	for _, condition := range conditions {
+		if err := Poll(DefaultInterval, DefaultDeadline, condition); err != nil {
+			return fmt.Errorf("%w: %w", ErrComponentNotReady, err)
+		}
+	}
+	return nil
+}
+
+// stopComponentWith stops a docker-compose component running its Makefile
+// target with the given runner, see StopComponent.
+func stopComponentWith(runner CommandRunner, component string) error {
+	cmdDown := fmt.Sprintf("stop-%s", component)
+	return runMakeTarget(runner, cmdDown)
+}
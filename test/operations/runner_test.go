@@ -0,0 +1,184 @@
+package operations
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// commandsRecorder is a fake CommandRunner that records the commands.
+type commandsRecorder struct {
+	mu       sync.Mutex
+	commands []string
+	fail     map[string]error
+}
+
+func (r *commandsRecorder) Run(name string, args ...string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	command := strings.Join(append([]string{name}, args...), " ")
+	r.commands = append(r.commands, command)
+	return r.fail[command]
+}
+
+// indexOf returns the position of the command in the recorded ones, -1 when
+// it wasn't run.
+func (r *commandsRecorder) indexOf(command string) int {
+	for i, c := range r.commands {
+		if c == command {
+			return i
+		}
+	}
+	return -1
+}
+
+// newRunnerManager returns a manager running its commands with the recorder
+// whose components are ready right away: the L1 and L2 networks are fake
+// synced nodes and the executor address accepts connections.
+func newRunnerManager(t *testing.T, r *commandsRecorder) *Manager {
+	node := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		_, _ = w.Write([]byte(`{"jsonrpc":"2.0","id":1,"result":false}`))
+	}))
+	t.Cleanup(node.Close)
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = l.Close() })
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			_ = conn.Close()
+		}
+	}()
+	prevExecutorURI := executorURI
+	executorURI = l.Addr().String()
+	t.Cleanup(func() { executorURI = prevExecutorURI })
+
+	// the Pol is approved with L1 txs and not with a make target
+	return &Manager{
+		cfg:          &Config{L1URL: node.URL, L2URL: node.URL, Runner: r},
+		approvePolFn: func(numBatches uint64) error { return nil },
+	}
+}
+
+func TestSetupRunsMakeTargets(t *testing.T) {
+	r := &commandsRecorder{}
+	require.NoError(t, newRunnerManager(t, r).Setup())
+
+	require.Len(t, r.commands, 6)
+	// the network and the prover are started concurrently, each one is
+	// stopped before running it
+	for _, component := range []string{ComponentNetwork, ComponentProver} {
+		stop := r.indexOf(fmt.Sprintf("make stop-%s", component))
+		run := r.indexOf(fmt.Sprintf("make run-%s", component))
+		require.NotEqual(t, -1, stop, component)
+		assert.Less(t, stop, run, component)
+		assert.Less(t, run, 4, component)
+	}
+	assert.Equal(t, []string{
+		"make stop-node",
+		"make run-node",
+	}, r.commands[4:])
+}
+
+func TestSetupRunnerFailure(t *testing.T) {
+	errRun := errors.New("make failed")
+	r := &commandsRecorder{fail: map[string]error{"make run-zkprover": errRun}}
+
+	err := newRunnerManager(t, r).Setup()
+	assert.ErrorIs(t, err, errRun)
+	var setupErr *SetupError
+	require.ErrorAs(t, err, &setupErr)
+	assert.Equal(t, ComponentProver, setupErr.Component)
+
+	assert.Equal(t, -1, r.indexOf("make run-node"))
+	assert.Equal(t, []string{
+		"make stop-node",
+		"make stop-zkprover",
+		"make stop-network",
+	}, r.commands[len(r.commands)-3:])
+}
+
+func TestManagerRunMakeTarget(t *testing.T) {
+	errRun := errors.New("make failed")
+	r := &commandsRecorder{fail: map[string]error{"make deploy-uniswap": errRun}}
+	m := newRunnerManager(t, r)
+
+	require.NoError(t, m.InitNetwork())
+	assert.ErrorIs(t, m.DeployUniswap(), errRun)
+	require.NoError(t, m.StopSequencer())
+	assert.Equal(t, []string{"make init-network", "make deploy-uniswap", "make stop-seq"}, r.commands)
+}
+
+// hangingRunner is a fake ContextCommandRunner whose hanging commands only
+// return when their context is done.
+type hangingRunner struct {
+	commandsRecorder
+	hang map[string]bool
+}
+
+func (r *hangingRunner) RunContext(ctx context.Context, name string, args ...string) error {
+	err := r.Run(name, args...)
+	if r.hang[strings.Join(append([]string{name}, args...), " ")] {
+		<-ctx.Done()
+		return ctx.Err()
+	}
+	return err
+}
+
+func TestStopComponentsWithContext(t *testing.T) {
+	errStop := errors.New("stop failed")
+	r := &hangingRunner{
+		commandsRecorder: commandsRecorder{fail: map[string]error{"make stop-network": errStop}},
+		hang:             map[string]bool{"make stop-node": true},
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 300*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	err := stopComponentsWithContext(ctx, r, ComponentNode, ComponentProver, ComponentNetwork)
+	// the hung stop only takes its share of the deadline
+	assert.Less(t, time.Since(start), 200*time.Millisecond)
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+	assert.ErrorIs(t, err, errStop)
+	var setupErr *SetupError
+	require.ErrorAs(t, err, &setupErr)
+	assert.Equal(t, ComponentNode, setupErr.Component)
+	// all the stops are attempted
+	assert.Equal(t, []string{"make stop-node", "make stop-zkprover", "make stop-network"}, r.commands)
+}
+
+func TestRunContextPlainRunner(t *testing.T) {
+	release := make(chan struct{})
+	defer close(release)
+	r := runnerFunc(func(name string, args ...string) error {
+		<-release
+		return nil
+	})
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	// the command can't be killed but the call returns on the deadline
+	err := runContext(ctx, r, "make", "stop-node")
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+}
+
+// runnerFunc adapts a function to a CommandRunner.
+type runnerFunc func(name string, args ...string) error
+
+func (f runnerFunc) Run(name string, args ...string) error {
+	return f(name, args...)
+}
@@ -0,0 +1,203 @@
+package operations
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"net"
+	"net/http"
+	"syscall"
+	"time"
+
+	"github.com/0xPolygonHermez/zkevm-node/log"
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/rpc"
+)
+
+const (
+	// DefaultSendTxRetries is the number of times a tx send that failed with a
+	// transient error is retried
+	DefaultSendTxRetries = 3
+	// sendTxBackoff is the wait before the first retry of a tx send, it's
+	// doubled on every retry
+	sendTxBackoff = 500 * time.Millisecond
+)
+
+// txSender is the client needed to send txs.
+type txSender interface {
+	SendTransaction(ctx context.Context, tx *types.Transaction) error
+}
+
+// sendTxRetries returns the number of retries of the tx sends of the manager.
+func (m *Manager) sendTxRetries() int {
+	if m.cfg == nil || m.cfg.SendTxRetries == 0 {
+		return DefaultSendTxRetries
+	}
+	if m.cfg.SendTxRetries < 0 {
+		return 0
+	}
+	return m.cfg.SendTxRetries
+}
+
+// sendTx sends the tx retrying up to retries times, with backoff, while the
+// send fails with a transient error. Errors returned by the node, like an
+// already known tx or an invalid nonce, are returned straight away.
+func sendTx(ctx context.Context, client txSender, tx *types.Transaction, retries int, logger *log.Logger) error {
+	backoff := sendTxBackoff
+	for attempt := 0; ; attempt++ {
+		err := client.SendTransaction(ctx, tx)
+		if err == nil || attempt >= retries || !isTransientSendError(err) {
+			return err
+		}
+		logger.Infow("retrying tx send", "txHash", tx.Hash(), "attempt", attempt+1, "error", err)
+
+		select {
+		case <-ctx.Done():
+			return err
+		case <-time.After(backoff):
+		}
+		backoff *= 2
+	}
+}
+
+// isTransientSendError returns whether the error of a tx send is caused by
+// the node being unreachable, so the send is worth retrying. The errors
+// returned by the node for the tx itself are not.
+func isTransientSendError(err error) bool {
+	var rpcErr rpc.Error
+	if errors.As(err, &rpcErr) {
+		return false
+	}
+	var httpErr rpc.HTTPError
+	if errors.As(err, &httpErr) {
+		return httpErr.StatusCode >= http.StatusInternalServerError
+	}
+	var netErr net.Error
+	return errors.As(err, &netErr) ||
+		errors.Is(err, syscall.ECONNREFUSED) ||
+		errors.Is(err, syscall.ECONNRESET) ||
+		errors.Is(err, io.EOF) ||
+		errors.Is(err, io.ErrUnexpectedEOF)
+}
+
+// droppedTxReason is the rejection reason returned by ExpectTxRejected when
+// the node accepted the tx but dropped it from the pool later
+const droppedTxReason = "the tx was dropped from the pool"
+
+// ExpectTxRejected sends the raw tx to the L2 network and waits until it's
+// rejected, returning the reason. The tx is rejected either when sending it
+// fails with an error of the node, e.g. an invalid signature or an
+// underpriced tx, or when it's accepted but dropped from the pool before
+// being mined. An error wrapping ErrTxNotRejected is returned when the tx is
+// mined, and one wrapping ErrTimeoutReached when it's still pending after the
+// timeout.
+func (m *Manager) ExpectTxRejected(ctx context.Context, rawTx []byte, timeout time.Duration) (string, error) {
+	client, err := m.L2Client()
+	if err != nil {
+		return "", err
+	}
+
+	var txHash common.Hash
+	err = client.Client().CallContext(ctx, &txHash, "eth_sendRawTransaction", hexutil.Encode(rawTx))
+	if err != nil {
+		var rpcErr rpc.Error
+		if errors.As(err, &rpcErr) {
+			return rpcErr.Error(), nil
+		}
+		return "", err
+	}
+
+	m.logger("txHash", txHash).Infow("tx accepted, waiting for it to be rejected")
+	var reason string
+	w := NewWaitWithConfig(WaitConfig{
+		Interval:    DefaultInterval,
+		MaxInterval: time.Second,
+		Deadline:    timeout,
+		Backoff:     2, //nolint:gomnd
+	})
+	err = w.Poll(func() (bool, error) {
+		if err := ctx.Err(); err != nil {
+			return false, err
+		}
+		receipt, err := client.TransactionReceipt(ctx, txHash)
+		if err == nil {
+			return false, fmt.Errorf("%w: tx %s was mined in block %s", ErrTxNotRejected, txHash, receipt.BlockNumber)
+		}
+		if !errors.Is(err, ethereum.NotFound) {
+			return false, err
+		}
+		_, _, err = client.TransactionByHash(ctx, txHash)
+		if errors.Is(err, ethereum.NotFound) {
+			reason = droppedTxReason
+			return true, nil
+		}
+		return false, err
+	})
+	if errors.Is(err, ErrTimeoutReached) {
+		return "", fmt.Errorf("%w: tx %s is still pending", err, txHash)
+	}
+	if err != nil {
+		return "", err
+	}
+	return reason, nil
+}
+
+// ApplyTxsWithAuth sends a value transfer to the given address for each
+// value, signed by auth, to the L2 network, waits for them to be mined and
+// returns their receipts in the same order. The nonces are taken from the
+// pending nonce of the sender, so the transfers don't wait for each other.
+func (m *Manager) ApplyTxsWithAuth(ctx context.Context, auth *bind.TransactOpts, to common.Address, values []*big.Int) ([]*types.Receipt, error) {
+	client, err := m.L2Client()
+	if err != nil {
+		return nil, err
+	}
+
+	chainID, err := client.ChainID(ctx)
+	if err != nil {
+		return nil, err
+	}
+	nonce, err := client.PendingNonceAt(ctx, auth.From)
+	if err != nil {
+		return nil, err
+	}
+
+	logger := m.logger("from", auth.From, "to", to)
+	sentTxs := make([]*types.Transaction, 0, len(values))
+	for _, value := range values {
+		tx, err := newTx(ctx, client, GasConfig{}, chainID, nonce, auth.From, &to, value, nil)
+		if err != nil {
+			return nil, err
+		}
+		signedTx, err := auth.Signer(auth.From, tx)
+		if err != nil {
+			return nil, err
+		}
+		err = sendTx(ctx, client, signedTx, m.sendTxRetries(), logger)
+		if err != nil {
+			return nil, fmt.Errorf("failed to send tx with nonce %d: %w", nonce, err)
+		}
+		logger.Infow("tx sent", "txHash", signedTx.Hash(), "nonce", nonce)
+		sentTxs = append(sentTxs, signedTx)
+		nonce++
+	}
+
+	receipts := make([]*types.Receipt, 0, len(sentTxs))
+	for _, tx := range sentTxs {
+		err := WaitTxToBeMined(ctx, client, tx, DefaultTimeoutTxToBeMined)
+		if err != nil {
+			return nil, err
+		}
+		receipt, err := client.TransactionReceipt(ctx, tx.Hash())
+		if err != nil {
+			return nil, err
+		}
+		receipts = append(receipts, receipt)
+	}
+	return receipts, nil
+}
@@ -0,0 +1,162 @@
+package operations
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/big"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/0xPolygonHermez/zkevm-node/log"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/rpc"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// sendErrClient is an L2 client whose sends fail with the given errors, in
+// order, before succeeding.
+type sendErrClient struct {
+	fakeEthClient
+	errs  []error
+	sends int
+}
+
+func (c *sendErrClient) SendTransaction(ctx context.Context, tx *types.Transaction) error {
+	c.sends++
+	if len(c.errs) == 0 {
+		return nil
+	}
+	err := c.errs[0]
+	c.errs = c.errs[1:]
+	return err
+}
+
+// nodeError is a JSON RPC error returned by the node.
+type nodeError struct {
+	msg string
+}
+
+func (e *nodeError) Error() string  { return e.msg }
+func (e *nodeError) ErrorCode() int { return -32000 }
+
+func TestApplyTxsRetriesSend(t *testing.T) {
+	auth, err := GetAuth(DefaultSequencerPrivateKey, DefaultL2ChainID)
+	require.NoError(t, err)
+	to := common.HexToAddress("0x1")
+	tx := types.NewTx(&types.LegacyTx{To: &to, Gas: 21000, GasPrice: big.NewInt(1)})
+	connErr := fmt.Errorf("dial tcp: %w", syscall.ECONNREFUSED)
+
+	tcs := []struct {
+		description   string
+		errs          []error
+		retries       int
+		expectedSends int
+		expectedErr   bool
+	}{
+		{"connection error is retried", []error{connErr}, DefaultSendTxRetries, 2, false},
+		{"unavailable node is retried", []error{rpc.HTTPError{StatusCode: 503}}, DefaultSendTxRetries, 2, false},
+		{"already known is not retried", []error{&nodeError{msg: "already known"}}, DefaultSendTxRetries, 1, true},
+		{"invalid nonce is not retried", []error{&nodeError{msg: "nonce too low"}}, DefaultSendTxRetries, 1, true},
+		{"retries are bounded", []error{connErr, connErr}, 1, 2, true},
+		{"no retries", []error{connErr}, 0, 1, true},
+	}
+	for _, tc := range tcs {
+		tc := tc
+		t.Run(tc.description, func(t *testing.T) {
+			client := &sendErrClient{errs: tc.errs}
+			_, err := applyTxs(context.Background(), []*types.Transaction{tx}, auth, client, false, tc.retries, log.WithFields())
+			if tc.expectedErr {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
+			assert.Equal(t, tc.expectedSends, client.sends)
+		})
+	}
+}
+
+func TestSendTxRetries(t *testing.T) {
+	assert.Equal(t, DefaultSendTxRetries, (&Manager{cfg: &Config{}}).sendTxRetries())
+	assert.Equal(t, 5, (&Manager{cfg: &Config{SendTxRetries: 5}}).sendTxRetries())
+	assert.Equal(t, 0, (&Manager{cfg: &Config{SendTxRetries: -1}}).sendTxRetries())
+	assert.False(t, isTransientSendError(errors.New("invalid sender")))
+}
+
+func TestExpectTxRejected(t *testing.T) {
+	ctx := context.Background()
+	// the simulated L1 network stands in for the L2 one
+	url := freeLocalURL(t)
+	l1, err := startSimulatedL1(url)
+	require.NoError(t, err)
+	defer func() {
+		require.NoError(t, l1.stop())
+	}()
+	m := &Manager{cfg: &Config{L2URL: url}}
+	client, err := m.L2Client()
+	require.NoError(t, err)
+	auth, err := GetAuthAutoChain(DefaultSequencerPrivateKey, client)
+	require.NoError(t, err)
+	nonce, err := client.PendingNonceAt(ctx, auth.From)
+	require.NoError(t, err)
+	gasPrice, err := client.SuggestGasPrice(ctx)
+	require.NoError(t, err)
+	to := common.HexToAddress("0x1")
+	signed, err := auth.Signer(auth.From, types.NewTx(&types.LegacyTx{
+		Nonce:    nonce,
+		To:       &to,
+		Value:    big.NewInt(1),
+		Gas:      21000,
+		GasPrice: gasPrice,
+	}))
+	require.NoError(t, err)
+
+	// a zero signature doesn't recover any sender
+	chainID, err := client.ChainID(ctx)
+	require.NoError(t, err)
+	invalid, err := signed.WithSignature(types.LatestSignerForChainID(chainID), make([]byte, 65))
+	require.NoError(t, err)
+	rawTx, err := invalid.MarshalBinary()
+	require.NoError(t, err)
+	reason, err := m.ExpectTxRejected(ctx, rawTx, time.Second)
+	require.NoError(t, err)
+	assert.Contains(t, reason, "invalid")
+
+	// a valid tx is mined
+	rawTx, err = signed.MarshalBinary()
+	require.NoError(t, err)
+	_, err = m.ExpectTxRejected(ctx, rawTx, 10*time.Second)
+	assert.ErrorIs(t, err, ErrTxNotRejected)
+}
+
+func TestManagerApplyTxsWithAuth(t *testing.T) {
+	ctx := context.Background()
+	// the simulated L1 network stands in for the L2 one
+	url := freeLocalURL(t)
+	l1, err := startSimulatedL1(url)
+	require.NoError(t, err)
+	defer func() {
+		require.NoError(t, l1.stop())
+	}()
+	m := &Manager{cfg: &Config{L2URL: url}}
+	client, err := m.L2Client()
+	require.NoError(t, err)
+	auth, err := GetAuthAutoChain(DefaultSequencerPrivateKey, client)
+	require.NoError(t, err)
+
+	to := common.HexToAddress("0x4321")
+	values := []*big.Int{big.NewInt(100), big.NewInt(200), big.NewInt(300)}
+	receipts, err := m.ApplyTxsWithAuth(ctx, auth, to, values)
+	require.NoError(t, err)
+	require.Len(t, receipts, len(values))
+	for _, receipt := range receipts {
+		assert.Equal(t, types.ReceiptStatusSuccessful, receipt.Status)
+	}
+
+	balance, err := client.BalanceAt(ctx, to, nil)
+	require.NoError(t, err)
+	assert.Equal(t, big.NewInt(600), balance)
+}
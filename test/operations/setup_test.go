@@ -0,0 +1,203 @@
+package operations
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// componentsRecorder fakes the start and stop of the components.
+type componentsRecorder struct {
+	mu      sync.Mutex
+	started []string
+	stopped []string
+	// running is the number of components being started at the same time
+	running    int
+	maxRunning int
+
+	delay time.Duration
+	fail  map[string]error
+}
+
+func (r *componentsRecorder) start(component string, conditions ...ConditionFunc) error {
+	r.mu.Lock()
+	r.running++
+	if r.running > r.maxRunning {
+		r.maxRunning = r.running
+	}
+	r.mu.Unlock()
+
+	time.Sleep(r.delay)
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.running--
+	if err := r.fail[component]; err != nil {
+		return err
+	}
+	r.started = append(r.started, component)
+	return nil
+}
+
+func (r *componentsRecorder) stop(component string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.stopped = append(r.stopped, component)
+	return nil
+}
+
+func newSetupManager(r *componentsRecorder) *Manager {
+	return &Manager{
+		cfg:              &Config{},
+		startComponentFn: r.start,
+		stopComponentFn:  r.stop,
+		approvePolFn: func(numBatches uint64) error {
+			return r.start(ComponentApprovePol)
+		},
+	}
+}
+
+func TestSetup(t *testing.T) {
+	r := &componentsRecorder{delay: 20 * time.Millisecond}
+	require.NoError(t, newSetupManager(r).Setup())
+
+	// the network and the prover are started concurrently
+	assert.Equal(t, 2, r.maxRunning)
+	assert.ElementsMatch(t, []string{"network", "zkprover"}, r.started[:2])
+	assert.Equal(t, []string{"approve-pol", "node"}, r.started[2:])
+	assert.Empty(t, r.stopped)
+}
+
+func TestSetupReuseEnvironment(t *testing.T) {
+	r := &componentsRecorder{}
+	resets := 0
+	m := newSetupManager(r)
+	m.cfg.ReuseEnvironment = true
+	m.resetStateFn = func() error {
+		resets++
+		return nil
+	}
+
+	// the first scenario starts the components
+	require.NoError(t, m.Setup())
+	assert.Equal(t, []string{"approve-pol", "node"}, r.started[2:])
+	assert.Zero(t, resets)
+
+	// the second one only resets the state and approves Pol again
+	require.NoError(t, m.Setup())
+	assert.Len(t, r.started, 5)
+	assert.Equal(t, "approve-pol", r.started[4])
+	assert.Equal(t, 1, resets)
+	assert.Empty(t, r.stopped)
+
+	errReset := errors.New("reset failed")
+	m.resetStateFn = func() error { return errReset }
+	assert.ErrorIs(t, m.Reset(), errReset)
+
+	// without ReuseEnvironment every Setup starts the components
+	r = &componentsRecorder{}
+	m = newSetupManager(r)
+	require.NoError(t, m.Setup())
+	require.NoError(t, m.Setup())
+	assert.Len(t, r.started, 8)
+}
+
+func TestSetupFailure(t *testing.T) {
+	errProver := errors.New("prover failed")
+	r := &componentsRecorder{fail: map[string]error{"zkprover": errProver}}
+
+	err := newSetupManager(r).Setup()
+	assert.ErrorIs(t, err, errProver)
+	assert.NotContains(t, r.started, "approve-pol")
+	assert.NotContains(t, r.started, "node")
+	assert.Equal(t, []string{"node", "zkprover", "network"}, r.stopped)
+}
+
+func TestSetupErrorComponent(t *testing.T) {
+	for _, component := range []string{ComponentNetwork, ComponentProver, ComponentApprovePol, ComponentNode} {
+		t.Run(component, func(t *testing.T) {
+			errComponent := errors.New("failed to start")
+			r := &componentsRecorder{fail: map[string]error{component: errComponent}}
+
+			err := newSetupManager(r).Setup()
+			var setupErr *SetupError
+			require.True(t, errors.As(err, &setupErr))
+			assert.Equal(t, component, setupErr.Component)
+			assert.True(t, setupErr.TeardownAttempted)
+			assert.ErrorIs(t, err, errComponent)
+			assert.Contains(t, err.Error(), component)
+		})
+	}
+}
+
+func TestSetupErrorLogs(t *testing.T) {
+	var logs strings.Builder
+	for i := 0; i < 100; i++ {
+		fmt.Fprintf(&logs, "line %d\n", i)
+	}
+	var commands [][]string
+	runOutput := func(c *exec.Cmd) ([]byte, error) {
+		commands = append(commands, c.Args)
+		return []byte(logs.String()), nil
+	}
+
+	// the prover didn't get ready
+	logsDir := t.TempDir()
+	r := &componentsRecorder{fail: map[string]error{ComponentProver: fmt.Errorf("%w: %w", ErrComponentNotReady, ErrTimeoutReached)}}
+	m := newSetupManager(r)
+	m.cfg.LogTailLines = 3
+	m.cfg.LogsDir = logsDir
+	m.runOutputFn = runOutput
+
+	err := m.Setup()
+	assert.ErrorIs(t, err, ErrTimeoutReached)
+	var setupErr *SetupError
+	require.ErrorAs(t, err, &setupErr)
+	assert.Equal(t, "line 97\nline 98\nline 99", setupErr.Logs)
+	assert.Contains(t, err.Error(), "line 99")
+	assert.NotContains(t, err.Error(), "line 96")
+	require.Len(t, commands, 1)
+	assert.Contains(t, commands[0], "zkevm-prover")
+
+	files, err := os.ReadDir(logsDir)
+	require.NoError(t, err)
+	require.Len(t, files, 1)
+	assert.True(t, strings.HasPrefix(files[0].Name(), ComponentProver))
+	content, err := os.ReadFile(filepath.Join(logsDir, files[0].Name()))
+	require.NoError(t, err)
+	assert.Equal(t, logs.String(), string(content))
+
+	// the logs are not captured when the component failed to start
+	commands = nil
+	r = &componentsRecorder{fail: map[string]error{ComponentProver: errors.New("make failed")}}
+	m = newSetupManager(r)
+	m.runOutputFn = runOutput
+	err = m.Setup()
+	require.ErrorAs(t, err, &setupErr)
+	assert.Empty(t, setupErr.Logs)
+	assert.Empty(t, commands)
+}
+
+func TestSetupApprovedBatches(t *testing.T) {
+	var approved []uint64
+	m := newSetupManager(&componentsRecorder{})
+	m.approvePolFn = func(numBatches uint64) error {
+		approved = append(approved, numBatches)
+		return nil
+	}
+	require.NoError(t, m.Setup())
+
+	m.cfg.ApprovedBatches = 10
+	m.resetStateFn = func() error { return nil }
+	require.NoError(t, m.Reset())
+	assert.Equal(t, []uint64{DefaultApprovedBatches, 10}, approved)
+}
@@ -0,0 +1,104 @@
+package operations
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/0xPolygonHermez/zkevm-node/state"
+	"github.com/0xPolygonHermez/zkevm-node/state/metrics"
+	"github.com/0xPolygonHermez/zkevm-node/test/vectors"
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// SimResult is the outcome of a tx executed by Manager.SimulateTxs.
+type SimResult struct {
+	// TxHash is the hash of the tx
+	TxHash common.Hash
+	// Success is true when the tx was executed without errors
+	Success bool
+	// GasUsed is the gas used by the tx
+	GasUsed uint64
+	// Err is the execution error of the tx, nil when it succeeded
+	Err error
+}
+
+// SimulateTxs executes the raw txs of the vectors on top of initialRoot, in a
+// single L2 block of the batch that follows the last batch of the state, and
+// returns the root they would produce and the result of each tx.
+//
+// The batch is processed by the executor without updating the merkletree, so
+// the changes only live in the memory of the executor while it runs and
+// neither the tree nor the state database are modified. The projected root
+// matches the real one only when the sequencer closes the same L2 block: the
+// timestamp and the coinbase of the block are part of the root.
+func (m *Manager) SimulateTxs(ctx context.Context, txs []vectors.Tx, initialRoot string) (finalRoot string, results []SimResult, err error) {
+	if err := m.checkState("SimulateTxs"); err != nil {
+		return "", nil, err
+	}
+
+	l2Txs := make([]state.L2TxRaw, 0, len(txs))
+	for _, vecTx := range txs {
+		tx, err := state.DecodeTx(vecTx.RawTx)
+		if err != nil {
+			return "", nil, fmt.Errorf("failed to decode the tx %d: %w", vecTx.ID, err)
+		}
+		l2Txs = append(l2Txs, state.L2TxRaw{
+			Tx:                   *tx,
+			EfficiencyPercentage: state.MaxEffectivePercentage,
+		})
+	}
+
+	lastBatch, err := m.st.GetLastBatch(ctx, nil)
+	if err != nil {
+		return "", nil, err
+	}
+	timestamp := uint64(time.Now().Unix())
+	batchData, err := state.EncodeBatchV2(&state.BatchRawV2{
+		Blocks: []state.L2BlockRaw{{
+			ChangeL2BlockHeader: state.ChangeL2BlockHeader{
+				DeltaTimestamp: uint32(timestamp - uint64(lastBatch.Timestamp.Unix())),
+			},
+			Transactions: l2Txs,
+		}},
+	})
+	if err != nil {
+		return "", nil, err
+	}
+
+	coinbase := common.HexToAddress(DefaultSequencerAddress)
+	if m.cfg != nil && m.cfg.SequenceSender != nil && m.cfg.SequenceSender.SenderAddress != "" {
+		coinbase = common.HexToAddress(m.cfg.SequenceSender.SenderAddress)
+	}
+	batchNumber := lastBatch.BatchNumber + 1
+	request := state.ProcessRequest{
+		BatchNumber:             batchNumber,
+		OldStateRoot:            common.HexToHash(initialRoot),
+		OldAccInputHash:         lastBatch.AccInputHash,
+		Transactions:            batchData,
+		Coinbase:                coinbase,
+		TimestampLimit_V2:       timestamp,
+		ForkID:                  m.st.GetForkIDByBatchNumber(batchNumber),
+		SkipVerifyL1InfoRoot_V2: true,
+		Caller:                  metrics.DiscardCallerLabel,
+	}
+	response, err := m.st.ProcessBatchV2(ctx, request, false)
+	if err != nil {
+		return "", nil, err
+	}
+	if response.ExecutorError != nil {
+		return "", nil, response.ExecutorError
+	}
+
+	for _, block := range response.BlockResponses {
+		for _, txResponse := range block.TransactionResponses {
+			results = append(results, SimResult{
+				TxHash:  txResponse.TxHash,
+				Success: txResponse.RomError == nil,
+				GasUsed: txResponse.GasUsed,
+				Err:     txResponse.RomError,
+			})
+		}
+	}
+	return response.NewStateRoot.String(), results, nil
+}
@@ -0,0 +1,98 @@
+package operations
+
+import (
+	"context"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/0xPolygonHermez/zkevm-node/hex"
+	"github.com/0xPolygonHermez/zkevm-node/state"
+	"github.com/0xPolygonHermez/zkevm-node/state/mocks"
+	"github.com/0xPolygonHermez/zkevm-node/state/runtime"
+	"github.com/0xPolygonHermez/zkevm-node/state/runtime/executor"
+	"github.com/0xPolygonHermez/zkevm-node/test/vectors"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSimulateTxsErrors(t *testing.T) {
+	ctx := context.Background()
+	txs := []vectors.Tx{{ID: 1, RawTx: "0xnot a tx"}}
+
+	m := &Manager{cfg: &Config{Backend: SimulatedL1Backend}}
+	_, _, err := m.SimulateTxs(ctx, txs, state.ZeroHash.String())
+	assert.ErrorIs(t, err, ErrUnsupportedByBackend)
+
+	// invalid txs are rejected before reading the state
+	m = &Manager{
+		cfg: &Config{},
+		st:  state.NewState(state.Config{}, mocks.NewStorageMock(t), mocks.NewExecutorServiceClientMock(t), nil, nil, nil, nil),
+	}
+	_, _, err = m.SimulateTxs(ctx, txs, state.ZeroHash.String())
+	assert.ErrorContains(t, err, "failed to decode the tx 1")
+}
+
+func TestSimulateTxs(t *testing.T) {
+	ctx := context.Background()
+	initialRoot := common.HexToHash("0x1234")
+	newRoot := common.HexToHash("0x5678")
+
+	to := common.HexToAddress("0x1")
+	var (
+		txs      []vectors.Tx
+		txHashes []common.Hash
+	)
+	for nonce := uint64(0); nonce < 2; nonce++ {
+		tx := types.NewTx(&types.LegacyTx{Nonce: nonce, To: &to, Gas: 21000, GasPrice: big.NewInt(1), Value: big.NewInt(1)})
+		rawTx, err := tx.MarshalBinary()
+		require.NoError(t, err)
+		txs = append(txs, vectors.Tx{ID: uint(nonce), RawTx: hex.EncodeToHex(rawTx)})
+		txHashes = append(txHashes, tx.Hash())
+	}
+
+	lastBatch := &state.Batch{BatchNumber: 5, AccInputHash: common.HexToHash("0xabcd"), Timestamp: time.Now().Add(-time.Minute)}
+	storage := mocks.NewStorageMock(t)
+	storage.EXPECT().GetLastNBatches(ctx, uint(1), nil).Return([]*state.Batch{lastBatch}, nil)
+	storage.EXPECT().GetForkIDByBatchNumber(uint64(6)).Return(uint64(state.FORKID_ETROG))
+
+	// the batch follows the last one and doesn't update the merkletree
+	executorClient := mocks.NewExecutorServiceClientMock(t)
+	executorClient.EXPECT().ProcessBatchV2(ctx, mock.MatchedBy(func(request *executor.ProcessBatchRequestV2) bool {
+		return request.OldBatchNum == lastBatch.BatchNumber &&
+			common.BytesToHash(request.OldStateRoot) == initialRoot &&
+			common.BytesToHash(request.OldAccInputHash) == lastBatch.AccInputHash &&
+			request.Coinbase == common.HexToAddress(DefaultSequencerAddress).String() &&
+			request.ForkId == state.FORKID_ETROG &&
+			request.UpdateMerkleTree == 0
+	})).Return(&executor.ProcessBatchResponseV2{
+		NewStateRoot: newRoot.Bytes(),
+		Error:        executor.ExecutorError_EXECUTOR_ERROR_NO_ERROR,
+		ErrorRom:     executor.RomError_ROM_ERROR_NO_ERROR,
+		BlockResponses: []*executor.ProcessBlockResponseV2{{
+			Ger:           state.ZeroHash.Bytes(),
+			BlockHashL1:   state.ZeroHash.Bytes(),
+			BlockInfoRoot: state.ZeroHash.Bytes(),
+			BlockHash:     state.ZeroHash.Bytes(),
+			Responses: []*executor.ProcessTransactionResponseV2{
+				{TxHash: txHashes[0].Bytes(), GasUsed: 21000, Error: executor.RomError_ROM_ERROR_NO_ERROR},
+				{TxHash: txHashes[1].Bytes(), GasUsed: 30000, Error: executor.RomError_ROM_ERROR_EXECUTION_REVERTED},
+			},
+		}},
+	}, nil)
+
+	m := &Manager{
+		cfg: &Config{},
+		st:  state.NewState(state.Config{}, storage, executorClient, nil, nil, nil, nil),
+	}
+	finalRoot, results, err := m.SimulateTxs(ctx, txs, initialRoot.String())
+	require.NoError(t, err)
+	assert.Equal(t, newRoot.String(), finalRoot)
+	assert.Equal(t, []SimResult{
+		{TxHash: txHashes[0], Success: true, GasUsed: 21000},
+		{TxHash: txHashes[1], Success: false, GasUsed: 30000, Err: runtime.ErrExecutionReverted},
+	}, results)
+}
@@ -0,0 +1,54 @@
+package operations
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/0xPolygonHermez/zkevm-node/jsonrpc/types"
+	"github.com/0xPolygonHermez/zkevm-node/state/runtime/instrumentation/tracers/structlogger"
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/rpc"
+)
+
+// TraceTransaction returns the raw execution trace of the tx in the L2
+// network, as returned by debug_traceTransaction with the default struct
+// logger. An error wrapping ErrTracingDisabled is returned when the node
+// doesn't expose the debug endpoints.
+func (m *Manager) TraceTransaction(ctx context.Context, txHash common.Hash) (json.RawMessage, error) {
+	client, err := m.L2Client()
+	if err != nil {
+		return nil, err
+	}
+
+	var trace json.RawMessage
+	err = client.Client().CallContext(ctx, &trace, "debug_traceTransaction", txHash)
+	if err != nil {
+		var rpcErr rpc.Error
+		if errors.As(err, &rpcErr) && rpcErr.ErrorCode() == types.NotFoundErrorCode {
+			return nil, fmt.Errorf("%w: debug_traceTransaction is not available in %s: %v", ErrTracingDisabled, m.L2NetworkURL(), err)
+		}
+		return nil, err
+	}
+	if len(trace) == 0 || string(trace) == "null" {
+		return nil, fmt.Errorf("trace of tx %s: %w", txHash, ethereum.NotFound)
+	}
+	return trace, nil
+}
+
+// TraceTransactionLogs is like TraceTransaction but decodes the trace into the
+// gas used, the failure flag, the return value and the executed opcodes.
+func (m *Manager) TraceTransactionLogs(ctx context.Context, txHash common.Hash) (*structlogger.TraceResponse, error) {
+	trace, err := m.TraceTransaction(ctx, txHash)
+	if err != nil {
+		return nil, err
+	}
+
+	var response structlogger.TraceResponse
+	if err := json.Unmarshal(trace, &response); err != nil {
+		return nil, fmt.Errorf("failed to decode the trace of tx %s: %w", txHash, err)
+	}
+	return &response, nil
+}
@@ -0,0 +1,63 @@
+package operations
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestManagerTraceTransaction(t *testing.T) {
+	ctx := context.Background()
+	txHash := common.HexToHash("0x1")
+	// trace of a plain transfer, no opcode is executed
+	transferTrace := map[string]interface{}{
+		"gas":         21000,
+		"failed":      false,
+		"returnValue": "",
+		"structLogs":  []interface{}{},
+	}
+	recorder, srv := newRPCRecorder(t, map[string]interface{}{
+		"debug_traceTransaction": transferTrace,
+	})
+	m := &Manager{cfg: &Config{L2URL: srv.URL}}
+
+	trace, err := m.TraceTransaction(ctx, txHash)
+	require.NoError(t, err)
+	expected, err := json.Marshal(transferTrace)
+	require.NoError(t, err)
+	assert.JSONEq(t, string(expected), string(trace))
+	assert.Equal(t, []string{"debug_traceTransaction"}, recorder.calls())
+	assert.JSONEq(t, `"`+txHash.Hex()+`"`, string(recorder.params[0][0]))
+
+	logs, err := m.TraceTransactionLogs(ctx, txHash)
+	require.NoError(t, err)
+	assert.Equal(t, uint64(21000), logs.Gas)
+	assert.False(t, logs.Failed)
+	assert.Empty(t, logs.StructLogs)
+
+	// unknown tx
+	recorder.mu.Lock()
+	recorder.results["debug_traceTransaction"] = nil
+	recorder.mu.Unlock()
+	_, err = m.TraceTransaction(ctx, txHash)
+	assert.ErrorIs(t, err, ethereum.NotFound)
+}
+
+func TestManagerTraceTransactionDisabled(t *testing.T) {
+	// the simulated L1 network doesn't expose the debug endpoints
+	url := freeLocalURL(t)
+	l1, err := startSimulatedL1(url)
+	require.NoError(t, err)
+	defer func() {
+		require.NoError(t, l1.stop())
+	}()
+	m := &Manager{cfg: &Config{L2URL: url}}
+
+	_, err = m.TraceTransaction(context.Background(), common.HexToHash("0x1"))
+	assert.ErrorIs(t, err, ErrTracingDisabled)
+}
@@ -8,6 +8,7 @@ import (
 	"fmt"
 	"io"
 	"math/big"
+	"net"
 	"net/http"
 	"os"
 	"os/signal"
@@ -17,38 +18,138 @@ import (
 	"github.com/0xPolygonHermez/zkevm-node/jsonrpc/client"
 	"github.com/0xPolygonHermez/zkevm-node/log"
 	"github.com/0xPolygonHermez/zkevm-node/state"
+	"github.com/0xPolygonHermez/zkevm-node/test/constants"
 	"github.com/ethereum/go-ethereum"
 	"github.com/ethereum/go-ethereum/accounts/abi"
 	"github.com/ethereum/go-ethereum/accounts/abi/bind"
 	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
 	"github.com/ethereum/go-ethereum/core/types"
 	"github.com/ethereum/go-ethereum/ethclient"
+	"github.com/ethereum/go-ethereum/rpc"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/credentials/insecure"
 	"google.golang.org/grpc/health/grpc_health_v1"
 )
 
 const (
+	defaultInterval        = 2 * time.Millisecond
+	defaultDeadline        = 2 * time.Minute
+	defaultTxMinedDeadline = 5 * time.Second
+)
+
+// The polling durations can be overridden with the environment variables
+// ZKEVM_OPS_INTERVAL, ZKEVM_OPS_DEADLINE and ZKEVM_OPS_TX_MINED_DEADLINE, in
+// the format of time.ParseDuration, e.g. to give more time to slow CI runners.
+// They are read once when the package is initialized.
+var (
 	// DefaultInterval is a time interval
-	DefaultInterval = 2 * time.Millisecond
+	DefaultInterval = durationFromEnv(constants.ENV_OPS_INTERVAL, defaultInterval)
 	// DefaultDeadline is a time interval
-	DefaultDeadline = 2 * time.Minute
+	DefaultDeadline = durationFromEnv(constants.ENV_OPS_DEADLINE, defaultDeadline)
 	// DefaultTxMinedDeadline is a time interval
-	DefaultTxMinedDeadline = 5 * time.Second
+	DefaultTxMinedDeadline = durationFromEnv(constants.ENV_OPS_TX_MINED_DEADLINE, defaultTxMinedDeadline)
 )
 
+func init() {
+	log.Infof("operations polling interval %v, deadline %v, tx mined deadline %v", DefaultInterval, DefaultDeadline, DefaultTxMinedDeadline)
+}
+
+// durationFromEnv returns the duration set in the environment variable, or
+// the default one when it's not set or it's not a valid positive duration.
+func durationFromEnv(key string, defaultValue time.Duration) time.Duration {
+	value, exists := os.LookupEnv(key)
+	if !exists {
+		return defaultValue
+	}
+	d, err := time.ParseDuration(value)
+	if err != nil {
+		log.Errorf("invalid duration %q in %s, using the default %v: %v", value, key, defaultValue, err)
+		return defaultValue
+	}
+	if d <= 0 {
+		log.Errorf("duration %v in %s must be positive, using the default %v", d, key, defaultValue)
+		return defaultValue
+	}
+	return d
+}
+
 var (
 	// ErrTimeoutReached is thrown when the timeout is reached and
 	// because the condition is not matched
 	ErrTimeoutReached = fmt.Errorf("timeout has been reached")
+	// ErrTxFailed is returned when a mined tx has a receipt with failed status
+	ErrTxFailed = errors.New("transaction has failed")
 )
 
+// WaitConfig is the configuration of the polling of a Wait.
+type WaitConfig struct {
+	// Interval is the time between the first polls
+	Interval time.Duration
+	// MaxInterval caps the interval when Backoff is used, zero means no cap
+	MaxInterval time.Duration
+	// Deadline is the maximum time to wait for the condition
+	Deadline time.Duration
+	// Backoff is the factor the interval is multiplied by after every poll,
+	// values lower or equal than 1 keep the interval constant
+	Backoff float64
+}
+
 // Wait handles polliing until conditions are met.
-type Wait struct{}
+type Wait struct {
+	cfg WaitConfig
+}
 
-// NewWait is the Wait constructor.
+// NewWait is the Wait constructor, it polls with DefaultInterval until
+// DefaultDeadline.
 func NewWait() *Wait {
-	return &Wait{}
+	return NewWaitWithConfig(WaitConfig{Interval: DefaultInterval, Deadline: DefaultDeadline})
+}
+
+// NewWaitWithConfig creates a Wait with the given configuration.
+func NewWaitWithConfig(cfg WaitConfig) *Wait {
+	return &Wait{cfg: cfg}
+}
+
+// Poll retries the given condition until it succeeds or the deadline of the
+// Wait expires, waiting between polls according to its configuration.
+func (w *Wait) Poll(condition ConditionFunc) error {
+	timeout := time.NewTimer(w.cfg.Deadline)
+	defer timeout.Stop()
+
+	interval := w.cfg.Interval
+	tick := time.NewTimer(interval)
+	defer tick.Stop()
+
+	for {
+		select {
+		case <-timeout.C:
+			return ErrTimeoutReached
+		case <-tick.C:
+			ok, err := condition()
+			if err != nil {
+				return err
+			}
+			if ok {
+				return nil
+			}
+			interval = w.nextInterval(interval)
+			tick.Reset(interval)
+		}
+	}
+}
+
+// nextInterval returns the interval to wait after a poll that waited the
+// given interval.
+func (w *Wait) nextInterval(interval time.Duration) time.Duration {
+	if w.cfg.Backoff <= 1 {
+		return interval
+	}
+	next := time.Duration(float64(interval) * w.cfg.Backoff)
+	if w.cfg.MaxInterval > 0 && next > w.cfg.MaxInterval {
+		return w.cfg.MaxInterval
+	}
+	return next
 }
 
 // Poll retries the given condition with the given interval until it succeeds
@@ -96,7 +197,7 @@ func WaitTxToBeMined(parentCtx context.Context, client ethClienter, tx *types.Tr
 		if reasonErr != nil {
 			reason = reasonErr.Error()
 		}
-		return fmt.Errorf("transaction has failed, reason: %s, receipt: %+v. tx: %+v, gas: %v", reason, receipt, tx, tx.Gas())
+		return fmt.Errorf("%w, reason: %s, receipt: %+v. tx: %+v, gas: %v", ErrTxFailed, reason, receipt, tx, tx.Gas())
 	}
 	log.Debug("Transaction successfully mined: ", tx.Hash())
 	return nil
@@ -124,12 +225,24 @@ func RevertReason(ctx context.Context, c ethClienter, tx *types.Transaction, blo
 		Value: tx.Value(),
 		Data:  tx.Data(),
 	}
-	hex, err := c.CallContract(ctx, msg, blockNumber)
+	data, err := c.CallContract(ctx, msg, blockNumber)
 	if err != nil {
-		return "", err
+		// nodes report the revert as an error carrying the returned data
+		var dataErr rpc.DataError
+		if !errors.As(err, &dataErr) {
+			return "", err
+		}
+		errData, ok := dataErr.ErrorData().(string)
+		if !ok {
+			return "", err
+		}
+		data, err = hex.DecodeHex(errData)
+		if err != nil {
+			return "", err
+		}
 	}
 
-	unpackedMsg, err := abi.UnpackRevert(hex)
+	unpackedMsg, err := abi.UnpackRevert(data)
 	if err != nil {
 		log.Warnf("failed to get the revert message for tx %v: %v", tx.Hash(), err)
 		return "", errors.New("execution reverted")
@@ -148,17 +261,19 @@ func WaitGRPCHealthy(address string) error {
 
 // WaitL2BlockToBeConsolidated waits until a L2 Block has been consolidated or the given timeout expires.
 func WaitL2BlockToBeConsolidated(l2Block *big.Int, timeout time.Duration) error {
+	return WaitL2BlockToBeConsolidatedCustomRPC(l2Block, timeout, DefaultL2NetworkURL)
+}
+
+// WaitL2BlockToBeConsolidatedCustomRPC waits until a L2 Block has been consolidated or the given timeout expires.
+func WaitL2BlockToBeConsolidatedCustomRPC(l2Block *big.Int, timeout time.Duration, l2NetworkURL string) error {
 	return Poll(DefaultInterval, timeout, func() (bool, error) {
-		return l2BlockConsolidationCondition(l2Block)
+		return l2BlockConsolidationCondition(l2Block, l2NetworkURL)
 	})
 }
 
 // WaitL2BlockToBeVirtualized waits until a L2 Block has been virtualized or the given timeout expires.
 func WaitL2BlockToBeVirtualized(l2Block *big.Int, timeout time.Duration) error {
-	l2NetworkURL := "http://localhost:8123"
-	return Poll(DefaultInterval, timeout, func() (bool, error) {
-		return l2BlockVirtualizationCondition(l2Block, l2NetworkURL)
-	})
+	return WaitL2BlockToBeVirtualizedCustomRPC(l2Block, timeout, DefaultL2NetworkURL)
 }
 
 // WaitL2BlockToBeVirtualizedCustomRPC waits until a L2 Block has been virtualized or the given timeout expires.
@@ -254,15 +369,134 @@ func NodeUpCondition(target string) (bool, error) {
 	return done, nil
 }
 
+// waitBatchConsolidation polls the L2 network until the last consolidated
+// batch is at least minBatchNumber or the timeout expires. On timeout the
+// returned error wraps ErrTimeoutReached and includes the last consolidated
+// batch observed.
+func waitBatchConsolidation(ctx context.Context, l2NetworkURL string, minBatchNumber uint64, timeout time.Duration) error {
+	return waitBatchNumber(ctx, minBatchNumber, timeout, "consolidated", func() (uint64, error) {
+		return GetLastBatchNumberConsolidatedOnEthereum(l2NetworkURL)
+	})
+}
+
+// waitBatchVirtualization polls the L2 network until the last virtualized
+// batch is at least minBatchNumber or the timeout expires. On timeout the
+// returned error wraps ErrTimeoutReached and includes the last virtualized
+// batch observed.
+func waitBatchVirtualization(ctx context.Context, l2NetworkURL string, minBatchNumber uint64, timeout time.Duration) error {
+	return waitBatchNumber(ctx, minBatchNumber, timeout, "virtualized", func() (uint64, error) {
+		return GetLastBatchNumberSeenOnEthereum(l2NetworkURL)
+	})
+}
+
+// waitBatchNumber polls lastBatchNumberFn until it returns at least
+// minBatchNumber or the timeout expires.
+func waitBatchNumber(ctx context.Context, minBatchNumber uint64, timeout time.Duration, stage string, lastBatchNumberFn func() (uint64, error)) error {
+	var lastBatchNumber uint64
+	w := NewWaitWithConfig(WaitConfig{
+		Interval:    DefaultInterval,
+		MaxInterval: time.Second,
+		Deadline:    timeout,
+		Backoff:     2, //nolint:gomnd
+	})
+	err := w.Poll(func() (bool, error) {
+		if err := ctx.Err(); err != nil {
+			return false, err
+		}
+		var err error
+		lastBatchNumber, err = lastBatchNumberFn()
+		if err != nil {
+			return false, err
+		}
+		return lastBatchNumber >= minBatchNumber, nil
+	})
+	if errors.Is(err, ErrTimeoutReached) {
+		return fmt.Errorf("%w: batch %d not %s, last %s batch is %d", err, minBatchNumber, stage, stage, lastBatchNumber)
+	}
+	return err
+}
+
+// GetLastBatchNumberConsolidatedOnEthereum returns the number of the last
+// batch verified on L1 according to the given L2 network.
+func GetLastBatchNumberConsolidatedOnEthereum(l2NetworkURL string) (uint64, error) {
+	batchNumber, err := l2BatchNumberCall(l2NetworkURL, "zkevm_verifiedBatchNumber")
+	if err != nil {
+		return 0, err
+	}
+	return *batchNumber, nil
+}
+
+// GetLastBatchNumberSeenOnEthereum returns the number of the last batch
+// sequenced on L1, virtualized, according to the given L2 network.
+func GetLastBatchNumberSeenOnEthereum(l2NetworkURL string) (uint64, error) {
+	batchNumber, err := l2BatchNumberCall(l2NetworkURL, "zkevm_virtualBatchNumber")
+	if err != nil {
+		return 0, err
+	}
+	return *batchNumber, nil
+}
+
+// l2BatchNumberOfBlock returns the number of the batch that contains the
+// given L2 block.
+func l2BatchNumberOfBlock(l2Block *big.Int, l2NetworkURL string) (uint64, error) {
+	batchNumber, err := l2BatchNumberCall(l2NetworkURL, "zkevm_batchNumberByBlockNumber", hex.EncodeBig(l2Block))
+	if err != nil {
+		return 0, err
+	}
+	if batchNumber == nil {
+		return 0, fmt.Errorf("batch of the block number %v not found", l2Block)
+	}
+	return *batchNumber, nil
+}
+
+// l2BatchNumberCall calls a zkevm method of the L2 network returning a batch
+// number, nil is returned when the method returns null.
+func l2BatchNumberCall(l2NetworkURL, method string, parameters ...interface{}) (*uint64, error) {
+	response, err := client.JSONRPCCall(l2NetworkURL, method, parameters...)
+	if err != nil {
+		return nil, err
+	}
+	if response.Error != nil {
+		return nil, fmt.Errorf("%d - %s", response.Error.Code, response.Error.Message)
+	}
+	var result *string
+	err = json.Unmarshal(response.Result, &result)
+	if err != nil {
+		return nil, err
+	}
+	if result == nil {
+		return nil, nil
+	}
+	batchNumber, err := hexutil.DecodeUint64(*result)
+	if err != nil {
+		return nil, err
+	}
+	return &batchNumber, nil
+}
+
 // ConditionFunc is a generic function
 type ConditionFunc func() (done bool, err error)
 
-func networkUpCondition() (bool, error) {
-	return NodeUpCondition(DefaultL1NetworkURL)
+func (m *Manager) networkUpCondition() (bool, error) {
+	return NodeUpCondition(m.L1NetworkURL())
+}
+
+func (m *Manager) nodeUpCondition() (done bool, err error) {
+	return NodeUpCondition(m.L2NetworkURL())
 }
 
-func nodeUpCondition() (done bool, err error) {
-	return NodeUpCondition(DefaultL2NetworkURL)
+func (m *Manager) proverUpCondition() (done bool, err error) {
+	return tcpUpCondition(executorURI)
+}
+
+// tcpUpCondition checks if the address accepts connections
+func tcpUpCondition(address string) (bool, error) {
+	conn, err := net.DialTimeout("tcp", address, time.Second)
+	if err != nil {
+		// we allow connection errors to wait for the container up
+		return false, nil
+	}
+	return true, conn.Close()
 }
 
 func grpcHealthyCondition(address string) (bool, error) {
@@ -293,8 +527,7 @@ func grpcHealthyCondition(address string) (bool, error) {
 }
 
 // l2BlockConsolidationCondition
-func l2BlockConsolidationCondition(l2Block *big.Int) (bool, error) {
-	l2NetworkURL := "http://localhost:8123"
+func l2BlockConsolidationCondition(l2Block *big.Int, l2NetworkURL string) (bool, error) {
 	response, err := client.JSONRPCCall(l2NetworkURL, "zkevm_isBlockConsolidated", hex.EncodeBig(l2Block))
 	if err != nil {
 		return false, err
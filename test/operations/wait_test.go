@@ -0,0 +1,150 @@
+package operations
+
+import (
+	"context"
+	"errors"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/0xPolygonHermez/zkevm-node/hex"
+	"github.com/0xPolygonHermez/zkevm-node/test/constants"
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeEthClient returns a failed receipt for every tx and answers the calls
+// with the configured data or error.
+type fakeEthClient struct {
+	callData []byte
+	callErr  error
+}
+
+func (c *fakeEthClient) TransactionByHash(ctx context.Context, txHash common.Hash) (*types.Transaction, bool, error) {
+	return nil, false, ethereum.NotFound
+}
+
+func (c *fakeEthClient) TransactionReceipt(ctx context.Context, txHash common.Hash) (*types.Receipt, error) {
+	return &types.Receipt{TxHash: txHash, Status: types.ReceiptStatusFailed, BlockNumber: big.NewInt(1)}, nil
+}
+
+func (c *fakeEthClient) CallContract(ctx context.Context, call ethereum.CallMsg, blockNumber *big.Int) ([]byte, error) {
+	return c.callData, c.callErr
+}
+
+func (c *fakeEthClient) CodeAt(ctx context.Context, account common.Address, blockNumber *big.Int) ([]byte, error) {
+	return nil, nil
+}
+
+// rpcDataError is a JSON RPC error carrying the data returned by the call.
+type rpcDataError struct {
+	data string
+}
+
+func (e *rpcDataError) Error() string          { return "execution reverted" }
+func (e *rpcDataError) ErrorData() interface{} { return e.data }
+
+func revertData(t *testing.T, reason string) []byte {
+	stringType, err := abi.NewType("string", "", nil)
+	require.NoError(t, err)
+	encoded, err := abi.Arguments{{Type: stringType}}.Pack(reason)
+	require.NoError(t, err)
+	return append(crypto.Keccak256([]byte("Error(string)"))[:4], encoded...)
+}
+
+func TestWaitTxToBeMinedRevertReason(t *testing.T) {
+	auth, err := GetAuth(DefaultSequencerPrivateKey, DefaultL2ChainID)
+	require.NoError(t, err)
+	to := common.HexToAddress("0x1")
+	tx, err := auth.Signer(auth.From, types.NewTx(&types.LegacyTx{To: &to, Gas: 21000, GasPrice: big.NewInt(1)}))
+	require.NoError(t, err)
+
+	tcs := []struct {
+		description    string
+		client         *fakeEthClient
+		expectedReason string
+	}{
+		{"revert data returned", &fakeEthClient{callData: revertData(t, "not enough funds")}, "reason: not enough funds"},
+		{"revert data in the error", &fakeEthClient{callErr: &rpcDataError{data: hex.EncodeToHex(revertData(t, "not enough funds"))}}, "reason: not enough funds"},
+		{"plain revert", &fakeEthClient{callErr: &rpcDataError{data: "0x"}}, "reason: execution reverted"},
+		{"call failed", &fakeEthClient{callErr: errors.New("connection refused")}, "reason: connection refused"},
+	}
+	for _, tc := range tcs {
+		tc := tc
+		t.Run(tc.description, func(t *testing.T) {
+			err := WaitTxToBeMined(context.Background(), tc.client, tx, time.Second)
+			require.ErrorIs(t, err, ErrTxFailed)
+			assert.Contains(t, err.Error(), tc.expectedReason)
+		})
+	}
+}
+
+func TestWaitBackoffSchedule(t *testing.T) {
+	w := NewWaitWithConfig(WaitConfig{
+		Interval:    time.Second,
+		MaxInterval: 10 * time.Second,
+		Deadline:    time.Minute,
+		Backoff:     2,
+	})
+
+	interval := w.cfg.Interval
+	schedule := []time.Duration{interval}
+	for i := 0; i < 5; i++ {
+		interval = w.nextInterval(interval)
+		schedule = append(schedule, interval)
+	}
+	expected := []time.Duration{time.Second, 2 * time.Second, 4 * time.Second, 8 * time.Second, 10 * time.Second, 10 * time.Second}
+	assert.Equal(t, expected, schedule)
+
+	// the default wait keeps the interval constant
+	w = NewWait()
+	assert.Equal(t, DefaultInterval, w.nextInterval(DefaultInterval))
+}
+
+func TestWaitPoll(t *testing.T) {
+	w := NewWaitWithConfig(WaitConfig{
+		Interval:    time.Millisecond,
+		MaxInterval: 8 * time.Millisecond,
+		Deadline:    100 * time.Millisecond,
+		Backoff:     2,
+	})
+
+	var polls []time.Time
+	err := w.Poll(func() (bool, error) {
+		polls = append(polls, time.Now())
+		return len(polls) == 4, nil
+	})
+	require.NoError(t, err)
+	require.Len(t, polls, 4)
+	// the waits between polls grow: 2ms, 4ms, 8ms
+	assert.GreaterOrEqual(t, polls[3].Sub(polls[2]), 8*time.Millisecond)
+
+	start := time.Now()
+	err = w.Poll(func() (bool, error) { return false, nil })
+	assert.ErrorIs(t, err, ErrTimeoutReached)
+	elapsed := time.Since(start)
+	assert.GreaterOrEqual(t, elapsed, 100*time.Millisecond)
+	assert.Less(t, elapsed, 200*time.Millisecond)
+
+	errCondition := errors.New("condition error")
+	err = w.Poll(func() (bool, error) { return false, errCondition })
+	assert.ErrorIs(t, err, errCondition)
+}
+
+func TestDurationFromEnv(t *testing.T) {
+	assert.Equal(t, defaultDeadline, durationFromEnv(constants.ENV_OPS_DEADLINE, defaultDeadline))
+
+	t.Setenv(constants.ENV_OPS_DEADLINE, "10m")
+	assert.Equal(t, 10*time.Minute, durationFromEnv(constants.ENV_OPS_DEADLINE, defaultDeadline))
+
+	// invalid values fall back to the default
+	for _, value := range []string{"10", "ten minutes", "0s", "-1m"} {
+		t.Setenv(constants.ENV_OPS_DEADLINE, value)
+		assert.Equal(t, defaultDeadline, durationFromEnv(constants.ENV_OPS_DEADLINE, defaultDeadline), value)
+	}
+}